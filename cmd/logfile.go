@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// newMultiHandler constructs a slog handler that passes each record to all of the specified
+// handlers that are enabled for the record's level.
+func newMultiHandler(handlers ...slog.Handler) slog.Handler {
+	return &multiHandler{handlers: handlers}
+}
+
+// multiHandler is a slog handler that writes records to several handlers, such as the console
+// and the log file for a run, each of which may have a different level.
+type multiHandler struct {
+	handlers []slog.Handler
+}
+
+// Enabled reports whether any of the handlers handle records at the specified level.
+func (h *multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle passes a record to each of the handlers that are enabled for its level.
+func (h *multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, r.Level) {
+			errs = append(errs, handler.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithAttrs returns a handler whose handlers each include the specified attributes.
+func (h *multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := []slog.Handler{}
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler.WithAttrs(attrs))
+	}
+	return newMultiHandler(handlers...)
+}
+
+// WithGroup returns a handler whose handlers each use the specified group.
+func (h *multiHandler) WithGroup(name string) slog.Handler {
+	handlers := []slog.Handler{}
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler.WithGroup(name))
+	}
+	return newMultiHandler(handlers...)
+}
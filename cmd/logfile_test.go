@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestMultiHandler(t *testing.T) {
+	var console, file bytes.Buffer
+
+	logger := slog.New(newMultiHandler(
+		slog.NewTextHandler(&console, &slog.HandlerOptions{Level: slog.LevelInfo}),
+		slog.NewTextHandler(&file, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	))
+
+	logger.With("user", "test-user").Debug("Starting command", "command", "snap list")
+	logger.Info("Installing snap", "snap", "juju")
+
+	if strings.Contains(console.String(), "Starting command") {
+		t.Fatalf("expected debug record to be omitted from console, got: %s", console.String())
+	}
+
+	for _, expected := range []string{"user=test-user", "command=\"snap list\"", "snap=juju"} {
+		if !strings.Contains(file.String(), expected) {
+			t.Fatalf("expected: %s, got: %s", expected, file.String())
+		}
+	}
+
+	if !strings.Contains(console.String(), "snap=juju") {
+		t.Fatalf("expected: %s, got: %s", "snap=juju", console.String())
+	}
+}
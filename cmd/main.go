@@ -1,11 +1,22 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
 	"os/user"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/jnsgruk/concierge/internal/concierge"
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
+	"github.com/jnsgruk/concierge/internal/system"
 	"github.com/spf13/pflag"
 )
 
@@ -56,3 +67,142 @@ func checkUser() error {
 
 	return nil
 }
+
+// runManager constructs a concierge manager and runs the specified action with it. If the
+// '--dry-run' flag is set, changes to the system are recorded and printed rather than executed.
+// The action is cancelled on SIGINT or SIGTERM, or once the '--timeout' elapses if it is set.
+func runManager(conf *config.Config, name string, flags *pflag.FlagSet, action func(m *concierge.Manager, ctx context.Context) error) error {
+	conf.Version = version
+	conf.Commit = commit
+
+	dryRun, _ := flags.GetBool("dry-run")
+	timeout, _ := flags.GetDuration("timeout")
+	eventsDest, _ := flags.GetString("events")
+
+	worker, err := system.NewSystem(conf.Trace)
+	if err != nil {
+		return fmt.Errorf("failed to initialise system: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if eventsDest != "" {
+		eventsFile, err := openEventsFile(eventsDest)
+		if err != nil {
+			return err
+		}
+		defer eventsFile.Close()
+
+		ctx = events.WithEmitter(ctx, events.NewEmitter(eventsFile))
+	}
+
+	if !dryRun {
+		logFile := setupLogFile(worker, name)
+		if logFile != nil {
+			defer logFile.Close()
+		}
+
+		err = action(concierge.NewManager(conf, worker), ctx)
+		if err != nil && logFile != nil {
+			slog.Error("Full log of the run written to file", "path", logFile.Name())
+		}
+
+		return cancellationError(ctx, timeout, err)
+	}
+
+	slog.Info("Dry-run requested, no changes will be made to the system")
+
+	recorder := system.NewDryRunWorker(worker)
+	err = action(concierge.NewManager(conf, recorder), ctx)
+	printDryRun(recorder)
+
+	return cancellationError(ctx, timeout, err)
+}
+
+// setupLogFile creates a log file for the run, and ensures that all log records are written to
+// it at debug level, along with the output of every command, whatever the console verbosity.
+// A failure to create the log file is not fatal, and results in a nil file.
+func setupLogFile(worker *system.System, name string) *os.File {
+	logFile, err := worker.CreateLogFile(name)
+	if err != nil {
+		slog.Warn("Failed to create log file", "error", err.Error())
+		return nil
+	}
+
+	fileHandler := slog.NewTextHandler(logFile, &slog.HandlerOptions{Level: slog.LevelDebug})
+	slog.SetDefault(slog.New(newMultiHandler(slog.Default().Handler(), fileHandler)))
+
+	slog.Debug("Starting concierge", "action", name, "version", version, "commit", commit, "args", os.Args[1:])
+	slog.Debug("Logging to file", "path", logFile.Name())
+
+	return logFile
+}
+
+// openEventsFile opens the destination for the event stream, which is either the number of an
+// open file descriptor, such as '3', or the path of a file, which is created or truncated.
+func openEventsFile(dest string) (*os.File, error) {
+	if fd, err := strconv.Atoi(dest); err == nil {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+		if _, err := f.Stat(); err != nil {
+			return nil, fmt.Errorf("failed to open events file descriptor '%d': %w", fd, err)
+		}
+		return f, nil
+	}
+
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open events file: %w", err)
+	}
+	return f, nil
+}
+
+// cancellationError explains why an action failed if its context was cancelled, either by a
+// signal or because the timeout elapsed.
+func cancellationError(ctx context.Context, timeout time.Duration, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("timed out after %s: %w", timeout, err)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("cancelled: %w", err)
+	default:
+		return err
+	}
+}
+
+// printDryRun prints the set of changes recorded by a dry-run worker.
+func printDryRun(d *system.DryRunWorker) {
+	sections := []struct {
+		title  string
+		prefix string
+		items  []string
+	}{
+		{title: "Commands", items: d.Commands},
+		{title: "Directories created", prefix: "~/", items: d.Directories},
+		{title: "Files written", prefix: "~/", items: d.Files},
+		{title: "Paths removed", prefix: "~/", items: d.Removed},
+	}
+
+	for _, s := range sections {
+		if len(s.items) == 0 {
+			continue
+		}
+
+		fmt.Printf("%s:\n", s.title)
+		for _, item := range s.items {
+			if path.IsAbs(item) {
+				fmt.Printf("  %s\n", item)
+			} else {
+				fmt.Printf("  %s%s\n", s.prefix, item)
+			}
+		}
+	}
+}
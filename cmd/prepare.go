@@ -21,10 +21,17 @@ the '-c' flag.
 
 There are 3 presets available by default: 'machine', 'k8s' and 'dev'.
 
+A configuration file can extend a preset, either by specifying 'base: <preset>' in the file,
+or by passing both the '-p' and '-c' flags. The file is merged over the preset: maps are merged,
+lists are appended to, and other values replace those in the preset.
+
 Some aspects of presets and config files can be overridden using flags such as '--juju-channel'.
 Each of the override flags has an environment variable equivalent, 
 such as 'CONCIERGE_JUJU_CHANNEL'.
 
+Each completed step is recorded in '~/.cache/concierge/journal.yaml'. If a run fails, the
+'--resume' flag skips the steps that completed, unless their configuration has changed.
+
 More information at https://github.com/jnsgruk/concierge.
 `,
 		SilenceErrors: true,
@@ -36,33 +43,25 @@ More information at https://github.com/jnsgruk/concierge.
 		RunE: func(cmd *cobra.Command, args []string) error {
 			flags := cmd.Flags()
 
-			configFile, _ := flags.GetString("config")
-			preset, _ := flags.GetString("preset")
-
-			// Concierge cannot merge a preset & manual configuration
-			if len(preset) > 0 && len(configFile) > 0 {
-				return fmt.Errorf("cannot proceed with both preset and configuration file specified")
-			}
-
 			conf, err := config.NewConfig(cmd, flags)
 			if err != nil {
 				return fmt.Errorf("failed to configure concierge: %w", err)
 			}
 
-			mgr, err := concierge.NewManager(conf)
-			if err != nil {
-				return err
-			}
-
-			return mgr.Prepare()
+			return runManager(conf, "prepare", flags, (*concierge.Manager).Prepare)
 		},
 	}
 
 	flags := cmd.Flags()
 	flags.StringP("config", "c", "", "path to a specific config file to use")
-	flags.StringP("preset", "p", "", "config preset to use (k8s | machine | dev)")
+	flags.StringP("preset", "p", "", "config preset to use (see 'concierge presets list')")
+	flags.Bool("dry-run", false, "print the commands and files that would be used, without running them")
+	flags.Duration("timeout", 0, "cancel the run if it does not complete within the duration, e.g. '30m'")
+	flags.String("events", "", "write a JSON event for each state change to a file or file descriptor, e.g. '3'")
+	flags.Bool("resume", false, "skip steps completed by a previous run with the same configuration")
 	flags.Bool("disable-juju", false, "disable the installation and bootstrap of juju")
 	flags.String("juju-channel", "", "override the snap channel for juju")
+	flags.String("juju-agent-version", "", "override the juju agent version to bootstrap")
 	flags.String("k8s-channel", "", "override snap channel for the k8s snap")
 	flags.String("microk8s-channel", "", "override snap channel for microk8s")
 	flags.String("lxd-channel", "", "override snap channel for lxd")
@@ -82,7 +81,13 @@ More information at https://github.com/jnsgruk/concierge.
 	flags.StringSlice(
 		"extra-debs",
 		[]string{},
-		"comma-separated list of extra debs to install. E.g. 'make,python3-tox'",
+		"comma-separated list of extra debs to install. E.g. 'make,python3-tox,./tool_1.0_amd64.deb'",
+	)
+
+	flags.StringSlice(
+		"user",
+		[]string{},
+		"user to provision, which may be repeated. The first user bootstraps Juju. Defaults to the user running sudo",
 	)
 
 	return cmd
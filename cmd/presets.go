@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// presetsCmd constructs the `presets` subcommand, used for inspecting the available presets.
+func presetsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "presets",
+		Short: "Inspect the presets available to `concierge`.",
+		Long: `Inspect the presets available to 'concierge'.
+
+In addition to the built-in presets, user presets are loaded from YAML files named
+'<preset>.yaml', in the same format as 'concierge.yaml'. They are searched for in the
+following directories, in order:
+
+  - each directory in $CONCIERGE_PRESET_PATH (separated by ':')
+  - ~/.config/concierge/presets
+  - /etc/concierge/presets.d
+
+User presets cannot replace built-in presets, but can extend them using 'base: <preset>'.
+		`,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			parseLoggingFlags(cmd.Flags())
+		},
+	}
+
+	cmd.AddCommand(presetsListCmd())
+	cmd.AddCommand(presetsShowCmd())
+
+	return cmd
+}
+
+// presetsListCmd constructs the `presets list` subcommand.
+func presetsListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:           "list",
+		Short:         "List the available presets, and where they are defined.",
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			presets, err := config.ListPresets()
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSOURCE")
+			for _, p := range presets {
+				fmt.Fprintf(w, "%s\t%s\n", p.Name, p.Source)
+			}
+
+			return w.Flush()
+		},
+	}
+}
+
+// presetsShowCmd constructs the `presets show` subcommand.
+func presetsShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:           "show <name>",
+		Short:         "Print the fully rendered configuration for a preset.",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			preset, err := config.Preset(args[0])
+			if err != nil {
+				return err
+			}
+
+			content, err := config.RenderPreset(preset)
+			if err != nil {
+				return err
+			}
+
+			fmt.Print(strings.TrimSpace(string(content)) + "\n")
+			return nil
+		},
+	}
+}
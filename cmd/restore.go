@@ -10,15 +10,15 @@ import (
 
 // restoreCmd constructs the `restore` subcommand
 func restoreCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "restore",
 		Short: "Run the reverse of `concierge prepare`.",
 		Long: `Run the reverse of 'concierge prepare'.
 
-If the machine already had a given snap or configuration
-prior to running 'prepare', this will not be taken into account during 'restore'.
-Running 'restore' is the literal opposite of 'prepare', so any packages,
-files or configuration that would normally be created during 'prepare' will be removed.
+Snaps, debs, files, Juju controllers and group memberships that existed
+prior to running 'prepare' are recorded, and left in place during 'restore'.
+Snaps that were refreshed by 'prepare' are returned to their original channel.
+Each of the users provisioned by 'prepare' is restored, without needing to pass '--user'.
 		`,
 		SilenceErrors: true,
 		SilenceUsage:  true,
@@ -34,12 +34,14 @@ files or configuration that would normally be created during 'prepare' will be r
 				return fmt.Errorf("failed to configure concierge: %w", err)
 			}
 
-			mgr, err := concierge.NewManager(conf)
-			if err != nil {
-				return err
-			}
-
-			return mgr.Restore()
+			return runManager(conf, "restore", flags, (*concierge.Manager).Restore)
 		},
 	}
+
+	flags := cmd.Flags()
+	flags.Bool("dry-run", false, "print the commands and files that would be used, without running them")
+	flags.Duration("timeout", 0, "cancel the run if it does not complete within the duration, e.g. '30m'")
+	flags.String("events", "", "write a JSON event for each state change to a file or file descriptor, e.g. '3'")
+
+	return cmd
 }
@@ -34,6 +34,8 @@ tools from the [snap store](https://snapcraft.io) or the Ubuntu archive.
 	cmd.AddCommand(restoreCmd())
 	cmd.AddCommand(prepareCmd())
 	cmd.AddCommand(statusCmd())
+	cmd.AddCommand(validateCmd())
+	cmd.AddCommand(presetsCmd())
 
 	return cmd
 }
@@ -1,21 +1,28 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/jnsgruk/concierge/internal/concierge"
 	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/system"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 // statusCmd reports the status of concierge provisioning on a machine.
 func statusCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Report the status of `concierge` on the machine.",
 		Long: `Report the status of 'concierge' on the machine.
 
-Reports one of 'provisioning', 'succeeded' or 'failed'.
+Reports one of 'provisioning', 'succeeded', 'failed' or 'cancelled'.
+
+With '--format json' or '--format yaml', a detailed report is printed including the
+effective configuration, the preset or config file used, start and finish times, the
+version of concierge and the outcome for each snap, deb, provider and Juju controller.
 		`,
 		SilenceErrors: true,
 		SilenceUsage:  true,
@@ -26,23 +33,65 @@ Reports one of 'provisioning', 'succeeded' or 'failed'.
 		RunE: func(cmd *cobra.Command, args []string) error {
 			flags := cmd.Flags()
 
+			format, _ := flags.GetString("format")
+			if format != "text" && format != "json" && format != "yaml" {
+				return fmt.Errorf("unknown output format '%s'", format)
+			}
+
 			conf, err := config.NewConfig(cmd, flags)
 			if err != nil {
 				return fmt.Errorf("failed to configure concierge: %w", err)
 			}
 
-			mgr, err := concierge.NewManager(conf)
+			worker, err := system.NewSystem(conf.Trace)
 			if err != nil {
-				return err
+				return fmt.Errorf("failed to initialise system: %w", err)
 			}
 
-			status, err := mgr.Status()
+			mgr := concierge.NewManager(conf, worker)
+
+			if format == "text" {
+				status, err := mgr.Status()
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("%s\n", status)
+				return nil
+			}
+
+			report, err := mgr.Report()
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("%s\n", status)
-			return nil
+			return printReport(report, format)
 		},
 	}
+
+	flags := cmd.Flags()
+	flags.StringP("format", "f", "text", "output format (text | json | yaml)")
+
+	return cmd
+}
+
+// printReport prints a status report in the specified format.
+func printReport(report *concierge.Report, format string) error {
+	var output []byte
+	var err error
+
+	switch format {
+	case "json":
+		output, err = json.MarshalIndent(report, "", "  ")
+		output = append(output, '\n')
+	case "yaml":
+		output, err = yaml.Marshal(report)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal status report: %w", err)
+	}
+
+	fmt.Print(string(output))
+	return nil
 }
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// validateCmd checks a concierge config file for errors.
+func validateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check a configuration file for errors.",
+		Long: `Check a configuration file for errors.
+
+The configuration file must be in the current working directory and named 'concierge.yaml',
+or the path specified using the '-c' flag.
+
+Unknown keys, values of the wrong type and invalid values (such as malformed snap channels,
+MicroK8s addons or K8s feature names) are reported along with their line and column.
+
+With '--schema', the JSON Schema for the configuration file is printed instead. The schema is
+also published at:
+
+  ` + config.SchemaURL + `
+		`,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			parseLoggingFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags := cmd.Flags()
+
+			if schema, _ := flags.GetBool("schema"); schema {
+				content, err := config.Schema()
+				if err != nil {
+					return fmt.Errorf("failed to generate schema: %w", err)
+				}
+
+				fmt.Print(string(content))
+				return nil
+			}
+
+			configFile, _ := flags.GetString("config")
+
+			err := config.ValidateFile(configFile)
+
+			var validationErrors config.ValidationErrors
+			if errors.As(err, &validationErrors) {
+				for _, e := range validationErrors {
+					fmt.Fprintln(os.Stderr, e.Error())
+				}
+				return fmt.Errorf("found %d problem(s) in '%s'", len(validationErrors), configFile)
+			} else if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s is valid\n", configFile)
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringP("config", "c", "concierge.yaml", "path to the config file to validate")
+	flags.Bool("schema", false, "print the JSON Schema for the config file")
+
+	return cmd
+}
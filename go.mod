@@ -7,6 +7,7 @@ toolchain go1.24.1
 require (
 	github.com/canonical/x-go v0.0.0-20230522092633-7947a7587f5b
 	github.com/fatih/color v1.18.0
+	github.com/go-viper/mapstructure/v2 v2.2.1
 	github.com/sethvargo/go-retry v0.3.0
 	github.com/snapcore/snapd v0.0.0-20240925090801-8bae53ad3248
 	github.com/spf13/cobra v1.9.1
@@ -23,7 +24,6 @@ require (
 	github.com/canonical/go-tpm2 v0.0.0-20210827151749-f80ff5afff61 // indirect
 	github.com/canonical/tcglog-parser v0.0.0-20210824131805-69fa1e9f0ad2 // indirect
 	github.com/fsnotify/fsnotify v1.8.0 // indirect
-	github.com/go-viper/mapstructure/v2 v2.2.1 // indirect
 	github.com/godbus/dbus v0.0.0-20190726142602-4481cbc300e2 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
@@ -1,6 +1,9 @@
 package concierge
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 const (
 	RestoreAction string = "restore"
@@ -9,18 +12,18 @@ const (
 
 // Executable is an interface that represents any struct implementing the Prepare/Restore methods.
 type Executable interface {
-	Prepare() error
-	Restore() error
+	Prepare(ctx context.Context) error
+	Restore(ctx context.Context) error
 }
 
 // DoAction takes an Executable, and calls either Prepare() or Restore() according
 // to the action parameter.
-func DoAction(executable Executable, action string) error {
+func DoAction(ctx context.Context, executable Executable, action string) error {
 	switch action {
 	case PrepareAction:
-		return executable.Prepare()
+		return executable.Prepare(ctx)
 	case RestoreAction:
-		return executable.Restore()
+		return executable.Restore(ctx)
 	default:
 		return fmt.Errorf("unknown executor action: %s", action)
 	}
@@ -1,26 +1,33 @@
 package concierge
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"path"
+	"time"
 
 	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
 	"github.com/jnsgruk/concierge/internal/system"
 	"gopkg.in/yaml.v3"
 )
 
-// NewManager constructs a new instance of the concierge manager.
-func NewManager(config *config.Config) (*Manager, error) {
-	system, err := system.NewSystem(config.Trace)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialise system: %w", err)
-	}
+// runtimeConfigPath is the path, relative to the user's home directory, in which the runtime
+// configuration is recorded.
+var runtimeConfigPath = path.Join(".cache", "concierge", "concierge.yaml")
 
+// journalPath is the path, relative to the user's home directory, in which the steps completed
+// by `concierge prepare` are recorded.
+var journalPath = path.Join(".cache", "concierge", "journal.yaml")
+
+// NewManager constructs a new instance of the concierge manager, which uses the
+// specified worker to make changes to the system.
+func NewManager(config *config.Config, worker system.Worker) *Manager {
 	return &Manager{
 		config: config,
-		system: system,
-	}, nil
+		system: worker,
+	}
 }
 
 // Manager is a construct for controlling the main execution of concierge.
@@ -31,13 +38,42 @@ type Manager struct {
 }
 
 // Prepare runs the steps required for provisioning the machine according to
-// the config.
-func (m *Manager) Prepare() error {
-	err := m.execute(PrepareAction)
+// the config. If resuming, steps completed by a previous run are skipped. If the context is
+// cancelled, in-flight commands are terminated and the run is recorded as cancelled.
+func (m *Manager) Prepare(ctx context.Context) error {
+	m.config.Inventory = m.previousInventory()
+	m.config.StartedAt = time.Now()
+	m.config.FinishedAt = time.Time{}
+
+	if m.config.Resume {
+		m.config.Journal = m.previousJournal()
+	} else {
+		m.config.Journal = config.NewJournal()
+	}
+
+	// Record each step as it completes, such that a run that is interrupted before it
+	// finishes can be resumed.
+	m.config.Journal.OnComplete(func(journal *config.Journal) {
+		err := m.recordJournal(journal)
+		if err != nil {
+			slog.Error("failed to record concierge journal", "error", err.Error())
+		}
+	})
+
+	err := m.execute(ctx, PrepareAction)
+	m.config.FinishedAt = time.Now()
+
+	// Record the completed steps, such that a failed run can be resumed.
+	journalErr := m.recordJournal(m.config.Journal)
+	if journalErr != nil {
+		slog.Error("failed to record concierge journal", "error", journalErr.Error())
+	}
 
 	// Record the status of the provisioning process in the cached plan.
 	var recordErr error
-	if err != nil {
+	if ctx.Err() != nil {
+		recordErr = m.recordRuntimeConfig(config.Cancelled)
+	} else if err != nil {
 		recordErr = m.recordRuntimeConfig(config.Failed)
 	} else {
 		recordErr = m.recordRuntimeConfig(config.Succeeded)
@@ -48,16 +84,52 @@ func (m *Manager) Prepare() error {
 		slog.Error("failed to record concierge status", "error", recordErr.Error())
 	}
 
+	emitRunFinished(ctx, PrepareAction, m.config.FinishedAt.Sub(m.config.StartedAt), err)
 	return err
 }
 
 // Restore reverses the provisioning process, returning the machine to its.
-func (m *Manager) Restore() error {
-	return m.execute(RestoreAction)
+func (m *Manager) Restore(ctx context.Context) error {
+	start := time.Now()
+
+	err := m.execute(ctx, RestoreAction)
+	if err != nil {
+		emitRunFinished(ctx, RestoreAction, time.Since(start), err)
+		return err
+	}
+
+	// Remove the runtime configuration and journal, since they no longer describe the state
+	// of the machine.
+	for _, p := range []string{runtimeConfigPath, journalPath} {
+		err = m.system.RemoveAllHome(p)
+		if err != nil {
+			err = fmt.Errorf("failed to remove runtime configuration: %w", err)
+			emitRunFinished(ctx, RestoreAction, time.Since(start), err)
+			return err
+		}
+	}
+
+	emitRunFinished(ctx, RestoreAction, time.Since(start), nil)
+	return nil
+}
+
+// emitRunFinished emits an event reporting the outcome of an action.
+func emitRunFinished(ctx context.Context, action string, duration time.Duration, err error) {
+	seconds := duration.Seconds()
+	event := events.Event{Type: events.RunFinished, Action: action, Duration: &seconds}
+	if ctx.Err() != nil {
+		event.Status = events.StatusCancelled
+	} else {
+		event.Status = events.Status(err)
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	events.Emit(ctx, event)
 }
 
 // execute runs the overlord with a specified action.
-func (m *Manager) execute(action string) error {
+func (m *Manager) execute(ctx context.Context, action string) error {
 	switch action {
 	case PrepareAction:
 		err := m.recordRuntimeConfig(config.Provisioning)
@@ -75,7 +147,7 @@ func (m *Manager) execute(action string) error {
 
 	// Create the installation/preparation plan
 	m.Plan = NewPlan(m.config, m.system)
-	return m.Plan.Execute(action)
+	return m.Plan.Execute(ctx, action)
 }
 
 // recordRuntimeConfig dumps the current manager config into a file in the user's home
@@ -87,53 +159,109 @@ func (m *Manager) recordRuntimeConfig(status config.Status) error {
 		return fmt.Errorf("failed to marshal config file as yaml: %w", err)
 	}
 
-	filepath := path.Join(".cache", "concierge", "concierge.yaml")
-	err = m.system.WriteHomeDirFile(filepath, configYaml)
+	err = m.system.WriteHomeDirFile(runtimeConfigPath, configYaml)
 	if err != nil {
 		return fmt.Errorf("failed to write runtime config file: %w", err)
 	}
 
-	slog.Debug("Merged runtime configuration saved", "path", filepath)
-
+	slog.Debug("Merged runtime configuration saved", "path", runtimeConfigPath)
 	return nil
 }
 
 // loadRuntimeConfig loads a previously cached concierge runtime configuration.
 func (m *Manager) loadRuntimeConfig() error {
-	recordPath := path.Join(".cache", "concierge", "concierge.yaml")
+	config, err := m.readRuntimeConfig()
+	if err != nil {
+		return err
+	}
+
+	m.config = config
+
+	slog.Debug("Loaded previous runtime configuration", "path", runtimeConfigPath)
+	return nil
+}
 
-	contents, err := m.system.ReadHomeDirFile(recordPath)
+// readRuntimeConfig reads and parses a previously cached concierge runtime configuration.
+func (m *Manager) readRuntimeConfig() (*config.Config, error) {
+	contents, err := m.system.ReadHomeDirFile(runtimeConfigPath)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
 	var config config.Config
 	err = yaml.Unmarshal(contents, &config)
 	if err != nil {
-		return fmt.Errorf("failed to parse file: %w", err)
+		return nil, fmt.Errorf("failed to parse file: %w", err)
 	}
 
-	m.config = &config
+	return &config, nil
+}
+
+// previousInventory returns the inventory recorded by a previous run of concierge, or a new
+// inventory if concierge has not run on the machine before.
+func (m *Manager) previousInventory() *config.Inventory {
+	previous, err := m.readRuntimeConfig()
+	if err != nil || previous.Inventory == nil {
+		return config.NewInventory()
+	}
 
-	slog.Debug("Loaded previous runtime configuration", "path", recordPath)
+	slog.Debug("Loaded inventory from previous runtime configuration", "path", runtimeConfigPath)
+	return previous.Inventory
+}
+
+// recordJournal writes the steps completed by `concierge prepare` into a file in the user's
+// home directory.
+func (m *Manager) recordJournal(journal *config.Journal) error {
+	journalYaml, err := yaml.Marshal(journal)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal as yaml: %w", err)
+	}
+
+	err = m.system.WriteHomeDirFile(journalPath, journalYaml)
+	if err != nil {
+		return fmt.Errorf("failed to write journal file: %w", err)
+	}
 
+	slog.Debug("Journal saved", "path", journalPath)
 	return nil
 }
 
+// previousJournal returns the journal recorded by a previous run of `concierge prepare`, or a
+// new journal if there is no previous run to resume.
+func (m *Manager) previousJournal() *config.Journal {
+	contents, err := m.system.ReadHomeDirFile(journalPath)
+	if err != nil {
+		slog.Info("No previous run found to resume, preparing from scratch")
+		return config.NewJournal()
+	}
+
+	journal := config.NewJournal()
+	err = yaml.Unmarshal(contents, journal)
+	if err != nil {
+		slog.Warn("Failed to parse previous journal, preparing from scratch", "error", err.Error())
+		return config.NewJournal()
+	}
+
+	slog.Info("Resuming previous run", "steps", len(journal.Steps))
+	return journal
+}
+
 // Status reads the concierge status on the machine.
 func (m *Manager) Status() (config.Status, error) {
-	recordPath := path.Join(".cache", "concierge", "concierge.yaml")
-
-	contents, err := m.system.ReadHomeDirFile(recordPath)
+	config, err := m.readRuntimeConfig()
 	if err != nil {
 		return 0, fmt.Errorf("concierge has not prepared this machine and cannot report its status")
 	}
 
-	var config config.Config
-	err = yaml.Unmarshal(contents, &config)
+	return config.Status, nil
+}
+
+// Report reads a detailed report of the concierge status on the machine.
+func (m *Manager) Report() (*Report, error) {
+	config, err := m.readRuntimeConfig()
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse file: %w", err)
+		return nil, fmt.Errorf("concierge has not prepared this machine and cannot report its status")
 	}
 
-	return config.Status, nil
+	return NewReport(config)
 }
@@ -0,0 +1,87 @@
+package concierge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"slices"
+	"testing"
+
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/system"
+	"gopkg.in/yaml.v3"
+)
+
+func TestManagerRecordsCancelledStatus(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Host.Packages = []string{"cowsay"}
+	cfg.Juju.Disable = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	system := system.NewMockSystem()
+
+	err := NewManager(cfg, system).Prepare(ctx)
+	if err == nil {
+		t.Fatalf("expected prepare to fail when cancelled")
+	}
+
+	recorded := config.Config{}
+	err = yaml.Unmarshal([]byte(system.CreatedFiles[runtimeConfigPath]), &recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if recorded.Status != config.Cancelled {
+		t.Fatalf("expected: %v, got: %v", config.Cancelled, recorded.Status)
+	}
+}
+
+func TestManagerLeavesRealUserUntouched(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Host.Users = []string{"alice", "bob"}
+	cfg.Host.Files = []config.FileConfig{{Path: "~/.config/user", Content: "{{ .User.Username }}", Template: true}}
+	binary := []byte("kustomize binary")
+	sum := sha256.Sum256(binary)
+	cfg.Host.Binaries = map[string]config.BinaryConfig{
+		"kustomize": {URL: "file:///srv/mirror/kustomize", SHA256: hex.EncodeToString(sum[:]), Scope: "user"},
+	}
+	cfg.Providers.LXD.Enable = true
+	cfg.Providers.LXD.Bootstrap = true
+
+	system := system.NewMockSystem()
+	system.MockFetch("file:///srv/mirror/kustomize", binary)
+
+	err := NewManager(cfg, system).Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the runtime configuration and journal are written to the real user's home
+	// directory, which the mock records with relative paths.
+	for f := range system.CreatedFiles {
+		if !path.IsAbs(f) && f != runtimeConfigPath && f != journalPath {
+			t.Fatalf("expected no files in the real user's home directory, got: %v", f)
+		}
+	}
+
+	for _, d := range system.CreatedDirectories {
+		if !path.IsAbs(d) && d != path.Dir(runtimeConfigPath) {
+			t.Fatalf("expected no directories in the real user's home directory, got: %v", d)
+		}
+	}
+
+	if system.CreatedFiles["/home/alice/.config/user"] != "alice" {
+		t.Fatalf("expected: %v, got: %v", "alice", system.CreatedFiles["/home/alice/.config/user"])
+	}
+
+	if _, ok := system.CreatedFiles["/home/alice/.local/bin/kustomize"]; !ok {
+		t.Fatalf("expected binary to be installed for the first user, got: %v", system.CreatedFiles)
+	}
+
+	if !slices.Contains(system.ExecutedCommands, "cp -rT /home/alice/.local/share/juju /home/bob/.local/share/juju") {
+		t.Fatalf("expected Juju data to be shared with the second user, got: %v", system.ExecutedCommands)
+	}
+}
@@ -1,10 +1,18 @@
 package concierge
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"os/user"
+	"path"
+	"slices"
+	"sync"
 
 	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
 	"github.com/jnsgruk/concierge/internal/juju"
 	"github.com/jnsgruk/concierge/internal/packages"
 	"github.com/jnsgruk/concierge/internal/providers"
@@ -17,9 +25,19 @@ type Plan struct {
 	Providers []providers.Provider
 	Snaps     []*system.Snap
 	Debs      []*packages.Deb
+	// AptSources is the list of apt repositories to configure before installing debs.
+	AptSources []*packages.AptSource
+	// PythonTools is the list of Python tools to install for the user once the snaps and debs
+	// are installed.
+	PythonTools []*packages.PythonTool
+	// Binaries is the list of binaries to download and install.
+	Binaries []*packages.Binary
+	// Files is the list of files to write once the rest of the plan is prepared.
+	Files []*packages.ManagedFile
 
 	config *config.Config
 	system system.Worker
+	mtx    sync.Mutex
 }
 
 // NewPlan constructs a new plan consisting of snaps/debs/providers & juju.
@@ -28,9 +46,13 @@ func NewPlan(cfg *config.Config, worker system.Worker) *Plan {
 
 	for name, snapConfig := range cfg.Host.Snaps {
 		snap := system.NewSnap(name, snapConfig.Channel, snapConfig.Connections)
+		snap.Path = snapConfig.Path
+		snap.Config = snapConfig.Config
+		snap.Services = snapConfig.Services
+		snap.Aliases = snapConfig.Aliases
 		// Check if the channel has been overridden by a CLI argument/env var
 		channelOverride := getSnapChannelOverride(cfg, snap.Name)
-		if channelOverride != "" {
+		if channelOverride != "" && snap.Path == "" {
 			snap.Channel = channelOverride
 		}
 		plan.Snaps = append(plan.Snaps, snap)
@@ -41,14 +63,48 @@ func NewPlan(cfg *config.Config, worker system.Worker) *Plan {
 		snap := system.NewSnapFromString(s)
 		// Check if the channel has been overridden by a CLI argument/env var
 		channelOverride := getSnapChannelOverride(cfg, snap.Name)
-		if channelOverride != "" {
+		if channelOverride != "" && snap.Path == "" {
 			snap.Channel = channelOverride
 		}
 		plan.Snaps = append(plan.Snaps, snap)
 	}
 
 	for _, p := range append(cfg.Host.Packages, cfg.Overrides.ExtraDebs...) {
-		plan.Debs = append(plan.Debs, packages.NewDeb(p))
+		deb := packages.NewDeb(p)
+		deb.Pin = cfg.Host.Apt.Pins[deb.Name]
+		deb.Hold = slices.Contains(cfg.Host.Apt.Holds, deb.Name)
+		plan.Debs = append(plan.Debs, deb)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Host.Apt.Sources)) {
+		plan.AptSources = append(plan.AptSources, packages.NewAptSource(name, cfg.Host.Apt.Sources[name]))
+	}
+
+	for _, ppa := range cfg.Host.Apt.PPAs {
+		plan.AptSources = append(plan.AptSources, packages.NewPPA(ppa))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Host.Binaries)) {
+		plan.Binaries = append(plan.Binaries, packages.NewBinary(name, cfg.Host.Binaries[name]))
+	}
+
+	for _, f := range cfg.Host.Files {
+		plan.Files = append(plan.Files, packages.NewManagedFile(f))
+	}
+
+	for _, t := range cfg.Host.PythonTools {
+		plan.PythonTools = append(plan.PythonTools, packages.NewPythonTool(t))
+	}
+
+	// Ensure that the installer for any Python tools is installed.
+	if len(plan.PythonTools) > 0 {
+		if cfg.Host.PythonToolInstaller == "pipx" {
+			if !slices.ContainsFunc(plan.Debs, func(d *packages.Deb) bool { return d.Name == "pipx" }) {
+				plan.Debs = append(plan.Debs, packages.NewDeb("pipx"))
+			}
+		} else if !slices.ContainsFunc(plan.Snaps, func(s *system.Snap) bool { return s.Name == "astral-uv" }) {
+			plan.Snaps = append(plan.Snaps, system.NewSnap("astral-uv", "latest/stable", []string{}))
+		}
 	}
 
 	for _, providerName := range providers.SupportedProviders {
@@ -71,47 +127,318 @@ func NewPlan(cfg *config.Config, worker system.Worker) *Plan {
 }
 
 // Execute either prepares or restores a given plan
-func (p *Plan) Execute(action string) error {
+func (p *Plan) Execute(ctx context.Context, action string) error {
 	err := p.validate()
 	if err != nil {
 		return fmt.Errorf("failed to validate plan: %w", err)
 	}
 
+	p.initComponents()
+
+	components := []string{}
+	for _, c := range p.config.Components {
+		components = append(components, fmt.Sprintf("%s/%s", c.Kind, c.Name))
+	}
+	events.Emit(ctx, events.Event{Type: events.PlanComputed, Action: action, Components: components})
+
+	// Snaps, debs and providers are prepared by the plan's own worker, while the steps that
+	// apply to a user's home directory are carried out on behalf of the first user.
+	user, err := p.firstUser()
+	if err != nil {
+		return fmt.Errorf("failed to provision user: %w", err)
+	}
+
 	var eg errgroup.Group
 
-	snapHandler := packages.NewSnapHandler(p.system, p.Snaps)
-	debHandler := packages.NewDebHandler(p.system, p.Debs)
+	snapHandler := packages.NewSnapHandler(p.system, p.Snaps, p.config.Inventory, p.config.Journal)
+	debHandler := packages.NewDebHandler(p.system, p.Debs, p.AptSources, p.config.Inventory, p.config.Journal)
+	binaryHandler := packages.NewBinaryHandler(user, p.Binaries, p.config.Inventory, p.config.Journal)
+	pythonToolHandler := packages.NewPythonToolHandler(user, p.config.Host.PythonToolInstaller, p.PythonTools, p.config.Inventory, p.config.Journal)
+	fileHandler := packages.NewFileHandler(user, p.Files, p.fileTemplateData(user.User()), p.config.Inventory, p.config.Journal)
+
+	// Managed files are restored first, and Python tools are removed before the snaps and
+	// debs that provide their installer.
+	if action == RestoreAction {
+		err := p.doFileAction(ctx, fileHandler, action)
+		if err != nil {
+			return err
+		}
+
+		err = p.doPythonToolAction(ctx, pythonToolHandler, action)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Prepare/restore package handlers concurrently
-	eg.Go(func() error { return DoAction(snapHandler, action) })
-	eg.Go(func() error { return DoAction(debHandler, action) })
+	eg.Go(func() error {
+		err := DoAction(system.WithOutputPrefix(ctx, "snap"), snapHandler, action)
+		p.recordResults("snap", snapHandler.Results)
+		return err
+	})
+	eg.Go(func() error {
+		err := DoAction(system.WithOutputPrefix(ctx, "deb"), debHandler, action)
+		p.recordResults("deb", debHandler.Results)
+		return err
+	})
+	eg.Go(func() error {
+		err := DoAction(system.WithOutputPrefix(ctx, "binary"), binaryHandler, action)
+		p.recordResults("binary", binaryHandler.Results)
+		return err
+	})
+
 	if err := eg.Wait(); err != nil {
 		return err
 	}
 
-	// Prepare/restore providers concurrently
+	// Python tools are installed once the snaps and debs that provide their installer are.
+	if action == PrepareAction {
+		err := p.doPythonToolAction(ctx, pythonToolHandler, action)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Prepare/restore providers concurrently, except that providers which depend on another
+	// are prepared after it, and restored before it.
+	runs := map[string]*providerRun{}
+	for _, provider := range p.Providers {
+		runs[provider.Name()] = &providerRun{done: make(chan struct{})}
+	}
+
 	for _, provider := range p.Providers {
-		eg.Go(func() error { return DoAction(provider, action) })
+		eg.Go(func() error {
+			run := runs[provider.Name()]
+			defer close(run.done)
+
+			run.err = p.awaitProviders(provider, p.providerPrerequisites(provider, action), runs)
+			if run.err == nil {
+				run.err = p.doProviderAction(system.WithOutputPrefix(ctx, provider.Name()), provider, action)
+			}
+
+			p.recordResults("provider", map[string]error{provider.Name(): run.err})
+			return run.err
+		})
 	}
+
 	if err := eg.Wait(); err != nil {
 		return err
 	}
 
-	// Skip Juju handler if Juju is disabled in the config
-	if p.config.Juju.Disable {
+	// Prepare/Restore juju controllers, unless Juju is disabled in the config
+	if !p.config.Juju.Disable {
+		jujuHandler := juju.NewJujuHandler(p.config, user, p.Providers)
+		err = DoAction(system.WithOutputPrefix(ctx, "juju"), jujuHandler, action)
+		p.recordResults("controller", jujuHandler.Results)
+		if err != nil {
+			return fmt.Errorf("failed to prepare Juju: %w", err)
+		}
+	}
+
+	// Managed files are written last, such that templates can refer to the controllers and
+	// kubeconfig that were set up.
+	if action == PrepareAction {
+		return p.doFileAction(ctx, fileHandler, action)
+	}
+
+	return nil
+}
+
+// firstUser returns a worker acting on behalf of the first of the users to provision, who
+// bootstraps Juju and for whom Python tools, binaries and files are installed. If no users are
+// configured, the plan's own worker is returned.
+func (p *Plan) firstUser() (system.Worker, error) {
+	users := p.config.Users()
+	if len(users) == 0 {
+		return p.system, nil
+	}
+
+	return p.system.ForUser(users[0])
+}
+
+// doFileAction prepares or restores the managed files in the plan, and records the result
+// for each file.
+func (p *Plan) doFileAction(ctx context.Context, handler *packages.FileHandler, action string) error {
+	err := DoAction(system.WithOutputPrefix(ctx, "file"), handler, action)
+	p.recordResults("file", handler.Results)
+	return err
+}
+
+// fileTemplateData returns the data available to managed files rendered as templates for the
+// specified user.
+func (p *Plan) fileTemplateData(user *user.User) packages.FileTemplateData {
+	data := packages.FileTemplateData{
+		Config:      p.config,
+		User:        user,
+		Controllers: []string{},
+	}
+
+	if kubeconfig := providers.KubeconfigPath(p.Providers); kubeconfig != "" {
+		data.Kubeconfig = path.Join(data.User.HomeDir, kubeconfig)
+	}
+
+	if !p.config.Juju.Disable {
+		for _, provider := range p.Providers {
+			if !provider.Bootstrap() {
+				continue
+			}
+
+			for _, controller := range juju.Controllers(provider) {
+				data.Controllers = append(data.Controllers, controller.Name)
+			}
+		}
+	}
+
+	return data
+}
+
+// doPythonToolAction prepares or restores the Python tools in the plan, and records the result
+// for each tool.
+func (p *Plan) doPythonToolAction(ctx context.Context, handler *packages.PythonToolHandler, action string) error {
+	err := DoAction(system.WithOutputPrefix(ctx, "python-tool"), handler, action)
+	p.recordResults("python-tool", handler.Results)
+	return err
+}
+
+// providerRun tracks the outcome of preparing or restoring a provider, such that providers
+// that must wait for it can do so. The done channel is closed once err is set.
+type providerRun struct {
+	done chan struct{}
+	err  error
+}
+
+// providerPrerequisites returns the names of the providers in the plan that must be prepared
+// or restored before the specified provider: those it depends on when preparing, and those
+// that depend on it when restoring.
+func (p *Plan) providerPrerequisites(provider providers.Provider, action string) []string {
+	prerequisites := []string{}
+	for _, other := range p.Providers {
+		if action == PrepareAction && slices.Contains(providers.Dependencies(provider), other.Name()) {
+			prerequisites = append(prerequisites, other.Name())
+		}
+		if action != PrepareAction && slices.Contains(providers.Dependencies(other), provider.Name()) {
+			prerequisites = append(prerequisites, other.Name())
+		}
+	}
+	return prerequisites
+}
+
+// awaitProviders waits for each of the named providers to be prepared or restored, returning
+// an error if any of them failed.
+func (p *Plan) awaitProviders(provider providers.Provider, names []string, runs map[string]*providerRun) error {
+	for _, name := range names {
+		<-runs[name].done
+		if runs[name].err != nil {
+			return fmt.Errorf("provider '%s' was skipped because provider '%s' failed", provider.Name(), name)
+		}
+	}
+	return nil
+}
+
+// doProviderAction prepares or restores a provider. Providers that the journal records as
+// already prepared with the same configuration are skipped.
+func (p *Plan) doProviderAction(ctx context.Context, provider providers.Provider, action string) error {
+	step := fmt.Sprintf("provider/%s", provider.Name())
+
+	if action != PrepareAction {
+		events.EmitStepStarted(ctx, step)
+		err := DoAction(ctx, provider, action)
+		events.EmitStepFinished(ctx, step, err)
+		return err
+	}
+
+	inputs := getProviderInputs(p.config, provider.Name())
+
+	if p.config.Journal.Completed(step, inputs...) {
+		slog.Info("Skipping completed step", "provider", provider.Name())
+		events.EmitStepSkipped(ctx, step)
 		return nil
 	}
 
-	// Prepare/Restore juju controllers
-	jujuHandler := juju.NewJujuHandler(p.config, p.system, p.Providers)
-	err = DoAction(jujuHandler, action)
+	events.EmitStepStarted(ctx, step)
+	err := DoAction(ctx, provider, action)
+	events.EmitStepFinished(ctx, step, err)
 	if err != nil {
-		return fmt.Errorf("failed to prepare Juju: %w", err)
+		return err
 	}
 
+	p.config.Journal.Complete(step, inputs...)
 	return nil
 }
 
+// initComponents populates the config with a pending entry for each snap, deb, binary, Python
+// tool, provider, Juju controller and managed file in the plan.
+func (p *Plan) initComponents() {
+	components := []config.Component{}
+
+	for _, s := range p.Snaps {
+		components = append(components, config.Component{Kind: "snap", Name: s.Name})
+	}
+
+	for _, d := range p.Debs {
+		components = append(components, config.Component{Kind: "deb", Name: d.Name})
+	}
+
+	for _, b := range p.Binaries {
+		components = append(components, config.Component{Kind: "binary", Name: b.Name})
+	}
+
+	for _, t := range p.PythonTools {
+		components = append(components, config.Component{Kind: "python-tool", Name: t.Name})
+	}
+
+	for _, provider := range p.Providers {
+		components = append(components, config.Component{Kind: "provider", Name: provider.Name()})
+	}
+
+	if !p.config.Juju.Disable {
+		for _, provider := range p.Providers {
+			if !provider.Bootstrap() {
+				continue
+			}
+
+			for _, controller := range juju.Controllers(provider) {
+				components = append(components, config.Component{Kind: "controller", Name: controller.Name})
+			}
+		}
+	}
+
+	for _, f := range p.Files {
+		components = append(components, config.Component{Kind: "file", Name: f.Location()})
+	}
+
+	p.config.Components = components
+}
+
+// recordResults updates the status of components of the specified kind according to the
+// results reported by a handler.
+func (p *Plan) recordResults(kind string, results map[string]error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for i, c := range p.config.Components {
+		if c.Kind != kind {
+			continue
+		}
+
+		err, ok := results[c.Name]
+		if !ok {
+			continue
+		}
+
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			p.config.Components[i].Status = config.Cancelled
+			p.config.Components[i].Error = err.Error()
+		} else if err != nil {
+			p.config.Components[i].Status = config.Failed
+			p.config.Components[i].Error = err.Error()
+		} else {
+			p.config.Components[i].Status = config.Succeeded
+			p.config.Components[i].Error = ""
+		}
+	}
+}
+
 // validate returns an error if the generated plan contains errors that would prevent a successful
 // configuration of the machine.
 func (p *Plan) validate() error {
@@ -142,3 +469,20 @@ func getSnapChannelOverride(config *config.Config, snap string) string {
 		return ""
 	}
 }
+
+// getProviderInputs takes the name of a provider, and returns the configuration that
+// determines how the provider is prepared, including any overrides.
+func getProviderInputs(config *config.Config, provider string) []interface{} {
+	switch provider {
+	case "lxd":
+		return []interface{}{config.Providers.LXD, config.Overrides.LXDChannel}
+	case "k8s":
+		return []interface{}{config.Providers.K8s, config.Overrides.K8sChannel}
+	case "microk8s":
+		return []interface{}{config.Providers.MicroK8s, config.Overrides.MicroK8sChannel}
+	case "google":
+		return []interface{}{config.Providers.Google, config.Overrides.GoogleCredentialFile}
+	default:
+		return nil
+	}
+}
@@ -1,10 +1,21 @@
 package concierge
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
+	"github.com/jnsgruk/concierge/internal/system"
 )
 
 func TestGetSnapChannelOverride(t *testing.T) {
@@ -32,3 +43,354 @@ func TestGetSnapChannelOverride(t *testing.T) {
 		}
 	}
 }
+
+func TestPlanRecordsComponentResults(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Host.Snaps = map[string]config.SnapConfig{"jq": {Channel: "latest/stable"}}
+	cfg.Host.Packages = []string{"cowsay", "sl"}
+	cfg.Providers.LXD.Enable = true
+	cfg.Providers.LXD.Bootstrap = true
+
+	system := system.NewMockSystem()
+	system.MockCommandReturn("DEBIAN_FRONTEND=noninteractive apt-get install -y cowsay sl", []byte{}, fmt.Errorf("boom"))
+
+	plan := NewPlan(cfg, system)
+	err := plan.Execute(context.Background(), PrepareAction)
+	if err == nil {
+		t.Fatalf("expected plan execution to fail")
+	}
+
+	expected := []config.Component{
+		{Kind: "snap", Name: "jq", Status: config.Succeeded},
+		{Kind: "deb", Name: "cowsay", Status: config.Failed, Error: "failed to install apt packages 'cowsay, sl': boom"},
+		{Kind: "deb", Name: "sl", Status: config.Failed, Error: "failed to install apt packages 'cowsay, sl': boom"},
+		{Kind: "provider", Name: "lxd", Status: config.Provisioning},
+		{Kind: "controller", Name: "concierge-lxd", Status: config.Provisioning},
+	}
+
+	if !reflect.DeepEqual(expected, cfg.Components) {
+		t.Fatalf("expected: %+v, got: %+v", expected, cfg.Components)
+	}
+}
+
+func TestPlanRecordsCancelledComponents(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Host.Snaps = map[string]config.SnapConfig{"jq": {Channel: "latest/stable"}}
+	cfg.Providers.LXD.Enable = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	plan := NewPlan(cfg, system.NewMockSystem())
+	err := plan.Execute(ctx, PrepareAction)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected plan execution to be cancelled, got: %v", err)
+	}
+
+	expected := []config.Component{
+		{Kind: "snap", Name: "jq", Status: config.Cancelled, Error: "failed to install snap: command 'snap install jq --channel latest/stable' cancelled: context canceled"},
+		{Kind: "provider", Name: "lxd", Status: config.Provisioning},
+	}
+
+	if !reflect.DeepEqual(expected, cfg.Components) {
+		t.Fatalf("expected: %+v, got: %+v", expected, cfg.Components)
+	}
+}
+
+func TestPlanSkipsCompletedProviders(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Providers.LXD.Enable = true
+	cfg.Juju.Disable = true
+	cfg.Journal = config.NewJournal()
+	cfg.Journal.Complete("provider/lxd", getProviderInputs(cfg, "lxd")...)
+
+	system := system.NewMockSystem()
+
+	err := NewPlan(cfg, system).Execute(context.Background(), PrepareAction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(system.ExecutedCommands) > 0 {
+		t.Fatalf("expected no commands to be run, got: %v", system.ExecutedCommands)
+	}
+
+	// Changing the provider configuration should cause it to be prepared again.
+	cfg.Overrides.LXDChannel = "5.21/stable"
+
+	err = NewPlan(cfg, system).Execute(context.Background(), PrepareAction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(system.ExecutedCommands) == 0 {
+		t.Fatalf("expected provider to be prepared again")
+	}
+}
+
+func TestPlanEmitsEvents(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Host.Snaps = map[string]config.SnapConfig{"jq": {Channel: "latest/stable"}}
+	cfg.Providers.LXD.Enable = true
+	cfg.Juju.Disable = true
+
+	var buf bytes.Buffer
+	ctx := events.WithEmitter(context.Background(), events.NewEmitter(&buf))
+
+	err := NewPlan(cfg, system.NewMockSystem()).Execute(ctx, PrepareAction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emitted := []string{}
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		event := events.Event{}
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		fields := fmt.Sprintf("%s %s %s %s %s", event.Type, event.Step, event.Status, event.Provider, strings.Join(event.Components, ","))
+		emitted = append(emitted, strings.Join(strings.Fields(fields), " "))
+	}
+
+	expected := []string{
+		"plan-computed snap/jq,provider/lxd",
+		"step-started snap/jq",
+		"step-finished snap/jq succeeded",
+		"step-started provider/lxd",
+		"step-started snap/lxd",
+		"step-finished snap/lxd succeeded",
+		"provider-prepared lxd",
+		"step-finished provider/lxd succeeded",
+	}
+
+	if !reflect.DeepEqual(expected, emitted) {
+		t.Fatalf("expected: %q, got: %q", expected, emitted)
+	}
+}
+
+func TestPlanPythonTools(t *testing.T) {
+	type test struct {
+		installer string
+		expected  []string
+	}
+
+	tests := []test{
+		{
+			installer: "",
+			expected: []string{
+				"snap install astral-uv --channel latest/stable",
+				"sudo -u test-user uv tool list",
+				"sudo -u test-user uv tool install tox==4.18.0",
+			},
+		},
+		{
+			installer: "pipx",
+			expected: []string{
+				"apt-get update",
+				"DEBIAN_FRONTEND=noninteractive apt-get install -y pipx",
+				"dpkg-query --show '--showformat=${Package} ${Version}\\n' pipx",
+				"sudo -u test-user pipx list --short",
+				"sudo -u test-user pipx install tox==4.18.0",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		cfg := &config.Config{}
+		cfg.Host.PythonTools = []string{"tox==4.18.0"}
+		cfg.Host.PythonToolInstaller = tc.installer
+		cfg.Juju.Disable = true
+
+		system := system.NewMockSystem()
+		err := NewPlan(cfg, system).Execute(context.Background(), PrepareAction)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(tc.expected, system.ExecutedCommands) {
+			t.Fatalf("expected: %v, got: %v", tc.expected, system.ExecutedCommands)
+		}
+
+		component := cfg.Components[len(cfg.Components)-1]
+		if component.Kind != "python-tool" || component.Name != "tox" || component.Status != config.Succeeded {
+			t.Fatalf("expected python tool to be recorded as succeeded, got: %+v", component)
+		}
+	}
+}
+
+func TestPlanRestoresPythonToolsFirst(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Host.PythonTools = []string{"tox"}
+	cfg.Juju.Disable = true
+
+	system := system.NewMockSystem()
+	err := NewPlan(cfg, system).Execute(context.Background(), RestoreAction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The snap and deb handlers run concurrently, so only the first command is deterministic.
+	expected := "sudo -u test-user uv tool uninstall tox"
+	if len(system.ExecutedCommands) == 0 || system.ExecutedCommands[0] != expected {
+		t.Fatalf("expected: %v, got: %v", expected, system.ExecutedCommands)
+	}
+
+	if !slices.Contains(system.ExecutedCommands, "snap remove astral-uv --purge") {
+		t.Fatalf("expected astral-uv to be removed, got: %v", system.ExecutedCommands)
+	}
+}
+
+func TestPlanFileTemplateData(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Providers.LXD.Enable = true
+	cfg.Providers.LXD.Bootstrap = true
+	cfg.Providers.K8s.Enable = true
+	cfg.Providers.K8s.Bootstrap = true
+	cfg.Providers.K8s.Controllers = []config.ControllerConfig{{Name: "k8s-a"}, {Name: "k8s-b"}}
+
+	worker := system.NewMockSystem()
+	data := NewPlan(cfg, worker).fileTemplateData(worker.User())
+
+	expectedControllers := []string{"k8s-a", "k8s-b", "concierge-lxd"}
+	if !reflect.DeepEqual(expectedControllers, data.Controllers) {
+		t.Fatalf("expected: %v, got: %v", expectedControllers, data.Controllers)
+	}
+
+	expectedKubeconfig := path.Join(os.TempDir(), ".kube", "config")
+	if data.Kubeconfig != expectedKubeconfig {
+		t.Fatalf("expected: %v, got: %v", expectedKubeconfig, data.Kubeconfig)
+	}
+
+	cfg.Juju.Disable = true
+
+	data = NewPlan(cfg, worker).fileTemplateData(worker.User())
+	if len(data.Controllers) > 0 {
+		t.Fatalf("expected no controllers when juju is disabled, got: %v", data.Controllers)
+	}
+}
+
+func TestPlanWritesFilesLast(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Host.Files = []config.FileConfig{{Path: "~/.config/user", Content: "{{ .User.Username }}", Template: true}}
+	cfg.Host.PythonTools = []string{"tox"}
+	cfg.Juju.Disable = true
+	cfg.Inventory = config.NewInventory()
+
+	worker := system.NewMockSystem()
+	err := NewPlan(cfg, worker).Execute(context.Background(), PrepareAction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if worker.CreatedFiles[".config/user"] != "test-user" {
+		t.Fatalf("expected: %v, got: %v", "test-user", worker.CreatedFiles[".config/user"])
+	}
+
+	component := cfg.Components[len(cfg.Components)-1]
+	if component.Kind != "file" || component.Name != "~/.config/user" || component.Status != config.Succeeded {
+		t.Fatalf("expected file to be recorded as succeeded, got: %+v", component)
+	}
+
+	worker = system.NewMockSystem()
+	err = NewPlan(cfg, worker).Execute(context.Background(), RestoreAction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(worker.Deleted) == 0 || worker.Deleted[0] != ".config/user" {
+		t.Fatalf("expected file to be removed first, got: %v", worker.Deleted)
+	}
+}
+
+func TestPlanRestoreKeepsFilesNotWritten(t *testing.T) {
+	cfg := &config.Config{Inventory: config.NewInventory()}
+	cfg.Host.Files = []config.FileConfig{{Path: "/etc/docker/daemon.json", Content: `{"mtu": 1400}`}}
+	cfg.Providers.LXD.Enable = true
+	cfg.Providers.LXD.Bootstrap = true
+
+	// Prepare fails while bootstrapping Juju, before the files are written.
+	worker := system.NewMockSystem()
+	worker.MockFile("/etc/docker/daemon.json", []byte(`{}`))
+	worker.MockCommandReturn("snap install juju", []byte{}, fmt.Errorf("boom"))
+
+	err := NewPlan(cfg, worker).Execute(context.Background(), PrepareAction)
+	if err == nil {
+		t.Fatalf("expected plan execution to fail")
+	}
+
+	if _, ok := worker.CreatedFiles["/etc/docker/daemon.json"]; ok {
+		t.Fatalf("expected file not to be written")
+	}
+
+	err = NewPlan(cfg, worker).Execute(context.Background(), RestoreAction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slices.Contains(worker.Deleted, "/etc/docker/daemon.json") {
+		t.Fatalf("expected pre-existing file to survive restore, got: %v", worker.Deleted)
+	}
+}
+
+func TestPlanOrdersDependentProviders(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Providers.LXD.Enable = true
+	cfg.Providers.K8s.Enable = true
+	cfg.Providers.K8s.Nodes = []config.K8sNodeConfig{{Count: 1}}
+	cfg.Juju.Disable = true
+
+	// K8s nodes are launched once the LXD provider is prepared.
+	worker := system.NewMockSystem()
+	worker.MockCommandReturn("lxc info concierge-k8s-worker-1", []byte("Error: Instance not found"), fmt.Errorf("command error"))
+
+	err := NewPlan(cfg, worker).Execute(context.Background(), PrepareAction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initialised := slices.Index(worker.ExecutedCommands, "lxd init --minimal")
+	launched := slices.Index(worker.ExecutedCommands, "lxc info concierge-k8s-worker-1")
+	if initialised == -1 || launched < initialised {
+		t.Fatalf("expected LXD to be prepared before K8s nodes are launched, got: %v", worker.ExecutedCommands)
+	}
+
+	// K8s nodes are deleted before the LXD provider is restored.
+	worker = system.NewMockSystem()
+	err = NewPlan(cfg, worker).Execute(context.Background(), RestoreAction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := slices.Index(worker.ExecutedCommands, "lxc delete --force concierge-k8s-worker-1")
+	removed := slices.Index(worker.ExecutedCommands, "snap remove lxd --purge")
+	if deleted == -1 || removed < deleted {
+		t.Fatalf("expected K8s nodes to be deleted before LXD is removed, got: %v", worker.ExecutedCommands)
+	}
+}
+
+func TestPlanSkipsProvidersWhoseDependencyFailed(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Providers.LXD.Enable = true
+	cfg.Providers.K8s.Enable = true
+	cfg.Providers.K8s.Nodes = []config.K8sNodeConfig{{Count: 1}}
+	cfg.Juju.Disable = true
+
+	worker := system.NewMockSystem()
+	worker.MockCommandReturn("lxd init --minimal", []byte{}, fmt.Errorf("boom"))
+
+	err := NewPlan(cfg, worker).Execute(context.Background(), PrepareAction)
+	if err == nil {
+		t.Fatalf("expected plan execution to fail")
+	}
+
+	if slices.Contains(worker.ExecutedCommands, "lxc info concierge-k8s-worker-1") {
+		t.Fatalf("expected K8s nodes not to be launched, got: %v", worker.ExecutedCommands)
+	}
+
+	for _, component := range cfg.Components {
+		if component.Kind == "provider" && component.Name == "k8s" && component.Error != "provider 'k8s' was skipped because provider 'lxd' failed" {
+			t.Fatalf("expected K8s provider to be skipped, got: %+v", component)
+		}
+	}
+}
@@ -2,12 +2,17 @@ package concierge
 
 import (
 	"fmt"
+	"maps"
 	"slices"
+
+	"github.com/jnsgruk/concierge/internal/juju"
 )
 
 // planValidators is a list of planValidators used to verify a plan
 var planValidators = []func(p *Plan) error{
 	validateSingleLocalKubernetesInstance,
+	validateControllers,
+	validateAptPackages,
 }
 
 // validateSingleLocalKubernetesInstance ensures the plan won't try and install multiple
@@ -25,3 +30,52 @@ func validateSingleLocalKubernetesInstance(plan *Plan) error {
 
 	return nil
 }
+
+// validateControllers ensures that any controllers listed for a provider can be bootstrapped,
+// and that each controller has a name which is unique across all providers.
+func validateControllers(plan *Plan) error {
+	controllerNames := []string{}
+
+	for _, p := range plan.Providers {
+		if len(p.Controllers()) > 0 && !p.Bootstrap() {
+			return fmt.Errorf("cannot configure controllers for provider '%s' when bootstrap is disabled", p.Name())
+		}
+
+		for _, c := range juju.Controllers(p) {
+			if c.Name == "" {
+				return fmt.Errorf("controllers for provider '%s' must have a name", p.Name())
+			}
+
+			if slices.Contains(controllerNames, c.Name) {
+				return fmt.Errorf("controller name '%s' is used more than once", c.Name)
+			}
+
+			controllerNames = append(controllerNames, c.Name)
+		}
+	}
+
+	return nil
+}
+
+// validateAptPackages ensures that any packages which are pinned or held are also listed in
+// the packages to be installed.
+func validateAptPackages(plan *Plan) error {
+	names := []string{}
+	for _, d := range plan.Debs {
+		names = append(names, d.Name)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(plan.config.Host.Apt.Pins)) {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("cannot pin apt package '%s' which is not in the list of packages", name)
+		}
+	}
+
+	for _, name := range plan.config.Host.Apt.Holds {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("cannot hold apt package '%s' which is not in the list of packages", name)
+		}
+	}
+
+	return nil
+}
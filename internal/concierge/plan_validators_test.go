@@ -37,3 +37,93 @@ func TestSingleK8sValidator(t *testing.T) {
 	}
 
 }
+
+func TestControllersValidator(t *testing.T) {
+	system := system.NewMockSystem()
+
+	noBootstrap := &config.Config{}
+	noBootstrap.Providers.LXD.Enable = true
+	noBootstrap.Providers.LXD.Controllers = []config.ControllerConfig{{Name: "one"}}
+
+	plan := NewPlan(noBootstrap, system)
+	err := plan.validate()
+	if err == nil {
+		t.Fatalf("should not allow controllers on a provider that is not bootstrapped")
+	}
+
+	unnamed := &config.Config{}
+	unnamed.Providers.LXD.Enable = true
+	unnamed.Providers.LXD.Bootstrap = true
+	unnamed.Providers.LXD.Controllers = []config.ControllerConfig{{Name: "one"}, {}}
+
+	plan = NewPlan(unnamed, system)
+	err = plan.validate()
+	if err == nil {
+		t.Fatalf("should not allow controllers without a name")
+	}
+
+	duplicate := &config.Config{}
+	duplicate.Providers.LXD.Enable = true
+	duplicate.Providers.LXD.Bootstrap = true
+	duplicate.Providers.LXD.Controllers = []config.ControllerConfig{{Name: "one"}}
+	duplicate.Providers.K8s.Enable = true
+	duplicate.Providers.K8s.Bootstrap = true
+	duplicate.Providers.K8s.Controllers = []config.ControllerConfig{{Name: "one"}}
+
+	plan = NewPlan(duplicate, system)
+	err = plan.validate()
+	if err == nil {
+		t.Fatalf("should not allow duplicate controller names")
+	}
+
+	multiple := &config.Config{}
+	multiple.Providers.LXD.Enable = true
+	multiple.Providers.LXD.Bootstrap = true
+	multiple.Providers.LXD.Controllers = []config.ControllerConfig{{Name: "one"}, {Name: "two"}}
+	multiple.Providers.K8s.Enable = true
+	multiple.Providers.K8s.Bootstrap = true
+
+	plan = NewPlan(multiple, system)
+	err = plan.validate()
+	if err != nil {
+		t.Fatalf("multiple uniquely named controllers should be permitted")
+	}
+}
+
+func TestAptPackagesValidator(t *testing.T) {
+	system := system.NewMockSystem()
+
+	unlisted := &config.Config{}
+	unlisted.Host.Packages = []string{"python3.12"}
+	unlisted.Host.Apt.Holds = []string{"python3.13"}
+
+	plan := NewPlan(unlisted, system)
+	err := plan.validate()
+	if err == nil {
+		t.Fatalf("should not allow holding a package that is not installed")
+	}
+
+	unlisted.Host.Apt.Holds = nil
+	unlisted.Host.Apt.Pins = map[string]string{"python3.13": "3.13.*"}
+
+	plan = NewPlan(unlisted, system)
+	err = plan.validate()
+	if err == nil {
+		t.Fatalf("should not allow pinning a package that is not installed")
+	}
+
+	listed := &config.Config{}
+	listed.Host.Packages = []string{"python3.12=3.12.3-1"}
+	listed.Host.Apt.Holds = []string{"python3.12"}
+	listed.Host.Apt.Pins = map[string]string{"python3.12": "3.12.*"}
+
+	plan = NewPlan(listed, system)
+	err = plan.validate()
+	if err != nil {
+		t.Fatalf("pinning and holding listed packages should be permitted: %v", err)
+	}
+
+	if !plan.Debs[0].Hold || plan.Debs[0].Pin != "3.12.*" || plan.Debs[0].Version != "3.12.3-1" {
+		t.Fatalf("expected deb to be pinned and held, got: %+v", plan.Debs[0])
+	}
+}
@@ -0,0 +1,69 @@
+package concierge
+
+import (
+	"time"
+
+	"github.com/jnsgruk/concierge/internal/config"
+)
+
+// Report is a detailed account of the status of concierge on a given machine, designed
+// to be consumed by other programs.
+type Report struct {
+	Status     string                 `json:"status" yaml:"status"`
+	Version    string                 `json:"version" yaml:"version"`
+	Commit     string                 `json:"commit" yaml:"commit"`
+	Preset     string                 `json:"preset,omitempty" yaml:"preset,omitempty"`
+	ConfigFile string                 `json:"config-file,omitempty" yaml:"config-file,omitempty"`
+	StartedAt  *time.Time             `json:"started-at,omitempty" yaml:"started-at,omitempty"`
+	FinishedAt *time.Time             `json:"finished-at,omitempty" yaml:"finished-at,omitempty"`
+	Components []ComponentReport      `json:"components" yaml:"components"`
+	Config     map[string]interface{} `json:"config" yaml:"config"`
+}
+
+// ComponentReport details the outcome of preparing a single snap, deb, binary, Python tool,
+// provider, Juju controller or managed file.
+type ComponentReport struct {
+	Kind   string `json:"kind" yaml:"kind"`
+	Name   string `json:"name" yaml:"name"`
+	Status string `json:"status" yaml:"status"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// NewReport constructs a report from a concierge runtime configuration.
+func NewReport(conf *config.Config) (*Report, error) {
+	effective, err := conf.EffectiveConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Status:     conf.Status.String(),
+		Version:    conf.Version,
+		Commit:     conf.Commit,
+		Preset:     conf.Preset,
+		ConfigFile: conf.ConfigFile,
+		StartedAt:  optionalTime(conf.StartedAt),
+		FinishedAt: optionalTime(conf.FinishedAt),
+		Components: []ComponentReport{},
+		Config:     effective,
+	}
+
+	for _, c := range conf.Components {
+		report.Components = append(report.Components, ComponentReport{
+			Kind:   c.Kind,
+			Name:   c.Name,
+			Status: c.Status.String(),
+			Error:  c.Error,
+		})
+	}
+
+	return report, nil
+}
+
+// optionalTime returns a pointer to the specified time, or nil if it is the zero time.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,57 @@
+package concierge
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jnsgruk/concierge/internal/config"
+)
+
+func TestNewReport(t *testing.T) {
+	started := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	conf := &config.Config{
+		Status:    config.Failed,
+		Version:   "1.0.0",
+		Commit:    "deadbeef",
+		Preset:    "machine",
+		StartedAt: started,
+		Components: []config.Component{
+			{Kind: "snap", Name: "jq", Status: config.Succeeded},
+			{Kind: "deb", Name: "sl", Status: config.Failed, Error: "boom"},
+		},
+	}
+	conf.Juju.Channel = "3.6/stable"
+
+	report, err := NewReport(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Status != "failed" || report.Version != "1.0.0" || report.Preset != "machine" {
+		t.Fatalf("unexpected report metadata: %+v", report)
+	}
+
+	if report.StartedAt == nil || !report.StartedAt.Equal(started) {
+		t.Fatalf("expected: %v, got: %v", started, report.StartedAt)
+	}
+
+	if report.FinishedAt != nil {
+		t.Fatalf("expected no finish time, got: %v", report.FinishedAt)
+	}
+
+	expectedComponents := []ComponentReport{
+		{Kind: "snap", Name: "jq", Status: "succeeded"},
+		{Kind: "deb", Name: "sl", Status: "failed", Error: "boom"},
+	}
+
+	if !reflect.DeepEqual(expectedComponents, report.Components) {
+		t.Fatalf("expected: %v, got: %v", expectedComponents, report.Components)
+	}
+
+	juju := report.Config["juju"].(map[string]interface{})
+	if juju["channel"] != "3.6/stable" {
+		t.Fatalf("expected juju channel in effective config, got: %v", juju)
+	}
+}
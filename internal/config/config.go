@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"strings"
 
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 func init() {
@@ -34,16 +37,18 @@ func NewConfig(cmd *cobra.Command, flags *pflag.FlagSet) (*Config, error) {
 	preset, _ := flags.GetString("preset")
 	verbose, _ := flags.GetBool("verbose")
 	trace, _ := flags.GetBool("trace")
+	resume, _ := flags.GetBool("resume")
 
-	if len(preset) > 0 {
+	if len(preset) > 0 && len(configFile) == 0 {
 		conf, err = Preset(preset)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load configuration preset: %w", err)
 		}
 		slog.Info("Preset selected", "preset", preset)
+		conf.Preset = preset
 	} else {
-		// Load and validate the configuration file
-		conf, err = parseConfig(configFile)
+		// Load and validate the configuration file, merging it over the preset if specified
+		conf, err = parseConfig(configFile, preset)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse configuration: %w", err)
 		}
@@ -52,12 +57,16 @@ func NewConfig(cmd *cobra.Command, flags *pflag.FlagSet) (*Config, error) {
 	conf.Overrides = getOverrides(flags)
 	conf.Verbose = verbose
 	conf.Trace = trace
+	conf.Resume = resume
 
 	return conf, nil
 }
 
-// parseConfig locates and parses the concierge configuration.
-func parseConfig(configFile string) (*Config, error) {
+// parseConfig locates and parses the concierge configuration. If a preset is specified, or
+// the config file specifies a base preset, the config file is merged over that preset.
+func parseConfig(configFile string, preset string) (*Config, error) {
+	var contents []byte
+
 	// If the user specified a path to the config file manually, load that file
 	if len(configFile) > 0 {
 		b, err := os.ReadFile(configFile)
@@ -65,11 +74,17 @@ func parseConfig(configFile string) (*Config, error) {
 			return nil, errors.New("unable to read specified config file")
 		}
 
+		err = Validate(b, configFile)
+		if err != nil {
+			return nil, err
+		}
+
 		err = viper.ReadConfig(bytes.NewBuffer(b))
 		if err != nil {
 			return nil, errors.New("error parsing concierge config file")
 		}
 
+		contents = b
 		slog.Info("Configuration file found", "path", configFile)
 	} else {
 		// Otherwise check in the default locations
@@ -83,30 +98,119 @@ func parseConfig(configFile string) (*Config, error) {
 					return nil, fmt.Errorf("failed to load configuration preset: %w", err)
 				}
 
+				conf.Preset = "dev"
 				return conf, nil
 			}
 
 			return nil, errors.New("error parsing concierge config file")
 		}
 
+		err = ValidateFile(viper.ConfigFileUsed())
+		if err != nil {
+			return nil, err
+		}
+
+		contents, err = os.ReadFile(viper.ConfigFileUsed())
+		if err != nil {
+			return nil, errors.New("unable to read concierge config file")
+		}
+
 		slog.Info("Configuration file found", "path", "concierge.yaml")
 	}
 
-	conf := &Config{}
-	err := viper.Unmarshal(conf)
+	conf, settings, err := decodeConfig(contents)
 	if err != nil {
 		return nil, errors.New("error parsing concierge config file")
 	}
 
+	conf.ConfigFile = viper.ConfigFileUsed()
+	if len(configFile) > 0 {
+		conf.ConfigFile = configFile
+	}
+
+	if len(preset) > 0 {
+		if len(conf.Base) > 0 && conf.Base != preset {
+			return nil, fmt.Errorf("config file base '%s' conflicts with preset '%s'", conf.Base, preset)
+		}
+		conf.Base = preset
+	}
+
+	if len(conf.Base) == 0 {
+		return conf, nil
+	}
+
+	base, err := Preset(conf.Base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load base preset: %w", err)
+	}
+
+	slog.Info("Merging configuration file over preset", "preset", conf.Base)
+
+	conf = overlayConfig(base, conf, settings)
+	conf.Preset = conf.Base
+
 	return conf, nil
 }
 
+// decodeConfig parses the contents of a config file or preset, returning the configuration
+// along with the raw settings it was decoded from. The contents are decoded directly rather
+// than with viper, which would split keys containing '.', such as snap config options.
+func decodeConfig(contents []byte) (*Config, map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	err := yaml.Unmarshal(contents, &settings)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conf := &Config{}
+	err = mapstructure.WeakDecode(settings, conf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return conf, settings, nil
+}
+
+// Users returns the names of the users to provision: those specified with '--user', followed
+// by those listed in the config file, without duplicates. If the list is empty, only the real
+// user is provisioned.
+func (c *Config) Users() []string {
+	var users []string
+	for _, u := range slices.Concat(c.Overrides.Users, c.Host.Users) {
+		if !slices.Contains(users, u) {
+			users = append(users, u)
+		}
+	}
+	return users
+}
+
+// EffectiveConfig returns the juju, providers and host sections of the configuration, along
+// with any overrides, keyed by the same field names used in the config file.
+func (c *Config) EffectiveConfig() (map[string]interface{}, error) {
+	sections := struct {
+		Juju      jujuConfig      `mapstructure:"juju"`
+		Providers providerConfig  `mapstructure:"providers"`
+		Host      hostConfig      `mapstructure:"host"`
+		Overrides ConfigOverrides `mapstructure:"overrides"`
+	}{c.Juju, c.Providers, c.Host, c.Overrides}
+
+	effective := map[string]interface{}{}
+
+	err := mapstructure.Decode(sections, &effective)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert configuration: %w", err)
+	}
+
+	return effective, nil
+}
+
 // getOverrides parses the cli flags related to config overrides and returns a constructed
 // ConfigOverrides struct.
 func getOverrides(flags *pflag.FlagSet) ConfigOverrides {
 	return ConfigOverrides{
 		DisableJuju:       envOrFlagBool(flags, "disable-juju"),
 		JujuChannel:       envOrFlagString(flags, "juju-channel"),
+		JujuAgentVersion:  envOrFlagString(flags, "juju-agent-version"),
 		K8sChannel:        envOrFlagString(flags, "k8s-channel"),
 		MicroK8sChannel:   envOrFlagString(flags, "microk8s-channel"),
 		LXDChannel:        envOrFlagString(flags, "lxd-channel"),
@@ -118,6 +222,8 @@ func getOverrides(flags *pflag.FlagSet) ConfigOverrides {
 
 		ExtraSnaps: envOrFlagSlice(flags, "extra-snaps"),
 		ExtraDebs:  envOrFlagSlice(flags, "extra-debs"),
+
+		Users: envOrFlagSlice(flags, "user"),
 	}
 }
 
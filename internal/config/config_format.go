@@ -1,7 +1,11 @@
 package config
 
+import "time"
+
 // Config represents concierge's configuration format.
 type Config struct {
+	// Base is the name of a preset over which the rest of the configuration is merged.
+	Base      string         `mapstructure:"base"`
 	Juju      jujuConfig     `mapstructure:"juju"`
 	Providers providerConfig `mapstructure:"providers"`
 	Host      hostConfig     `mapstructure:"host"`
@@ -11,6 +15,19 @@ type Config struct {
 	Status    Status          `mapstructure:"status"`
 	Verbose   bool            `mapstructure:"verbose"`
 	Trace     bool            `mapstructure:"trace"`
+	Resume    bool            `mapstructure:"resume"`
+	Inventory *Inventory      `mapstructure:"inventory"`
+	// Journal is persisted separately from the runtime configuration.
+	Journal *Journal `mapstructure:"-" yaml:"-"`
+
+	// The following are recorded at runtime to report on the provisioning process
+	Preset     string      `mapstructure:"preset"`
+	ConfigFile string      `mapstructure:"config-file"`
+	Version    string      `mapstructure:"version"`
+	Commit     string      `mapstructure:"commit"`
+	StartedAt  time.Time   `mapstructure:"started-at"`
+	FinishedAt time.Time   `mapstructure:"finished-at"`
+	Components []Component `mapstructure:"components"`
 }
 
 // Status represents the status of concierge on a given machine.
@@ -20,11 +37,21 @@ const (
 	Provisioning Status = iota
 	Succeeded
 	Failed
+	Cancelled
 )
 
 // String returns a string representation of a given concierge status.
 func (s Status) String() string {
-	return [...]string{"provisioning", "succeeded", "failed"}[s]
+	return [...]string{"provisioning", "succeeded", "failed", "cancelled"}[s]
+}
+
+// Component records the outcome of the most recent action for a single snap, deb, binary,
+// Python tool, provider, Juju controller or managed file.
+type Component struct {
+	Kind   string `mapstructure:"kind"`
+	Name   string `mapstructure:"name"`
+	Status Status `mapstructure:"status"`
+	Error  string `mapstructure:"error"`
 }
 
 // jujuConfig represents the configuration for juju, including the desired version,
@@ -38,6 +65,10 @@ type jujuConfig struct {
 	ModelDefaults map[string]string `mapstructure:"model-defaults"`
 	// The set of bootstrap constraints to be passed to Juju
 	BootstrapConstraints map[string]string `mapstructure:"bootstrap-constraints"`
+	// The version of the Juju agent to bootstrap, if different to the client
+	AgentVersion string `mapstructure:"agent-version"`
+	// Additional arguments to be passed to Juju during bootstrap
+	ExtraBootstrapArgs []string `mapstructure:"extra-bootstrap-args"`
 }
 
 // providerConfig represents the set of providers to be configured and bootstrapped.
@@ -50,30 +81,39 @@ type providerConfig struct {
 
 // lxdConfig represents how LXD should be configured on the host.
 type lxdConfig struct {
-	Enable               bool              `mapstructure:"enable"`
-	Bootstrap            bool              `mapstructure:"bootstrap"`
-	Channel              string            `mapstructure:"channel"`
-	ModelDefaults        map[string]string `mapstructure:"model-defaults"`
-	BootstrapConstraints map[string]string `mapstructure:"bootstrap-constraints"`
+	Enable               bool               `mapstructure:"enable"`
+	Bootstrap            bool               `mapstructure:"bootstrap"`
+	Channel              string             `mapstructure:"channel"`
+	ModelDefaults        map[string]string  `mapstructure:"model-defaults"`
+	BootstrapConstraints map[string]string  `mapstructure:"bootstrap-constraints"`
+	Controllers          []ControllerConfig `mapstructure:"controllers"`
+	AgentVersion         string             `mapstructure:"agent-version"`
+	ExtraBootstrapArgs   []string           `mapstructure:"extra-bootstrap-args"`
 }
 
 // googleConfig represents how Juju should be configured for Google Cloud use.
 type googleConfig struct {
-	Enable               bool              `mapstructure:"enable"`
-	Bootstrap            bool              `mapstructure:"bootstrap"`
-	CredentialsFile      string            `mapstructure:"credentials-file"`
-	ModelDefaults        map[string]string `mapstructure:"model-defaults"`
-	BootstrapConstraints map[string]string `mapstructure:"bootstrap-constraints"`
+	Enable               bool               `mapstructure:"enable"`
+	Bootstrap            bool               `mapstructure:"bootstrap"`
+	CredentialsFile      string             `mapstructure:"credentials-file"`
+	ModelDefaults        map[string]string  `mapstructure:"model-defaults"`
+	BootstrapConstraints map[string]string  `mapstructure:"bootstrap-constraints"`
+	Controllers          []ControllerConfig `mapstructure:"controllers"`
+	AgentVersion         string             `mapstructure:"agent-version"`
+	ExtraBootstrapArgs   []string           `mapstructure:"extra-bootstrap-args"`
 }
 
 // microk8sConfig represents how MicroK8s should be configured on the host.
 type microk8sConfig struct {
-	Enable               bool              `mapstructure:"enable"`
-	Bootstrap            bool              `mapstructure:"bootstrap"`
-	Channel              string            `mapstructure:"channel"`
-	Addons               []string          `mapstructure:"addons"`
-	ModelDefaults        map[string]string `mapstructure:"model-defaults"`
-	BootstrapConstraints map[string]string `mapstructure:"bootstrap-constraints"`
+	Enable               bool               `mapstructure:"enable"`
+	Bootstrap            bool               `mapstructure:"bootstrap"`
+	Channel              string             `mapstructure:"channel"`
+	Addons               []string           `mapstructure:"addons"`
+	ModelDefaults        map[string]string  `mapstructure:"model-defaults"`
+	BootstrapConstraints map[string]string  `mapstructure:"bootstrap-constraints"`
+	Controllers          []ControllerConfig `mapstructure:"controllers"`
+	AgentVersion         string             `mapstructure:"agent-version"`
+	ExtraBootstrapArgs   []string           `mapstructure:"extra-bootstrap-args"`
 }
 
 // k8sConfig represents how MicroK8s should be configured on the host.
@@ -82,23 +122,166 @@ type k8sConfig struct {
 	Bootstrap            bool                         `mapstructure:"bootstrap"`
 	Channel              string                       `mapstructure:"channel"`
 	Features             map[string]map[string]string `mapstructure:"features"`
+	Nodes                []K8sNodeConfig              `mapstructure:"nodes"`
 	ModelDefaults        map[string]string            `mapstructure:"model-defaults"`
 	BootstrapConstraints map[string]string            `mapstructure:"bootstrap-constraints"`
+	Controllers          []ControllerConfig           `mapstructure:"controllers"`
+	AgentVersion         string                       `mapstructure:"agent-version"`
+	ExtraBootstrapArgs   []string                     `mapstructure:"extra-bootstrap-args"`
+}
+
+// K8sNodeConfig represents a set of additional nodes to join to the K8s cluster. Each node
+// is a LXD virtual machine launched by concierge.
+type K8sNodeConfig struct {
+	// Count is the number of nodes to launch. If unset, a single node is launched.
+	Count int `mapstructure:"count"`
+	// Role is the role of the nodes in the cluster, either 'control-plane' or 'worker'.
+	// If unset, the nodes join as workers.
+	Role string `mapstructure:"role"`
+	// Resources are the resources allocated to each node.
+	Resources K8sNodeResources `mapstructure:"resources"`
+}
+
+// K8sNodeResources represents the resources allocated to the virtual machine for a K8s node.
+type K8sNodeResources struct {
+	// CPU is the number of CPUs allocated to the node.
+	CPU int `mapstructure:"cpu"`
+	// Memory is the amount of memory allocated to the node, such as '4GiB'.
+	Memory string `mapstructure:"memory"`
+	// Disk is the size of the node's root disk, such as '20GiB'.
+	Disk string `mapstructure:"disk"`
+}
+
+// ControllerConfig represents a Juju controller to be bootstrapped on a provider.
+type ControllerConfig struct {
+	// Name is the name of the controller.
+	Name string `mapstructure:"name"`
+	// BootstrapArgs is a list of additional arguments passed to `juju bootstrap`.
+	BootstrapArgs []string `mapstructure:"bootstrap-args"`
+	// AgentVersion is the Juju agent version to bootstrap the controller with, which takes
+	// precedence over the provider and Juju config.
+	AgentVersion string `mapstructure:"agent-version"`
+	// ModelDefaults is the set of model-defaults specific to the controller.
+	ModelDefaults map[string]string `mapstructure:"model-defaults"`
+	// BootstrapConstraints is the set of bootstrap constraints specific to the controller.
+	BootstrapConstraints map[string]string `mapstructure:"bootstrap-constraints"`
+	// Models is the list of models to create on the controller.
+	Models []ModelConfig `mapstructure:"models"`
+}
+
+// ModelConfig represents a Juju model to be created on a controller.
+type ModelConfig struct {
+	// Name is the name of the model.
+	Name string `mapstructure:"name"`
+	// Config is the set of model-config to apply to the model.
+	Config map[string]string `mapstructure:"config"`
 }
 
 // SnapConfig represents the configuration for a specific snap to be installed.
 type SnapConfig struct {
 	// Channel is the channel from which to install the snap.
 	Channel string `mapstructure:"channel"`
+	// Path is the path of a local .snap file to install instead of installing from the store.
+	Path string `mapstructure:"path"`
 	// Connections is a list of snap connections to form.
 	Connections []string `mapstructure:"connections"`
+	// Config is a map of snap configuration options to set, as with 'snap set'.
+	Config map[string]string `mapstructure:"config"`
+	// Services maps the name of each of the snap's services to the action to take: one of
+	// 'start', 'stop', 'enable' (start, and start on boot) or 'disable' (stop, and do not
+	// start on boot).
+	Services map[string]string `mapstructure:"services"`
+	// Aliases maps the name of each alias to create to the snap application it refers to.
+	Aliases map[string]string `mapstructure:"aliases"`
 }
 
 // hostConfig is a top-level field containing addition configuration for the host being
 // configured.
 type hostConfig struct {
-	// Packages is a of apt packages to be installed from the archive
+	// Packages is a of apt packages to be installed from the archive. Each package may
+	// specify a version or release, i.e. 'python3.12=3.12.3-1' or 'lxd-installer/noble-backports'.
 	Packages []string `mapstructure:"packages"`
 	// Snaps is a map of snaps to be installed.
 	Snaps map[string]SnapConfig `mapstructure:"snaps"`
+	// Apt is the configuration of additional apt repositories.
+	Apt AptConfig `mapstructure:"apt"`
+	// PythonTools is a list of Python CLI tools to install in isolated environments for the
+	// user, optionally pinned to a version, i.e. 'tox==4.18.0'.
+	PythonTools []string `mapstructure:"python-tools"`
+	// PythonToolInstaller is the tool used to install Python tools. One of 'uv' or 'pipx'.
+	// Defaults to 'uv'.
+	PythonToolInstaller string `mapstructure:"python-tool-installer"`
+	// Binaries is a map of binaries to download and install, keyed by the name they are
+	// installed as.
+	Binaries map[string]BinaryConfig `mapstructure:"binaries"`
+	// Files is a list of files to write to the host once it is otherwise prepared.
+	Files []FileConfig `mapstructure:"files"`
+	// Users is a list of users to provision, in addition to any specified with '--user'. The
+	// first user bootstraps the Juju controllers, and each user is added to the provider
+	// groups, and given a kubeconfig and access to the controllers. Defaults to the real user.
+	Users []string `mapstructure:"users"`
+}
+
+// FileConfig represents a file managed by concierge. Exactly one of Content or Source must be
+// specified.
+type FileConfig struct {
+	// Path is the destination of the file. Relative paths, and those beginning with '~/', are
+	// relative to the user's home directory.
+	Path string `mapstructure:"path"`
+	// Content is the inline content of the file.
+	Content string `mapstructure:"content"`
+	// Source is the path of a local file whose content is copied to the destination.
+	Source string `mapstructure:"source"`
+	// Mode is the octal file mode to apply to the file, such as '0600'.
+	Mode string `mapstructure:"mode"`
+	// Owner is the user, and optionally the group, that should own the file, in the form
+	// '<user>[:<group>]'. Files in the user's home directory are owned by the user, and other
+	// files by root, unless specified.
+	Owner string `mapstructure:"owner"`
+	// Template specifies whether the content is rendered as a Go template, with access to the
+	// effective configuration, the names of the Juju controllers and the kubeconfig path.
+	Template bool `mapstructure:"template"`
+}
+
+// BinaryConfig represents a binary to be downloaded, either directly or as a member of an
+// archive, and installed on the host.
+type BinaryConfig struct {
+	// URL is the location of the binary, or of the archive containing it. Supported schemes
+	// are 'file', 'http' and 'https'.
+	URL string `mapstructure:"url"`
+	// SHA256 is the expected checksum of the file at the URL.
+	SHA256 string `mapstructure:"sha256"`
+	// Member is the path of the binary within a tar or zip archive.
+	Member string `mapstructure:"member"`
+	// Scope is where the binary is installed. One of 'system' (/usr/local/bin), or 'user'
+	// (~/.local/bin for the user). Defaults to 'system'.
+	Scope string `mapstructure:"scope"`
+}
+
+// AptConfig represents additional apt repositories to configure before installing packages,
+// and the pins and holds to apply to packages.
+type AptConfig struct {
+	// Sources is a map of apt repositories to configure, keyed by name.
+	Sources map[string]AptSourceConfig `mapstructure:"sources"`
+	// PPAs is a list of Launchpad PPAs to add, such as 'ppa:deadsnakes/ppa'.
+	PPAs []string `mapstructure:"ppas"`
+	// Pins maps the name of a package to the version it should be pinned to, which may
+	// include wildcards such as '3.12.*'.
+	Pins map[string]string `mapstructure:"pins"`
+	// Holds is a list of packages to hold at their installed version.
+	Holds []string `mapstructure:"holds"`
+}
+
+// AptSourceConfig represents an apt repository, which is written as a deb822 sources file.
+type AptSourceConfig struct {
+	// URIs is the list of base URIs of the repository.
+	URIs []string `mapstructure:"uris"`
+	// Suites is the list of suites to use. Defaults to the codename of the host's release.
+	Suites []string `mapstructure:"suites"`
+	// Components is the list of components to use, such as 'main'.
+	Components []string `mapstructure:"components"`
+	// Key is the ASCII-armored public key used to sign the repository.
+	Key string `mapstructure:"key"`
+	// KeyFile is the path of a file containing the public key used to sign the repository.
+	KeyFile string `mapstructure:"key-file"`
 }
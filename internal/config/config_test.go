@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -66,3 +68,64 @@ func TestMapMerge(t *testing.T) {
 		}
 	}
 }
+
+func TestConfigUsers(t *testing.T) {
+	type test struct {
+		overrides []string
+		host      []string
+		expected  []string
+	}
+
+	tests := []test{
+		{overrides: nil, host: nil, expected: nil},
+		{overrides: nil, host: []string{"ubuntu", "runner"}, expected: []string{"ubuntu", "runner"}},
+		{overrides: []string{"alice"}, host: []string{"ubuntu", "alice"}, expected: []string{"alice", "ubuntu"}},
+	}
+
+	for _, tc := range tests {
+		conf := &Config{}
+		conf.Overrides.Users = tc.overrides
+		conf.Host.Users = tc.host
+
+		users := conf.Users()
+		if !reflect.DeepEqual(tc.expected, users) {
+			t.Fatalf("expected: %v, got: %v", tc.expected, users)
+		}
+	}
+}
+
+func TestParseConfigDottedSnapOptions(t *testing.T) {
+	contents := `juju:
+  disable: true
+
+host:
+  snaps:
+    lxd:
+      channel: latest/stable
+      config:
+        ui.enable: "true"
+        core.https-address: "127.0.0.1:8443"
+`
+
+	expected := map[string]string{
+		"ui.enable":          "true",
+		"core.https-address": "127.0.0.1:8443",
+	}
+
+	for _, preset := range []string{"", "dev"} {
+		configFile := filepath.Join(t.TempDir(), "concierge.yaml")
+		err := os.WriteFile(configFile, []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conf, err := parseConfig(configFile, preset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(expected, conf.Host.Snaps["lxd"].Config) {
+			t.Fatalf("expected: %v, got: %v", expected, conf.Host.Snaps["lxd"].Config)
+		}
+	}
+}
@@ -0,0 +1,480 @@
+package config
+
+import (
+	"slices"
+	"sync"
+)
+
+// NewInventory constructs a new, empty inventory.
+func NewInventory() *Inventory {
+	return &Inventory{
+		Snaps:       map[string]SnapState{},
+		Debs:        map[string]bool{},
+		Files:       map[string]bool{},
+		Controllers: map[string]bool{},
+		Groups:      map[string]bool{},
+		AptSources:  map[string]bool{},
+		DebHolds:    map[string]bool{},
+		PythonTools: map[string]bool{},
+		Binaries:    map[string]bool{},
+		Attributes:  map[string]FileAttributes{},
+		DebFiles:    map[string]string{},
+	}
+}
+
+// Inventory records the state of the machine before concierge made changes to it, such that
+// `concierge restore` only reverses the changes that concierge introduced.
+//
+// Each item is recorded the first time it is observed, and never overwritten. This ensures
+// that items installed by a previous run of `concierge prepare` are not mistaken for items that
+// pre-date concierge.
+type Inventory struct {
+	// Snaps records whether each snap was installed, and on which channel.
+	Snaps map[string]SnapState `mapstructure:"snaps"`
+	// Debs records whether each deb was installed.
+	Debs map[string]bool `mapstructure:"debs"`
+	// Files records whether each path, either relative to the user's home directory or
+	// absolute, existed.
+	Files map[string]bool `mapstructure:"files"`
+	// Controllers records whether each Juju controller existed.
+	Controllers map[string]bool `mapstructure:"controllers"`
+	// Groups records whether each user was a member of each POSIX group, keyed by
+	// '<group>/<username>'.
+	Groups map[string]bool `mapstructure:"groups"`
+	// AptSources records whether each apt source was configured.
+	AptSources map[string]bool `mapstructure:"apt-sources"`
+	// DebHolds records whether each deb was held at its installed version.
+	DebHolds map[string]bool `mapstructure:"deb-holds"`
+	// PythonTools records whether each Python tool was installed for the user.
+	PythonTools map[string]bool `mapstructure:"python-tools"`
+	// Binaries records whether a file existed at the path to which each binary is installed.
+	Binaries map[string]bool `mapstructure:"binaries"`
+	// Attributes records the original mode and owner of each file that concierge backed up
+	// before overwriting it.
+	Attributes map[string]FileAttributes `mapstructure:"attributes"`
+	// DebFiles records the name of the package contained in each local .deb file, keyed by
+	// the path of the file.
+	DebFiles map[string]string `mapstructure:"deb-files"`
+
+	mtx sync.Mutex
+}
+
+// FileAttributes represents the mode and owner of a file before concierge made changes to it.
+type FileAttributes struct {
+	// Mode is the octal file mode, such as '644'.
+	Mode string `mapstructure:"mode"`
+	// Owner is the '<user>:<group>' that owned the file.
+	Owner string `mapstructure:"owner"`
+}
+
+// SnapState represents the state of a snap before concierge made changes to it.
+type SnapState struct {
+	Installed bool   `mapstructure:"installed"`
+	Channel   string `mapstructure:"channel"`
+	// Revision records the revision that was installed before the snap was replaced with a
+	// local .snap file.
+	Revision string `mapstructure:"revision"`
+	// Config records the original value of each configuration option set by concierge, or
+	// nil if the option was not set.
+	Config map[string]*string `mapstructure:"config"`
+	// Connections records the snap connections formed by concierge.
+	Connections []string `mapstructure:"connections"`
+	// Aliases records the snap aliases created by concierge.
+	Aliases []string `mapstructure:"aliases"`
+}
+
+// RecordSnap records the state of a snap, if it has not already been recorded.
+func (i *Inventory) RecordSnap(name string, state SnapState) bool {
+	if i == nil {
+		return false
+	}
+
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	if i.Snaps == nil {
+		i.Snaps = map[string]SnapState{}
+	}
+
+	if _, ok := i.Snaps[name]; ok {
+		return false
+	}
+
+	i.Snaps[name] = state
+	return true
+}
+
+// SnapState returns the recorded state of a snap, and whether or not it was recorded.
+func (i *Inventory) SnapState(name string) (SnapState, bool) {
+	if i == nil {
+		return SnapState{}, false
+	}
+
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	state, ok := i.Snaps[name]
+	return state, ok
+}
+
+// RecordSnapConfig records the original value of a snap configuration option, or nil if it
+// was not set, if the snap has been recorded and the option has not already been recorded.
+func (i *Inventory) RecordSnapConfig(name string, option string, value *string) bool {
+	if i == nil {
+		return false
+	}
+
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	state, ok := i.Snaps[name]
+	if !ok {
+		return false
+	}
+
+	if _, ok := state.Config[option]; ok {
+		return false
+	}
+
+	if state.Config == nil {
+		state.Config = map[string]*string{}
+	}
+
+	state.Config[option] = value
+	i.Snaps[name] = state
+	return true
+}
+
+// RecordSnapConnection records a connection formed by concierge, if the snap has been recorded
+// and the connection has not already been recorded.
+func (i *Inventory) RecordSnapConnection(name string, connection string) bool {
+	if i == nil {
+		return false
+	}
+
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	state, ok := i.Snaps[name]
+	if !ok || slices.Contains(state.Connections, connection) {
+		return false
+	}
+
+	state.Connections = append(state.Connections, connection)
+	i.Snaps[name] = state
+	return true
+}
+
+// RecordSnapAlias records an alias created by concierge, if the snap has been recorded and the
+// alias has not already been recorded.
+func (i *Inventory) RecordSnapAlias(name string, alias string) bool {
+	if i == nil {
+		return false
+	}
+
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	state, ok := i.Snaps[name]
+	if !ok || slices.Contains(state.Aliases, alias) {
+		return false
+	}
+
+	state.Aliases = append(state.Aliases, alias)
+	i.Snaps[name] = state
+	return true
+}
+
+// RecordDeb records whether a deb was installed, if it has not already been recorded.
+func (i *Inventory) RecordDeb(name string, installed bool) bool {
+	if i == nil {
+		return false
+	}
+
+	return i.record(&i.Debs, name, installed)
+}
+
+// DebInstalled reports whether a deb was installed before concierge made changes.
+func (i *Inventory) DebInstalled(name string) bool {
+	if i == nil {
+		return false
+	}
+
+	existed, ok := i.lookup(&i.Debs, name)
+	return ok && existed
+}
+
+// RecordDebFile records the name of the package contained in a local .deb file, if it has
+// not already been recorded.
+func (i *Inventory) RecordDebFile(filePath string, name string) bool {
+	if i == nil {
+		return false
+	}
+
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	if i.DebFiles == nil {
+		i.DebFiles = map[string]string{}
+	}
+
+	if _, ok := i.DebFiles[filePath]; ok {
+		return false
+	}
+
+	i.DebFiles[filePath] = name
+	return true
+}
+
+// DebFilePackage returns the name of the package contained in a local .deb file, and whether
+// or not it was recorded.
+func (i *Inventory) DebFilePackage(filePath string) (string, bool) {
+	if i == nil {
+		return "", false
+	}
+
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	name, ok := i.DebFiles[filePath]
+	return name, ok
+}
+
+// RecordDebHold records whether a deb was held, if it has not already been recorded.
+func (i *Inventory) RecordDebHold(name string, held bool) bool {
+	if i == nil {
+		return false
+	}
+
+	return i.record(&i.DebHolds, name, held)
+}
+
+// DebHeld reports whether a deb was held before concierge made changes.
+func (i *Inventory) DebHeld(name string) bool {
+	if i == nil {
+		return false
+	}
+
+	held, ok := i.lookup(&i.DebHolds, name)
+	return ok && held
+}
+
+// RecordPythonTool records whether a Python tool was installed, if it has not already been
+// recorded.
+func (i *Inventory) RecordPythonTool(name string, installed bool) bool {
+	if i == nil {
+		return false
+	}
+
+	return i.record(&i.PythonTools, name, installed)
+}
+
+// PythonToolInstalled reports whether a Python tool was installed before concierge made changes.
+func (i *Inventory) PythonToolInstalled(name string) bool {
+	if i == nil {
+		return false
+	}
+
+	installed, ok := i.lookup(&i.PythonTools, name)
+	return ok && installed
+}
+
+// RecordBinary records whether a file existed at the path to which a binary is installed, if
+// it has not already been recorded.
+func (i *Inventory) RecordBinary(filePath string, existed bool) bool {
+	if i == nil {
+		return false
+	}
+
+	return i.record(&i.Binaries, filePath, existed)
+}
+
+// BinaryExisted reports whether a file existed at the path to which a binary is installed
+// before concierge made changes.
+func (i *Inventory) BinaryExisted(filePath string) bool {
+	if i == nil {
+		return false
+	}
+
+	existed, ok := i.lookup(&i.Binaries, filePath)
+	return ok && existed
+}
+
+// BinaryAdded reports whether a file was created by concierge at the path to which a binary is
+// installed.
+func (i *Inventory) BinaryAdded(filePath string) bool {
+	if i == nil {
+		return false
+	}
+
+	existed, ok := i.lookup(&i.Binaries, filePath)
+	return ok && !existed
+}
+
+// RecordAptSource records whether an apt source was configured, if it has not already been
+// recorded.
+func (i *Inventory) RecordAptSource(name string, existed bool) bool {
+	if i == nil {
+		return false
+	}
+
+	return i.record(&i.AptSources, name, existed)
+}
+
+// AptSourceExisted reports whether an apt source was configured before concierge made changes.
+func (i *Inventory) AptSourceExisted(name string) bool {
+	if i == nil {
+		return false
+	}
+
+	existed, ok := i.lookup(&i.AptSources, name)
+	return ok && existed
+}
+
+// RecordFile records whether a path in the user's home directory, or an absolute path,
+// existed, if it has not already been recorded.
+func (i *Inventory) RecordFile(filePath string, existed bool) bool {
+	if i == nil {
+		return false
+	}
+
+	return i.record(&i.Files, filePath, existed)
+}
+
+// FileExisted reports whether a path in the user's home directory, or an absolute path,
+// existed before concierge made changes.
+func (i *Inventory) FileExisted(filePath string) bool {
+	if i == nil {
+		return false
+	}
+
+	existed, ok := i.lookup(&i.Files, filePath)
+	return ok && existed
+}
+
+// FileAdded reports whether a path in the user's home directory, or an absolute path, was
+// created by concierge.
+func (i *Inventory) FileAdded(filePath string) bool {
+	if i == nil {
+		return false
+	}
+
+	existed, ok := i.lookup(&i.Files, filePath)
+	return ok && !existed
+}
+
+// RecordFileAttributes records the original mode and owner of a file, if they have not
+// already been recorded.
+func (i *Inventory) RecordFileAttributes(filePath string, attributes FileAttributes) bool {
+	if i == nil {
+		return false
+	}
+
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	if i.Attributes == nil {
+		i.Attributes = map[string]FileAttributes{}
+	}
+
+	if _, ok := i.Attributes[filePath]; ok {
+		return false
+	}
+
+	i.Attributes[filePath] = attributes
+	return true
+}
+
+// FileAttributes returns the original mode and owner of a file, and whether they were recorded.
+func (i *Inventory) FileAttributes(filePath string) (FileAttributes, bool) {
+	if i == nil {
+		return FileAttributes{}, false
+	}
+
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	attributes, ok := i.Attributes[filePath]
+	return attributes, ok
+}
+
+// RecordController records whether a Juju controller existed, if it has not already been
+// recorded.
+func (i *Inventory) RecordController(name string, existed bool) bool {
+	if i == nil {
+		return false
+	}
+
+	return i.record(&i.Controllers, name, existed)
+}
+
+// ControllerExisted reports whether a Juju controller existed before concierge made changes.
+func (i *Inventory) ControllerExisted(name string) bool {
+	if i == nil {
+		return false
+	}
+
+	existed, ok := i.lookup(&i.Controllers, name)
+	return ok && existed
+}
+
+// ControllerAdded reports whether a Juju controller was bootstrapped by concierge.
+func (i *Inventory) ControllerAdded(name string) bool {
+	if i == nil {
+		return false
+	}
+
+	existed, ok := i.lookup(&i.Controllers, name)
+	return ok && !existed
+}
+
+// RecordGroup records whether a user was a member of a POSIX group, if it has not already
+// been recorded.
+func (i *Inventory) RecordGroup(username string, group string, member bool) bool {
+	if i == nil {
+		return false
+	}
+
+	return i.record(&i.Groups, groupKey(username, group), member)
+}
+
+// GroupAdded reports whether a user was added to a POSIX group by concierge.
+func (i *Inventory) GroupAdded(username string, group string) bool {
+	if i == nil {
+		return false
+	}
+
+	member, ok := i.lookup(&i.Groups, groupKey(username, group))
+	return ok && !member
+}
+
+// groupKey returns the key under which a user's membership of a POSIX group is recorded.
+func groupKey(username string, group string) string {
+	return group + "/" + username
+}
+
+// record sets the value of a key in one of the inventory's maps, unless it is already set.
+func (i *Inventory) record(m *map[string]bool, key string, value bool) bool {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	if *m == nil {
+		*m = map[string]bool{}
+	}
+
+	if _, ok := (*m)[key]; ok {
+		return false
+	}
+
+	(*m)[key] = value
+	return true
+}
+
+// lookup returns the value of a key in one of the inventory's maps.
+func (i *Inventory) lookup(m *map[string]bool, key string) (bool, bool) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	value, ok := (*m)[key]
+	return value, ok
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestInventoryFirstObservationWins(t *testing.T) {
+	inventory := NewInventory()
+
+	if !inventory.RecordDeb("cowsay", false) {
+		t.Fatalf("expected first observation of deb to be recorded")
+	}
+	if inventory.RecordDeb("cowsay", true) {
+		t.Fatalf("expected second observation of deb to be ignored")
+	}
+	if inventory.DebInstalled("cowsay") {
+		t.Fatalf("expected deb to be reported as not pre-installed")
+	}
+
+	inventory.RecordSnap("jq", SnapState{Installed: true, Channel: "latest/edge"})
+	inventory.RecordSnap("jq", SnapState{Installed: true, Channel: "latest/stable"})
+
+	state, ok := inventory.SnapState("jq")
+	if !ok || state.Channel != "latest/edge" {
+		t.Fatalf("expected: %v, got: %v", SnapState{Installed: true, Channel: "latest/edge"}, state)
+	}
+}
+
+func TestInventoryAdded(t *testing.T) {
+	inventory := NewInventory()
+	inventory.RecordGroup("ubuntu", "lxd", false)
+	inventory.RecordGroup("ubuntu", "microk8s", true)
+	inventory.RecordController("concierge-lxd", false)
+	inventory.RecordController("concierge-k8s", true)
+	inventory.RecordFile("/home/alice/.local/share/juju", false)
+	inventory.RecordFile("/home/bob/.local/share/juju", true)
+
+	if !inventory.GroupAdded("ubuntu", "lxd") || inventory.GroupAdded("ubuntu", "microk8s") || inventory.GroupAdded("ubuntu", "docker") || inventory.GroupAdded("alice", "lxd") {
+		t.Fatalf("incorrect group membership reported: %v", inventory.Groups)
+	}
+
+	if !inventory.ControllerAdded("concierge-lxd") || inventory.ControllerAdded("concierge-k8s") {
+		t.Fatalf("incorrect added controllers reported: %v", inventory.Controllers)
+	}
+
+	if !inventory.ControllerExisted("concierge-k8s") || inventory.ControllerExisted("concierge-lxd") {
+		t.Fatalf("incorrect existing controllers reported: %v", inventory.Controllers)
+	}
+
+	if !inventory.FileAdded("/home/alice/.local/share/juju") || inventory.FileAdded("/home/bob/.local/share/juju") || inventory.FileAdded("/home/carol/.local/share/juju") {
+		t.Fatalf("incorrect added files reported: %v", inventory.Files)
+	}
+}
+
+func TestNilInventory(t *testing.T) {
+	var inventory *Inventory
+
+	if inventory.RecordFile(".kube/config", true) {
+		t.Fatalf("expected nil inventory not to record items")
+	}
+	if inventory.FileExisted(".kube/config") || inventory.GroupAdded("ubuntu", "lxd") {
+		t.Fatalf("expected nil inventory to report no items")
+	}
+	if _, ok := inventory.SnapState("jq"); ok {
+		t.Fatalf("expected nil inventory to report no snaps")
+	}
+}
+
+func TestInventoryRoundTrip(t *testing.T) {
+	inventory := NewInventory()
+	inventory.RecordSnap("lxd", SnapState{Installed: true, Channel: "5.21/stable"})
+	address := "[::]:8443"
+	inventory.RecordSnapConfig("lxd", "core.https-address", &address)
+	inventory.RecordSnapConfig("lxd", "ui.enable", nil)
+	inventory.RecordSnapConnection("lxd", "lxd:network-control")
+	inventory.RecordSnapAlias("lxd", "lxc")
+	inventory.RecordDeb("cowsay", true)
+	inventory.RecordDebHold("cowsay", false)
+	inventory.RecordDebFile("./internal-tool_1.0_amd64.deb", "internal-tools")
+	inventory.RecordFile(".kube/config", false)
+	inventory.RecordFileAttributes("/etc/docker/daemon.json", FileAttributes{Mode: "644", Owner: "root:root"})
+
+	contents, err := yaml.Marshal(&Config{Inventory: inventory})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &Config{}
+	err = yaml.Unmarshal(contents, loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(inventory.Snaps, loaded.Inventory.Snaps) {
+		t.Fatalf("expected: %v, got: %v", inventory.Snaps, loaded.Inventory.Snaps)
+	}
+	if !reflect.DeepEqual(inventory.Debs, loaded.Inventory.Debs) {
+		t.Fatalf("expected: %v, got: %v", inventory.Debs, loaded.Inventory.Debs)
+	}
+	if !reflect.DeepEqual(inventory.DebHolds, loaded.Inventory.DebHolds) {
+		t.Fatalf("expected: %v, got: %v", inventory.DebHolds, loaded.Inventory.DebHolds)
+	}
+	if !reflect.DeepEqual(inventory.DebFiles, loaded.Inventory.DebFiles) {
+		t.Fatalf("expected: %v, got: %v", inventory.DebFiles, loaded.Inventory.DebFiles)
+	}
+	if !reflect.DeepEqual(inventory.Files, loaded.Inventory.Files) {
+		t.Fatalf("expected: %v, got: %v", inventory.Files, loaded.Inventory.Files)
+	}
+	if !reflect.DeepEqual(inventory.Attributes, loaded.Inventory.Attributes) {
+		t.Fatalf("expected: %v, got: %v", inventory.Attributes, loaded.Inventory.Attributes)
+	}
+}
+
+func TestInventoryRecordSnapConfig(t *testing.T) {
+	inventory := NewInventory()
+
+	if inventory.RecordSnapConfig("lxd", "ui.enable", nil) {
+		t.Fatalf("expected config of unrecorded snap to be ignored")
+	}
+
+	inventory.RecordSnap("lxd", SnapState{Installed: true, Channel: "5.21/stable"})
+
+	original, changed := "false", "true"
+	if !inventory.RecordSnapConfig("lxd", "ui.enable", &original) {
+		t.Fatalf("expected first observation of snap config to be recorded")
+	}
+	if inventory.RecordSnapConfig("lxd", "ui.enable", &changed) {
+		t.Fatalf("expected second observation of snap config to be ignored")
+	}
+
+	state, _ := inventory.SnapState("lxd")
+	if value := state.Config["ui.enable"]; value == nil || *value != "false" {
+		t.Fatalf("expected: %v, got: %v", original, value)
+	}
+}
+
+func TestInventoryRecordSnapConnection(t *testing.T) {
+	inventory := NewInventory()
+
+	if inventory.RecordSnapConnection("jhack", "jhack:dot-local-share-juju") {
+		t.Fatalf("expected connection of unrecorded snap to be ignored")
+	}
+
+	inventory.RecordSnap("jhack", SnapState{Installed: true, Channel: "latest/edge"})
+	inventory.RecordSnapConnection("jhack", "jhack:dot-local-share-juju")
+	inventory.RecordSnapConnection("jhack", "jhack:ssh-read")
+	inventory.RecordSnapConnection("jhack", "jhack:dot-local-share-juju")
+
+	state, _ := inventory.SnapState("jhack")
+	expected := []string{"jhack:dot-local-share-juju", "jhack:ssh-read"}
+	if !reflect.DeepEqual(expected, state.Connections) {
+		t.Fatalf("expected: %v, got: %v", expected, state.Connections)
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// NewJournal constructs a new, empty journal.
+func NewJournal() *Journal {
+	return &Journal{Steps: map[string]string{}}
+}
+
+// Journal records the steps completed by `concierge prepare`, along with a digest of the
+// inputs to each step, such that a failed run can be resumed without repeating the steps
+// that already succeeded.
+type Journal struct {
+	// Steps maps the name of each completed step to a digest of its inputs.
+	Steps map[string]string `mapstructure:"steps"`
+
+	// onComplete is called with a copy of the journal each time a step completes.
+	onComplete func(*Journal)
+
+	mtx sync.Mutex
+}
+
+// OnComplete registers a function that is called with a copy of the journal each time a step
+// completes, such that the journal can be saved as the run progresses. Calls are made one at
+// a time, in the order in which the steps complete.
+func (j *Journal) OnComplete(fn func(*Journal)) {
+	if j == nil {
+		return
+	}
+
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	j.onComplete = fn
+}
+
+// Complete records that a step completed successfully with the specified inputs.
+func (j *Journal) Complete(step string, inputs ...interface{}) {
+	if j == nil {
+		return
+	}
+
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if j.Steps == nil {
+		j.Steps = map[string]string{}
+	}
+
+	j.Steps[step] = digest(inputs)
+
+	if j.onComplete != nil {
+		j.onComplete(&Journal{Steps: maps.Clone(j.Steps)})
+	}
+}
+
+// Completed reports whether a step has previously completed with identical inputs.
+func (j *Journal) Completed(step string, inputs ...interface{}) bool {
+	if j == nil {
+		return false
+	}
+
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	d, ok := j.Steps[step]
+	return ok && d == digest(inputs)
+}
+
+// digest computes a stable digest of a set of step inputs. Maps are formatted with their
+// keys sorted, so the digest does not depend upon iteration order.
+func digest(inputs []interface{}) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%v", inputs)))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestJournalCompleted(t *testing.T) {
+	journal := NewJournal()
+	journal.Complete("snap/jq", "latest/stable", []string{"jq:home"})
+
+	if !journal.Completed("snap/jq", "latest/stable", []string{"jq:home"}) {
+		t.Fatalf("expected step with identical inputs to be completed")
+	}
+	if journal.Completed("snap/jq", "latest/edge", []string{"jq:home"}) {
+		t.Fatalf("expected step with changed inputs not to be completed")
+	}
+	if journal.Completed("snap/yq", "latest/stable") {
+		t.Fatalf("expected unknown step not to be completed")
+	}
+}
+
+func TestJournalDigestIsStable(t *testing.T) {
+	journal := NewJournal()
+	journal.Complete("controller/concierge-lxd", map[string]string{"a": "1", "b": "2", "c": "3"})
+
+	contents, err := yaml.Marshal(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded Journal
+	err = yaml.Unmarshal(contents, &loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !loaded.Completed("controller/concierge-lxd", map[string]string{"c": "3", "b": "2", "a": "1"}) {
+		t.Fatalf("expected step to be completed after reloading journal: %v", loaded.Steps)
+	}
+}
+
+func TestJournalOnComplete(t *testing.T) {
+	journal := NewJournal()
+
+	saved := []int{}
+	journal.OnComplete(func(j *Journal) {
+		saved = append(saved, len(j.Steps))
+	})
+
+	journal.Complete("deb/cowsay")
+	journal.Complete("snap/jq", "latest/stable")
+
+	if !reflect.DeepEqual([]int{1, 2}, saved) {
+		t.Fatalf("expected: %v, got: %v", []int{1, 2}, saved)
+	}
+}
+
+func TestNilJournal(t *testing.T) {
+	var journal *Journal
+	journal.Complete("deb/cowsay")
+
+	if journal.Completed("deb/cowsay") {
+		t.Fatalf("expected nil journal to report no completed steps")
+	}
+}
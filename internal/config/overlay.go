@@ -0,0 +1,123 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// overlayConfig returns a new configuration in which the juju, providers and host sections
+// of a config file are deep-merged over those of a base configuration, such as a preset.
+// The base configuration is not modified.
+//
+// The settings are the raw contents of the config file, and are used to determine which
+// values were set explicitly. The merge follows these rules:
+//
+//   - Maps, such as snaps and model-defaults, are merged key by key in the same way as
+//     MergeMaps, with the values from the config file taking precedence.
+//   - Lists, such as packages and addons, are appended to the list in the base, skipping
+//     any items that are already present.
+//   - Other values, such as channels and the 'enable' flag of providers, replace the value in
+//     the base only if they are set in the config file. Setting 'enable: false' disables a
+//     provider inherited from the base.
+func overlayConfig(base *Config, overlay *Config, settings map[string]interface{}) *Config {
+	merged := fileConfig{Juju: base.Juju, Providers: base.Providers, Host: base.Host}
+	sections := fileConfig{Juju: overlay.Juju, Providers: overlay.Providers, Host: overlay.Host}
+
+	mergeValue(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(sections), nil, settings)
+
+	conf := *overlay
+	conf.Juju = merged.Juju
+	conf.Providers = merged.Providers
+	conf.Host = merged.Host
+
+	return &conf
+}
+
+// mergeValue merges the overlay value into the base value, which must be settable. New maps
+// and slices are allocated rather than modifying those in the base, which may be shared.
+func mergeValue(base reflect.Value, overlay reflect.Value, keys []string, settings map[string]interface{}) {
+	switch base.Kind() {
+	case reflect.Struct:
+		for i := 0; i < base.NumField(); i++ {
+			tag := strings.Split(base.Type().Field(i).Tag.Get("mapstructure"), ",")[0]
+			if tag == "" || tag == "-" {
+				continue
+			}
+			mergeValue(base.Field(i), overlay.Field(i), append(keys, tag), settings)
+		}
+
+	case reflect.Map:
+		if overlay.IsNil() {
+			return
+		}
+
+		merged := reflect.MakeMap(base.Type())
+		for _, k := range base.MapKeys() {
+			merged.SetMapIndex(k, base.MapIndex(k))
+		}
+
+		elemKind := base.Type().Elem().Kind()
+		for _, k := range overlay.MapKeys() {
+			existing := merged.MapIndex(k)
+
+			// Complex values present in both maps are merged, rather than replaced.
+			if existing.IsValid() && (elemKind == reflect.Struct || elemKind == reflect.Map || elemKind == reflect.Slice) {
+				value := reflect.New(base.Type().Elem()).Elem()
+				value.Set(existing)
+				mergeValue(value, overlay.MapIndex(k), append(keys, k.String()), settings)
+				merged.SetMapIndex(k, value)
+				continue
+			}
+
+			merged.SetMapIndex(k, overlay.MapIndex(k))
+		}
+
+		base.Set(merged)
+
+	case reflect.Slice:
+		if overlay.Len() == 0 {
+			return
+		}
+
+		merged := reflect.MakeSlice(base.Type(), 0, base.Len()+overlay.Len())
+		items := []interface{}{}
+
+		for _, s := range []reflect.Value{base, overlay} {
+			for i := 0; i < s.Len(); i++ {
+				item := s.Index(i)
+				if slices.ContainsFunc(items, func(v interface{}) bool { return reflect.DeepEqual(v, item.Interface()) }) {
+					continue
+				}
+				items = append(items, item.Interface())
+				merged = reflect.Append(merged, item)
+			}
+		}
+
+		base.Set(merged)
+
+	default:
+		if isSet(settings, keys) {
+			base.Set(overlay)
+		}
+	}
+}
+
+// isSet reports whether the value at the specified path is set in a set of raw settings.
+func isSet(settings map[string]interface{}, keys []string) bool {
+	var current interface{} = settings
+
+	for _, k := range keys {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return false
+		}
+
+		current, ok = m[k]
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-viper/mapstructure/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// parseOverlay decodes a config file in the same way as viper, returning both the config and
+// its raw settings.
+func parseOverlay(t *testing.T, contents string) (*Config, map[string]interface{}) {
+	settings := map[string]interface{}{}
+	err := yaml.Unmarshal([]byte(contents), &settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{}
+	err = mapstructure.WeakDecode(settings, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conf, settings
+}
+
+func TestOverlayConfig(t *testing.T) {
+	overlay, settings := parseOverlay(t, `
+base: k8s
+juju:
+  model-defaults:
+    logging-config: "<root>=DEBUG"
+providers:
+  lxd:
+    enable: false
+  k8s:
+    channel: 1.32-classic/stable
+    features:
+      load-balancer:
+        cidrs: 10.43.46.0/28
+host:
+  packages:
+    - python3-venv
+    - make
+  snaps:
+    jq:
+      channel: latest/edge
+    astral-uv:
+      channel: latest/stable
+`)
+
+	base, _ := Preset("k8s")
+	presetSnaps := len(base.Host.Snaps)
+
+	conf := overlayConfig(base, overlay, settings)
+
+	expectedModelDefaults := map[string]string{
+		"test-mode":                 "true",
+		"automatically-retry-hooks": "false",
+		"logging-config":            "<root>=DEBUG",
+	}
+	if !reflect.DeepEqual(expectedModelDefaults, conf.Juju.ModelDefaults) {
+		t.Fatalf("expected: %v, got: %v", expectedModelDefaults, conf.Juju.ModelDefaults)
+	}
+
+	if conf.Providers.LXD.Enable {
+		t.Fatalf("expected lxd to be disabled by the overlay")
+	}
+
+	if !conf.Providers.K8s.Enable || !conf.Providers.K8s.Bootstrap || conf.Providers.K8s.Channel != "1.32-classic/stable" {
+		t.Fatalf("unexpected k8s config: %+v", conf.Providers.K8s)
+	}
+
+	expectedLoadBalancer := map[string]string{"l2-mode": "true", "cidrs": "10.43.46.0/28"}
+	if !reflect.DeepEqual(expectedLoadBalancer, conf.Providers.K8s.Features["load-balancer"]) {
+		t.Fatalf("expected: %v, got: %v", expectedLoadBalancer, conf.Providers.K8s.Features["load-balancer"])
+	}
+
+	expectedPackages := []string{"python3-pip", "python3-venv", "make"}
+	if !reflect.DeepEqual(expectedPackages, conf.Host.Packages) {
+		t.Fatalf("expected: %v, got: %v", expectedPackages, conf.Host.Packages)
+	}
+
+	expectedSnaps := MergeMaps(base.Host.Snaps, map[string]SnapConfig{
+		"jq":        {Channel: "latest/edge"},
+		"astral-uv": {Channel: "latest/stable"},
+	})
+	if !reflect.DeepEqual(expectedSnaps, conf.Host.Snaps) {
+		t.Fatalf("expected: %v, got: %v", expectedSnaps, conf.Host.Snaps)
+	}
+
+	// The preset itself must not be modified by the overlay.
+	if len(base.Host.Snaps) != presetSnaps || base.Host.Snaps["jq"].Channel != "latest/stable" || !base.Providers.LXD.Enable {
+		t.Fatalf("expected preset to be unmodified, got: %+v", base)
+	}
+}
+
+func TestOverlayConfigLists(t *testing.T) {
+	overlay, settings := parseOverlay(t, `
+providers:
+  microk8s:
+    addons:
+      - dns
+      - ingress
+host:
+  snaps:
+    jhack:
+      connections:
+        - jhack:ssh-read
+`)
+
+	base, _ := Preset("microk8s")
+	base.Host.Snaps = MergeMaps(base.Host.Snaps, map[string]SnapConfig{
+		"jhack": {Channel: "latest/stable", Connections: []string{"jhack:dot-local-share-juju"}},
+	})
+
+	conf := overlayConfig(base, overlay, settings)
+
+	expectedAddons := []string{"hostpath-storage", "dns", "rbac", "metallb:10.64.140.43-10.64.140.49", "ingress"}
+	if !reflect.DeepEqual(expectedAddons, conf.Providers.MicroK8s.Addons) {
+		t.Fatalf("expected: %v, got: %v", expectedAddons, conf.Providers.MicroK8s.Addons)
+	}
+
+	expectedJhack := SnapConfig{
+		Channel:     "latest/stable",
+		Connections: []string{"jhack:dot-local-share-juju", "jhack:ssh-read"},
+	}
+	if !reflect.DeepEqual(expectedJhack, conf.Host.Snaps["jhack"]) {
+		t.Fatalf("expected: %v, got: %v", expectedJhack, conf.Host.Snaps["jhack"])
+	}
+}
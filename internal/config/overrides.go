@@ -1,17 +1,20 @@
 package config
 
 type ConfigOverrides struct {
-	DisableJuju       bool
-	K8sChannel        string
-	JujuChannel       string
-	MicroK8sChannel   string
-	LXDChannel        string
-	CharmcraftChannel string
-	SnapcraftChannel  string
-	RockcraftChannel  string
+	DisableJuju       bool   `mapstructure:"disable-juju"`
+	K8sChannel        string `mapstructure:"k8s-channel"`
+	JujuChannel       string `mapstructure:"juju-channel"`
+	JujuAgentVersion  string `mapstructure:"juju-agent-version"`
+	MicroK8sChannel   string `mapstructure:"microk8s-channel"`
+	LXDChannel        string `mapstructure:"lxd-channel"`
+	CharmcraftChannel string `mapstructure:"charmcraft-channel"`
+	SnapcraftChannel  string `mapstructure:"snapcraft-channel"`
+	RockcraftChannel  string `mapstructure:"rockcraft-channel"`
 
-	GoogleCredentialFile string
+	GoogleCredentialFile string `mapstructure:"google-credential-file"`
 
-	ExtraSnaps []string
-	ExtraDebs  []string
+	ExtraSnaps []string `mapstructure:"extra-snaps"`
+	ExtraDebs  []string `mapstructure:"extra-debs"`
+
+	Users []string `mapstructure:"users"`
 }
@@ -1,23 +1,18 @@
 package config
 
-import "fmt"
-
-// Preset returns a configuration preset by name.
+// Preset returns a configuration preset by name. Built-in presets are checked first, followed
+// by user presets in each of the directories returned by PresetDirs.
 func Preset(preset string) (*Config, error) {
-	switch preset {
-	case "k8s":
-		return k8sPreset, nil
-	case "microk8s":
-		return microk8sPreset, nil
-	case "machine":
-		return machinePreset, nil
-	case "dev":
-		return devPreset, nil
-	case "crafts":
-		return craftsPreset, nil
-	default:
-		return nil, fmt.Errorf("unknown preset '%s'", preset)
-	}
+	return loadPreset(preset, 0)
+}
+
+// builtinPresets maps the name of each built-in preset to its configuration.
+var builtinPresets = map[string]*Config{
+	"crafts":   craftsPreset,
+	"dev":      devPreset,
+	"k8s":      k8sPreset,
+	"machine":  machinePreset,
+	"microk8s": microk8sPreset,
 }
 
 // defaultJujuConfig is the default Juju config for all presets.
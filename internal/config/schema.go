@@ -0,0 +1,154 @@
+package config
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+)
+
+// SchemaURL is the location at which the JSON Schema for concierge's config file is published.
+const SchemaURL = "https://raw.githubusercontent.com/jnsgruk/concierge/main/concierge.schema.json"
+
+// channelPattern is a regular expression that matches valid snap channels.
+const channelPattern = `^[a-zA-Z0-9][a-zA-Z0-9._+-]*(/[a-zA-Z0-9][a-zA-Z0-9._+-]*){0,2}$`
+
+// schemaPatterns maps the path of a value in the config file to a regular expression that
+// the value must match. Paths are matched using path.Match.
+var schemaPatterns = map[string]string{
+	"juju/channel":                            channelPattern,
+	"providers/*/channel":                     channelPattern,
+	"host/snaps/*/channel":                    channelPattern,
+	"providers/microk8s/addons/*":             addonRegex.String(),
+	"providers/*/controllers/*/name":          jujuNameRegex.String(),
+	"providers/*/controllers/*/models/*/name": jujuNameRegex.String(),
+	"juju/agent-version":                      agentVersionRegex.String(),
+	"providers/*/agent-version":               agentVersionRegex.String(),
+	"providers/*/controllers/*/agent-version": agentVersionRegex.String(),
+	"providers/k8s/nodes/*/resources/memory":  sizeRegex.String(),
+	"providers/k8s/nodes/*/resources/disk":    sizeRegex.String(),
+	"host/snaps/*/path":                       snapPathRegex.String(),
+	"host/snaps/*/aliases/*":                  snapAppRegex.String(),
+	"host/apt/ppas/*":                         ppaRegex.String(),
+	"host/apt/sources/*/uris/*":               aptURIRegex.String(),
+	"host/packages/*":                         debSpecRegex.String(),
+	"host/apt/holds/*":                        debNameRegex.String(),
+	"host/apt/pins/*":                         aptPinRegex.String(),
+	"host/python-tools/*":                     pythonToolRegex.String(),
+	"host/binaries/*/url":                     binaryURLRegex.String(),
+	"host/binaries/*/sha256":                  sha256Regex.String(),
+	"host/files/*/path":                       filePathRegex.String(),
+	"host/files/*/mode":                       fileModeRegex.String(),
+	"host/files/*/owner":                      fileOwnerRegex.String(),
+	"host/users/*":                            usernameRegex.String(),
+}
+
+// schemaEnums maps the path of a value in the config file to the set of values it may take.
+var schemaEnums = map[string][]string{
+	"providers/k8s/nodes/*/role": K8sNodeRoles,
+	"host/snaps/*/services/*":    SnapServiceActions,
+	"host/python-tool-installer": PythonToolInstallers,
+	"host/binaries/*/scope":      BinaryScopes,
+}
+
+// schemaKeyPatterns maps the path of a mapping in the config file to a regular expression that
+// each of its keys must match.
+var schemaKeyPatterns = map[string]string{
+	"host/snaps/*/config":  snapOptionRegex.String(),
+	"host/snaps/*/aliases": snapAliasRegex.String(),
+	"host/apt/sources":     jujuNameRegex.String(),
+	"host/apt/pins":        debNameRegex.String(),
+	"host/binaries":        binaryNameRegex.String(),
+}
+
+// schemaKeys maps the path of a mapping in the config file to the set of keys it may contain.
+var schemaKeys = map[string][]string{
+	"providers/k8s/features": K8sFeatures,
+}
+
+// Schema returns a JSON Schema describing concierge's config file, generated from the
+// Config struct, which can be used by editors to validate and autocomplete config files.
+func Schema() ([]byte, error) {
+	schema := schemaFor(reflect.TypeOf(fileConfig{}), nil)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["$id"] = SchemaURL
+	schema["title"] = "concierge configuration"
+
+	content, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(content, '\n'), nil
+}
+
+// schemaFor returns the JSON Schema for a value of the specified type at the specified path
+// in the config file.
+func schemaFor(t reflect.Type, keys []string) map[string]interface{} {
+	p := path.Join(keys...)
+
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for name, field := range structFields(t) {
+			properties[name] = schemaFor(field, append(keys, name))
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+
+	case reflect.Map:
+		values := schemaFor(t.Elem(), append(keys, "*"))
+
+		// Values in maps, such as model-defaults, are often unquoted numbers or booleans.
+		if _, ok := values["pattern"]; t.Elem().Kind() == reflect.String && !ok {
+			values["type"] = []string{"string", "number", "boolean"}
+		}
+
+		schema := map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": values,
+		}
+		for pattern, allowed := range schemaKeys {
+			if ok, _ := path.Match(pattern, p); ok {
+				schema["propertyNames"] = map[string]interface{}{"enum": allowed}
+			}
+		}
+		for pattern, regex := range schemaKeyPatterns {
+			if ok, _ := path.Match(pattern, p); ok {
+				schema["propertyNames"] = map[string]interface{}{"pattern": regex}
+			}
+		}
+		return schema
+
+	case reflect.Slice:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": schemaFor(t.Elem(), append(keys, "*")),
+		}
+
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+
+	case reflect.Int:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+
+	case reflect.String:
+		schema := map[string]interface{}{"type": "string"}
+		for pattern, regex := range schemaPatterns {
+			if ok, _ := path.Match(pattern, p); ok {
+				schema["pattern"] = regex
+			}
+		}
+		for pattern, allowed := range schemaEnums {
+			if ok, _ := path.Match(pattern, p); ok {
+				schema["enum"] = allowed
+			}
+		}
+		return schema
+
+	default:
+		return map[string]interface{}{}
+	}
+}
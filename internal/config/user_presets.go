@@ -0,0 +1,221 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxPresetDepth is the maximum number of presets that can be chained using 'base'.
+const maxPresetDepth = 10
+
+// systemPresetDir is the directory in which system-wide user presets are stored.
+var systemPresetDir = filepath.Join("/etc", "concierge", "presets.d")
+
+// PresetInfo describes a preset available to concierge.
+type PresetInfo struct {
+	// Name is the name used to select the preset.
+	Name string
+	// Source is either "built-in", or the path of the file that defines the preset.
+	Source string
+}
+
+// PresetDirs returns the directories searched for user presets, in order of precedence:
+// each directory in $CONCIERGE_PRESET_PATH, then ~/.config/concierge/presets, then
+// /etc/concierge/presets.d.
+func PresetDirs() []string {
+	dirs := []string{}
+
+	if presetPath := os.Getenv("CONCIERGE_PRESET_PATH"); presetPath != "" {
+		for _, d := range filepath.SplitList(presetPath) {
+			if d != "" {
+				dirs = append(dirs, d)
+			}
+		}
+	}
+
+	home, err := homeDir()
+	if err != nil {
+		slog.Debug("Unable to determine home directory for user presets", "error", err.Error())
+	} else {
+		dirs = append(dirs, filepath.Join(home, ".config", "concierge", "presets"))
+	}
+
+	return append(dirs, systemPresetDir)
+}
+
+// ListPresets returns the built-in presets, followed by any user presets. User presets with
+// the same name as a built-in preset, or a preset in a directory of higher precedence, are
+// omitted since they cannot be selected.
+func ListPresets() ([]PresetInfo, error) {
+	presets := []PresetInfo{}
+	seen := []string{}
+
+	names := []string{}
+	for name := range builtinPresets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		presets = append(presets, PresetInfo{Name: name, Source: "built-in"})
+		seen = append(seen, name)
+	}
+
+	for _, dir := range PresetDirs() {
+		files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list presets in '%s': %w", dir, err)
+		}
+
+		for _, f := range files {
+			name := strings.TrimSuffix(filepath.Base(f), ".yaml")
+			if slices.Contains(seen, name) {
+				slog.Debug("Preset is shadowed by another preset", "preset", name, "path", f)
+				continue
+			}
+
+			presets = append(presets, PresetInfo{Name: name, Source: f})
+			seen = append(seen, name)
+		}
+	}
+
+	return presets, nil
+}
+
+// RenderPreset returns the juju, providers and host sections of a configuration as YAML, in the
+// same format as a config file. Empty fields are omitted.
+func RenderPreset(conf *Config) ([]byte, error) {
+	sections := fileConfig{Juju: conf.Juju, Providers: conf.Providers, Host: conf.Host}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+
+	err := encoder.Encode(renderValue(reflect.ValueOf(sections)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal configuration as yaml: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// loadPreset returns a built-in preset, or loads a user preset from disk. The depth is the
+// number of presets that have been followed using 'base', and guards against cycles.
+func loadPreset(name string, depth int) (*Config, error) {
+	if depth > maxPresetDepth {
+		return nil, fmt.Errorf("too many levels of preset bases when loading preset '%s'", name)
+	}
+
+	if preset, ok := builtinPresets[name]; ok {
+		return preset, nil
+	}
+
+	for _, dir := range PresetDirs() {
+		presetPath := filepath.Join(dir, fmt.Sprintf("%s.yaml", name))
+		if _, err := os.Stat(presetPath); err != nil {
+			continue
+		}
+
+		slog.Debug("User preset found", "preset", name, "path", presetPath)
+
+		preset, err := loadPresetFile(presetPath, depth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load preset '%s': %w", name, err)
+		}
+		return preset, nil
+	}
+
+	return nil, fmt.Errorf("unknown preset '%s'", name)
+}
+
+// loadPresetFile parses a user preset, merging it over its base preset if one is specified.
+func loadPresetFile(presetPath string, depth int) (*Config, error) {
+	contents, err := os.ReadFile(presetPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read preset file: %w", err)
+	}
+
+	err = Validate(contents, presetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	conf, settings, err := decodeConfig(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse preset file: %w", err)
+	}
+
+	if len(conf.Base) == 0 {
+		return conf, nil
+	}
+
+	base, err := loadPreset(conf.Base, depth+1)
+	if err != nil {
+		return nil, err
+	}
+
+	return overlayConfig(base, conf, settings), nil
+}
+
+// homeDir returns the home directory of the user who ran concierge, which may differ from the
+// current user when concierge is executed with `sudo`.
+func homeDir() (string, error) {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		u, err := user.Lookup(sudoUser)
+		if err != nil {
+			return "", err
+		}
+		return u.HomeDir, nil
+	}
+
+	return os.UserHomeDir()
+}
+
+// renderValue converts a configuration value into maps keyed by the same field names used in
+// the config file, omitting empty struct fields.
+func renderValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Struct:
+		m := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			tag := strings.Split(v.Type().Field(i).Tag.Get("mapstructure"), ",")[0]
+			field := v.Field(i)
+
+			if tag == "" || tag == "-" || field.IsZero() {
+				continue
+			}
+			if (field.Kind() == reflect.Map || field.Kind() == reflect.Slice) && field.Len() == 0 {
+				continue
+			}
+
+			m[tag] = renderValue(field)
+		}
+		return m
+
+	case reflect.Map:
+		m := map[string]interface{}{}
+		for _, k := range v.MapKeys() {
+			m[k.String()] = renderValue(v.MapIndex(k))
+		}
+		return m
+
+	case reflect.Slice:
+		s := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			s = append(s, renderValue(v.Index(i)))
+		}
+		return s
+
+	default:
+		return v.Interface()
+	}
+}
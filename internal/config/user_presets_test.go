@@ -0,0 +1,124 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setupPresetDirs creates a directory of user presets, and points concierge at it.
+func setupPresetDirs(t *testing.T, presets map[string]string) string {
+	dir := t.TempDir()
+
+	for name, contents := range presets {
+		err := os.WriteFile(filepath.Join(dir, name+".yaml"), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("CONCIERGE_PRESET_PATH", dir)
+	t.Setenv("SUDO_USER", "")
+	t.Setenv("HOME", t.TempDir())
+
+	return dir
+}
+
+func TestUserPreset(t *testing.T) {
+	setupPresetDirs(t, map[string]string{
+		"team": `
+base: machine
+host:
+  snaps:
+    astral-uv:
+      channel: latest/stable
+`,
+		"team-edge": `
+base: team
+juju:
+  channel: 3.6/edge
+`,
+	})
+
+	preset, err := Preset("team-edge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preset.Juju.Channel != "3.6/edge" {
+		t.Fatalf("expected: %v, got: %v", "3.6/edge", preset.Juju.Channel)
+	}
+
+	if _, ok := preset.Host.Snaps["astral-uv"]; !ok {
+		t.Fatalf("expected snap from intermediate preset, got: %v", preset.Host.Snaps)
+	}
+
+	if !preset.Providers.LXD.Enable || !preset.Providers.LXD.Bootstrap {
+		t.Fatalf("expected LXD config from machine preset, got: %+v", preset.Providers.LXD)
+	}
+}
+
+func TestUserPresetErrors(t *testing.T) {
+	setupPresetDirs(t, map[string]string{
+		"loop":    "base: loop\n",
+		"invalid": "providers:\n  lxd:\n    enabel: true\n",
+	})
+
+	_, err := Preset("loop")
+	if err == nil || !strings.Contains(err.Error(), "too many levels of preset bases") {
+		t.Fatalf("expected error for preset cycle, got: %v", err)
+	}
+
+	_, err = Preset("invalid")
+	if err == nil || !strings.Contains(err.Error(), "invalid.yaml:3:5: unknown key 'enabel'") {
+		t.Fatalf("expected validation error, got: %v", err)
+	}
+
+	_, err = Preset("missing")
+	if err == nil || err.Error() != "unknown preset 'missing'" {
+		t.Fatalf("expected unknown preset error, got: %v", err)
+	}
+}
+
+func TestListPresets(t *testing.T) {
+	dir := setupPresetDirs(t, map[string]string{
+		"team": "base: k8s\n",
+		"dev":  "base: k8s\n",
+	})
+
+	presets, err := ListPresets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []PresetInfo{
+		{Name: "crafts", Source: "built-in"},
+		{Name: "dev", Source: "built-in"},
+		{Name: "k8s", Source: "built-in"},
+		{Name: "machine", Source: "built-in"},
+		{Name: "microk8s", Source: "built-in"},
+		{Name: "team", Source: filepath.Join(dir, "team.yaml")},
+	}
+
+	if !reflect.DeepEqual(expected, presets) {
+		t.Fatalf("expected: %v, got: %v", expected, presets)
+	}
+}
+
+func TestRenderPreset(t *testing.T) {
+	for name := range builtinPresets {
+		preset, _ := Preset(name)
+
+		content, err := RenderPreset(preset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Validate(content, name)
+		if err != nil {
+			t.Fatalf("expected rendered preset '%s' to be valid, got: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,644 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig represents the sections of the configuration that can be set in a config file.
+type fileConfig struct {
+	Base      string         `mapstructure:"base"`
+	Juju      jujuConfig     `mapstructure:"juju"`
+	Providers providerConfig `mapstructure:"providers"`
+	Host      hostConfig     `mapstructure:"host"`
+}
+
+// K8sFeatures is the list of features that can be enabled on the k8s provider.
+var K8sFeatures = []string{
+	"dns",
+	"gateway",
+	"ingress",
+	"load-balancer",
+	"local-storage",
+	"metrics-server",
+	"network",
+}
+
+// K8sNodeRoles is the list of roles a K8s node can be joined to the cluster with.
+var K8sNodeRoles = []string{"control-plane", "worker"}
+
+// SnapServiceActions is the list of actions that can be taken on a snap's services.
+var SnapServiceActions = []string{"start", "stop", "enable", "disable"}
+
+// PythonToolInstallers is the list of tools that can be used to install Python tools.
+var PythonToolInstallers = []string{"uv", "pipx"}
+
+// BinaryScopes is the list of locations to which binaries can be installed.
+var BinaryScopes = []string{"system", "user"}
+
+// snapRisks is the list of valid risk levels for a snap channel.
+var snapRisks = []string{"stable", "candidate", "beta", "edge"}
+
+var (
+	channelPartRegex  = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._+-]*$`)
+	addonRegex        = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*(/[a-z0-9][a-z0-9-]*)?(:\S+)?$`)
+	jujuNameRegex     = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	sizeRegex         = regexp.MustCompile(`^[0-9]+(B|[KMGTP]i?B)$`)
+	agentVersionRegex = regexp.MustCompile(`^[0-9]+\.[0-9]+(\.[0-9]+|-[a-z]+[0-9]*)(\.[0-9]+)?$`)
+	snapOptionRegex   = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*(\.[a-z0-9]+(-[a-z0-9]+)*)*$`)
+	snapPathRegex     = regexp.MustCompile(`^\S+\.snap$`)
+	snapAliasRegex    = regexp.MustCompile(`^[a-zA-Z0-9][-_.a-zA-Z0-9]*$`)
+	snapAppRegex      = regexp.MustCompile(`^[a-zA-Z0-9](-?[a-zA-Z0-9])*$`)
+	ppaRegex          = regexp.MustCompile(`^ppa:[a-z0-9][a-z0-9.+-]*/[a-z0-9][a-z0-9.+-]*$`)
+	aptURIRegex       = regexp.MustCompile(`^[a-z][a-z0-9+.-]*://\S+$`)
+	debNameRegex      = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+	debSpecRegex      = regexp.MustCompile(`^([a-z0-9][a-z0-9+.-]+(=[0-9][A-Za-z0-9.+~:-]*|/[a-z0-9][a-z0-9.-]*)?|\S+\.deb(@sha256:[0-9a-fA-F]{64})?)$`)
+	aptPinRegex       = regexp.MustCompile(`^[0-9*][A-Za-z0-9.+~:*-]*$`)
+	binaryNameRegex   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	binaryURLRegex    = regexp.MustCompile(`^(file|https?)://\S+$`)
+	sha256Regex       = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	pythonToolRegex   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?(==[A-Za-z0-9.+!-]+)?$`)
+	filePathRegex     = regexp.MustCompile(`^\S+$`)
+	fileModeRegex     = regexp.MustCompile(`^[0-7]?[0-7]{3}$`)
+	fileOwnerRegex    = regexp.MustCompile(`^[a-z_][a-z0-9_-]*(:[a-z_][a-z0-9_-]*)?$`)
+	usernameRegex     = regexp.MustCompile(`^[a-z_][a-z0-9_-]*$`)
+)
+
+// valueValidators maps the path of a value in the config file to a function that checks
+// whether the value is valid. Paths are matched using path.Match.
+var valueValidators = map[string]func(value string) error{
+	"juju/channel":                               validateChannel,
+	"providers/*/channel":                        validateChannel,
+	"host/snaps/*/channel":                       validateChannel,
+	"providers/microk8s/addons/*":                validateAddon,
+	"providers/*/controllers/*/name":             validateJujuName,
+	"providers/*/controllers/*/models/*/name":    validateJujuName,
+	"juju/agent-version":                         validateAgentVersion,
+	"providers/*/agent-version":                  validateAgentVersion,
+	"providers/*/controllers/*/agent-version":    validateAgentVersion,
+	"juju/extra-bootstrap-args/*":                validateBootstrapArg,
+	"providers/*/extra-bootstrap-args/*":         validateBootstrapArg,
+	"providers/*/controllers/*/bootstrap-args/*": validateBootstrapArg,
+	"providers/k8s/nodes/*/role":                 validateK8sNodeRole,
+	"providers/k8s/nodes/*/resources/memory":     validateSize,
+	"providers/k8s/nodes/*/resources/disk":       validateSize,
+	"host/snaps/*/services/*":                    validateSnapServiceAction,
+	"host/snaps/*/path":                          validateSnapPath,
+	"host/snaps/*/aliases/*":                     validateSnapApp,
+	"host/apt/ppas/*":                            validatePPA,
+	"host/apt/sources/*/uris/*":                  validateAptURI,
+	"host/packages/*":                            validateDebSpec,
+	"host/apt/holds/*":                           validateDebName,
+	"host/apt/pins/*":                            validateAptPin,
+	"host/python-tools/*":                        validatePythonTool,
+	"host/python-tool-installer":                 validatePythonToolInstaller,
+	"host/binaries/*/url":                        validateBinaryURL,
+	"host/binaries/*/sha256":                     validateSHA256,
+	"host/binaries/*/scope":                      validateBinaryScope,
+	"host/files/*/path":                          validateFilePath,
+	"host/files/*/mode":                          validateFileMode,
+	"host/files/*/owner":                         validateFileOwner,
+	"host/users/*":                               validateUsername,
+}
+
+// keyValidators maps the path of a mapping in the config file to a function that checks
+// whether each of its keys is valid. Paths are matched using path.Match.
+var keyValidators = map[string]func(key string) error{
+	"providers/k8s/features": validateK8sFeature,
+	"host/snaps/*/config":    validateSnapOption,
+	"host/snaps/*/aliases":   validateSnapAlias,
+	"host/apt/sources":       validateJujuName,
+	"host/apt/pins":          validateDebName,
+	"host/binaries":          validateBinaryName,
+}
+
+// ValidationError describes a single problem with a config file, and where it occurs.
+type ValidationError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+// Error returns a string representation of the validation error.
+func (e ValidationError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	if e.Column == 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// ValidationErrors is the set of problems found when validating a config file.
+type ValidationErrors []ValidationError
+
+// Error returns a string representation of the validation errors, one per line.
+func (e ValidationErrors) Error() string {
+	messages := []string{}
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Validate strictly checks the contents of a config file, rejecting unknown keys, values of
+// the wrong type, and invalid values. The file name is used only in error messages. If any
+// problems are found, a ValidationErrors is returned.
+func Validate(contents []byte, file string) error {
+	v := &validator{file: file}
+
+	var doc yaml.Node
+	err := yaml.NewDecoder(bytes.NewReader(contents)).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return ValidationErrors{{File: file, Line: yamlErrorLine(err), Message: yamlErrorMessage(err)}}
+	}
+
+	if len(doc.Content) > 0 {
+		v.walk(doc.Content[0], reflect.TypeOf(fileConfig{}), nil)
+	}
+
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+// ValidateFile strictly checks the contents of the config file at the specified path.
+func ValidateFile(filePath string) error {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("unable to read config file '%s': %w", filePath, err)
+	}
+
+	return Validate(contents, filePath)
+}
+
+// validator walks a YAML document alongside the type it should decode into, collecting
+// validation errors.
+type validator struct {
+	file   string
+	errors ValidationErrors
+}
+
+// errorf records a validation error at the position of the specified node.
+func (v *validator) errorf(node *yaml.Node, format string, args ...interface{}) {
+	v.errors = append(v.errors, ValidationError{
+		File:    v.file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// walk checks that a node can be decoded into the specified type, recursing into mappings
+// and sequences.
+func (v *validator) walk(node *yaml.Node, t reflect.Type, keys []string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	// Empty values are permitted anywhere, and leave the default in place.
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	name := strings.Join(keys, ".")
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			v.errorf(node, "expected a mapping for '%s'", name)
+			return
+		}
+
+		fields := structFields(t)
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			field, ok := fields[key.Value]
+			if !ok {
+				v.errorf(key, "unknown key '%s'%s", key.Value, suggestKey(key.Value, fields))
+				continue
+			}
+
+			v.walk(value, field, append(keys, key.Value))
+		}
+
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.errorf(node, "expected a mapping for '%s'", name)
+			return
+		}
+
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			v.validateKey(key, keys)
+			v.walk(value, t.Elem(), append(keys, key.Value))
+		}
+
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			v.errorf(node, "expected a list for '%s'", name)
+			return
+		}
+
+		for i, item := range node.Content {
+			v.walk(item, t.Elem(), append(keys, fmt.Sprint(i)))
+		}
+
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			v.errorf(node, "expected a boolean for '%s', got '%s'", name, node.Value)
+		}
+
+	case reflect.Int:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			v.errorf(node, "expected an integer for '%s', got '%s'", name, node.Value)
+		}
+
+	case reflect.String:
+		// Numbers and booleans are accepted as strings, such that values like model-defaults
+		// do not need to be quoted.
+		if node.Kind != yaml.ScalarNode {
+			v.errorf(node, "expected a string for '%s'", name)
+			return
+		}
+		// Unquoted numbers with a leading zero, such as file modes, are parsed as octal and
+		// would be converted to a different decimal string.
+		if node.Tag == "!!int" && len(node.Value) > 1 && node.Value[0] == '0' {
+			v.errorf(node, "value '%s' for '%s' must be quoted", node.Value, name)
+			return
+		}
+		v.validateValue(node, keys)
+	}
+}
+
+// validateKey runs any key validators that apply to the mapping containing the key.
+func (v *validator) validateKey(key *yaml.Node, keys []string) {
+	for pattern, validate := range keyValidators {
+		if ok, _ := path.Match(pattern, path.Join(keys...)); ok {
+			if err := validate(key.Value); err != nil {
+				v.errorf(key, "invalid key '%s' in '%s': %s", key.Value, strings.Join(keys, "."), err.Error())
+			}
+		}
+	}
+}
+
+// validateValue runs any value validators that apply to the scalar node.
+func (v *validator) validateValue(node *yaml.Node, keys []string) {
+	for pattern, validate := range valueValidators {
+		if ok, _ := path.Match(pattern, path.Join(keys...)); ok {
+			if err := validate(node.Value); err != nil {
+				v.errorf(node, "invalid value '%s' for '%s': %s", node.Value, strings.Join(keys, "."), err.Error())
+			}
+		}
+	}
+}
+
+// structFields maps the mapstructure tag of each field in a struct to the field's type.
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		fields[tag] = field.Type
+	}
+	return fields
+}
+
+// suggestKey returns a hint naming the known key closest to an unknown key, if there is one
+// that is similar enough to be a likely typo.
+func suggestKey(key string, fields map[string]reflect.Type) string {
+	candidates := []string{}
+	for candidate := range fields {
+		candidates = append(candidates, candidate)
+	}
+	slices.Sort(candidates)
+
+	best, bestDistance := "", 3
+	for _, candidate := range candidates {
+		if d := levenshtein(key, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean '%s'?)", best)
+}
+
+// levenshtein computes the edit distance between two strings.
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+
+	return previous[len(b)]
+}
+
+// validateChannel checks that a snap channel is of the form [<track>/]<risk>[/<branch>], or
+// consists of only a track.
+func validateChannel(channel string) error {
+	parts := strings.Split(channel, "/")
+	if len(parts) > 3 {
+		return fmt.Errorf("channel must be of the form [<track>/]<risk>[/<branch>]")
+	}
+
+	for _, p := range parts {
+		if !channelPartRegex.MatchString(p) {
+			return fmt.Errorf("channel must be of the form [<track>/]<risk>[/<branch>]")
+		}
+	}
+
+	switch len(parts) {
+	case 2:
+		if !slices.Contains(snapRisks, parts[0]) && !slices.Contains(snapRisks, parts[1]) {
+			return fmt.Errorf("risk must be one of: %s", strings.Join(snapRisks, ", "))
+		}
+	case 3:
+		if !slices.Contains(snapRisks, parts[1]) {
+			return fmt.Errorf("risk must be one of: %s", strings.Join(snapRisks, ", "))
+		}
+	}
+
+	return nil
+}
+
+// validateAddon checks that a MicroK8s addon is of the form <name>[:<args>].
+func validateAddon(addon string) error {
+	if !addonRegex.MatchString(addon) {
+		return fmt.Errorf("addon must be of the form <name>[:<args>]")
+	}
+	return nil
+}
+
+// validateJujuName checks that the name of a Juju controller or model, or an apt source, is
+// valid.
+func validateJujuName(name string) error {
+	if !jujuNameRegex.MatchString(name) {
+		return fmt.Errorf("name must contain only lowercase letters, digits and hyphens")
+	}
+	return nil
+}
+
+// validateAgentVersion checks that a Juju agent version is of the form <major>.<minor>.<patch>.
+func validateAgentVersion(version string) error {
+	if !agentVersionRegex.MatchString(version) {
+		return fmt.Errorf("agent version must be of the form <major>.<minor>.<patch>")
+	}
+	return nil
+}
+
+// validateBootstrapArg checks that an additional argument to `juju bootstrap` does not set the
+// agent version, which concierge must know in order to check it against the Juju client.
+func validateBootstrapArg(arg string) error {
+	for _, flag := range []string{"--agent-version", "--build-agent"} {
+		if arg == flag || strings.HasPrefix(arg, flag+"=") {
+			return fmt.Errorf("'%s' cannot be passed as a bootstrap argument, use 'agent-version' instead", flag)
+		}
+	}
+	return nil
+}
+
+// validateK8sNodeRole checks that a K8s node role is supported by the k8s snap.
+func validateK8sNodeRole(role string) error {
+	if !slices.Contains(K8sNodeRoles, role) {
+		return fmt.Errorf("role must be one of: %s", strings.Join(K8sNodeRoles, ", "))
+	}
+	return nil
+}
+
+// validateSize checks that a size is a number followed by a unit, such as '4GiB'.
+func validateSize(size string) error {
+	if !sizeRegex.MatchString(size) {
+		return fmt.Errorf("size must be a number followed by a unit, such as '4GiB'")
+	}
+	return nil
+}
+
+// validateSnapServiceAction checks that the action to take on a snap service is supported.
+func validateSnapServiceAction(action string) error {
+	if !slices.Contains(SnapServiceActions, action) {
+		return fmt.Errorf("action must be one of: %s", strings.Join(SnapServiceActions, ", "))
+	}
+	return nil
+}
+
+// validateSnapOption checks that the name of a snap configuration option is valid, such as
+// 'ui.enable' or 'core.https-address'.
+func validateSnapOption(option string) error {
+	if !snapOptionRegex.MatchString(option) {
+		return fmt.Errorf("option must contain only lowercase letters, digits and hyphens, separated by dots")
+	}
+	return nil
+}
+
+// validateSnapPath checks that the path of a local snap refers to a .snap file.
+func validateSnapPath(path string) error {
+	if !snapPathRegex.MatchString(path) {
+		return fmt.Errorf("path must refer to a file with the '.snap' extension")
+	}
+	return nil
+}
+
+// validateSnapAlias checks that the name of a snap alias is valid.
+func validateSnapAlias(alias string) error {
+	if !snapAliasRegex.MatchString(alias) {
+		return fmt.Errorf("alias must contain only letters, digits, dots, hyphens and underscores")
+	}
+	return nil
+}
+
+// validateSnapApp checks that the name of a snap application is valid.
+func validateSnapApp(app string) error {
+	if !snapAppRegex.MatchString(app) {
+		return fmt.Errorf("application name must contain only letters, digits and hyphens")
+	}
+	return nil
+}
+
+// validatePPA checks that a Launchpad PPA is of the form ppa:<owner>/<name>.
+func validatePPA(ppa string) error {
+	if !ppaRegex.MatchString(ppa) {
+		return fmt.Errorf("ppa must be of the form ppa:<owner>/<name>")
+	}
+	return nil
+}
+
+// validateAptURI checks that the URI of an apt repository includes a scheme.
+func validateAptURI(uri string) error {
+	if !aptURIRegex.MatchString(uri) {
+		return fmt.Errorf("uri must be of the form <scheme>://<path>")
+	}
+	return nil
+}
+
+// validateDebName checks that the name of an apt package is valid.
+func validateDebName(name string) error {
+	if !debNameRegex.MatchString(name) {
+		return fmt.Errorf("package name must contain only lowercase letters, digits, '+', '-' and '.'")
+	}
+	return nil
+}
+
+// validateDebSpec checks that an apt package is of the form <name>, <name>=<version> or
+// <name>/<release>, or is the path of a local .deb file with an optional checksum.
+func validateDebSpec(spec string) error {
+	if !debSpecRegex.MatchString(spec) {
+		return fmt.Errorf("package must be of the form <name>, <name>=<version>, <name>/<release> or <path>.deb[@sha256:<checksum>]")
+	}
+	return nil
+}
+
+// validateAptPin checks that the version an apt package is pinned to is valid. Versions may
+// include '*' wildcards.
+func validateAptPin(version string) error {
+	if !aptPinRegex.MatchString(version) {
+		return fmt.Errorf("pinned version must start with a digit or '*', and contain no whitespace")
+	}
+	return nil
+}
+
+// validatePythonTool checks that a Python tool is of the form <name> or <name>==<version>.
+func validatePythonTool(tool string) error {
+	if !pythonToolRegex.MatchString(tool) {
+		return fmt.Errorf("python tool must be of the form <name> or <name>==<version>")
+	}
+	return nil
+}
+
+// validatePythonToolInstaller checks that the Python tool installer is supported.
+func validatePythonToolInstaller(installer string) error {
+	if !slices.Contains(PythonToolInstallers, installer) {
+		return fmt.Errorf("installer must be one of: %s", strings.Join(PythonToolInstallers, ", "))
+	}
+	return nil
+}
+
+// validateBinaryName checks that the name a binary is installed as is a valid file name.
+func validateBinaryName(name string) error {
+	if !binaryNameRegex.MatchString(name) {
+		return fmt.Errorf("binary name must contain only letters, digits, dots, hyphens and underscores")
+	}
+	return nil
+}
+
+// validateBinaryURL checks that the URL of a binary uses a supported scheme.
+func validateBinaryURL(url string) error {
+	if !binaryURLRegex.MatchString(url) {
+		return fmt.Errorf("url must be of the form <file|http|https>://<path>")
+	}
+	return nil
+}
+
+// validateSHA256 checks that a checksum is a hex-encoded SHA-256 digest.
+func validateSHA256(checksum string) error {
+	if !sha256Regex.MatchString(checksum) {
+		return fmt.Errorf("checksum must be 64 hexadecimal characters")
+	}
+	return nil
+}
+
+// validateBinaryScope checks that the scope of a binary is supported.
+func validateBinaryScope(scope string) error {
+	if !slices.Contains(BinaryScopes, scope) {
+		return fmt.Errorf("scope must be one of: %s", strings.Join(BinaryScopes, ", "))
+	}
+	return nil
+}
+
+// validateFilePath checks that the destination of a managed file contains no whitespace, and
+// does not refer to a parent directory.
+func validateFilePath(filePath string) error {
+	if !filePathRegex.MatchString(filePath) {
+		return fmt.Errorf("file path must not be empty or contain whitespace")
+	}
+	if slices.Contains(strings.Split(filePath, "/"), "..") {
+		return fmt.Errorf("file path must not contain '..'")
+	}
+	return nil
+}
+
+// validateFileMode checks that the mode of a managed file is an octal permission, i.e. 0644.
+func validateFileMode(mode string) error {
+	if !fileModeRegex.MatchString(mode) {
+		return fmt.Errorf("mode must be an octal permission, such as 0644")
+	}
+	return nil
+}
+
+// validateFileOwner checks that the owner of a managed file is of the form <user>[:<group>].
+func validateFileOwner(owner string) error {
+	if !fileOwnerRegex.MatchString(owner) {
+		return fmt.Errorf("owner must be of the form <user> or <user>:<group>")
+	}
+	return nil
+}
+
+// validateUsername checks that a username is a valid POSIX user name.
+func validateUsername(username string) error {
+	if !usernameRegex.MatchString(username) {
+		return fmt.Errorf("username must start with a lowercase letter or '_', and contain only lowercase letters, digits, '_' and '-'")
+	}
+	return nil
+}
+
+// validateK8sFeature checks that a k8s feature is supported by the k8s snap.
+func validateK8sFeature(feature string) error {
+	if !slices.Contains(K8sFeatures, feature) {
+		return fmt.Errorf("feature must be one of: %s", strings.Join(K8sFeatures, ", "))
+	}
+	return nil
+}
+
+var yamlLineRegex = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// yamlErrorLine extracts the line number from a YAML syntax error, if present.
+func yamlErrorLine(err error) int {
+	var line int
+	if m := yamlLineRegex.FindStringSubmatch(err.Error()); m != nil {
+		fmt.Sscan(m[1], &line)
+	}
+	return line
+}
+
+// yamlErrorMessage strips the line number from a YAML syntax error, if present.
+func yamlErrorMessage(err error) string {
+	if m := yamlLineRegex.FindStringSubmatch(err.Error()); m != nil {
+		return m[2]
+	}
+	return strings.TrimPrefix(err.Error(), "yaml: ")
+}
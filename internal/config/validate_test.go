@@ -0,0 +1,330 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	type test struct {
+		config   string
+		expected []string
+	}
+
+	tests := []test{
+		{
+			config: `
+juju:
+  channel: 3.6/stable
+  agent-version: 3.6.1
+  extra-bootstrap-args: ["--config", "idle-connection-timeout=90s"]
+  model-defaults:
+    test-mode: true
+providers:
+  lxd:
+    enable: true
+    bootstrap: true
+  microk8s:
+    enable: true
+    addons:
+      - hostpath-storage
+      - metallb:10.64.140.43-10.64.140.49
+  k8s:
+    features:
+      local-storage:
+      load-balancer:
+        l2-mode: true
+host:
+  snaps:
+    jq:
+      channel: latest/edge/fix-123
+`,
+			expected: nil,
+		},
+		{
+			config: `
+providers:
+  lxd:
+    enable: true
+    bootsrap: true
+`,
+			expected: []string{"concierge.yaml:5:5: unknown key 'bootsrap' (did you mean 'bootstrap'?)"},
+		},
+		{
+			config: `
+juju:
+  disable: yes
+  model-defaults: [test-mode]
+`,
+			expected: []string{
+				"concierge.yaml:3:12: expected a boolean for 'juju.disable', got 'yes'",
+				"concierge.yaml:4:19: expected a mapping for 'juju.model-defaults'",
+			},
+		},
+		{
+			config: `
+juju:
+  channel: 3.6/stabel/branch
+  agent-version: "3.6"
+providers:
+  microk8s:
+    addons:
+      - "metallb :10.64.140.43"
+  k8s:
+    features:
+      dsn:
+host:
+  snaps:
+    jq:
+      channel: "latest stable"
+`,
+			expected: []string{
+				"concierge.yaml:3:12: invalid value '3.6/stabel/branch' for 'juju.channel': risk must be one of: stable, candidate, beta, edge",
+				"concierge.yaml:4:18: invalid value '3.6' for 'juju.agent-version': agent version must be of the form <major>.<minor>.<patch>",
+				"concierge.yaml:8:9: invalid value 'metallb :10.64.140.43' for 'providers.microk8s.addons.0': addon must be of the form <name>[:<args>]",
+				"concierge.yaml:11:7: invalid key 'dsn' in 'providers.k8s.features': feature must be one of: dns, gateway, ingress, load-balancer, local-storage, metrics-server, network",
+				"concierge.yaml:15:16: invalid value 'latest stable' for 'host.snaps.jq.channel': channel must be of the form [<track>/]<risk>[/<branch>]",
+			},
+		},
+		{
+			config: `
+providers:
+  lxd:
+    enable: true
+    bootstrap: true
+    controllers:
+      - name: lxd-one
+        bootstrap-args: ["--config", "idle-connection-timeout=90s"]
+        models:
+          - name: dev
+            config:
+              update-status-hook-interval: 10s
+      - name: Lxd_Two
+        models:
+          - name: prod
+            confg: {}
+`,
+			expected: []string{
+				"concierge.yaml:13:15: invalid value 'Lxd_Two' for 'providers.lxd.controllers.1.name': name must contain only lowercase letters, digits and hyphens",
+				"concierge.yaml:16:13: unknown key 'confg' (did you mean 'config'?)",
+			},
+		},
+		{
+			config: `
+juju:
+  extra-bootstrap-args: ["--agent-version", "3.6.1"]
+providers:
+  lxd:
+    extra-bootstrap-args: ["--build-agent"]
+    controllers:
+      - name: lxd-one
+        bootstrap-args: ["--config", "--agent-version=3.5.4"]
+        agent-version: "3.6"
+`,
+			expected: []string{
+				"concierge.yaml:3:26: invalid value '--agent-version' for 'juju.extra-bootstrap-args.0': '--agent-version' cannot be passed as a bootstrap argument, use 'agent-version' instead",
+				"concierge.yaml:6:28: invalid value '--build-agent' for 'providers.lxd.extra-bootstrap-args.0': '--build-agent' cannot be passed as a bootstrap argument, use 'agent-version' instead",
+				"concierge.yaml:9:38: invalid value '--agent-version=3.5.4' for 'providers.lxd.controllers.0.bootstrap-args.1': '--agent-version' cannot be passed as a bootstrap argument, use 'agent-version' instead",
+				"concierge.yaml:10:24: invalid value '3.6' for 'providers.lxd.controllers.0.agent-version': agent version must be of the form <major>.<minor>.<patch>",
+			},
+		},
+		{
+			config: `
+providers:
+  k8s:
+    enable: true
+    nodes:
+      - role: control-plane
+        count: 2
+      - role: master
+        count: two
+        resources:
+          cpu: 4
+          memory: 8G
+`,
+			expected: []string{
+				"concierge.yaml:8:15: invalid value 'master' for 'providers.k8s.nodes.1.role': role must be one of: control-plane, worker",
+				"concierge.yaml:9:16: expected an integer for 'providers.k8s.nodes.1.count', got 'two'",
+				"concierge.yaml:12:19: invalid value '8G' for 'providers.k8s.nodes.1.resources.memory': size must be a number followed by a unit, such as '4GiB'",
+			},
+		},
+		{
+			config: `
+host:
+  snaps:
+    lxd:
+      config:
+        core.https_address: "[::]:8443"
+        ui.enable: "true"
+      services:
+        daemon: restart
+        activate: enable
+`,
+			expected: []string{
+				"concierge.yaml:6:9: invalid key 'core.https_address' in 'host.snaps.lxd.config': option must contain only lowercase letters, digits and hyphens, separated by dots",
+				"concierge.yaml:9:17: invalid value 'restart' for 'host.snaps.lxd.services.daemon': action must be one of: start, stop, enable, disable",
+			},
+		},
+		{
+			config: `
+host:
+  snaps:
+    jhack:
+      path: ./jhack_0.4_amd64.zip
+      aliases:
+        jh: jhack
+        "j h": jhack.
+`,
+			expected: []string{
+				"concierge.yaml:5:13: invalid value './jhack_0.4_amd64.zip' for 'host.snaps.jhack.path': path must refer to a file with the '.snap' extension",
+				"concierge.yaml:8:9: invalid key 'j h' in 'host.snaps.jhack.aliases': alias must contain only letters, digits, dots, hyphens and underscores",
+				"concierge.yaml:8:16: invalid value 'jhack.' for 'host.snaps.jhack.aliases.j h': application name must contain only letters, digits and hyphens",
+			},
+		},
+		{
+			config: `
+host:
+  apt:
+    ppas:
+      - ppa:deadsnakes/ppa
+      - deadsnakes/ppa
+    sources:
+      HashiCorp:
+        uris:
+          - apt.releases.hashicorp.com
+`,
+			expected: []string{
+				"concierge.yaml:6:9: invalid value 'deadsnakes/ppa' for 'host.apt.ppas.1': ppa must be of the form ppa:<owner>/<name>",
+				"concierge.yaml:8:7: invalid key 'HashiCorp' in 'host.apt.sources': name must contain only lowercase letters, digits and hyphens",
+				"concierge.yaml:10:13: invalid value 'apt.releases.hashicorp.com' for 'host.apt.sources.HashiCorp.uris.0': uri must be of the form <scheme>://<path>",
+			},
+		},
+		{
+			config: `
+host:
+  packages:
+    - python3.12=3.12.3-1ubuntu0.1
+    - lxd-installer/noble-backports
+    - ./tool_1.0_amd64.deb@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+    - ./tool_1.0_amd64.deb@sha256:0123
+    - python3.12==3.12
+  apt:
+    pins:
+      python3.12: 3.12.*
+      Python3: latest
+    holds:
+      - python3.12
+      - python 3
+`,
+			expected: []string{
+				"concierge.yaml:7:7: invalid value './tool_1.0_amd64.deb@sha256:0123' for 'host.packages.3': package must be of the form <name>, <name>=<version>, <name>/<release> or <path>.deb[@sha256:<checksum>]",
+				"concierge.yaml:8:7: invalid value 'python3.12==3.12' for 'host.packages.4': package must be of the form <name>, <name>=<version>, <name>/<release> or <path>.deb[@sha256:<checksum>]",
+				"concierge.yaml:12:7: invalid key 'Python3' in 'host.apt.pins': package name must contain only lowercase letters, digits, '+', '-' and '.'",
+				"concierge.yaml:12:16: invalid value 'latest' for 'host.apt.pins.Python3': pinned version must start with a digit or '*', and contain no whitespace",
+				"concierge.yaml:15:9: invalid value 'python 3' for 'host.apt.holds.1': package name must contain only lowercase letters, digits, '+', '-' and '.'",
+			},
+		},
+		{
+			config: `
+host:
+  python-tools:
+    - tox==4.18.0
+    - charmcraftcache
+    - tox>=4
+  python-tool-installer: pip
+`,
+			expected: []string{
+				"concierge.yaml:6:7: invalid value 'tox>=4' for 'host.python-tools.2': python tool must be of the form <name> or <name>==<version>",
+				"concierge.yaml:7:26: invalid value 'pip' for 'host.python-tool-installer': installer must be one of: uv, pipx",
+			},
+		},
+		{
+			config: `
+host:
+  binaries:
+    kustomize:
+      url: https://mirror.example.com/kustomize_v5.4.3_linux_amd64.tar.gz
+      sha256: 3669470b454d865c8184d6bce78df05e977c9aea31c30df3c669317d43bcc7a7
+      member: kustomize
+      scope: user
+    "helm plugin":
+      url: mirror.example.com/helm
+      sha256: abc123
+      scope: global
+`,
+			expected: []string{
+				"concierge.yaml:9:5: invalid key 'helm plugin' in 'host.binaries': binary name must contain only letters, digits, dots, hyphens and underscores",
+				"concierge.yaml:10:12: invalid value 'mirror.example.com/helm' for 'host.binaries.helm plugin.url': url must be of the form <file|http|https>://<path>",
+				"concierge.yaml:11:15: invalid value 'abc123' for 'host.binaries.helm plugin.sha256': checksum must be 64 hexadecimal characters",
+				"concierge.yaml:12:14: invalid value 'global' for 'host.binaries.helm plugin.scope': scope must be one of: system, user",
+			},
+		},
+		{
+			config: `
+host:
+  files:
+    - path: ~/.config/charmcraft/config.yaml
+      content: foo
+      mode: "0600"
+      owner: ubuntu:ubuntu
+    - path: /etc/my file
+      source: ./daemon.json
+      mode: 0644
+    - path: ../outside
+      content: foo
+      mode: "999"
+      owner: Ubuntu
+`,
+			expected: []string{
+				"concierge.yaml:8:13: invalid value '/etc/my file' for 'host.files.1.path': file path must not be empty or contain whitespace",
+				"concierge.yaml:10:13: value '0644' for 'host.files.1.mode' must be quoted",
+				"concierge.yaml:11:13: invalid value '../outside' for 'host.files.2.path': file path must not contain '..'",
+				"concierge.yaml:13:13: invalid value '999' for 'host.files.2.mode': mode must be an octal permission, such as 0644",
+				"concierge.yaml:14:14: invalid value 'Ubuntu' for 'host.files.2.owner': owner must be of the form <user> or <user>:<group>",
+			},
+		},
+		{
+			config: `
+juju:
+  channel: [
+`,
+			expected: []string{"concierge.yaml:3: did not find expected node content"},
+		},
+	}
+
+	for _, tc := range tests {
+		err := Validate([]byte(tc.config), "concierge.yaml")
+
+		var got []string
+		var validationErrors ValidationErrors
+		if errors.As(err, &validationErrors) {
+			for _, e := range validationErrors {
+				got = append(got, e.Error())
+			}
+		} else if err != nil {
+			t.Fatalf("expected validation errors, got: %v", err)
+		}
+
+		if !reflect.DeepEqual(tc.expected, got) {
+			t.Fatalf("expected: %v, got: %v", tc.expected, got)
+		}
+	}
+}
+
+func TestSchemaIsUpToDate(t *testing.T) {
+	expected, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published, err := os.ReadFile("../../concierge.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(expected) != string(published) {
+		t.Fatalf("concierge.schema.json is out of date, run 'go generate ./...'")
+	}
+}
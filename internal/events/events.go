@@ -0,0 +1,154 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SchemaVersion is the version of the event schema. It is incremented if a field is removed or
+// its meaning changes. New event types and fields may be added without changing the version.
+const SchemaVersion = 1
+
+// Type identifies the kind of an event.
+type Type string
+
+const (
+	// PlanComputed is emitted once the plan has been validated, and lists its components.
+	PlanComputed Type = "plan-computed"
+	// StepStarted is emitted when concierge starts to prepare or restore a component.
+	StepStarted Type = "step-started"
+	// StepFinished is emitted when a step finishes, successfully or otherwise.
+	StepFinished Type = "step-finished"
+	// CommandStarted is emitted when a command is started.
+	CommandStarted Type = "command-started"
+	// CommandFinished is emitted when a command exits, along with its exit code and duration.
+	CommandFinished Type = "command-finished"
+	// RetryAttempted is emitted before a failed command is retried.
+	RetryAttempted Type = "retry-attempted"
+	// ProviderPrepared is emitted when a provider has been prepared.
+	ProviderPrepared Type = "provider-prepared"
+	// ProviderRestored is emitted when a provider has been restored.
+	ProviderRestored Type = "provider-restored"
+	// ControllerBootstrapped is emitted when a Juju controller and its models have been created.
+	ControllerBootstrapped Type = "controller-bootstrapped"
+	// RunFinished is emitted when `concierge prepare` or `concierge restore` finishes.
+	RunFinished Type = "run-finished"
+)
+
+// Statuses reported by StepFinished and RunFinished events.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	StatusSkipped   = "skipped"
+)
+
+// Event is a single state change. Fields that do not apply to the event type are omitted.
+type Event struct {
+	Version int       `json:"version"`
+	Type    Type      `json:"type"`
+	Time    time.Time `json:"time"`
+	// Action is the action being run, i.e. "prepare" or "restore".
+	Action string `json:"action,omitempty"`
+	// Component is the provider or handler that started a command, e.g. "k8s" or "juju:lxd".
+	Component string `json:"component,omitempty"`
+	// Step is the name of the step, in the form "<kind>/<name>", e.g. "snap/juju".
+	Step   string `json:"step,omitempty"`
+	Status string `json:"status,omitempty"`
+	// Components lists the components of the plan, in the form "<kind>/<name>".
+	Components []string `json:"components,omitempty"`
+	Provider   string   `json:"provider,omitempty"`
+	Controller string   `json:"controller,omitempty"`
+	Command    string   `json:"command,omitempty"`
+	User       string   `json:"user,omitempty"`
+	ExitCode   *int     `json:"exit-code,omitempty"`
+	// Duration is the duration of a command or run, in seconds.
+	Duration *float64 `json:"duration,omitempty"`
+	// Attempt is the number of the attempt at running a command, starting at 1.
+	Attempt int    `json:"attempt,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NewEmitter constructs an emitter that writes events to w.
+func NewEmitter(w io.Writer) *Emitter {
+	return &Emitter{encoder: json.NewEncoder(w)}
+}
+
+// Emitter writes events as newline-delimited JSON. It is safe for concurrent use.
+type Emitter struct {
+	encoder *json.Encoder
+	mtx     sync.Mutex
+}
+
+// Emit writes a single event, populating its version, and its time if unset.
+func (e *Emitter) Emit(event Event) error {
+	event.Version = SchemaVersion
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	return e.encoder.Encode(event)
+}
+
+// emitterKey is the context key used to store the emitter.
+type emitterKey struct{}
+
+// WithEmitter returns a copy of the context which causes events emitted with it to be written
+// using the specified emitter.
+func WithEmitter(ctx context.Context, e *Emitter) context.Context {
+	return context.WithValue(ctx, emitterKey{}, e)
+}
+
+// Emit writes an event using the emitter in the context, if there is one. Failures to write
+// events are logged, but do not interrupt the run.
+func Emit(ctx context.Context, event Event) {
+	e, ok := ctx.Value(emitterKey{}).(*Emitter)
+	if !ok || e == nil {
+		return
+	}
+
+	if err := e.Emit(event); err != nil {
+		slog.Debug("Failed to emit event", "type", event.Type, "error", err.Error())
+	}
+}
+
+// EmitStepStarted emits a StepStarted event for the specified step.
+func EmitStepStarted(ctx context.Context, step string) {
+	Emit(ctx, Event{Type: StepStarted, Step: step})
+}
+
+// EmitStepFinished emits a StepFinished event for the specified step, with a status derived
+// from the error returned by the step.
+func EmitStepFinished(ctx context.Context, step string, err error) {
+	event := Event{Type: StepFinished, Step: step, Status: Status(err)}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	Emit(ctx, event)
+}
+
+// EmitStepSkipped emits a StepFinished event for a step that was skipped because it completed
+// in a previous run.
+func EmitStepSkipped(ctx context.Context, step string) {
+	Emit(ctx, Event{Type: StepFinished, Step: step, Status: StatusSkipped})
+}
+
+// Status returns the status of an operation that returned the specified error.
+func Status(err error) string {
+	switch {
+	case err == nil:
+		return StatusSucceeded
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return StatusCancelled
+	default:
+		return StatusFailed
+	}
+}
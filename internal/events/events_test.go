@@ -0,0 +1,103 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEmit(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := WithEmitter(context.Background(), NewEmitter(&buf))
+
+	exitCode := 1
+	duration, noDuration := 1.5, 0.0
+	eventTime := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	Emit(ctx, Event{Type: CommandFinished, Time: eventTime, Component: "k8s", Command: "k8s status", ExitCode: &exitCode, Duration: &duration})
+	Emit(ctx, Event{Type: StepStarted, Time: eventTime, Step: "snap/juju"})
+	Emit(ctx, Event{Type: RunFinished, Time: eventTime, Action: "prepare", Status: StatusSucceeded, Duration: &noDuration})
+
+	expected := `{"version":1,"type":"command-finished","time":"2025-01-02T15:04:05Z","component":"k8s","command":"k8s status","exit-code":1,"duration":1.5}
+{"version":1,"type":"step-started","time":"2025-01-02T15:04:05Z","step":"snap/juju"}
+{"version":1,"type":"run-finished","time":"2025-01-02T15:04:05Z","action":"prepare","status":"succeeded","duration":0}
+`
+
+	if buf.String() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, buf.String())
+	}
+}
+
+func TestEmitWithoutEmitter(t *testing.T) {
+	// Emitting events without an emitter in the context should be a no-op.
+	Emit(context.Background(), Event{Type: RunFinished})
+	EmitStepStarted(context.Background(), "snap/juju")
+}
+
+func TestEmitStepFinished(t *testing.T) {
+	type test struct {
+		err      error
+		expected Event
+	}
+
+	tests := []test{
+		{
+			err:      nil,
+			expected: Event{Version: 1, Type: StepFinished, Step: "deb/make", Status: StatusSucceeded},
+		},
+		{
+			err:      fmt.Errorf("failed to install deb"),
+			expected: Event{Version: 1, Type: StepFinished, Step: "deb/make", Status: StatusFailed, Error: "failed to install deb"},
+		},
+		{
+			err:      fmt.Errorf("command cancelled: %w", context.Canceled),
+			expected: Event{Version: 1, Type: StepFinished, Step: "deb/make", Status: StatusCancelled, Error: "command cancelled: context canceled"},
+		},
+	}
+
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		ctx := WithEmitter(context.Background(), NewEmitter(&buf))
+
+		EmitStepFinished(ctx, "deb/make", tc.err)
+
+		event := Event{}
+		err := json.Unmarshal(buf.Bytes(), &event)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if event.Time.IsZero() {
+			t.Fatalf("expected event time to be set")
+		}
+		event.Time = time.Time{}
+
+		if !reflect.DeepEqual(tc.expected, event) {
+			t.Fatalf("expected: %+v, got: %+v", tc.expected, event)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	type test struct {
+		err      error
+		expected string
+	}
+
+	tests := []test{
+		{err: nil, expected: StatusSucceeded},
+		{err: errors.New("failed"), expected: StatusFailed},
+		{err: fmt.Errorf("timed out: %w", context.DeadlineExceeded), expected: StatusCancelled},
+	}
+
+	for _, tc := range tests {
+		if status := Status(tc.err); status != tc.expected {
+			t.Fatalf("expected: %s, got: %s", tc.expected, status)
+		}
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"path"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
 	"github.com/jnsgruk/concierge/internal/packages"
 	"github.com/jnsgruk/concierge/internal/providers"
 	"github.com/jnsgruk/concierge/internal/system"
@@ -29,36 +31,88 @@ func NewJujuHandler(config *config.Config, r system.Worker, providers []provider
 
 	return &JujuHandler{
 		channel:              channel,
+		agentVersion:         config.Juju.AgentVersion,
+		agentVersionOverride: config.Overrides.JujuAgentVersion,
+		extraBootstrapArgs:   config.Juju.ExtraBootstrapArgs,
 		bootstrapConstraints: config.Juju.BootstrapConstraints,
 		modelDefaults:        config.Juju.ModelDefaults,
 		providers:            providers,
+		users:                config.Users(),
 		system:               r,
 		snaps:                []*system.Snap{{Name: "juju", Channel: channel}},
+		inventory:            config.Inventory,
+		journal:              config.Journal,
+		Results:              map[string]error{},
 	}
 }
 
+// Controllers returns the Juju controllers concierge bootstraps on a provider. Unless the
+// provider's config specifies a list of controllers, a single controller named
+// 'concierge-<provider>' is bootstrapped.
+func Controllers(provider providers.Provider) []config.ControllerConfig {
+	if len(provider.Controllers()) > 0 {
+		return provider.Controllers()
+	}
+
+	return []config.ControllerConfig{{Name: fmt.Sprintf("concierge-%s", provider.Name())}}
+}
+
+// models returns the models to create on a controller. Unless the controller's config
+// specifies a list of models, a single model named 'testing' is created.
+func models(controller config.ControllerConfig) []config.ModelConfig {
+	if len(controller.Models) > 0 {
+		return controller.Models
+	}
+
+	return []config.ModelConfig{{Name: "testing"}}
+}
+
 // JujuHandler represents a Juju installation on the system.
 type JujuHandler struct {
+	// Results records the outcome of bootstrapping each controller, keyed by controller name.
+	// Controllers that were not bootstrapped have no entry.
+	Results map[string]error
+
 	channel              string
+	agentVersion         string
+	agentVersionOverride string
+	extraBootstrapArgs   []string
 	bootstrapConstraints map[string]string
 	modelDefaults        map[string]string
 	providers            []providers.Provider
-	system               system.Worker
-	snaps                []*system.Snap
+	// users is the list of users to provision, the first of which bootstraps Juju. Each of
+	// the others is given a copy of its Juju data.
+	users     []string
+	system    system.Worker
+	snaps     []*system.Snap
+	inventory *config.Inventory
+	journal   *config.Journal
+	mtx       sync.Mutex
 }
 
+// jujuDataDir is the path of Juju's data directory, relative to the user's home directory.
+var jujuDataDir = path.Join(".local", "share", "juju")
+
+// credentialsPath is the path of Juju's credentials file, relative to the user's home directory.
+var credentialsPath = path.Join(jujuDataDir, "credentials.yaml")
+
 // Prepare bootstraps Juju on the configured providers.
-func (j *JujuHandler) Prepare() error {
-	err := j.install()
+func (j *JujuHandler) Prepare(ctx context.Context) error {
+	err := j.install(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to install Juju: %w", err)
 	}
 
-	dir := path.Join(".local", "share", "juju")
+	err = j.checkAgentVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	j.recordJujuData()
 
-	err = j.system.MkHomeSubdirectory(dir)
+	err = j.system.MkHomeSubdirectory(jujuDataDir)
 	if err != nil {
-		return fmt.Errorf("failed to create directory '%s': %w", dir, err)
+		return fmt.Errorf("failed to create directory '%s': %w", jujuDataDir, err)
 	}
 
 	err = j.writeCredentials()
@@ -66,36 +120,47 @@ func (j *JujuHandler) Prepare() error {
 		return fmt.Errorf("failed to write juju credentials file: %w", err)
 	}
 
-	err = j.bootstrap()
+	err = j.bootstrap(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to bootstrap Juju controller: %w", err)
 	}
 
+	err = j.shareJujuData(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to share Juju controllers: %w", err)
+	}
+
 	return nil
 }
 
-// Restore uninstalls Juju from the system.
-func (j *JujuHandler) Restore() error {
-	// Kill controllers for credentialed providers.
+// Restore uninstalls Juju from the system. Controllers and Juju data that existed before
+// concierge ran are left in place.
+func (j *JujuHandler) Restore(ctx context.Context) error {
 	for _, p := range j.providers {
-		if p.Credentials() == nil {
-			continue
+		for _, controller := range Controllers(p) {
+			step := fmt.Sprintf("controller/%s", controller.Name)
+			events.EmitStepStarted(ctx, step)
+			err := j.restoreController(ctx, p, controller.Name)
+			events.EmitStepFinished(ctx, step, err)
+			if err != nil {
+				return err
+			}
 		}
+	}
 
-		err := j.killProvider(p)
-		if err != nil {
-			return err
-		}
+	err := j.restoreSharedJujuData()
+	if err != nil {
+		return err
 	}
 
-	err := j.system.RemoveAllHome(path.Join(".local", "share", "juju"))
+	err = j.restoreJujuData()
 	if err != nil {
-		return fmt.Errorf("failed to remove '.local/share/juju' subdirectory from user's home directory: %w", err)
+		return err
 	}
 
-	snapHandler := packages.NewSnapHandler(j.system, j.snaps)
+	snapHandler := packages.NewSnapHandler(j.system, j.snaps, j.inventory, nil)
 
-	err = snapHandler.Restore()
+	err = snapHandler.Restore(ctx)
 	if err != nil {
 		return err
 	}
@@ -105,11 +170,155 @@ func (j *JujuHandler) Restore() error {
 	return nil
 }
 
+// restoreController removes a controller bootstrapped by concierge, either by destroying it or
+// by removing its details from the Juju client.
+func (j *JujuHandler) restoreController(ctx context.Context, provider providers.Provider, controllerName string) error {
+	if j.inventory.ControllerExisted(controllerName) {
+		return nil
+	}
+
+	// Kill controllers for credentialed providers, and for providers that are not being
+	// removed because they were installed before concierge ran.
+	if provider.Credentials() != nil || j.providerKept(provider) {
+		return j.killController(ctx, provider, controllerName)
+	}
+
+	// If the Juju data directory is being kept, make sure it doesn't reference controllers
+	// on providers that have been removed.
+	if j.inventory.FileExisted(jujuDataDir) && j.inventory.ControllerAdded(controllerName) {
+		return j.unregisterController(ctx, controllerName)
+	}
+
+	return nil
+}
+
+// recordJujuData records whether the user had Juju client data before concierge ran.
+func (j *JujuHandler) recordJujuData() {
+	j.inventory.RecordFile(jujuDataDir, hasJujuData(j.system))
+}
+
+// hasJujuData reports whether a worker's user has Juju client data.
+func hasJujuData(w system.Worker) bool {
+	for _, f := range []string{"controllers.yaml", "credentials.yaml"} {
+		if _, err := w.ReadHomeDirFile(path.Join(jujuDataDir, f)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// additionalUsers returns a worker for each of the users to provision, other than the user
+// that bootstraps Juju.
+func (j *JujuHandler) additionalUsers() ([]system.Worker, error) {
+	workers, err := system.UserWorkers(j.system, j.users)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(workers, func(w system.Worker) bool {
+		return w.User().Username == j.system.User().Username
+	}), nil
+}
+
+// shareJujuData gives each of the additional users access to the controllers bootstrapped
+// by concierge, by copying the Juju data directory to their home directory. Users who had
+// Juju data before concierge ran are left as they are.
+func (j *JujuHandler) shareJujuData(ctx context.Context) error {
+	workers, err := j.additionalUsers()
+	if err != nil {
+		return err
+	}
+
+	source := path.Join(j.system.User().HomeDir, jujuDataDir)
+
+	for _, w := range workers {
+		user := w.User()
+		dataDir := path.Join(user.HomeDir, jujuDataDir)
+
+		j.inventory.RecordFile(dataDir, hasJujuData(w))
+		if j.inventory.FileExisted(dataDir) {
+			slog.Warn("Juju data pre-dates concierge, not sharing controllers", "user", user.Username)
+			continue
+		}
+
+		err := w.MkHomeSubdirectory(path.Dir(jujuDataDir))
+		if err != nil {
+			return fmt.Errorf("failed to create directory '%s' for user '%s': %w", path.Dir(jujuDataDir), user.Username, err)
+		}
+
+		err = j.system.RunMany(ctx,
+			system.NewCommand("cp", []string{"-rT", source, dataDir}),
+			system.NewCommand("chown", []string{"-R", fmt.Sprintf("%s:", user.Username), dataDir}),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to copy Juju data for user '%s': %w", user.Username, err)
+		}
+
+		slog.Info("Shared Juju controllers", "user", user.Username)
+	}
+
+	return nil
+}
+
+// restoreSharedJujuData removes the Juju data directory that concierge copied to each of the
+// additional users.
+func (j *JujuHandler) restoreSharedJujuData() error {
+	workers, err := j.additionalUsers()
+	if err != nil {
+		return err
+	}
+
+	for _, w := range workers {
+		user := w.User()
+		if !j.inventory.FileAdded(path.Join(user.HomeDir, jujuDataDir)) {
+			continue
+		}
+
+		err := w.RemoveAllHome(jujuDataDir)
+		if err != nil {
+			return fmt.Errorf("failed to remove '%s' from the home directory of user '%s': %w", jujuDataDir, user.Username, err)
+		}
+	}
+
+	return nil
+}
+
+// restoreJujuData removes the Juju data directory from the user's home directory. If the
+// directory existed before concierge ran, only the credentials written by concierge are
+// removed, and any original credentials file is restored.
+func (j *JujuHandler) restoreJujuData() error {
+	if !j.inventory.FileExisted(jujuDataDir) {
+		err := j.system.RemoveAllHome(jujuDataDir)
+		if err != nil {
+			return fmt.Errorf("failed to remove '%s' subdirectory from user's home directory: %w", jujuDataDir, err)
+		}
+		return nil
+	}
+
+	if j.inventory.FileExisted(credentialsPath) {
+		return system.RestoreHomeDirFile(j.system, credentialsPath)
+	}
+
+	err := j.system.RemoveAllHome(credentialsPath)
+	if err != nil {
+		return fmt.Errorf("failed to remove '%s' from user's home directory: %w", credentialsPath, err)
+	}
+
+	return nil
+}
+
+// providerKept reports whether a provider's snap pre-dates concierge, and is therefore not
+// removed during restore.
+func (j *JujuHandler) providerKept(provider providers.Provider) bool {
+	state, ok := j.inventory.SnapState(provider.Name())
+	return ok && state.Installed
+}
+
 // install ensures that Juju is installed.
-func (j *JujuHandler) install() error {
-	snapHandler := packages.NewSnapHandler(j.system, j.snaps)
+func (j *JujuHandler) install(ctx context.Context) error {
+	snapHandler := packages.NewSnapHandler(j.system, j.snaps, j.inventory, j.journal)
 
-	err := snapHandler.Prepare()
+	err := snapHandler.Prepare(ctx)
 	if err != nil {
 		return err
 	}
@@ -150,7 +359,18 @@ func (j *JujuHandler) writeCredentials() error {
 		return fmt.Errorf("failed to marshal juju credentials to yaml: %w", err)
 	}
 
-	err = j.system.WriteHomeDirFile(path.Join(".local", "share", "juju", "credentials.yaml"), content)
+	// Back up any credentials that existed before concierge ran, so they can be restored.
+	_, err = j.system.ReadHomeDirFile(credentialsPath)
+	existed := err == nil
+
+	if j.inventory.RecordFile(credentialsPath, existed) && existed {
+		err = system.BackupHomeDirFile(j.system, credentialsPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = j.system.WriteHomeDirFile(credentialsPath, content)
 	if err != nil {
 		return fmt.Errorf("failed to write credentials.yaml: %w", err)
 	}
@@ -159,12 +379,30 @@ func (j *JujuHandler) writeCredentials() error {
 }
 
 // bootstrap iterates over the set of configured providers, and bootstraps each of
-// them in parallel with a unique controller name.
-func (j *JujuHandler) bootstrap() error {
+// their controllers in parallel.
+func (j *JujuHandler) bootstrap(ctx context.Context) error {
 	var eg errgroup.Group
 
 	for _, provider := range j.providers {
-		eg.Go(func() error { return j.bootstrapProvider(provider) })
+		if !provider.Bootstrap() {
+			continue
+		}
+
+		// Output is prefixed with the provider name, along with the controller name if the
+		// provider has several controllers which are bootstrapped concurrently.
+		controllers := Controllers(provider)
+		for _, controller := range controllers {
+			prefix := fmt.Sprintf("juju:%s", provider.Name())
+			if len(controllers) > 1 {
+				prefix = fmt.Sprintf("%s/%s", prefix, controller.Name)
+			}
+
+			eg.Go(func() error {
+				err := j.bootstrapController(system.WithOutputPrefix(ctx, prefix), provider, controller)
+				j.recordResult(controller.Name, err)
+				return err
+			})
+		}
 	}
 
 	if err := eg.Wait(); err != nil {
@@ -174,26 +412,36 @@ func (j *JujuHandler) bootstrap() error {
 	return nil
 }
 
-// bootstrapProvider bootstraps one specific provider.
-func (j *JujuHandler) bootstrapProvider(provider providers.Provider) error {
-	if !provider.Bootstrap() {
-		return nil
-	}
+// recordResult records the outcome of bootstrapping a controller.
+func (j *JujuHandler) recordResult(controllerName string, err error) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	j.Results[controllerName] = err
+}
 
-	controllerName := fmt.Sprintf("concierge-%s", provider.Name())
+// bootstrapController bootstraps one specific controller on a provider, and creates its models.
+func (j *JujuHandler) bootstrapController(ctx context.Context, provider providers.Provider, controller config.ControllerConfig) error {
+	controllerName := controller.Name
 
-	bootstrapped, err := j.checkBootstrapped(controllerName)
-	if err != nil {
-		return fmt.Errorf("error checking bootstrap status for provider '%s'", provider.Name())
-	}
+	// Combine the global, provider-local and controller-local model-defaults and
+	// bootstrap-constraints.
+	modelDefaults := config.MergeMaps(config.MergeMaps(j.modelDefaults, provider.ModelDefaults()), controller.ModelDefaults)
+	bootstrapConstraints := config.MergeMaps(config.MergeMaps(j.bootstrapConstraints, provider.BootstrapConstraints()), controller.BootstrapConstraints)
 
-	if bootstrapped {
-		slog.Info("Previous Juju controller found", "provider", provider.Name())
+	agentVersion := j.controllerAgentVersion(provider, controller)
+
+	// Combine the global, provider-local and controller-local extra bootstrap arguments.
+	extraArgs := slices.Concat(j.extraBootstrapArgs, provider.ExtraBootstrapArgs(), controller.BootstrapArgs)
+
+	step := fmt.Sprintf("controller/%s", controllerName)
+	inputs := []interface{}{provider.CloudName(), j.channel, modelDefaults, bootstrapConstraints, agentVersion, extraArgs, models(controller)}
+
+	if j.journal.Completed(step, inputs...) {
+		slog.Info("Skipping completed step", "controller", controllerName)
+		events.EmitStepSkipped(ctx, step)
 		return nil
 	}
 
-	slog.Info("Bootstrapping Juju", "provider", provider.Name())
-
 	bootstrapArgs := []string{
 		"bootstrap",
 		provider.CloudName(),
@@ -201,10 +449,6 @@ func (j *JujuHandler) bootstrapProvider(provider providers.Provider) error {
 		"--verbose",
 	}
 
-	// Combine the global and provider-local model-defaults and bootstrap-constraints.
-	modelDefaults := config.MergeMaps(j.modelDefaults, provider.ModelDefaults())
-	bootstrapConstraints := config.MergeMaps(j.bootstrapConstraints, provider.BootstrapConstraints())
-
 	// Iterate over the model-defaults and append them to the bootstrapArgs
 	for _, k := range sortedKeys(modelDefaults) {
 		bootstrapArgs = append(bootstrapArgs, "--model-default", fmt.Sprintf("%s=%s", k, modelDefaults[k]))
@@ -215,56 +459,197 @@ func (j *JujuHandler) bootstrapProvider(provider providers.Provider) error {
 		bootstrapArgs = append(bootstrapArgs, "--bootstrap-constraints", fmt.Sprintf("%s=%s", k, bootstrapConstraints[k]))
 	}
 
+	if agentVersion != "" {
+		bootstrapArgs = append(bootstrapArgs, "--agent-version", agentVersion)
+	}
+
+	bootstrapArgs = append(bootstrapArgs, extraArgs...)
+
+	events.EmitStepStarted(ctx, step)
+	err := j.createController(ctx, provider, controller, bootstrapArgs)
+	events.EmitStepFinished(ctx, step, err)
+	if err != nil {
+		return err
+	}
+
+	j.journal.Complete(step, inputs...)
+	return nil
+}
+
+// createController bootstraps a controller with the specified arguments, unless it already
+// exists, and creates its models.
+func (j *JujuHandler) createController(ctx context.Context, provider providers.Provider, controller config.ControllerConfig, bootstrapArgs []string) error {
+	controllerName := controller.Name
+
+	bootstrapped, err := j.checkBootstrapped(ctx, controllerName)
+	if err != nil {
+		return fmt.Errorf("error checking bootstrap status for controller '%s'", controllerName)
+	}
+
+	j.inventory.RecordController(controllerName, bootstrapped)
+
+	if bootstrapped {
+		slog.Info("Previous Juju controller found", "provider", provider.Name(), "controller", controllerName)
+		return nil
+	}
+
+	slog.Info("Bootstrapping Juju", "provider", provider.Name(), "controller", controllerName)
+
 	user := j.system.User().Username
 
 	cmd := system.NewCommandAs(user, provider.GroupName(), "juju", bootstrapArgs)
-	_, err = j.system.RunWithRetries(cmd, (5 * time.Minute))
+	_, err = j.system.RunWithRetries(ctx, cmd, (5 * time.Minute))
 	if err != nil {
 		return err
 	}
 
-	cmd = system.NewCommandAs(user, "", "juju", []string{"add-model", "-c", controllerName, "testing"})
-	_, err = j.system.Run(cmd)
+	for _, model := range models(controller) {
+		err = j.addModel(ctx, controllerName, model)
+		if err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Bootstrapped Juju", "provider", provider.Name(), "controller", controllerName)
+	events.Emit(ctx, events.Event{Type: events.ControllerBootstrapped, Provider: provider.Name(), Controller: controllerName})
+	return nil
+}
+
+// controllerAgentVersion returns the Juju agent version to bootstrap a controller with. The
+// override flag takes precedence over the controller config, then the provider config, then
+// the Juju config.
+func (j *JujuHandler) controllerAgentVersion(provider providers.Provider, controller config.ControllerConfig) string {
+	if j.agentVersionOverride != "" {
+		return j.agentVersionOverride
+	}
+
+	if controller.AgentVersion != "" {
+		return controller.AgentVersion
+	}
+
+	if provider.AgentVersion() != "" {
+		return provider.AgentVersion()
+	}
+
+	return j.agentVersion
+}
+
+// checkAgentVersions ensures that the installed Juju client is able to bootstrap each of the
+// requested agent versions, before any controllers are bootstrapped.
+func (j *JujuHandler) checkAgentVersions(ctx context.Context) error {
+	agentVersions := []string{}
+	for _, provider := range j.providers {
+		if !provider.Bootstrap() {
+			continue
+		}
+
+		for _, controller := range Controllers(provider) {
+			agentVersion := j.controllerAgentVersion(provider, controller)
+			if agentVersion != "" && !slices.Contains(agentVersions, agentVersion) {
+				agentVersions = append(agentVersions, agentVersion)
+			}
+		}
+	}
+
+	if len(agentVersions) == 0 {
+		return nil
+	}
+
+	cmd := system.NewCommandAs(j.system.User().Username, "", "juju", []string{"version"})
+	output, err := j.system.Run(ctx, cmd)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to determine juju client version: %w", err)
+	}
+
+	// The client version is not known if the command was not run, such as in a dry run.
+	clientVersion := strings.TrimSpace(string(output))
+	if clientVersion == "" {
+		slog.Debug("Unable to determine juju client version, skipping agent version check")
+		return nil
+	}
+
+	clientMajorMinor, err := majorMinor(clientVersion)
+	if err != nil {
+		return fmt.Errorf("failed to parse juju client version: %w", err)
+	}
+
+	for _, agentVersion := range agentVersions {
+		agentMajorMinor, err := majorMinor(agentVersion)
+		if err != nil {
+			return fmt.Errorf("invalid juju agent version: %w", err)
+		}
+
+		if agentMajorMinor != clientMajorMinor {
+			return fmt.Errorf(
+				"juju agent version '%s' is not supported by juju client '%s': agent version must be %s.x",
+				agentVersion, clientVersion, clientMajorMinor,
+			)
+		}
 	}
 
-	slog.Info("Bootstrapped Juju", "provider", provider.Name())
 	return nil
 }
 
-// killProvider destroys the controller for a specific provider.
-func (j *JujuHandler) killProvider(provider providers.Provider) error {
-	controllerName := fmt.Sprintf("concierge-%s", provider.Name())
+// addModel creates a model on a controller, with the specified model-config.
+func (j *JujuHandler) addModel(ctx context.Context, controllerName string, model config.ModelConfig) error {
+	args := []string{"add-model", "-c", controllerName, model.Name}
+
+	for _, k := range sortedKeys(model.Config) {
+		args = append(args, "--config", fmt.Sprintf("%s=%s", k, model.Config[k]))
+	}
+
+	cmd := system.NewCommandAs(j.system.User().Username, "", "juju", args)
+	_, err := j.system.Run(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to add model '%s' to controller '%s': %w", model.Name, controllerName, err)
+	}
+
+	return nil
+}
 
-	bootstrapped, err := j.checkBootstrapped(controllerName)
+// killController destroys a controller bootstrapped on a specific provider.
+func (j *JujuHandler) killController(ctx context.Context, provider providers.Provider, controllerName string) error {
+	bootstrapped, err := j.checkBootstrapped(ctx, controllerName)
 	if err != nil {
-		return fmt.Errorf("error checking bootstrap status for provider '%s'", provider.Name())
+		return fmt.Errorf("error checking bootstrap status for controller '%s'", controllerName)
 	}
 
 	if !bootstrapped {
-		slog.Info("No Juju controller found", "provider", provider.Name())
+		slog.Info("No Juju controller found", "provider", provider.Name(), "controller", controllerName)
 		return nil
 	}
 
-	slog.Info("Destroying Juju controller", "provider", provider.Name())
+	slog.Info("Destroying Juju controller", "provider", provider.Name(), "controller", controllerName)
 
 	killArgs := []string{"kill-controller", "--verbose", "--no-prompt", controllerName}
 
 	cmd := system.NewCommandAs(j.system.User().Username, "", "juju", killArgs)
-	_, err = j.system.Run(cmd)
+	_, err = j.system.Run(ctx, cmd)
 	if err != nil {
 		return fmt.Errorf("failed to destroy controller: '%s': %w", controllerName, err)
 	}
 
-	slog.Info("Destroyed Juju controller", "provider", provider.Name())
+	slog.Info("Destroyed Juju controller", "provider", provider.Name(), "controller", controllerName)
+	return nil
+}
+
+// unregisterController removes the details of a controller from the Juju client.
+func (j *JujuHandler) unregisterController(ctx context.Context, controllerName string) error {
+	cmd := system.NewCommandAs(j.system.User().Username, "", "juju", []string{"unregister", "--no-prompt", controllerName})
+	output, err := j.system.Run(ctx, cmd)
+	if err != nil && !strings.Contains(string(output), "not found") {
+		return fmt.Errorf("failed to unregister controller '%s': %w", controllerName, err)
+	}
+
+	slog.Info("Unregistered Juju controller", "controller", controllerName)
 	return nil
 }
 
 // checkBootstrapped checks whether concierge has already been bootstrapped on a given provider.
-func (j *JujuHandler) checkBootstrapped(controllerName string) (bool, error) {
+func (j *JujuHandler) checkBootstrapped(ctx context.Context, controllerName string) (bool, error) {
 	user := j.system.User().Username
 	cmd := system.NewCommandAs(user, "", "juju", []string{"show-controller", controllerName})
+	cmd.ReadOnly = true
 
 	// Configure a back-off for retrying the assessment of controller status.
 	backoff := retry.WithMaxRetries(10, retry.NewExponential(1*time.Second))
@@ -273,8 +658,8 @@ func (j *JujuHandler) checkBootstrapped(controllerName string) (bool, error) {
 	// This retry works around an issue where a given controller may not respond, causing the
 	// tool to conclude that the controller doesn't exist, rather than the controller simply
 	// not responding.
-	return retry.DoValue(context.Background(), backoff, func(ctx context.Context) (bool, error) {
-		output, err := j.system.Run(cmd)
+	return retry.DoValue(ctx, backoff, func(ctx context.Context) (bool, error) {
+		output, err := j.system.Run(ctx, cmd)
 		if err != nil {
 			// If the error message on checking contains "not found" then the controller
 			// is not actually there, so don't retry the check.
@@ -289,6 +674,19 @@ func (j *JujuHandler) checkBootstrapped(controllerName string) (bool, error) {
 	})
 }
 
+// majorMinor returns the major and minor components of a Juju version, such as '3.6' for
+// both '3.6.1-genericlinux-amd64' and '3.6-beta2'.
+func majorMinor(version string) (string, error) {
+	number, _, _ := strings.Cut(version, "-")
+
+	parts := strings.Split(number, ".")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("version '%s' is not of the form <major>.<minor>[.<patch>]", version)
+	}
+
+	return fmt.Sprintf("%s.%s", parts[0], parts[1]), nil
+}
+
 // sortedKeys gets an alphabetically sorted list of keys from a map.
 func sortedKeys(m map[string]string) []string {
 	keys := make([]string, 0, len(m))
@@ -1,8 +1,13 @@
 package juju
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/jnsgruk/concierge/internal/config"
@@ -60,7 +65,7 @@ func setupHandlerWithGoogleProvider() (*system.MockSystem, *JujuHandler, error)
 
 	provider := providers.NewProvider("google", system, cfg)
 
-	err := provider.Prepare()
+	err := provider.Prepare(context.Background())
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to prepare google provider: %w", err)
 	}
@@ -114,7 +119,7 @@ func TestJujuHandlerCommandsPresets(t *testing.T) {
 			t.Fatal(err.Error())
 		}
 
-		err = handler.Prepare()
+		err = handler.Prepare(context.Background())
 		if err != nil {
 			t.Fatal(err.Error())
 		}
@@ -150,7 +155,7 @@ func TestJujuHandlerWithCredentialedProvider(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	err = handler.Prepare()
+	err = handler.Prepare(context.Background())
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -168,7 +173,7 @@ func TestJujuRestoreNoKillController(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	handler.Restore()
+	handler.Restore(context.Background())
 
 	expectedDeleted := []string{".local/share/juju"}
 	expectedCommands := []string{"snap remove juju --purge"}
@@ -188,7 +193,7 @@ func TestJujuRestoreKillController(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	handler.Restore()
+	handler.Restore(context.Background())
 
 	expectedDeleted := []string{".local/share/juju"}
 	expectedCommands := []string{
@@ -205,3 +210,366 @@ func TestJujuRestoreKillController(t *testing.T) {
 		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
 	}
 }
+
+func TestJujuRestoreWithInventory(t *testing.T) {
+	inventory := config.NewInventory()
+	inventory.RecordSnap("lxd", config.SnapState{Installed: true, Channel: "5.21/stable"})
+	inventory.RecordSnap("juju", config.SnapState{Installed: true, Channel: "3.6/stable"})
+	inventory.RecordController("concierge-lxd", false)
+	inventory.RecordController("concierge-k8s", true)
+	inventory.RecordFile(".local/share/juju", true)
+
+	cfg := &config.Config{Inventory: inventory}
+	cfg.Providers.LXD.Enable = true
+	cfg.Providers.LXD.Bootstrap = true
+	cfg.Providers.K8s.Enable = true
+	cfg.Providers.K8s.Bootstrap = true
+
+	system := system.NewMockSystem()
+
+	lxd := providers.NewLXD(system, cfg)
+	k8s := providers.NewK8s(system, cfg)
+
+	handler := NewJujuHandler(cfg, system, []providers.Provider{lxd, k8s})
+	handler.Restore(context.Background())
+
+	// The LXD controller is killed because LXD is not being removed, the K8s controller
+	// pre-dates concierge, and the Juju snap was already installed on the same channel.
+	expectedCommands := []string{
+		"sudo -u test-user juju show-controller concierge-lxd",
+		"sudo -u test-user juju kill-controller --verbose --no-prompt concierge-lxd",
+		"snap refresh juju --channel 3.6/stable",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	// Only the credentials file is removed, since the Juju data directory pre-dates concierge.
+	expectedDeleted := []string{".local/share/juju/credentials.yaml"}
+	if !reflect.DeepEqual(expectedDeleted, system.Deleted) {
+		t.Fatalf("expected: %v, got: %v", expectedDeleted, system.Deleted)
+	}
+}
+
+func TestJujuRestoreUnregistersRemovedProviders(t *testing.T) {
+	inventory := config.NewInventory()
+	inventory.RecordController("concierge-lxd", false)
+	inventory.RecordFile(".local/share/juju", true)
+
+	cfg := &config.Config{Inventory: inventory}
+	cfg.Providers.LXD.Enable = true
+	cfg.Providers.LXD.Bootstrap = true
+
+	system := system.NewMockSystem()
+	handler := NewJujuHandler(cfg, system, []providers.Provider{providers.NewLXD(system, cfg)})
+	handler.Restore(context.Background())
+
+	expectedCommands := []string{
+		"sudo -u test-user juju unregister --no-prompt concierge-lxd",
+		"snap remove juju --purge",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+}
+
+func TestJujuHandlerSkipsCompletedBootstrap(t *testing.T) {
+	system, handler, err := setupHandlerWithPreset("machine")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	handler.journal = config.NewJournal()
+
+	err = handler.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(handler.journal.Steps) != 2 {
+		t.Fatalf("expected juju snap and controller steps to be recorded, got: %v", handler.journal.Steps)
+	}
+
+	system.ExecutedCommands = nil
+
+	err = handler.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(system.ExecutedCommands) > 0 {
+		t.Fatalf("expected no commands to be run, got: %v", system.ExecutedCommands)
+	}
+
+	// Changing the bootstrap inputs should cause the controller step to run again.
+	handler.modelDefaults = map[string]string{"test-mode": "false"}
+	system.ExecutedCommands = nil
+
+	err = handler.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := "sudo -u test-user juju show-controller concierge-lxd"
+	if len(system.ExecutedCommands) == 0 || system.ExecutedCommands[0] != expected {
+		t.Fatalf("expected controller to be checked again, got: %v", system.ExecutedCommands)
+	}
+}
+
+func TestJujuHandlerMultipleControllers(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Juju.ModelDefaults = map[string]string{"test-mode": "true"}
+	cfg.Providers.LXD.Enable = true
+	cfg.Providers.LXD.Bootstrap = true
+	cfg.Providers.LXD.Controllers = []config.ControllerConfig{
+		{
+			Name:          "lxd-one",
+			BootstrapArgs: []string{"--config", "idle-connection-timeout=90s"},
+			ModelDefaults: map[string]string{"automatically-retry-hooks": "false"},
+			Models: []config.ModelConfig{
+				{Name: "dev", Config: map[string]string{"update-status-hook-interval": "10s", "default-series": "noble"}},
+				{Name: "prod"},
+			},
+		},
+		{
+			Name:                 "lxd-two",
+			BootstrapConstraints: map[string]string{"mem": "4G"},
+		},
+	}
+
+	system := system.NewMockSystem()
+	system.MockCommandReturn("sudo -u test-user juju show-controller lxd-one", []byte("not found"), fmt.Errorf("Test error"))
+	system.MockCommandReturn("sudo -u test-user juju show-controller lxd-two", []byte("not found"), fmt.Errorf("Test error"))
+
+	handler := NewJujuHandler(cfg, system, []providers.Provider{providers.NewLXD(system, cfg)})
+
+	err := handler.bootstrapController(context.Background(), handler.providers[0], cfg.Providers.LXD.Controllers[0])
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = handler.bootstrapController(context.Background(), handler.providers[0], cfg.Providers.LXD.Controllers[1])
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expectedCommands := []string{
+		"sudo -u test-user juju show-controller lxd-one",
+		"sudo -u test-user -g lxd juju bootstrap localhost lxd-one --verbose --model-default automatically-retry-hooks=false --model-default test-mode=true --config idle-connection-timeout=90s",
+		"sudo -u test-user juju add-model -c lxd-one dev --config default-series=noble --config update-status-hook-interval=10s",
+		"sudo -u test-user juju add-model -c lxd-one prod",
+		"sudo -u test-user juju show-controller lxd-two",
+		"sudo -u test-user -g lxd juju bootstrap localhost lxd-two --verbose --model-default test-mode=true --bootstrap-constraints mem=4G",
+		"sudo -u test-user juju add-model -c lxd-two testing",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+}
+
+func TestJujuRestoreKillsAllControllers(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Providers.Google.Enable = true
+	cfg.Providers.Google.Bootstrap = true
+	cfg.Providers.Google.CredentialsFile = "google.yaml"
+	cfg.Providers.Google.Controllers = []config.ControllerConfig{{Name: "gce-one"}, {Name: "gce-two"}}
+
+	system := system.NewMockSystem()
+	system.MockFile("google.yaml", fakeGoogleCreds)
+
+	provider := providers.NewProvider("google", system, cfg)
+	err := provider.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	handler := NewJujuHandler(cfg, system, []providers.Provider{provider})
+	handler.Restore(context.Background())
+
+	expectedCommands := []string{
+		"sudo -u test-user juju show-controller gce-one",
+		"sudo -u test-user juju kill-controller --verbose --no-prompt gce-one",
+		"sudo -u test-user juju show-controller gce-two",
+		"sudo -u test-user juju kill-controller --verbose --no-prompt gce-two",
+		"snap remove juju --purge",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+}
+
+func TestJujuHandlerAgentVersion(t *testing.T) {
+	type test struct {
+		jujuVersion       string
+		providerVersion   string
+		controllerVersion string
+		override          string
+		expected          string
+	}
+
+	tests := []test{
+		{jujuVersion: "3.6.1", expected: "--agent-version 3.6.1"},
+		{jujuVersion: "3.6.1", providerVersion: "3.6.0", expected: "--agent-version 3.6.0"},
+		{jujuVersion: "3.6.1", providerVersion: "3.6.0", controllerVersion: "3.6.3", expected: "--agent-version 3.6.3"},
+		{jujuVersion: "3.6.1", providerVersion: "3.6.0", override: "3.6.2", expected: "--agent-version 3.6.2"},
+		{jujuVersion: "3.6.1", controllerVersion: "3.6.3", override: "3.6.2", expected: "--agent-version 3.6.2"},
+	}
+
+	for _, tc := range tests {
+		cfg := &config.Config{}
+		cfg.Juju.AgentVersion = tc.jujuVersion
+		cfg.Juju.ExtraBootstrapArgs = []string{"--config", "idle-connection-timeout=90s"}
+		cfg.Overrides.JujuAgentVersion = tc.override
+		cfg.Providers.LXD.Enable = true
+		cfg.Providers.LXD.Bootstrap = true
+		cfg.Providers.LXD.AgentVersion = tc.providerVersion
+		cfg.Providers.LXD.ExtraBootstrapArgs = []string{"--keep-broken"}
+		cfg.Providers.LXD.Controllers = []config.ControllerConfig{{Name: "concierge-lxd", AgentVersion: tc.controllerVersion}}
+
+		system := system.NewMockSystem()
+		system.MockCommandReturn("sudo -u test-user juju version", []byte("3.6.4-genericlinux-amd64\n"), nil)
+		system.MockCommandReturn("sudo -u test-user juju show-controller concierge-lxd", []byte("not found"), fmt.Errorf("Test error"))
+
+		handler := NewJujuHandler(cfg, system, []providers.Provider{providers.NewLXD(system, cfg)})
+
+		err := handler.Prepare(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		expected := fmt.Sprintf("sudo -u test-user -g lxd juju bootstrap localhost concierge-lxd --verbose %s --config idle-connection-timeout=90s --keep-broken", tc.expected)
+		if !slices.Contains(system.ExecutedCommands, expected) {
+			t.Fatalf("expected: %v, got: %v", expected, system.ExecutedCommands)
+		}
+	}
+}
+
+func TestJujuHandlerUnsupportedAgentVersion(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Juju.AgentVersion = "3.5.4"
+	cfg.Providers.LXD.Enable = true
+	cfg.Providers.LXD.Bootstrap = true
+
+	system := system.NewMockSystem()
+	system.MockCommandReturn("sudo -u test-user juju version", []byte("3.6.4-genericlinux-amd64\n"), nil)
+
+	handler := NewJujuHandler(cfg, system, []providers.Provider{providers.NewLXD(system, cfg)})
+
+	err := handler.Prepare(context.Background())
+	if err == nil {
+		t.Fatalf("expected an error bootstrapping an unsupported agent version")
+	}
+
+	expected := "juju agent version '3.5.4' is not supported by juju client '3.6.4-genericlinux-amd64': agent version must be 3.6.x"
+	if err.Error() != expected {
+		t.Fatalf("expected: %v, got: %v", expected, err.Error())
+	}
+
+	for _, cmd := range system.ExecutedCommands {
+		if strings.Contains(cmd, "bootstrap") {
+			t.Fatalf("expected no controllers to be bootstrapped, got: %v", system.ExecutedCommands)
+		}
+	}
+}
+
+func TestJujuHandlerControllerAgentVersions(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Providers.LXD.Enable = true
+	cfg.Providers.LXD.Bootstrap = true
+	cfg.Providers.LXD.AgentVersion = "3.6.1"
+	cfg.Providers.LXD.Controllers = []config.ControllerConfig{
+		{Name: "lxd-old", AgentVersion: "3.6.0"},
+		{Name: "lxd-new"},
+	}
+
+	system := system.NewMockSystem()
+	system.MockCommandReturn("sudo -u test-user juju version", []byte("3.6.4-genericlinux-amd64\n"), nil)
+	system.MockCommandReturn("sudo -u test-user juju show-controller lxd-old", []byte("not found"), fmt.Errorf("Test error"))
+	system.MockCommandReturn("sudo -u test-user juju show-controller lxd-new", []byte("not found"), fmt.Errorf("Test error"))
+
+	handler := NewJujuHandler(cfg, system, []providers.Provider{providers.NewLXD(system, cfg)})
+
+	err := handler.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, expected := range []string{
+		"sudo -u test-user -g lxd juju bootstrap localhost lxd-old --verbose --agent-version 3.6.0",
+		"sudo -u test-user -g lxd juju bootstrap localhost lxd-new --verbose --agent-version 3.6.1",
+	} {
+		if !slices.Contains(system.ExecutedCommands, expected) {
+			t.Fatalf("expected: %v, got: %v", expected, system.ExecutedCommands)
+		}
+	}
+
+	// The agent version of each controller is checked against the client before bootstrapping.
+	cfg.Providers.LXD.Controllers[1].AgentVersion = "3.5.4"
+
+	system.ExecutedCommands = []string{}
+	handler = NewJujuHandler(cfg, system, []providers.Provider{providers.NewLXD(system, cfg)})
+
+	err = handler.Prepare(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "juju agent version '3.5.4' is not supported") {
+		t.Fatalf("expected an error bootstrapping an unsupported agent version, got: %v", err)
+	}
+}
+
+func TestJujuHandlerSharesControllersWithUsers(t *testing.T) {
+	system, handler, err := setupHandlerWithPreset("machine")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Bob already uses Juju, so his data is left as it is.
+	system.MockFile("/home/bob/.local/share/juju/controllers.yaml", []byte("controllers: {}"))
+	handler.users = []string{"test-user", "alice", "bob"}
+	handler.inventory = config.NewInventory()
+
+	err = handler.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir := path.Join(os.TempDir(), ".local/share/juju")
+	expectedCommands := []string{
+		"cp -rT " + dataDir + " /home/alice/.local/share/juju",
+		"chown -R alice: /home/alice/.local/share/juju",
+	}
+
+	if !slices.Equal(expectedCommands, system.ExecutedCommands[len(system.ExecutedCommands)-2:]) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	if slices.ContainsFunc(system.ExecutedCommands, func(c string) bool { return strings.Contains(c, "bob") }) {
+		t.Fatalf("expected Juju data of user 'bob' not to be changed, got: %v", system.ExecutedCommands)
+	}
+
+	if !handler.inventory.FileAdded("/home/alice/.local/share/juju") || !handler.inventory.FileExisted("/home/bob/.local/share/juju") {
+		t.Fatalf("incorrect Juju data recorded: %v", handler.inventory.Files)
+	}
+}
+
+func TestJujuRestoreRemovesSharedData(t *testing.T) {
+	inventory := config.NewInventory()
+	inventory.RecordFile("/home/alice/.local/share/juju", false)
+	inventory.RecordFile("/home/bob/.local/share/juju", true)
+
+	cfg := &config.Config{Inventory: inventory}
+	cfg.Overrides.Users = []string{"test-user", "alice", "bob", "carol"}
+
+	system := system.NewMockSystem()
+	handler := NewJujuHandler(cfg, system, []providers.Provider{})
+	handler.Restore(context.Background())
+
+	// Only the data copied to alice is removed: bob's pre-dates concierge, and concierge
+	// never shared its controllers with carol.
+	expectedDeleted := []string{"/home/alice/.local/share/juju", ".local/share/juju"}
+	if !reflect.DeepEqual(expectedDeleted, system.Deleted) {
+		t.Fatalf("expected: %v, got: %v", expectedDeleted, system.Deleted)
+	}
+}
@@ -0,0 +1,104 @@
+package packages
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/jnsgruk/concierge/internal/config"
+)
+
+var (
+	// aptSourcesDir is the directory to which apt sources files are written.
+	aptSourcesDir = "/etc/apt/sources.list.d"
+	// aptKeyringsDir is the directory to which the signing keys of apt sources are written.
+	aptKeyringsDir = "/etc/apt/keyrings"
+	// codenameRegex matches the release codename in /etc/os-release.
+	codenameRegex = regexp.MustCompile(`(?m)^VERSION_CODENAME=(\S+)$`)
+)
+
+// NewAptSource constructs a new apt source from its configuration.
+func NewAptSource(name string, conf config.AptSourceConfig) *AptSource {
+	return &AptSource{
+		Name:       name,
+		URIs:       conf.URIs,
+		Suites:     conf.Suites,
+		Components: conf.Components,
+		Key:        conf.Key,
+		KeyFile:    conf.KeyFile,
+	}
+}
+
+// NewPPA constructs a new apt source representing a Launchpad PPA, specified in shorthand
+// form, i.e. `ppa:deadsnakes/ppa`.
+func NewPPA(ppa string) *AptSource {
+	name := strings.ReplaceAll(strings.TrimPrefix(ppa, "ppa:"), "/", "-")
+	return &AptSource{Name: fmt.Sprintf("ppa-%s", name), PPA: ppa}
+}
+
+// AptSource is an apt repository to be configured on the host. Repositories are either
+// specified in full, and written as deb822 sources files, or are Launchpad PPAs, which are
+// added with `add-apt-repository`.
+type AptSource struct {
+	Name string
+	// PPA is the shorthand name of a Launchpad PPA, i.e. `ppa:deadsnakes/ppa`.
+	PPA        string
+	URIs       []string
+	Suites     []string
+	Components []string
+	// Key is the ASCII-armored public key used to sign the repository.
+	Key string
+	// KeyFile is the path of a file containing the public key used to sign the repository.
+	KeyFile string
+}
+
+// SourcesPath returns the path of the sources file for the repository.
+func (s *AptSource) SourcesPath() string {
+	return path.Join(aptSourcesDir, fmt.Sprintf("concierge-%s.sources", s.Name))
+}
+
+// KeyringPath returns the path to which the repository's signing key is written. ASCII-armored
+// keys must have the '.asc' extension, and binary keys the '.gpg' extension.
+func (s *AptSource) KeyringPath(key []byte) string {
+	ext := "gpg"
+	if bytes.HasPrefix(bytes.TrimSpace(key), []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+		ext = "asc"
+	}
+	return path.Join(aptKeyringsDir, fmt.Sprintf("concierge-%s.%s", s.Name, ext))
+}
+
+// deb822 renders the repository in the deb822 sources format, using the specified suites and
+// keyring path.
+func (s *AptSource) deb822(suites []string, keyring string) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Types: deb\n")
+	fmt.Fprintf(&b, "URIs: %s\n", strings.Join(s.URIs, " "))
+	fmt.Fprintf(&b, "Suites: %s\n", strings.Join(suites, " "))
+
+	if len(s.Components) > 0 {
+		fmt.Fprintf(&b, "Components: %s\n", strings.Join(s.Components, " "))
+	}
+
+	if keyring != "" {
+		fmt.Fprintf(&b, "Signed-By: %s\n", keyring)
+	}
+
+	return []byte(b.String())
+}
+
+// ppaPath returns the part of a PPA's URI that identifies it, i.e. `/deadsnakes/ppa/ubuntu`.
+func (s *AptSource) ppaPath() string {
+	return fmt.Sprintf("/%s/ubuntu", strings.TrimPrefix(s.PPA, "ppa:"))
+}
+
+// parseCodename returns the release codename from the contents of /etc/os-release.
+func parseCodename(osRelease []byte) (string, error) {
+	matches := codenameRegex.FindSubmatch(osRelease)
+	if matches == nil {
+		return "", fmt.Errorf("no VERSION_CODENAME found in os-release")
+	}
+	return strings.Trim(string(matches[1]), `"`), nil
+}
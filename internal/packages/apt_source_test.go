@@ -0,0 +1,66 @@
+package packages
+
+import (
+	"testing"
+
+	"github.com/jnsgruk/concierge/internal/config"
+)
+
+func TestNewPPA(t *testing.T) {
+	ppa := NewPPA("ppa:deadsnakes/ppa")
+
+	if ppa.Name != "ppa-deadsnakes-ppa" {
+		t.Fatalf("expected: %v, got: %v", "ppa-deadsnakes-ppa", ppa.Name)
+	}
+
+	if ppa.ppaPath() != "/deadsnakes/ppa/ubuntu" {
+		t.Fatalf("expected: %v, got: %v", "/deadsnakes/ppa/ubuntu", ppa.ppaPath())
+	}
+}
+
+func TestAptSourceDeb822(t *testing.T) {
+	source := NewAptSource("hashicorp", config.AptSourceConfig{
+		URIs:       []string{"https://apt.releases.hashicorp.com"},
+		Components: []string{"main"},
+	})
+
+	expected := `Types: deb
+URIs: https://apt.releases.hashicorp.com
+Suites: noble
+Components: main
+Signed-By: /etc/apt/keyrings/concierge-hashicorp.asc
+`
+
+	got := string(source.deb822([]string{"noble"}, "/etc/apt/keyrings/concierge-hashicorp.asc"))
+	if got != expected {
+		t.Fatalf("expected: %v, got: %v", expected, got)
+	}
+}
+
+func TestAptSourceKeyringPath(t *testing.T) {
+	source := NewAptSource("hashicorp", config.AptSourceConfig{})
+
+	armored := []byte("\n-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nmQINBF...\n")
+	if got := source.KeyringPath(armored); got != "/etc/apt/keyrings/concierge-hashicorp.asc" {
+		t.Fatalf("expected: %v, got: %v", "/etc/apt/keyrings/concierge-hashicorp.asc", got)
+	}
+
+	binary := []byte{0x99, 0x02, 0x0d}
+	if got := source.KeyringPath(binary); got != "/etc/apt/keyrings/concierge-hashicorp.gpg" {
+		t.Fatalf("expected: %v, got: %v", "/etc/apt/keyrings/concierge-hashicorp.gpg", got)
+	}
+}
+
+func TestParseCodename(t *testing.T) {
+	osRelease := []byte("NAME=\"Ubuntu\"\nVERSION_ID=\"24.04\"\nVERSION_CODENAME=noble\nID=ubuntu\n")
+
+	codename, err := parseCodename(osRelease)
+	if err != nil || codename != "noble" {
+		t.Fatalf("expected: %v, got: %v (%v)", "noble", codename, err)
+	}
+
+	_, err = parseCodename([]byte("NAME=\"Ubuntu\"\n"))
+	if err == nil {
+		t.Fatalf("expected an error when no codename is present")
+	}
+}
@@ -0,0 +1,107 @@
+package packages
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// archiveFormat returns the format of the archive at the specified path, determined by its
+// extension, or an empty string if the path does not refer to a supported archive.
+func archiveFormat(filePath string) string {
+	for _, format := range []string{".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar", ".zip"} {
+		if strings.HasSuffix(filePath, format) {
+			return format
+		}
+	}
+	return ""
+}
+
+// extractArchiveMember returns the contents of the named member of a tar or zip archive. The
+// format of the archive is determined by the extension of its path.
+func extractArchiveMember(filePath string, contents []byte, member string) ([]byte, error) {
+	switch archiveFormat(filePath) {
+	case ".tar.gz", ".tgz":
+		r, err := gzip.NewReader(bytes.NewReader(contents))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress archive '%s': %w", filePath, err)
+		}
+		return extractTarMember(filePath, r, member)
+	case ".tar.bz2", ".tbz2":
+		return extractTarMember(filePath, bzip2.NewReader(bytes.NewReader(contents)), member)
+	case ".tar":
+		return extractTarMember(filePath, bytes.NewReader(contents), member)
+	case ".zip":
+		return extractZipMember(filePath, contents, member)
+	default:
+		return nil, fmt.Errorf("'%s' is not a tar or zip archive", filePath)
+	}
+}
+
+// extractTarMember returns the contents of the named member of a tar archive.
+func extractTarMember(filePath string, r io.Reader, member string) ([]byte, error) {
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive '%s': %w", filePath, err)
+		}
+
+		if header.Typeflag != tar.TypeReg || !sameMember(header.Name, member) {
+			continue
+		}
+
+		contents, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract '%s' from archive '%s': %w", member, filePath, err)
+		}
+		return contents, nil
+	}
+
+	return nil, fmt.Errorf("archive '%s' has no file named '%s'", filePath, member)
+}
+
+// extractZipMember returns the contents of the named member of a zip archive.
+func extractZipMember(filePath string, contents []byte, member string) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive '%s': %w", filePath, err)
+	}
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !sameMember(f.Name, member) {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract '%s' from archive '%s': %w", member, filePath, err)
+		}
+		defer r.Close()
+
+		contents, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract '%s' from archive '%s': %w", member, filePath, err)
+		}
+		return contents, nil
+	}
+
+	return nil, fmt.Errorf("archive '%s' has no file named '%s'", filePath, member)
+}
+
+// sameMember reports whether two paths within an archive refer to the same member, ignoring
+// any leading './'.
+func sameMember(a, b string) bool {
+	return path.Clean(strings.TrimPrefix(a, "./")) == path.Clean(strings.TrimPrefix(b, "./"))
+}
@@ -0,0 +1,102 @@
+package packages
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+)
+
+// testTarGz returns a gzipped tar archive containing the specified files.
+func testTarGz(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	for name, contents := range files {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// testZip returns a zip archive containing the specified files.
+func testZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestExtractArchiveMember(t *testing.T) {
+	files := map[string]string{
+		"./kustomize":           "kustomize binary",
+		"linux-amd64/helm":      "helm binary",
+		"linux-amd64/README.md": "readme",
+	}
+
+	type test struct {
+		filePath string
+		contents []byte
+		member   string
+		expected []byte
+		err      string
+	}
+
+	tests := []test{
+		{filePath: "kustomize_v5.4.3_linux_amd64.tar.gz", contents: testTarGz(t, files), member: "kustomize", expected: []byte("kustomize binary")},
+		{filePath: "helm-v3.16.1-linux-amd64.tgz", contents: testTarGz(t, files), member: "linux-amd64/helm", expected: []byte("helm binary")},
+		{filePath: "tools.zip", contents: testZip(t, files), member: "./linux-amd64/helm", expected: []byte("helm binary")},
+		{filePath: "tools.zip", contents: testZip(t, files), member: "helm", err: "archive 'tools.zip' has no file named 'helm'"},
+		{filePath: "tools.tar.gz", contents: []byte("not an archive"), member: "helm", err: "failed to decompress archive 'tools.tar.gz': gzip: invalid header"},
+		{filePath: "tools.tar.xz", contents: []byte{}, member: "helm", err: "'tools.tar.xz' is not a tar or zip archive"},
+	}
+
+	for _, tc := range tests {
+		contents, err := extractArchiveMember(tc.filePath, tc.contents, tc.member)
+
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("expected: %v, got: %v", tc.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(tc.expected, contents) {
+			t.Fatalf("expected: %s, got: %s", tc.expected, contents)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package packages
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
+	"github.com/jnsgruk/concierge/internal/system"
+)
+
+var (
+	// systemBinDir is the directory to which binaries with the 'system' scope are installed.
+	systemBinDir = "/usr/local/bin"
+	// userBinDir is the directory, relative to the user's home directory, to which binaries
+	// with the 'user' scope are installed.
+	userBinDir = ".local/bin"
+)
+
+// NewBinary constructs a new binary from its configuration.
+func NewBinary(name string, conf config.BinaryConfig) *Binary {
+	scope := conf.Scope
+	if scope == "" {
+		scope = "system"
+	}
+
+	return &Binary{
+		Name:   name,
+		URL:    conf.URL,
+		SHA256: conf.SHA256,
+		Member: conf.Member,
+		Scope:  scope,
+	}
+}
+
+// Binary is an executable downloaded from a URL, either directly or as a member of an archive.
+type Binary struct {
+	Name   string
+	URL    string
+	SHA256 string
+	// Member is the path of the binary within a tar or zip archive, if the URL refers to one.
+	Member string
+	// Scope is either 'system', for binaries installed to /usr/local/bin, or 'user', for
+	// binaries installed to ~/.local/bin.
+	Scope string
+}
+
+// Location returns the path to which the binary is installed. Paths in the user's home
+// directory are prefixed with '~'.
+func (b *Binary) Location() string {
+	if b.Scope == "user" {
+		return path.Join("~", userBinDir, b.Name)
+	}
+	return path.Join(systemBinDir, b.Name)
+}
+
+// NewBinaryHandler constructs a new instance of a BinaryHandler. Whether or not a file existed
+// at the path of each binary prior to concierge running is recorded in the inventory, and
+// each installed binary is recorded in the journal, if they are provided. Existing files are
+// backed up before they are overwritten.
+func NewBinaryHandler(system system.Worker, binaries []*Binary, inventory *config.Inventory, journal *config.Journal) *BinaryHandler {
+	return &BinaryHandler{
+		Binaries:  binaries,
+		Results:   map[string]error{},
+		system:    system,
+		inventory: inventory,
+		journal:   journal,
+	}
+}
+
+// BinaryHandler can install or remove a set of binaries.
+type BinaryHandler struct {
+	Binaries []*Binary
+	// Results records the outcome of the most recent action for each binary, keyed by name.
+	// Binaries that were not acted upon have no entry.
+	Results map[string]error
+
+	system    system.Worker
+	inventory *config.Inventory
+	journal   *config.Journal
+}
+
+// Prepare downloads, verifies and installs a set of binaries. Binaries that the journal
+// records as already installed are skipped.
+func (h *BinaryHandler) Prepare(ctx context.Context) error {
+	for _, b := range h.Binaries {
+		if h.journal.Completed(binaryStep(b), *b) {
+			slog.Info("Skipping completed step", "binary", b.Name)
+			events.EmitStepSkipped(ctx, binaryStep(b))
+			h.Results[b.Name] = nil
+			continue
+		}
+
+		events.EmitStepStarted(ctx, binaryStep(b))
+		err := h.installBinary(ctx, b)
+		events.EmitStepFinished(ctx, binaryStep(b), err)
+		h.Results[b.Name] = err
+		if err != nil {
+			return fmt.Errorf("failed to install binary: %w", err)
+		}
+
+		h.journal.Complete(binaryStep(b), *b)
+	}
+
+	return nil
+}
+
+// Restore removes a set of binaries. Files that existed at the path of a binary before
+// concierge ran are restored from their backups, and binaries that concierge did not install
+// are left in place.
+func (h *BinaryHandler) Restore(ctx context.Context) error {
+	for _, b := range h.Binaries {
+		if !h.inventory.BinaryExisted(b.Location()) && !h.inventory.BinaryAdded(b.Location()) {
+			slog.Info("Binary not installed by concierge, not removing", "binary", b.Name, "path", b.Location())
+			continue
+		}
+
+		events.EmitStepStarted(ctx, binaryStep(b))
+		err := h.restoreBinary(b)
+		events.EmitStepFinished(ctx, binaryStep(b), err)
+		h.Results[b.Name] = err
+		if err != nil {
+			return fmt.Errorf("failed to restore binary: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// installBinary fetches a binary, verifies its checksum, extracts it from its archive if
+// necessary, and installs it as an executable.
+func (h *BinaryHandler) installBinary(ctx context.Context, b *Binary) error {
+	if b.SHA256 == "" {
+		return fmt.Errorf("binary '%s' must specify a sha256 checksum", b.Name)
+	}
+
+	if existed := h.binaryExists(b); h.inventory.RecordBinary(b.Location(), existed) && existed {
+		err := system.BackupHomeDirFile(h.system, binaryPath(b))
+		if err != nil {
+			return err
+		}
+	}
+
+	contents, err := h.system.Fetch(ctx, b.URL)
+	if err != nil {
+		return fmt.Errorf("failed to download binary '%s': %w", b.Name, err)
+	}
+
+	sum := sha256.Sum256(contents)
+	if checksum := hex.EncodeToString(sum[:]); !strings.EqualFold(checksum, b.SHA256) {
+		return fmt.Errorf("checksum of '%s' does not match: expected '%s', got '%s'", b.URL, b.SHA256, checksum)
+	}
+
+	contents, err = h.extractBinary(b, contents)
+	if err != nil {
+		return err
+	}
+
+	if b.Scope == "user" {
+		err = h.installUserBinary(ctx, b, contents)
+	} else {
+		err = h.system.WriteFile(binaryPath(b), contents, 0755)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to install binary '%s': %w", b.Name, err)
+	}
+
+	slog.Info("Installed binary", "binary", b.Name, "path", b.Location())
+	return nil
+}
+
+// extractBinary returns the binary contained in the downloaded file. Archives must specify
+// the member to extract, and other files are returned as they are.
+func (h *BinaryHandler) extractBinary(b *Binary, contents []byte) ([]byte, error) {
+	u, err := url.Parse(b.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse url of binary '%s': %w", b.Name, err)
+	}
+
+	if archiveFormat(u.Path) == "" {
+		if b.Member != "" {
+			return nil, fmt.Errorf("binary '%s' specifies a member, but '%s' is not a tar or zip archive", b.Name, b.URL)
+		}
+		return contents, nil
+	}
+
+	if b.Member == "" {
+		return nil, fmt.Errorf("binary '%s' must specify the member of archive '%s' to install", b.Name, b.URL)
+	}
+
+	return extractArchiveMember(path.Base(u.Path), contents, b.Member)
+}
+
+// installUserBinary writes a binary to the user's home directory, and makes it executable.
+func (h *BinaryHandler) installUserBinary(ctx context.Context, b *Binary, contents []byte) error {
+	filePath := binaryPath(b)
+
+	err := h.system.WriteHomeDirFile(filePath, contents)
+	if err != nil {
+		return err
+	}
+
+	user := h.system.User()
+	cmd := system.NewCommandAs(user.Username, "", "chmod", []string{"0755", path.Join(user.HomeDir, filePath)})
+
+	_, err = h.system.Run(ctx, cmd)
+	return err
+}
+
+// restoreBinary puts back the file that existed at the path of a binary from its backup, or
+// removes the binary if there was none.
+func (h *BinaryHandler) restoreBinary(b *Binary) error {
+	if h.inventory.BinaryExisted(b.Location()) {
+		err := system.RestoreHomeDirFile(h.system, binaryPath(b))
+		if err != nil {
+			return err
+		}
+
+		slog.Info("Restored file overwritten by binary", "binary", b.Name, "path", b.Location())
+		return nil
+	}
+
+	err := h.system.RemoveAllHome(binaryPath(b))
+	if err != nil {
+		return fmt.Errorf("failed to remove binary '%s': %w", b.Name, err)
+	}
+
+	slog.Info("Removed binary", "binary", b.Name, "path", b.Location())
+	return nil
+}
+
+// binaryExists reports whether a file exists at the path to which a binary is installed.
+func (h *BinaryHandler) binaryExists(b *Binary) bool {
+	_, err := h.system.ReadHomeDirFile(binaryPath(b))
+	return err == nil
+}
+
+// binaryPath returns the path to which a binary is installed, either relative to the user's
+// home directory or absolute.
+func binaryPath(b *Binary) string {
+	if b.Scope == "user" {
+		return path.Join(userBinDir, b.Name)
+	}
+	return path.Join(systemBinDir, b.Name)
+}
+
+// binaryStep returns the name of the journal step that installs a binary.
+func binaryStep(b *Binary) string {
+	return fmt.Sprintf("binary/%s", b.Name)
+}
@@ -0,0 +1,218 @@
+package packages
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/system"
+)
+
+// testChecksum returns the hex-encoded SHA-256 digest of the specified contents.
+func testChecksum(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestBinaryHandlerPrepare(t *testing.T) {
+	archive := testTarGz(t, map[string]string{"kustomize": "kustomize binary"})
+	binary := []byte("crashdump binary")
+
+	binaries := []*Binary{
+		NewBinary("kustomize", config.BinaryConfig{
+			URL:    "https://mirror.example.com/kustomize_v5.4.3_linux_amd64.tar.gz",
+			SHA256: testChecksum(archive),
+			Member: "kustomize",
+		}),
+		NewBinary("juju-crashdump", config.BinaryConfig{
+			URL:    "file:///srv/mirror/juju-crashdump",
+			SHA256: strings.ToUpper(testChecksum(binary)),
+			Scope:  "user",
+		}),
+	}
+
+	system := system.NewMockSystem()
+	system.MockFetch("https://mirror.example.com/kustomize_v5.4.3_linux_amd64.tar.gz", archive)
+	system.MockFetch("file:///srv/mirror/juju-crashdump", binary)
+
+	inventory := config.NewInventory()
+	handler := NewBinaryHandler(system, binaries, inventory, nil)
+
+	err := handler.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFiles := map[string]string{
+		"/usr/local/bin/kustomize":  "kustomize binary",
+		".local/bin/juju-crashdump": "crashdump binary",
+	}
+
+	if !reflect.DeepEqual(expectedFiles, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expectedFiles, system.CreatedFiles)
+	}
+
+	expectedCommands := []string{
+		"sudo -u test-user chmod 0755 " + path.Join(os.TempDir(), ".local/bin/juju-crashdump"),
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	expectedInventory := map[string]bool{
+		"/usr/local/bin/kustomize":    false,
+		"~/.local/bin/juju-crashdump": false,
+	}
+
+	if !reflect.DeepEqual(expectedInventory, inventory.Binaries) {
+		t.Fatalf("expected: %v, got: %v", expectedInventory, inventory.Binaries)
+	}
+}
+
+func TestBinaryHandlerErrors(t *testing.T) {
+	archive := testTarGz(t, map[string]string{"kustomize": "kustomize binary"})
+
+	type test struct {
+		conf config.BinaryConfig
+		err  string
+	}
+
+	tests := []test{
+		{
+			conf: config.BinaryConfig{URL: "https://mirror.example.com/kustomize.tar.gz", Member: "kustomize"},
+			err:  "binary 'kustomize' must specify a sha256 checksum",
+		},
+		{
+			conf: config.BinaryConfig{URL: "https://mirror.example.com/kustomize.tar.gz", SHA256: strings.Repeat("0", 64), Member: "kustomize"},
+			err:  "checksum of 'https://mirror.example.com/kustomize.tar.gz' does not match",
+		},
+		{
+			conf: config.BinaryConfig{URL: "https://mirror.example.com/kustomize.tar.gz", SHA256: testChecksum(archive)},
+			err:  "binary 'kustomize' must specify the member of archive 'https://mirror.example.com/kustomize.tar.gz' to install",
+		},
+		{
+			conf: config.BinaryConfig{URL: "https://mirror.example.com/missing", SHA256: testChecksum(archive)},
+			err:  "failed to download binary 'kustomize': failed to fetch 'https://mirror.example.com/missing': 404 Not Found",
+		},
+	}
+
+	for _, tc := range tests {
+		system := system.NewMockSystem()
+		system.MockFetch("https://mirror.example.com/kustomize.tar.gz", archive)
+
+		handler := NewBinaryHandler(system, []*Binary{NewBinary("kustomize", tc.conf)}, nil, nil)
+		err := handler.Prepare(context.Background())
+
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("expected: %v, got: %v", tc.err, err)
+		}
+
+		if handler.Results["kustomize"] == nil {
+			t.Fatalf("expected failure to be recorded for binary 'kustomize'")
+		}
+
+		if len(system.CreatedFiles) > 0 {
+			t.Fatalf("expected no files to be written, got: %v", system.CreatedFiles)
+		}
+	}
+}
+
+func TestBinaryHandlerRestore(t *testing.T) {
+	binaries := []*Binary{
+		NewBinary("kustomize", config.BinaryConfig{URL: "file:///srv/mirror/kustomize"}),
+		NewBinary("helm", config.BinaryConfig{URL: "file:///srv/mirror/helm"}),
+		NewBinary("juju-crashdump", config.BinaryConfig{URL: "file:///srv/mirror/juju-crashdump", Scope: "user"}),
+	}
+
+	inventory := config.NewInventory()
+	inventory.RecordBinary("/usr/local/bin/kustomize", false)
+	inventory.RecordBinary("/usr/local/bin/helm", true)
+	inventory.RecordBinary("~/.local/bin/juju-crashdump", false)
+
+	system := system.NewMockSystem()
+	system.MockFile("/var/lib/concierge/backups/usr/local/bin/helm", []byte("original helm"))
+
+	err := NewBinaryHandler(system, binaries, inventory, nil).Restore(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFiles := map[string]string{"/usr/local/bin/helm": "original helm"}
+
+	if !reflect.DeepEqual(expectedFiles, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expectedFiles, system.CreatedFiles)
+	}
+
+	expectedDeleted := []string{
+		"/usr/local/bin/kustomize",
+		"/var/lib/concierge/backups/usr/local/bin/helm",
+		".local/bin/juju-crashdump",
+	}
+
+	if !reflect.DeepEqual(expectedDeleted, system.Deleted) {
+		t.Fatalf("expected: %v, got: %v", expectedDeleted, system.Deleted)
+	}
+}
+
+func TestBinaryHandlerRestoreUnrecorded(t *testing.T) {
+	binaries := []*Binary{
+		NewBinary("kustomize", config.BinaryConfig{URL: "file:///srv/mirror/kustomize"}),
+		NewBinary("juju-crashdump", config.BinaryConfig{URL: "file:///srv/mirror/juju-crashdump", Scope: "user"}),
+	}
+
+	for _, inventory := range []*config.Inventory{nil, config.NewInventory()} {
+		system := system.NewMockSystem()
+
+		err := NewBinaryHandler(system, binaries, inventory, nil).Restore(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(system.Deleted) > 0 {
+			t.Fatalf("expected no files to be removed, got: %v", system.Deleted)
+		}
+	}
+}
+
+func TestBinaryHandlerBacksUpExistingFiles(t *testing.T) {
+	binary := []byte("helm binary")
+
+	binaries := []*Binary{
+		NewBinary("helm", config.BinaryConfig{URL: "file:///srv/mirror/helm", SHA256: testChecksum(binary)}),
+		NewBinary("juju-crashdump", config.BinaryConfig{URL: "file:///srv/mirror/helm", SHA256: testChecksum(binary), Scope: "user"}),
+	}
+
+	system := system.NewMockSystem()
+	system.MockFetch("file:///srv/mirror/helm", binary)
+	system.MockFile("/usr/local/bin/helm", []byte("original helm"))
+	system.MockFile(".local/bin/juju-crashdump", []byte("original crashdump"))
+
+	inventory := config.NewInventory()
+
+	err := NewBinaryHandler(system, binaries, inventory, nil).Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFiles := map[string]string{
+		"/var/lib/concierge/backups/usr/local/bin/helm":      "original helm",
+		"/usr/local/bin/helm":                                "helm binary",
+		".cache/concierge/backups/.local/bin/juju-crashdump": "original crashdump",
+		".local/bin/juju-crashdump":                          "helm binary",
+	}
+
+	if !reflect.DeepEqual(expectedFiles, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expectedFiles, system.CreatedFiles)
+	}
+
+	if !inventory.BinaryExisted("/usr/local/bin/helm") || !inventory.BinaryExisted("~/.local/bin/juju-crashdump") {
+		t.Fatalf("expected existing files to be recorded, got: %v", inventory.Binaries)
+	}
+}
@@ -1,60 +1,252 @@
 package packages
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
 
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
 	"github.com/jnsgruk/concierge/internal/system"
 )
 
-// NewDeb constructs a new Deb instance.
-func NewDeb(name string) *Deb {
-	return &Deb{Name: name}
+// aptPreferencesPath is the path of the apt preferences file to which package pins are written.
+var aptPreferencesPath = "/etc/apt/preferences.d/concierge.pref"
+
+// NewDeb constructs a new Deb instance from a string of the form `<name>`, `<name>=<version>`
+// or `<name>/<release>`, or the path of a local .deb file, optionally followed by its checksum,
+// i.e. `./tool_1.0_amd64.deb@sha256:<checksum>`.
+func NewDeb(spec string) *Deb {
+	if path, checksum, _ := strings.Cut(spec, "@sha256:"); strings.HasSuffix(path, ".deb") {
+		deb := NewDebFromPath(path)
+		deb.SHA256 = checksum
+		return deb
+	}
+
+	if name, version, ok := strings.Cut(spec, "="); ok {
+		return &Deb{Name: name, Version: version}
+	}
+
+	if name, release, ok := strings.Cut(spec, "/"); ok {
+		return &Deb{Name: name, Release: release}
+	}
+
+	return &Deb{Name: spec}
 }
 
-// Deb is a simple representation of a package installed from the Ubuntu archive.
+// NewDebFromPath returns a deb to be installed from a local .deb file. The name of the deb is
+// taken from the file name, which is of the form `<name>_<version>_<arch>.deb`, until it is
+// read from the file's control data.
+func NewDebFromPath(path string) *Deb {
+	name, _, _ := strings.Cut(strings.TrimSuffix(filepath.Base(path), ".deb"), "_")
+	return &Deb{Name: name, Path: path}
+}
+
+// Deb is a simple representation of a package installed from the Ubuntu archive, or from a
+// local .deb file.
 type Deb struct {
 	Name string
+	// Version is the exact version of the package to install, if specified.
+	Version string
+	// Release is the release from which to install the package, such as 'noble-backports'.
+	Release string
+	// Pin is a version to pin the package to with apt preferences, which may include
+	// wildcards such as '3.12.*'.
+	Pin string
+	// Hold indicates that the package should be held with `apt-mark hold` once installed.
+	Hold bool
+	// Path is the path of a local .deb file to install instead of installing from the archive.
+	Path string
+	// SHA256 is the expected checksum of the local .deb file, if specified.
+	SHA256 string
 }
 
-// NewDebHandler constructs a new instance of a DebHandler.
-func NewDebHandler(system system.Worker, debs []*Deb) *DebHandler {
+// String returns the deb in the form passed to `apt-get install`.
+func (d *Deb) String() string {
+	switch {
+	case d.Path != "":
+		// apt only treats arguments containing a slash as paths to local files.
+		if !strings.Contains(d.Path, "/") {
+			return fmt.Sprintf("./%s", d.Path)
+		}
+		return d.Path
+	case d.Version != "":
+		return fmt.Sprintf("%s=%s", d.Name, d.Version)
+	case d.Release != "":
+		return fmt.Sprintf("%s/%s", d.Name, d.Release)
+	default:
+		return d.Name
+	}
+}
+
+// NewDebHandler constructs a new instance of a DebHandler. Whether or not each deb and apt
+// source existed prior to concierge running is recorded in the inventory, and each installed
+// deb and configured source is recorded in the journal, if they are provided.
+func NewDebHandler(system system.Worker, debs []*Deb, sources []*AptSource, inventory *config.Inventory, journal *config.Journal) *DebHandler {
 	return &DebHandler{
-		Debs:   debs,
-		system: system,
+		Debs:      debs,
+		Sources:   sources,
+		Results:   map[string]error{},
+		system:    system,
+		inventory: inventory,
+		journal:   journal,
 	}
 }
 
-// DebHandler can install or remove a set of debs.
+// DebHandler can install or remove a set of debs, and the apt sources they are installed from.
 type DebHandler struct {
-	Debs   []*Deb
-	system system.Worker
+	Debs    []*Deb
+	Sources []*AptSource
+	// Results records the outcome of the most recent action for each deb, keyed by name.
+	// Debs that were not acted upon have no entry.
+	Results map[string]error
+
+	system    system.Worker
+	inventory *config.Inventory
+	journal   *config.Journal
 }
 
-// Prepare updates the apt cache and installs a set of debs from the archive.
-func (h *DebHandler) Prepare() error {
-	if len(h.Debs) == 0 {
-		return nil
+// Prepare configures a set of apt sources and package pins, updates the apt cache and installs
+// a set of debs in a single transaction, holding any that should be held. Sources and debs that
+// the journal records as already configured or installed are skipped, and the apt cache is only
+// updated if there are sources or debs left to process.
+func (h *DebHandler) Prepare(ctx context.Context) error {
+	for _, deb := range h.Debs {
+		if deb.Path == "" {
+			continue
+		}
+
+		err := h.verifyDebFile(deb)
+		if err != nil {
+			return err
+		}
+
+		deb.Name, err = h.debFileName(ctx, deb)
+		if err != nil {
+			return err
+		}
+
+		h.inventory.RecordDebFile(deb.Path, deb.Name)
 	}
 
-	err := h.updateAptCache()
-	if err != nil {
-		return fmt.Errorf("failed to update apt cache: %w", err)
+	pendingSources := []*AptSource{}
+	for _, source := range h.Sources {
+		if h.journal.Completed(aptSourceStep(source), *source) {
+			slog.Info("Skipping completed step", "source", source.Name)
+			events.EmitStepSkipped(ctx, aptSourceStep(source))
+			continue
+		}
+		pendingSources = append(pendingSources, source)
 	}
 
+	pending := []*Deb{}
 	for _, deb := range h.Debs {
-		err := h.installDeb(deb)
+		if h.journal.Completed(debStep(deb), deb.String(), deb.SHA256, deb.Pin, deb.Hold) {
+			slog.Info("Skipping completed step", "package", deb.Name)
+			events.EmitStepSkipped(ctx, debStep(deb))
+			h.Results[deb.Name] = nil
+			continue
+		}
+		pending = append(pending, deb)
+	}
+
+	if len(pending) == 0 && len(pendingSources) == 0 {
+		return nil
+	}
+
+	for _, source := range pendingSources {
+		events.EmitStepStarted(ctx, aptSourceStep(source))
+		err := h.addAptSource(ctx, source)
+		events.EmitStepFinished(ctx, aptSourceStep(source), err)
 		if err != nil {
-			return fmt.Errorf("failed to install deb: %w", err)
+			return fmt.Errorf("failed to add apt source: %w", err)
 		}
+
+		h.journal.Complete(aptSourceStep(source), *source)
+	}
+
+	err := h.writeAptPins()
+	if err != nil {
+		return fmt.Errorf("failed to pin apt packages: %w", err)
+	}
+
+	h.recordInstalledDebs(ctx)
+	h.recordHeldDebs(ctx)
+
+	err = h.updateAptCache(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update apt cache: %w", err)
+	}
+
+	if len(pending) == 0 {
+		return nil
 	}
+
+	for _, deb := range pending {
+		events.EmitStepStarted(ctx, debStep(deb))
+	}
+
+	err = h.installDebs(ctx, pending)
+	if err == nil {
+		err = h.holdDebs(ctx, pending)
+	}
+
+	for _, deb := range pending {
+		events.EmitStepFinished(ctx, debStep(deb), err)
+		h.Results[deb.Name] = err
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to install debs: %w", err)
+	}
+
+	for _, deb := range pending {
+		h.journal.Complete(debStep(deb), deb.String(), deb.SHA256, deb.Pin, deb.Hold)
+	}
+
+	h.reportDebVersions(ctx, pending)
 	return nil
 }
 
-// Restore removes a set of debs from the machine.
-func (h *DebHandler) Restore() error {
+// Restore releases any holds placed on debs and removes them from the machine, followed by
+// their pins, the apt sources and their signing keys. Debs, holds and sources that existed
+// before concierge ran are kept, as are debs from local files that concierge did not install.
+func (h *DebHandler) Restore(ctx context.Context) error {
+	debs := []*Deb{}
 	for _, deb := range h.Debs {
-		err := h.removeDeb(deb)
+		if deb.Path != "" {
+			// The file may have changed or been removed since it was installed, so the name of
+			// the package is taken from the inventory rather than read from the file again.
+			name, ok := h.inventory.DebFilePackage(deb.Path)
+			if !ok {
+				slog.Info("Deb file not installed by concierge, not removing", "path", deb.Path)
+				continue
+			}
+			deb.Name = name
+		}
+		debs = append(debs, deb)
+	}
+
+	err := h.unholdDebs(ctx, debs)
+	if err != nil {
+		return fmt.Errorf("failed to release apt package holds: %w", err)
+	}
+
+	for _, deb := range debs {
+		if h.inventory.DebInstalled(deb.Name) {
+			slog.Info("Apt package pre-dates concierge, not removing", "package", deb.Name)
+			continue
+		}
+
+		events.EmitStepStarted(ctx, debStep(deb))
+		err := h.removeDeb(ctx, deb)
+		events.EmitStepFinished(ctx, debStep(deb), err)
+		h.Results[deb.Name] = err
 		if err != nil {
 			return fmt.Errorf("failed to remove deb: %w", err)
 		}
@@ -62,32 +254,344 @@ func (h *DebHandler) Restore() error {
 
 	cmd := system.NewCommand("apt-get", []string{"autoremove", "-y"})
 
-	_, err := h.system.RunExclusive(cmd)
+	_, err = h.system.RunExclusive(ctx, cmd)
 	if err != nil {
 		return fmt.Errorf("failed to install apt package: %w", err)
 	}
 
+	if slices.ContainsFunc(h.Debs, func(d *Deb) bool { return d.Pin != "" }) {
+		err = h.system.RemoveFile(aptPreferencesPath)
+		if err != nil {
+			return fmt.Errorf("failed to remove apt package pins: %w", err)
+		}
+	}
+
+	for _, source := range h.Sources {
+		if h.inventory.AptSourceExisted(source.Name) {
+			slog.Info("Apt source pre-dates concierge, not removing", "source", source.Name)
+			continue
+		}
+
+		events.EmitStepStarted(ctx, aptSourceStep(source))
+		err := h.removeAptSource(ctx, source)
+		events.EmitStepFinished(ctx, aptSourceStep(source), err)
+		if err != nil {
+			return fmt.Errorf("failed to remove apt source: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// addAptSource configures an apt source on the host. PPAs are added with `add-apt-repository`,
+// and other sources are written as deb822 sources files, along with their signing keys.
+func (h *DebHandler) addAptSource(ctx context.Context, s *AptSource) error {
+	if s.PPA != "" {
+		return h.addPPA(ctx, s)
+	}
+
+	if len(s.URIs) == 0 {
+		return fmt.Errorf("apt source '%s' must specify at least one uri", s.Name)
+	}
+
+	_, err := h.system.ReadFile(s.SourcesPath())
+	h.inventory.RecordAptSource(s.Name, err == nil)
+
+	suites := s.Suites
+	if len(suites) == 0 {
+		codename, err := h.releaseCodename()
+		if err != nil {
+			return fmt.Errorf("failed to determine suite for apt source '%s': %w", s.Name, err)
+		}
+		suites = []string{codename}
+	}
+
+	keyring, err := h.writeAptKey(s)
+	if err != nil {
+		return err
+	}
+
+	err = h.system.WriteFile(s.SourcesPath(), s.deb822(suites, keyring), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write apt source '%s': %w", s.Name, err)
+	}
+
+	slog.Info("Added apt source", "source", s.Name, "path", s.SourcesPath())
+	return nil
+}
+
+// writeAptKey writes the signing key of an apt source to the keyrings directory, and returns
+// its path. If the source has no signing key, the path is empty.
+func (h *DebHandler) writeAptKey(s *AptSource) (string, error) {
+	if s.Key != "" && s.KeyFile != "" {
+		return "", fmt.Errorf("apt source '%s' must specify only one of key and key-file", s.Name)
+	}
+
+	key := []byte(s.Key)
+	if s.KeyFile != "" {
+		contents, err := h.system.ReadFile(s.KeyFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read key file for apt source '%s': %w", s.Name, err)
+		}
+		key = contents
+	}
+
+	if len(key) == 0 {
+		return "", nil
+	}
+
+	keyring := s.KeyringPath(key)
+	err := h.system.WriteFile(keyring, key, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write key for apt source '%s': %w", s.Name, err)
+	}
+
+	return keyring, nil
+}
+
+// addPPA adds a Launchpad PPA with `add-apt-repository`, which also imports its signing key.
+func (h *DebHandler) addPPA(ctx context.Context, s *AptSource) error {
+	h.inventory.RecordAptSource(s.Name, h.ppaConfigured(ctx, s))
+
+	cmd := system.NewCommand("add-apt-repository", []string{"-y", "--no-update", s.PPA})
+
+	_, err := h.system.RunExclusive(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to add ppa '%s': %w", s.PPA, err)
+	}
+
+	slog.Info("Added apt source", "source", s.Name, "ppa", s.PPA)
+	return nil
+}
+
+// ppaConfigured reports whether any of the host's apt sources refer to the specified PPA.
+func (h *DebHandler) ppaConfigured(ctx context.Context, s *AptSource) bool {
+	cmd := system.NewCommand("grep", []string{"-rqsF", s.ppaPath(), aptSourcesDir})
+	cmd.ReadOnly = true
+
+	_, err := h.system.Run(ctx, cmd)
+	return err == nil
+}
+
+// removeAptSource removes an apt source, and its signing key, from the host.
+func (h *DebHandler) removeAptSource(ctx context.Context, s *AptSource) error {
+	if s.PPA != "" {
+		cmd := system.NewCommand("add-apt-repository", []string{"-y", "--no-update", "--remove", s.PPA})
+
+		_, err := h.system.RunExclusive(ctx, cmd)
+		if err != nil {
+			return fmt.Errorf("failed to remove ppa '%s': %w", s.PPA, err)
+		}
+
+		slog.Info("Removed apt source", "source", s.Name, "ppa", s.PPA)
+		return nil
+	}
+
+	paths := []string{
+		s.SourcesPath(),
+		s.KeyringPath([]byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")),
+		s.KeyringPath(nil),
+	}
+
+	for _, p := range paths {
+		err := h.system.RemoveFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to remove apt source '%s': %w", s.Name, err)
+		}
+	}
+
+	slog.Info("Removed apt source", "source", s.Name)
+	return nil
+}
+
+// releaseCodename returns the codename of the host's release, such as 'noble'.
+func (h *DebHandler) releaseCodename() (string, error) {
+	osRelease, err := h.system.ReadFile("/etc/os-release")
+	if err != nil {
+		return "", err
+	}
+	return parseCodename(osRelease)
+}
+
+// verifyDebFile checks that a local .deb file matches its expected checksum, if specified.
+func (h *DebHandler) verifyDebFile(d *Deb) error {
+	if d.SHA256 == "" {
+		return nil
+	}
+
+	contents, err := h.system.ReadFile(d.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read deb file '%s': %w", d.Path, err)
+	}
+
+	sum := sha256.Sum256(contents)
+	if checksum := hex.EncodeToString(sum[:]); !strings.EqualFold(checksum, d.SHA256) {
+		return fmt.Errorf("checksum of deb file '%s' does not match: expected '%s', got '%s'", d.Path, d.SHA256, checksum)
+	}
+
+	return nil
+}
+
+// debFileName reads the name of the package contained in a local .deb file from its control
+// data.
+func (h *DebHandler) debFileName(ctx context.Context, d *Deb) (string, error) {
+	cmd := system.NewCommand("dpkg-deb", []string{"--field", d.Path, "Package"})
+	cmd.ReadOnly = true
+
+	output, err := h.system.Run(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to read control data of deb file '%s': %w", d.Path, err)
+	}
+
+	name := strings.TrimSpace(string(output))
+	if name == "" {
+		return "", fmt.Errorf("deb file '%s' does not specify a package name", d.Path)
+	}
+
+	return name, nil
+}
+
+// installDebs uses `apt` to install a set of packages on the system from the archives, in a
+// single transaction.
+func (h *DebHandler) installDebs(ctx context.Context, debs []*Deb) error {
+	args := []string{"install", "-y"}
+	names := []string{}
+	for _, deb := range debs {
+		args = append(args, deb.String())
+		names = append(names, deb.Name)
+	}
+
+	cmd := system.NewCommand("apt-get", args)
+	cmd.Env = []string{"DEBIAN_FRONTEND=noninteractive"}
+
+	_, err := h.system.RunExclusive(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to install apt packages '%s': %w", strings.Join(names, ", "), err)
+	}
+
 	return nil
 }
 
-// installDeb uses `apt` to install the package on the system from the archives.
-func (h *DebHandler) installDeb(d *Deb) error {
-	cmd := system.NewCommand("apt-get", []string{"install", "-y", d.Name})
+// holdDebs uses `apt-mark` to hold any of the packages that should be held at their
+// installed version.
+func (h *DebHandler) holdDebs(ctx context.Context, debs []*Deb) error {
+	names := []string{}
+	for _, deb := range debs {
+		if deb.Hold {
+			names = append(names, deb.Name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
 
-	_, err := h.system.RunExclusive(cmd)
+	cmd := system.NewCommand("apt-mark", append([]string{"hold"}, names...))
+
+	_, err := h.system.RunExclusive(ctx, cmd)
 	if err != nil {
-		return fmt.Errorf("failed to install apt package '%s': %w", d.Name, err)
+		return fmt.Errorf("failed to hold apt packages '%s': %w", strings.Join(names, ", "), err)
 	}
 
-	slog.Info("Installed apt package", "package", d.Name)
+	slog.Info("Held apt packages", "packages", strings.Join(names, ", "))
 	return nil
 }
 
+// unholdDebs releases the holds placed on a set of packages by concierge. Packages that were
+// held before concierge ran are left as they are.
+func (h *DebHandler) unholdDebs(ctx context.Context, debs []*Deb) error {
+	names := []string{}
+	for _, deb := range debs {
+		if !deb.Hold {
+			continue
+		}
+
+		if h.inventory.DebHeld(deb.Name) {
+			slog.Info("Apt package hold pre-dates concierge, not releasing", "package", deb.Name)
+			continue
+		}
+		names = append(names, deb.Name)
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	cmd := system.NewCommand("apt-mark", append([]string{"unhold"}, names...))
+
+	_, err := h.system.RunExclusive(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to unhold apt packages '%s': %w", strings.Join(names, ", "), err)
+	}
+
+	slog.Info("Released apt package holds", "packages", strings.Join(names, ", "))
+	return nil
+}
+
+// writeAptPins writes an apt preferences file pinning each package that specifies a pin to
+// the configured version.
+func (h *DebHandler) writeAptPins() error {
+	var b strings.Builder
+
+	for _, deb := range h.Debs {
+		if deb.Pin == "" {
+			continue
+		}
+
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+
+		fmt.Fprintf(&b, "Package: %s\n", deb.Name)
+		fmt.Fprintf(&b, "Pin: version %s\n", deb.Pin)
+		fmt.Fprintf(&b, "Pin-Priority: 1001\n")
+	}
+
+	if b.Len() == 0 {
+		return nil
+	}
+
+	err := h.system.WriteFile(aptPreferencesPath, []byte(b.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write apt preferences: %w", err)
+	}
+
+	slog.Info("Pinned apt packages", "path", aptPreferencesPath)
+	return nil
+}
+
+// reportDebVersions logs the version of each package that was resolved by apt and installed.
+func (h *DebHandler) reportDebVersions(ctx context.Context, debs []*Deb) {
+	args := []string{"--show", "--showformat=${Package} ${Version}\\n"}
+	for _, deb := range debs {
+		args = append(args, deb.Name)
+	}
+
+	cmd := system.NewCommand("dpkg-query", args)
+	cmd.ReadOnly = true
+
+	output, err := h.system.Run(ctx, cmd)
+	if err != nil {
+		slog.Debug("Failed to query installed apt package versions", "error", err.Error())
+	}
+
+	versions := map[string]string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if name, version, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			versions[name] = version
+		}
+	}
+
+	for _, deb := range debs {
+		slog.Info("Installed apt package", "package", deb.Name, "version", versions[deb.Name])
+	}
+}
+
 // Remove uninstalls the deb from the system with `apt`.
-func (h *DebHandler) removeDeb(d *Deb) error {
+func (h *DebHandler) removeDeb(ctx context.Context, d *Deb) error {
 	cmd := system.NewCommand("apt-get", []string{"remove", "-y", d.Name})
 
-	_, err := h.system.RunExclusive(cmd)
+	_, err := h.system.RunExclusive(ctx, cmd)
 	if err != nil {
 		return fmt.Errorf("failed to remove apt package '%s': %w", d.Name, err)
 	}
@@ -96,11 +600,64 @@ func (h *DebHandler) removeDeb(d *Deb) error {
 	return nil
 }
 
+// recordInstalledDebs records whether or not each deb is already installed in the inventory.
+func (h *DebHandler) recordInstalledDebs(ctx context.Context) {
+	if h.inventory == nil {
+		return
+	}
+
+	for _, deb := range h.Debs {
+		args := []string{"--show", "--showformat=${db:Status-Status}", deb.Name}
+		cmd := system.NewCommand("dpkg-query", args)
+		cmd.ReadOnly = true
+
+		// dpkg-query exits with an error for packages it knows nothing about.
+		output, err := h.system.Run(ctx, cmd)
+		installed := err == nil && strings.TrimSpace(string(output)) == "installed"
+
+		h.inventory.RecordDeb(deb.Name, installed)
+	}
+}
+
+// recordHeldDebs records whether or not each deb that should be held is already held in the
+// inventory.
+func (h *DebHandler) recordHeldDebs(ctx context.Context) {
+	if h.inventory == nil || !slices.ContainsFunc(h.Debs, func(d *Deb) bool { return d.Hold }) {
+		return
+	}
+
+	cmd := system.NewCommand("apt-mark", []string{"showhold"})
+	cmd.ReadOnly = true
+
+	output, err := h.system.Run(ctx, cmd)
+	if err != nil {
+		slog.Debug("Failed to query held apt packages", "error", err.Error())
+		return
+	}
+
+	held := strings.Fields(string(output))
+	for _, deb := range h.Debs {
+		if deb.Hold {
+			h.inventory.RecordDebHold(deb.Name, slices.Contains(held, deb.Name))
+		}
+	}
+}
+
+// aptSourceStep returns the name of the journal step that configures an apt source.
+func aptSourceStep(s *AptSource) string {
+	return fmt.Sprintf("apt-source/%s", s.Name)
+}
+
+// debStep returns the name of the journal step that installs a deb.
+func debStep(d *Deb) string {
+	return fmt.Sprintf("deb/%s", d.Name)
+}
+
 // updateAptCache is a helper method to update the host's package cache.
-func (h *DebHandler) updateAptCache() error {
+func (h *DebHandler) updateAptCache(ctx context.Context) error {
 	cmd := system.NewCommand("apt-get", []string{"update"})
 
-	_, err := h.system.RunExclusive(cmd)
+	_, err := h.system.RunExclusive(ctx, cmd)
 	if err != nil {
 		return fmt.Errorf("failed to update apt package lists: %w", err)
 	}
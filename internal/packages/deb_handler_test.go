@@ -1,9 +1,15 @@
 package packages
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/jnsgruk/concierge/internal/config"
 	"github.com/jnsgruk/concierge/internal/system"
 )
 
@@ -15,15 +21,15 @@ func TestDebHandlerCommands(t *testing.T) {
 
 	tests := []test{
 		{
-			func(d *DebHandler) { d.Prepare() },
+			func(d *DebHandler) { d.Prepare(context.Background()) },
 			[]string{
 				"apt-get update",
-				"apt-get install -y cowsay",
-				"apt-get install -y python3-venv",
+				"DEBIAN_FRONTEND=noninteractive apt-get install -y cowsay python3-venv",
+				"dpkg-query --show '--showformat=${Package} ${Version}\\n' cowsay python3-venv",
 			},
 		},
 		{
-			func(d *DebHandler) { d.Restore() },
+			func(d *DebHandler) { d.Restore(context.Background()) },
 			[]string{
 				"apt-get remove -y cowsay",
 				"apt-get remove -y python3-venv",
@@ -39,10 +45,412 @@ func TestDebHandlerCommands(t *testing.T) {
 
 	for _, tc := range tests {
 		system := system.NewMockSystem()
-		tc.testFunc(NewDebHandler(system, debs))
+		tc.testFunc(NewDebHandler(system, debs, nil, nil, nil))
 
 		if !reflect.DeepEqual(tc.expected, system.ExecutedCommands) {
 			t.Fatalf("expected: %v, got: %v", tc.expected, system.ExecutedCommands)
 		}
 	}
 }
+
+func TestDebHandlerInventory(t *testing.T) {
+	debs := []*Deb{
+		NewDeb("cowsay"),
+		NewDeb("python3-venv"),
+	}
+
+	system := system.NewMockSystem()
+	system.MockCommandReturn("dpkg-query --show '--showformat=${db:Status-Status}' python3-venv", []byte("installed"), nil)
+
+	inventory := config.NewInventory()
+	handler := NewDebHandler(system, debs, nil, inventory, nil)
+	handler.Prepare(context.Background())
+
+	expectedDebs := map[string]bool{"cowsay": false, "python3-venv": true}
+	if !reflect.DeepEqual(expectedDebs, inventory.Debs) {
+		t.Fatalf("expected: %v, got: %v", expectedDebs, inventory.Debs)
+	}
+
+	system.ExecutedCommands = nil
+	handler.Restore(context.Background())
+
+	expectedCommands := []string{
+		"apt-get remove -y cowsay",
+		"apt-get autoremove -y",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+}
+
+func TestDebHandlerSkipsCompletedSteps(t *testing.T) {
+	debs := []*Deb{
+		NewDeb("cowsay"),
+		NewDeb("python3-venv"),
+	}
+
+	journal := config.NewJournal()
+	journal.Complete("deb/cowsay", "cowsay", "", "", false)
+
+	system := system.NewMockSystem()
+	NewDebHandler(system, debs, nil, nil, journal).Prepare(context.Background())
+
+	expected := []string{
+		"apt-get update",
+		"DEBIAN_FRONTEND=noninteractive apt-get install -y python3-venv",
+		"dpkg-query --show '--showformat=${Package} ${Version}\\n' python3-venv",
+	}
+	if !reflect.DeepEqual(expected, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, system.ExecutedCommands)
+	}
+
+	// With every deb installed, the apt cache should not be updated again.
+	system.ExecutedCommands = nil
+	NewDebHandler(system, debs, nil, nil, journal).Prepare(context.Background())
+
+	if len(system.ExecutedCommands) > 0 {
+		t.Fatalf("expected no commands to be run, got: %v", system.ExecutedCommands)
+	}
+}
+
+func TestDebHandlerAptSources(t *testing.T) {
+	sources := []*AptSource{
+		NewAptSource("hashicorp", config.AptSourceConfig{
+			URIs:       []string{"https://apt.releases.hashicorp.com"},
+			Components: []string{"main"},
+			KeyFile:    "/tmp/hashicorp.asc",
+		}),
+		NewPPA("ppa:deadsnakes/ppa"),
+	}
+
+	system := system.NewMockSystem()
+	system.MockFile("/etc/os-release", []byte("VERSION_CODENAME=noble\n"))
+	system.MockFile("/tmp/hashicorp.asc", []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----\n"))
+	system.MockCommandReturn("grep -rqsF /deadsnakes/ppa/ubuntu /etc/apt/sources.list.d", []byte{}, fmt.Errorf("exit status 1"))
+
+	inventory := config.NewInventory()
+	handler := NewDebHandler(system, []*Deb{NewDeb("python3.12")}, sources, inventory, nil)
+	handler.Prepare(context.Background())
+
+	expectedCommands := []string{
+		"grep -rqsF /deadsnakes/ppa/ubuntu /etc/apt/sources.list.d",
+		"add-apt-repository -y --no-update ppa:deadsnakes/ppa",
+		"dpkg-query --show '--showformat=${db:Status-Status}' python3.12",
+		"apt-get update",
+		"DEBIAN_FRONTEND=noninteractive apt-get install -y python3.12",
+		"dpkg-query --show '--showformat=${Package} ${Version}\\n' python3.12",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	expectedFiles := map[string]string{
+		"/etc/apt/keyrings/concierge-hashicorp.asc": "-----BEGIN PGP PUBLIC KEY BLOCK-----\n",
+		"/etc/apt/sources.list.d/concierge-hashicorp.sources": "Types: deb\n" +
+			"URIs: https://apt.releases.hashicorp.com\n" +
+			"Suites: noble\n" +
+			"Components: main\n" +
+			"Signed-By: /etc/apt/keyrings/concierge-hashicorp.asc\n",
+	}
+
+	if !reflect.DeepEqual(expectedFiles, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expectedFiles, system.CreatedFiles)
+	}
+
+	system.ExecutedCommands = nil
+	handler.Restore(context.Background())
+
+	expectedCommands = []string{
+		"apt-get remove -y python3.12",
+		"apt-get autoremove -y",
+		"add-apt-repository -y --no-update --remove ppa:deadsnakes/ppa",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	expectedDeleted := []string{
+		"/etc/apt/sources.list.d/concierge-hashicorp.sources",
+		"/etc/apt/keyrings/concierge-hashicorp.asc",
+		"/etc/apt/keyrings/concierge-hashicorp.gpg",
+	}
+
+	if !reflect.DeepEqual(expectedDeleted, system.Deleted) {
+		t.Fatalf("expected: %v, got: %v", expectedDeleted, system.Deleted)
+	}
+}
+
+func TestDebHandlerKeepsExistingPPA(t *testing.T) {
+	sources := []*AptSource{NewPPA("ppa:deadsnakes/ppa")}
+
+	system := system.NewMockSystem()
+	inventory := config.NewInventory()
+	handler := NewDebHandler(system, nil, sources, inventory, nil)
+	handler.Prepare(context.Background())
+
+	if !inventory.AptSourceExisted("ppa-deadsnakes-ppa") {
+		t.Fatalf("expected ppa to be recorded as pre-existing: %v", inventory.AptSources)
+	}
+
+	system.ExecutedCommands = nil
+	handler.Restore(context.Background())
+
+	expected := []string{"apt-get autoremove -y"}
+	if !reflect.DeepEqual(expected, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, system.ExecutedCommands)
+	}
+}
+
+func TestNewDeb(t *testing.T) {
+	type test struct {
+		input    string
+		expected *Deb
+	}
+
+	tests := []test{
+		{"cowsay", &Deb{Name: "cowsay"}},
+		{"python3.12=3.12.3-1ubuntu0.1", &Deb{Name: "python3.12", Version: "3.12.3-1ubuntu0.1"}},
+		{"lxd-installer/noble-backports", &Deb{Name: "lxd-installer", Release: "noble-backports"}},
+	}
+
+	for _, tc := range tests {
+		deb := NewDeb(tc.input)
+		if !reflect.DeepEqual(tc.expected, deb) {
+			t.Fatalf("expected: %+v, got: %+v", tc.expected, deb)
+		}
+		if deb.String() != tc.input {
+			t.Fatalf("expected: %v, got: %v", tc.input, deb.String())
+		}
+	}
+}
+
+func TestNewDebFromPath(t *testing.T) {
+	type test struct {
+		input    string
+		expected *Deb
+		spec     string
+	}
+
+	checksum := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := []test{
+		{
+			input:    "./tool_1.0_amd64.deb",
+			expected: &Deb{Name: "tool", Path: "./tool_1.0_amd64.deb"},
+			spec:     "./tool_1.0_amd64.deb",
+		},
+		{
+			input:    "/tmp/debs/tool_1.0_amd64.deb@sha256:" + checksum,
+			expected: &Deb{Name: "tool", Path: "/tmp/debs/tool_1.0_amd64.deb", SHA256: checksum},
+			spec:     "/tmp/debs/tool_1.0_amd64.deb",
+		},
+		{
+			input:    "tool.deb",
+			expected: &Deb{Name: "tool", Path: "tool.deb"},
+			spec:     "./tool.deb",
+		},
+	}
+
+	for _, tc := range tests {
+		deb := NewDeb(tc.input)
+		if !reflect.DeepEqual(tc.expected, deb) {
+			t.Fatalf("expected: %+v, got: %+v", tc.expected, deb)
+		}
+		if deb.String() != tc.spec {
+			t.Fatalf("expected: %v, got: %v", tc.spec, deb.String())
+		}
+	}
+}
+
+func TestDebHandlerPinsAndHolds(t *testing.T) {
+	python := NewDeb("python3.12")
+	python.Pin = "3.12.*"
+	python.Hold = true
+
+	terraform := NewDeb("terraform=1.9.5-1")
+	terraform.Hold = true
+
+	debs := []*Deb{python, terraform, NewDeb("cowsay")}
+
+	system := system.NewMockSystem()
+	system.MockCommandReturn("apt-mark showhold", []byte("terraform\n"), nil)
+	system.MockCommandReturn(
+		"dpkg-query --show '--showformat=${Package} ${Version}\\n' python3.12 terraform cowsay",
+		[]byte("python3.12 3.12.3-1ubuntu0.1\nterraform 1.9.5-1\ncowsay 3.03+dfsg2-8\n"),
+		nil,
+	)
+
+	inventory := config.NewInventory()
+	handler := NewDebHandler(system, debs, nil, inventory, nil)
+
+	err := handler.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCommands := []string{
+		"dpkg-query --show '--showformat=${db:Status-Status}' python3.12",
+		"dpkg-query --show '--showformat=${db:Status-Status}' terraform",
+		"dpkg-query --show '--showformat=${db:Status-Status}' cowsay",
+		"apt-mark showhold",
+		"apt-get update",
+		"DEBIAN_FRONTEND=noninteractive apt-get install -y python3.12 terraform=1.9.5-1 cowsay",
+		"apt-mark hold python3.12 terraform",
+		"dpkg-query --show '--showformat=${Package} ${Version}\\n' python3.12 terraform cowsay",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	expectedFiles := map[string]string{
+		"/etc/apt/preferences.d/concierge.pref": "Package: python3.12\nPin: version 3.12.*\nPin-Priority: 1001\n",
+	}
+
+	if !reflect.DeepEqual(expectedFiles, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expectedFiles, system.CreatedFiles)
+	}
+
+	expectedHolds := map[string]bool{"python3.12": false, "terraform": true}
+	if !reflect.DeepEqual(expectedHolds, inventory.DebHolds) {
+		t.Fatalf("expected: %v, got: %v", expectedHolds, inventory.DebHolds)
+	}
+
+	system.ExecutedCommands = nil
+	handler.Restore(context.Background())
+
+	expectedCommands = []string{
+		"apt-mark unhold python3.12",
+		"apt-get remove -y python3.12",
+		"apt-get remove -y terraform",
+		"apt-get remove -y cowsay",
+		"apt-get autoremove -y",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	expectedDeleted := []string{"/etc/apt/preferences.d/concierge.pref"}
+	if !reflect.DeepEqual(expectedDeleted, system.Deleted) {
+		t.Fatalf("expected: %v, got: %v", expectedDeleted, system.Deleted)
+	}
+}
+
+func TestDebHandlerInstallFailure(t *testing.T) {
+	debs := []*Deb{NewDeb("cowsay"), NewDeb("python3-venv")}
+
+	system := system.NewMockSystem()
+	system.MockCommandReturn(
+		"DEBIAN_FRONTEND=noninteractive apt-get install -y cowsay python3-venv",
+		[]byte{},
+		fmt.Errorf("exit status 100"),
+	)
+
+	journal := config.NewJournal()
+	handler := NewDebHandler(system, debs, nil, nil, journal)
+
+	err := handler.Prepare(context.Background())
+	if err == nil {
+		t.Fatalf("expected install failure to be reported")
+	}
+
+	for _, deb := range debs {
+		if handler.Results[deb.Name] == nil {
+			t.Fatalf("expected failure to be recorded for deb '%s'", deb.Name)
+		}
+		if journal.Completed(debStep(deb), deb.String(), deb.Pin, deb.Hold) {
+			t.Fatalf("expected deb '%s' not to be recorded as installed", deb.Name)
+		}
+	}
+}
+
+func TestDebHandlerDebFile(t *testing.T) {
+	contents := []byte("not really a deb")
+	sum := sha256.Sum256(contents)
+	checksum := hex.EncodeToString(sum[:])
+
+	deb := NewDeb("./internal-tool_1.0_amd64.deb@sha256:" + checksum)
+
+	system := system.NewMockSystem()
+	system.MockFile("./internal-tool_1.0_amd64.deb", contents)
+	system.MockCommandReturn("dpkg-deb --field ./internal-tool_1.0_amd64.deb Package", []byte("internal-tools\n"), nil)
+
+	inventory := config.NewInventory()
+	handler := NewDebHandler(system, []*Deb{deb}, nil, inventory, nil)
+
+	err := handler.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCommands := []string{
+		"dpkg-deb --field ./internal-tool_1.0_amd64.deb Package",
+		"dpkg-query --show '--showformat=${db:Status-Status}' internal-tools",
+		"apt-get update",
+		"DEBIAN_FRONTEND=noninteractive apt-get install -y ./internal-tool_1.0_amd64.deb",
+		"dpkg-query --show '--showformat=${Package} ${Version}\\n' internal-tools",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	if _, ok := handler.Results["internal-tools"]; !ok {
+		t.Fatalf("expected result to be recorded under the package name, got: %v", handler.Results)
+	}
+
+	// A fresh deb is constructed on restore, and the file may since have been removed, so the
+	// name must be taken from the inventory.
+	system.ExecutedCommands = nil
+	system.MockCommandReturn("dpkg-deb --field ./internal-tool_1.0_amd64.deb Package", nil, fmt.Errorf("no such file"))
+	deb = NewDeb("./internal-tool_1.0_amd64.deb@sha256:" + checksum)
+	NewDebHandler(system, []*Deb{deb}, nil, inventory, nil).Restore(context.Background())
+
+	expectedCommands = []string{
+		"apt-get remove -y internal-tools",
+		"apt-get autoremove -y",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+}
+
+func TestDebHandlerDebFileNotInstalled(t *testing.T) {
+	deb := NewDeb("./internal-tool_1.0_amd64.deb")
+
+	system := system.NewMockSystem()
+	handler := NewDebHandler(system, []*Deb{deb}, nil, config.NewInventory(), nil)
+
+	err := handler.Restore(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCommands := []string{"apt-get autoremove -y"}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+}
+
+func TestDebHandlerDebFileChecksumMismatch(t *testing.T) {
+	checksum := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	deb := NewDeb("./internal-tool_1.0_amd64.deb@sha256:" + checksum)
+
+	system := system.NewMockSystem()
+	system.MockFile("./internal-tool_1.0_amd64.deb", []byte("not really a deb"))
+
+	err := NewDebHandler(system, []*Deb{deb}, nil, nil, nil).Prepare(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "checksum of deb file './internal-tool_1.0_amd64.deb' does not match") {
+		t.Fatalf("expected checksum mismatch error, got: %v", err)
+	}
+
+	if len(system.ExecutedCommands) > 0 {
+		t.Fatalf("expected no commands to be run, got: %v", system.ExecutedCommands)
+	}
+}
@@ -0,0 +1,287 @@
+package packages
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/user"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
+	"github.com/jnsgruk/concierge/internal/system"
+)
+
+// NewManagedFile constructs a new managed file from its configuration.
+func NewManagedFile(conf config.FileConfig) *ManagedFile {
+	return &ManagedFile{
+		Path:     strings.TrimPrefix(conf.Path, "~/"),
+		Content:  conf.Content,
+		Source:   conf.Source,
+		Mode:     conf.Mode,
+		Owner:    conf.Owner,
+		Template: conf.Template,
+	}
+}
+
+// ManagedFile is a file written to the host by concierge, whose content is either specified
+// inline or copied from a source file.
+type ManagedFile struct {
+	// Path is the destination of the file, either absolute or relative to the user's home
+	// directory.
+	Path    string
+	Content string
+	Source  string
+	// Mode is the octal file mode applied to the file, if specified.
+	Mode string
+	// Owner is the '<user>[:<group>]' that the file is chowned to, if specified.
+	Owner string
+	// Template specifies whether the content is rendered as a Go template.
+	Template bool
+}
+
+// Location returns the destination of the file. Paths in the user's home directory are
+// prefixed with '~'.
+func (f *ManagedFile) Location() string {
+	if path.IsAbs(f.Path) {
+		return f.Path
+	}
+	return path.Join("~", f.Path)
+}
+
+// FileTemplateData is the data available to managed files that are rendered as templates.
+type FileTemplateData struct {
+	// Config is the effective configuration of concierge.
+	Config *config.Config
+	// User is the real user, which may differ from the current user when concierge is run
+	// with `sudo`.
+	User *user.User
+	// Controllers is the list of names of the Juju controllers that concierge bootstraps.
+	Controllers []string
+	// Kubeconfig is the absolute path of the kubeconfig file written by concierge, if any.
+	Kubeconfig string
+}
+
+// NewFileHandler constructs a new instance of a FileHandler. Templates are rendered using the
+// data specified. Whether or not each file existed prior to concierge running is recorded in
+// the inventory, and each written file is recorded in the journal, if they are provided.
+func NewFileHandler(system system.Worker, files []*ManagedFile, data FileTemplateData, inventory *config.Inventory, journal *config.Journal) *FileHandler {
+	return &FileHandler{
+		Files:     files,
+		Results:   map[string]error{},
+		data:      data,
+		system:    system,
+		inventory: inventory,
+		journal:   journal,
+	}
+}
+
+// FileHandler can write or remove a set of managed files.
+type FileHandler struct {
+	Files []*ManagedFile
+	// Results records the outcome of the most recent action for each file, keyed by location.
+	// Files that were not acted upon have no entry.
+	Results map[string]error
+
+	data      FileTemplateData
+	system    system.Worker
+	inventory *config.Inventory
+	journal   *config.Journal
+}
+
+// Prepare writes a set of managed files, backing up any files that already exist at their
+// destinations. Files that the journal records as already written with the same content
+// are skipped.
+func (h *FileHandler) Prepare(ctx context.Context) error {
+	for _, f := range h.Files {
+		contents, err := h.render(f)
+		if err == nil && h.journal.Completed(fileStep(f), *f, string(contents)) {
+			slog.Info("Skipping completed step", "file", f.Location())
+			events.EmitStepSkipped(ctx, fileStep(f))
+			h.Results[f.Location()] = nil
+			continue
+		}
+
+		events.EmitStepStarted(ctx, fileStep(f))
+		if err == nil {
+			err = h.writeFile(ctx, f, contents)
+		}
+		events.EmitStepFinished(ctx, fileStep(f), err)
+		h.Results[f.Location()] = err
+		if err != nil {
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+
+		h.journal.Complete(fileStep(f), *f, string(contents))
+	}
+
+	return nil
+}
+
+// Restore removes a set of managed files. Files that existed before concierge ran are
+// restored from their backups, and files that concierge did not write are left in place.
+func (h *FileHandler) Restore(ctx context.Context) error {
+	for _, f := range h.Files {
+		if !h.inventory.FileExisted(f.Path) && !h.inventory.FileAdded(f.Path) {
+			slog.Info("File not written by concierge, not removing", "file", f.Location())
+			continue
+		}
+
+		events.EmitStepStarted(ctx, fileStep(f))
+		err := h.restoreFile(ctx, f)
+		events.EmitStepFinished(ctx, fileStep(f), err)
+		h.Results[f.Location()] = err
+		if err != nil {
+			return fmt.Errorf("failed to restore file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// render returns the content of a managed file, rendering it as a template if required.
+func (h *FileHandler) render(f *ManagedFile) ([]byte, error) {
+	if (f.Content == "") == (f.Source == "") {
+		return nil, fmt.Errorf("file '%s' must specify exactly one of content and source", f.Location())
+	}
+
+	contents := []byte(f.Content)
+	if f.Source != "" {
+		var err error
+		contents, err = h.system.ReadFile(f.Source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read source of file '%s': %w", f.Location(), err)
+		}
+	}
+
+	if !f.Template {
+		return contents, nil
+	}
+
+	tmpl, err := template.New(f.Location()).Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template for file '%s': %w", f.Location(), err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, h.data); err != nil {
+		return nil, fmt.Errorf("failed to render template for file '%s': %w", f.Location(), err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeFile writes a managed file, and applies its mode and owner.
+func (h *FileHandler) writeFile(ctx context.Context, f *ManagedFile, contents []byte) error {
+	_, err := h.system.ReadHomeDirFile(f.Path)
+	existed := err == nil
+
+	if h.inventory.RecordFile(f.Path, existed) && existed {
+		err := h.recordAttributes(ctx, f)
+		if err != nil {
+			return err
+		}
+
+		err = system.BackupHomeDirFile(h.system, f.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = h.system.WriteHomeDirFile(f.Path, contents)
+	if err != nil {
+		return fmt.Errorf("failed to write file '%s': %w", f.Location(), err)
+	}
+
+	err = h.applyAttributes(ctx, f, config.FileAttributes{Mode: f.Mode, Owner: f.Owner})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Wrote file", "file", f.Location())
+	return nil
+}
+
+// recordAttributes records the mode and owner of a file that is about to be overwritten, such
+// that they can be re-applied when the file is restored.
+func (h *FileHandler) recordAttributes(ctx context.Context, f *ManagedFile) error {
+	cmd := system.NewCommand("stat", []string{"-c", "%a:%U:%G", h.absPath(f)})
+	cmd.ReadOnly = true
+
+	output, err := h.system.Run(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to read attributes of file '%s': %w", f.Location(), err)
+	}
+
+	mode, owner, ok := strings.Cut(strings.TrimSpace(string(output)), ":")
+	if !ok {
+		return fmt.Errorf("failed to parse attributes of file '%s': '%s'", f.Location(), output)
+	}
+
+	h.inventory.RecordFileAttributes(f.Path, config.FileAttributes{Mode: mode, Owner: owner})
+	return nil
+}
+
+// applyAttributes sets the mode and owner of a file, where specified.
+func (h *FileHandler) applyAttributes(ctx context.Context, f *ManagedFile, attributes config.FileAttributes) error {
+	if attributes.Mode != "" {
+		_, err := h.system.Run(ctx, system.NewCommand("chmod", []string{attributes.Mode, h.absPath(f)}))
+		if err != nil {
+			return fmt.Errorf("failed to change mode of file '%s': %w", f.Location(), err)
+		}
+	}
+
+	if attributes.Owner != "" {
+		_, err := h.system.Run(ctx, system.NewCommand("chown", []string{attributes.Owner, h.absPath(f)}))
+		if err != nil {
+			return fmt.Errorf("failed to change owner of file '%s': %w", f.Location(), err)
+		}
+	}
+
+	return nil
+}
+
+// absPath returns the absolute path of a managed file.
+func (h *FileHandler) absPath(f *ManagedFile) string {
+	if path.IsAbs(f.Path) {
+		return f.Path
+	}
+	return path.Join(h.system.User().HomeDir, f.Path)
+}
+
+// restoreFile puts back the original of a managed file, along with its mode and owner, or
+// removes it if there was none.
+func (h *FileHandler) restoreFile(ctx context.Context, f *ManagedFile) error {
+	if h.inventory.FileExisted(f.Path) {
+		err := system.RestoreHomeDirFile(h.system, f.Path)
+		if err != nil {
+			return err
+		}
+
+		if attributes, ok := h.inventory.FileAttributes(f.Path); ok {
+			err := h.applyAttributes(ctx, f, attributes)
+			if err != nil {
+				return err
+			}
+		}
+
+		slog.Info("Restored file", "file", f.Location())
+		return nil
+	}
+
+	err := h.system.RemoveAllHome(f.Path)
+	if err != nil {
+		return fmt.Errorf("failed to remove file '%s': %w", f.Location(), err)
+	}
+
+	slog.Info("Removed file", "file", f.Location())
+	return nil
+}
+
+// fileStep returns the name of the journal step that writes a managed file.
+func fileStep(f *ManagedFile) string {
+	return fmt.Sprintf("file/%s", f.Location())
+}
@@ -0,0 +1,200 @@
+package packages
+
+import (
+	"context"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/system"
+)
+
+func TestFileHandlerPrepare(t *testing.T) {
+	files := []*ManagedFile{
+		NewManagedFile(config.FileConfig{
+			Path:     "~/.config/concierge/controllers",
+			Content:  "{{ range .Controllers }}{{ . }}\n{{ end }}kubeconfig: {{ .Kubeconfig }}\n",
+			Mode:     "0600",
+			Template: true,
+		}),
+		NewManagedFile(config.FileConfig{
+			Path:   "/etc/docker/daemon.json",
+			Source: "./daemon.json",
+			Owner:  "root:docker",
+		}),
+	}
+
+	data := FileTemplateData{
+		Controllers: []string{"concierge-lxd", "concierge-k8s"},
+		Kubeconfig:  "/home/ubuntu/.kube/config",
+	}
+
+	system := system.NewMockSystem()
+	system.MockFile("./daemon.json", []byte(`{"mtu": 1400}`))
+	system.MockFile("/etc/docker/daemon.json", []byte(`{}`))
+	system.MockCommandReturn("stat -c %a:%U:%G /etc/docker/daemon.json", []byte("644:root:root\n"), nil)
+
+	inventory := config.NewInventory()
+	handler := NewFileHandler(system, files, data, inventory, nil)
+
+	err := handler.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFiles := map[string]string{
+		".config/concierge/controllers":                     "concierge-lxd\nconcierge-k8s\nkubeconfig: /home/ubuntu/.kube/config\n",
+		"/var/lib/concierge/backups/etc/docker/daemon.json": `{}`,
+		"/etc/docker/daemon.json":                           `{"mtu": 1400}`,
+	}
+
+	if !reflect.DeepEqual(expectedFiles, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expectedFiles, system.CreatedFiles)
+	}
+
+	expectedCommands := []string{
+		"chmod 0600 " + path.Join(os.TempDir(), ".config/concierge/controllers"),
+		"stat -c %a:%U:%G /etc/docker/daemon.json",
+		"chown root:docker /etc/docker/daemon.json",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	expectedInventory := map[string]bool{
+		".config/concierge/controllers": false,
+		"/etc/docker/daemon.json":       true,
+	}
+
+	if !reflect.DeepEqual(expectedInventory, inventory.Files) {
+		t.Fatalf("expected: %v, got: %v", expectedInventory, inventory.Files)
+	}
+
+	// The original mode and owner are only recorded for files that are backed up.
+	expectedAttributes := map[string]config.FileAttributes{
+		"/etc/docker/daemon.json": {Mode: "644", Owner: "root:root"},
+	}
+
+	if !reflect.DeepEqual(expectedAttributes, inventory.Attributes) {
+		t.Fatalf("expected: %v, got: %v", expectedAttributes, inventory.Attributes)
+	}
+}
+
+func TestFileHandlerErrors(t *testing.T) {
+	type test struct {
+		conf config.FileConfig
+		err  string
+	}
+
+	tests := []test{
+		{
+			conf: config.FileConfig{Path: "~/.config/foo"},
+			err:  "file '~/.config/foo' must specify exactly one of content and source",
+		},
+		{
+			conf: config.FileConfig{Path: "~/.config/foo", Content: "foo", Source: "./foo"},
+			err:  "file '~/.config/foo' must specify exactly one of content and source",
+		},
+		{
+			conf: config.FileConfig{Path: "~/.config/foo", Source: "./missing"},
+			err:  "failed to read source of file '~/.config/foo': file not found",
+		},
+		{
+			conf: config.FileConfig{Path: "~/.config/foo", Content: "{{ .Missing }}", Template: true},
+			err:  "failed to render template for file '~/.config/foo'",
+		},
+		{
+			conf: config.FileConfig{Path: "~/.config/foo", Content: "{{ .Kubeconfig", Template: true},
+			err:  "failed to parse template for file '~/.config/foo'",
+		},
+	}
+
+	for _, tc := range tests {
+		system := system.NewMockSystem()
+
+		handler := NewFileHandler(system, []*ManagedFile{NewManagedFile(tc.conf)}, FileTemplateData{}, nil, nil)
+		err := handler.Prepare(context.Background())
+
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("expected: %v, got: %v", tc.err, err)
+		}
+
+		if handler.Results["~/.config/foo"] == nil {
+			t.Fatalf("expected failure to be recorded for file '~/.config/foo'")
+		}
+
+		if len(system.CreatedFiles) > 0 {
+			t.Fatalf("expected no files to be written, got: %v", system.CreatedFiles)
+		}
+	}
+}
+
+func TestFileHandlerRestore(t *testing.T) {
+	files := []*ManagedFile{
+		NewManagedFile(config.FileConfig{Path: "~/.config/concierge/controllers", Content: "foo"}),
+		NewManagedFile(config.FileConfig{Path: "/etc/docker/daemon.json", Content: "foo"}),
+		NewManagedFile(config.FileConfig{Path: "/etc/profile.d/concierge.sh", Content: "foo"}),
+	}
+
+	inventory := config.NewInventory()
+	inventory.RecordFile(".config/concierge/controllers", false)
+	inventory.RecordFile("/etc/docker/daemon.json", true)
+	inventory.RecordFileAttributes("/etc/docker/daemon.json", config.FileAttributes{Mode: "644", Owner: "root:root"})
+	inventory.RecordFile("/etc/profile.d/concierge.sh", false)
+
+	system := system.NewMockSystem()
+	system.MockFile("/var/lib/concierge/backups/etc/docker/daemon.json", []byte(`{}`))
+
+	err := NewFileHandler(system, files, FileTemplateData{}, inventory, nil).Restore(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFiles := map[string]string{"/etc/docker/daemon.json": `{}`}
+	if !reflect.DeepEqual(expectedFiles, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expectedFiles, system.CreatedFiles)
+	}
+
+	expectedDeleted := []string{
+		".config/concierge/controllers",
+		"/var/lib/concierge/backups/etc/docker/daemon.json",
+		"/etc/profile.d/concierge.sh",
+	}
+
+	if !reflect.DeepEqual(expectedDeleted, system.Deleted) {
+		t.Fatalf("expected: %v, got: %v", expectedDeleted, system.Deleted)
+	}
+
+	// The original mode and owner are re-applied to the restored file.
+	expectedCommands := []string{
+		"chmod 644 /etc/docker/daemon.json",
+		"chown root:root /etc/docker/daemon.json",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+}
+
+func TestFileHandlerRestoreUnrecorded(t *testing.T) {
+	files := []*ManagedFile{
+		NewManagedFile(config.FileConfig{Path: "~/.config/concierge/controllers", Content: "foo"}),
+		NewManagedFile(config.FileConfig{Path: "/etc/docker/daemon.json", Content: "foo"}),
+	}
+
+	// Files that concierge never wrote, such as when prepare failed before the files step, are
+	// left in place.
+	system := system.NewMockSystem()
+	err := NewFileHandler(system, files, FileTemplateData{}, config.NewInventory(), nil).Restore(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(system.Deleted) > 0 || len(system.CreatedFiles) > 0 {
+		t.Fatalf("expected no files to be changed, got deleted: %v, created: %v", system.Deleted, system.CreatedFiles)
+	}
+}
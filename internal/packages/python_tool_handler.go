@@ -0,0 +1,221 @@
+package packages
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
+	"github.com/jnsgruk/concierge/internal/system"
+)
+
+// NewPythonTool constructs a new PythonTool instance from a string of the form `<name>` or
+// `<name>==<version>`.
+func NewPythonTool(spec string) *PythonTool {
+	name, version, _ := strings.Cut(spec, "==")
+	return &PythonTool{Name: name, Version: version}
+}
+
+// PythonTool is a simple representation of a Python CLI tool installed from PyPI into its own
+// isolated environment.
+type PythonTool struct {
+	Name string
+	// Version is the exact version of the tool to install, if specified.
+	Version string
+}
+
+// String returns the tool in the form passed to the installer, i.e. `tox==4.18.0`.
+func (t *PythonTool) String() string {
+	if t.Version == "" {
+		return t.Name
+	}
+	return fmt.Sprintf("%s==%s", t.Name, t.Version)
+}
+
+// NewPythonToolHandler constructs a new instance of a PythonToolHandler, which installs tools
+// with the specified installer: either 'uv' or 'pipx'. Whether or not each tool existed prior
+// to concierge running is recorded in the inventory, and each installed tool is recorded in
+// the journal, if they are provided.
+func NewPythonToolHandler(system system.Worker, installer string, tools []*PythonTool, inventory *config.Inventory, journal *config.Journal) *PythonToolHandler {
+	if installer == "" {
+		installer = "uv"
+	}
+
+	return &PythonToolHandler{
+		Installer: installer,
+		Tools:     tools,
+		Results:   map[string]error{},
+		system:    system,
+		inventory: inventory,
+		journal:   journal,
+	}
+}
+
+// PythonToolHandler can install or remove a set of Python tools for the real user, using
+// either `uv tool` or `pipx`.
+type PythonToolHandler struct {
+	Installer string
+	Tools     []*PythonTool
+	// Results records the outcome of the most recent action for each tool, keyed by name.
+	// Tools that were not acted upon have no entry.
+	Results map[string]error
+
+	system    system.Worker
+	inventory *config.Inventory
+	journal   *config.Journal
+}
+
+// Prepare installs a set of Python tools for the user. Tools that are already installed at
+// the requested version are left as they are, and tools that the journal records as already
+// installed are skipped.
+func (h *PythonToolHandler) Prepare(ctx context.Context) error {
+	if len(h.Tools) == 0 {
+		return nil
+	}
+
+	installed := h.installedTools(ctx)
+
+	for _, tool := range h.Tools {
+		_, ok := installed[tool.Name]
+		h.inventory.RecordPythonTool(tool.Name, ok)
+	}
+
+	for _, tool := range h.Tools {
+		if h.journal.Completed(pythonToolStep(tool), tool.String(), h.Installer) {
+			slog.Info("Skipping completed step", "python-tool", tool.Name)
+			events.EmitStepSkipped(ctx, pythonToolStep(tool))
+			h.Results[tool.Name] = nil
+			continue
+		}
+
+		events.EmitStepStarted(ctx, pythonToolStep(tool))
+		err := h.installTool(ctx, tool, installed)
+		events.EmitStepFinished(ctx, pythonToolStep(tool), err)
+		h.Results[tool.Name] = err
+		if err != nil {
+			return fmt.Errorf("failed to install python tool: %w", err)
+		}
+
+		h.journal.Complete(pythonToolStep(tool), tool.String(), h.Installer)
+	}
+
+	return nil
+}
+
+// Restore uninstalls a set of Python tools. Tools that were installed before concierge ran
+// are kept.
+func (h *PythonToolHandler) Restore(ctx context.Context) error {
+	for _, tool := range h.Tools {
+		if h.inventory.PythonToolInstalled(tool.Name) {
+			slog.Info("Python tool pre-dates concierge, not removing", "python-tool", tool.Name)
+			continue
+		}
+
+		events.EmitStepStarted(ctx, pythonToolStep(tool))
+		err := h.removeTool(ctx, tool)
+		events.EmitStepFinished(ctx, pythonToolStep(tool), err)
+		h.Results[tool.Name] = err
+		if err != nil {
+			return fmt.Errorf("failed to remove python tool: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// installTool installs a Python tool, unless it is already installed at the requested version.
+// Tools installed at a different version are reinstalled.
+func (h *PythonToolHandler) installTool(ctx context.Context, t *PythonTool, installed map[string]string) error {
+	version, ok := installed[t.Name]
+	if ok && (t.Version == "" || t.Version == version) {
+		slog.Info("Python tool already installed", "python-tool", t.Name, "version", version)
+		return nil
+	}
+
+	args := []string{"install", t.String()}
+	if h.Installer == "uv" {
+		args = append([]string{"tool"}, args...)
+	}
+
+	if ok {
+		args = append(args, "--force")
+	}
+
+	_, err := h.system.RunExclusive(ctx, h.command(args))
+	if err != nil {
+		return fmt.Errorf("failed to install python tool '%s': %w", t.Name, err)
+	}
+
+	slog.Info("Installed python tool", "python-tool", t.Name, "installer", h.Installer)
+	return nil
+}
+
+// removeTool uninstalls a Python tool.
+func (h *PythonToolHandler) removeTool(ctx context.Context, t *PythonTool) error {
+	args := []string{"uninstall", t.Name}
+	if h.Installer == "uv" {
+		args = append([]string{"tool"}, args...)
+	}
+
+	_, err := h.system.RunExclusive(ctx, h.command(args))
+	if err != nil {
+		return fmt.Errorf("failed to remove python tool '%s': %w", t.Name, err)
+	}
+
+	slog.Info("Removed python tool", "python-tool", t.Name)
+	return nil
+}
+
+// installedTools returns the version of each Python tool installed for the user, keyed by
+// name. If the installer is not available, no tools are reported.
+func (h *PythonToolHandler) installedTools(ctx context.Context) map[string]string {
+	args := []string{"list", "--short"}
+	if h.Installer == "uv" {
+		args = []string{"tool", "list"}
+	}
+
+	cmd := h.command(args)
+	cmd.ReadOnly = true
+
+	output, err := h.system.Run(ctx, cmd)
+	if err != nil {
+		slog.Debug("Failed to list installed python tools", "installer", h.Installer, "error", err.Error())
+		return map[string]string{}
+	}
+
+	return parsePythonToolList(output)
+}
+
+// command constructs a command that runs the installer as the real user.
+func (h *PythonToolHandler) command(args []string) *system.Command {
+	return system.NewCommandAs(h.system.User().Username, "", h.Installer, args)
+}
+
+// parsePythonToolList parses the output of `uv tool list` or `pipx list --short`, where each
+// tool is listed as `<name> [v]<version>`. Other lines, such as those listing the executables
+// provided by each tool, are ignored.
+func parsePythonToolList(output []byte) map[string]string {
+	tools := map[string]string{}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+
+		version := strings.TrimPrefix(fields[1], "v")
+		if version == "" || version[0] < '0' || version[0] > '9' {
+			continue
+		}
+		tools[fields[0]] = version
+	}
+
+	return tools
+}
+
+// pythonToolStep returns the name of the journal step that installs a Python tool.
+func pythonToolStep(t *PythonTool) string {
+	return fmt.Sprintf("python-tool/%s", t.Name)
+}
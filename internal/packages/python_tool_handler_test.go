@@ -0,0 +1,176 @@
+package packages
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/system"
+)
+
+func TestNewPythonTool(t *testing.T) {
+	type test struct {
+		input    string
+		expected *PythonTool
+	}
+
+	tests := []test{
+		{"tox", &PythonTool{Name: "tox"}},
+		{"charmcraftcache==0.6.2", &PythonTool{Name: "charmcraftcache", Version: "0.6.2"}},
+	}
+
+	for _, tc := range tests {
+		tool := NewPythonTool(tc.input)
+		if !reflect.DeepEqual(tc.expected, tool) {
+			t.Fatalf("expected: %+v, got: %+v", tc.expected, tool)
+		}
+		if tool.String() != tc.input {
+			t.Fatalf("expected: %v, got: %v", tc.input, tool.String())
+		}
+	}
+}
+
+func TestParsePythonToolList(t *testing.T) {
+	type test struct {
+		output   string
+		expected map[string]string
+	}
+
+	tests := []test{
+		{
+			output:   "tox v4.18.0\n- tox\nruff v0.6.9\n- ruff\n",
+			expected: map[string]string{"tox": "4.18.0", "ruff": "0.6.9"},
+		},
+		{
+			output:   "charmcraftcache 0.6.2\ntox 4.18.0\n",
+			expected: map[string]string{"charmcraftcache": "0.6.2", "tox": "4.18.0"},
+		},
+		{
+			output:   "No tools installed\n",
+			expected: map[string]string{},
+		},
+		{
+			output:   "",
+			expected: map[string]string{},
+		},
+	}
+
+	for _, tc := range tests {
+		tools := parsePythonToolList([]byte(tc.output))
+		if !reflect.DeepEqual(tc.expected, tools) {
+			t.Fatalf("expected: %v, got: %v", tc.expected, tools)
+		}
+	}
+}
+
+func TestPythonToolHandlerCommands(t *testing.T) {
+	type test struct {
+		installer string
+		testFunc  func(h *PythonToolHandler)
+		expected  []string
+	}
+
+	tests := []test{
+		{
+			installer: "uv",
+			testFunc:  func(h *PythonToolHandler) { h.Prepare(context.Background()) },
+			expected: []string{
+				"sudo -u test-user uv tool list",
+				"sudo -u test-user uv tool install tox==4.18.0",
+				"sudo -u test-user uv tool install charmcraftcache",
+			},
+		},
+		{
+			installer: "uv",
+			testFunc:  func(h *PythonToolHandler) { h.Restore(context.Background()) },
+			expected: []string{
+				"sudo -u test-user uv tool uninstall tox",
+				"sudo -u test-user uv tool uninstall charmcraftcache",
+			},
+		},
+		{
+			installer: "pipx",
+			testFunc:  func(h *PythonToolHandler) { h.Prepare(context.Background()) },
+			expected: []string{
+				"sudo -u test-user pipx list --short",
+				"sudo -u test-user pipx install tox==4.18.0",
+				"sudo -u test-user pipx install charmcraftcache",
+			},
+		},
+		{
+			installer: "pipx",
+			testFunc:  func(h *PythonToolHandler) { h.Restore(context.Background()) },
+			expected: []string{
+				"sudo -u test-user pipx uninstall tox",
+				"sudo -u test-user pipx uninstall charmcraftcache",
+			},
+		},
+	}
+
+	tools := []*PythonTool{
+		NewPythonTool("tox==4.18.0"),
+		NewPythonTool("charmcraftcache"),
+	}
+
+	for _, tc := range tests {
+		system := system.NewMockSystem()
+		tc.testFunc(NewPythonToolHandler(system, tc.installer, tools, nil, nil))
+
+		if !reflect.DeepEqual(tc.expected, system.ExecutedCommands) {
+			t.Fatalf("expected: %v, got: %v", tc.expected, system.ExecutedCommands)
+		}
+	}
+}
+
+func TestPythonToolHandlerInventory(t *testing.T) {
+	tools := []*PythonTool{
+		NewPythonTool("tox==4.18.0"),
+		NewPythonTool("ruff"),
+		NewPythonTool("charmcraftcache"),
+	}
+
+	system := system.NewMockSystem()
+	system.MockCommandReturn("sudo -u test-user uv tool list", []byte("tox v4.11.3\n- tox\nruff v0.6.9\n- ruff\n"), nil)
+
+	inventory := config.NewInventory()
+	journal := config.NewJournal()
+	handler := NewPythonToolHandler(system, "", tools, inventory, journal)
+
+	err := handler.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCommands := []string{
+		"sudo -u test-user uv tool list",
+		"sudo -u test-user uv tool install tox==4.18.0 --force",
+		"sudo -u test-user uv tool install charmcraftcache",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	expectedTools := map[string]bool{"tox": true, "ruff": true, "charmcraftcache": false}
+	if !reflect.DeepEqual(expectedTools, inventory.PythonTools) {
+		t.Fatalf("expected: %v, got: %v", expectedTools, inventory.PythonTools)
+	}
+
+	// With every tool recorded in the journal, no tools should be installed again.
+	system.ExecutedCommands = nil
+	NewPythonToolHandler(system, "uv", tools, inventory, journal).Prepare(context.Background())
+
+	expectedCommands = []string{"sudo -u test-user uv tool list"}
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	system.ExecutedCommands = nil
+	handler.Restore(context.Background())
+
+	expectedCommands = []string{"sudo -u test-user uv tool uninstall charmcraftcache"}
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+}
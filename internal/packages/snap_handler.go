@@ -1,47 +1,91 @@
 package packages
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
 	"strings"
 
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
 	"github.com/jnsgruk/concierge/internal/system"
+	"gopkg.in/yaml.v3"
 )
 
-// NewSnapHandler constructs a new instance of a SnapHandler.
-func NewSnapHandler(system system.Worker, snaps []*system.Snap) *SnapHandler {
+// NewSnapHandler constructs a new instance of a SnapHandler. The state of each snap prior
+// to installation is recorded in the inventory, and each installed snap is recorded in the
+// journal, if they are provided.
+func NewSnapHandler(system system.Worker, snaps []*system.Snap, inventory *config.Inventory, journal *config.Journal) *SnapHandler {
 	return &SnapHandler{
-		Snaps:  snaps,
-		system: system,
+		Snaps:     snaps,
+		Results:   map[string]error{},
+		system:    system,
+		inventory: inventory,
+		journal:   journal,
 	}
 }
 
 // SnapHandler can install or remove a set of snaps.
 type SnapHandler struct {
-	Snaps  []*system.Snap
-	system system.Worker
+	Snaps []*system.Snap
+	// Results records the outcome of the most recent action for each snap, keyed by name.
+	// Snaps that were not acted upon have no entry.
+	Results map[string]error
+
+	system    system.Worker
+	inventory *config.Inventory
+	journal   *config.Journal
 }
 
-// Prepare installs a set of snaps on the machine.
-func (h *SnapHandler) Prepare() error {
+// Prepare installs a set of snaps on the machine. Snaps that the journal records as already
+// installed with the same channel, path, connections, aliases, config and services are skipped.
+func (h *SnapHandler) Prepare(ctx context.Context) error {
 	for _, snap := range h.Snaps {
-		err := h.installSnap(snap)
-		if err != nil {
-			return fmt.Errorf("failed to install snap: %w", err)
+		step := fmt.Sprintf("snap/%s", snap.Name)
+		if h.journal.Completed(step, snap.Channel, snap.Path, snap.Connections, snap.Aliases, snap.Config, snap.Services) {
+			slog.Info("Skipping completed step", "snap", snap.Name)
+			events.EmitStepSkipped(ctx, step)
+			h.Results[snap.Name] = nil
+			continue
 		}
 
-		err = h.connectSnap(snap)
+		events.EmitStepStarted(ctx, step)
+		err := h.prepareSnap(ctx, snap)
+		events.EmitStepFinished(ctx, step, err)
+		h.Results[snap.Name] = err
 		if err != nil {
-			return fmt.Errorf("failed to create snap connections: %w", err)
+			return err
 		}
+
+		h.journal.Complete(step, snap.Channel, snap.Path, snap.Connections, snap.Aliases, snap.Config, snap.Services)
 	}
 	return nil
 }
 
-// Restore removes a set of snaps from the machine.
-func (h *SnapHandler) Restore() error {
+// Restore removes a set of snaps from the machine. Snaps that were installed before concierge
+// ran are kept, and returned to their original channel and configuration if necessary, and
+// any connections and aliases created by concierge are removed.
+func (h *SnapHandler) Restore(ctx context.Context) error {
 	for _, snap := range h.Snaps {
-		err := h.removeSnap(snap)
+		step := fmt.Sprintf("snap/%s", snap.Name)
+		events.EmitStepStarted(ctx, step)
+
+		state, ok := h.inventory.SnapState(snap.Name)
+		if ok && state.Installed {
+			err := h.revertSnap(ctx, snap, state)
+			events.EmitStepFinished(ctx, step, err)
+			h.Results[snap.Name] = err
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := h.removeSnap(ctx, snap)
+		events.EmitStepFinished(ctx, step, err)
+		h.Results[snap.Name] = err
 		if err != nil {
 			return fmt.Errorf("failed to remove snap: %w", err)
 		}
@@ -49,71 +93,432 @@ func (h *SnapHandler) Restore() error {
 	return nil
 }
 
+// prepareSnap installs a single snap, forms its connections and creates its aliases, then
+// applies its configuration and service actions.
+func (h *SnapHandler) prepareSnap(ctx context.Context, s *system.Snap) error {
+	var err error
+	if s.Path != "" {
+		err = h.installSnapFile(ctx, s)
+	} else {
+		err = h.installSnap(ctx, s)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to install snap: %w", err)
+	}
+
+	err = h.connectSnap(ctx, s)
+	if err != nil {
+		return fmt.Errorf("failed to create snap connections: %w", err)
+	}
+
+	err = h.aliasSnap(ctx, s)
+	if err != nil {
+		return fmt.Errorf("failed to create snap aliases: %w", err)
+	}
+
+	err = h.configureSnap(ctx, s)
+	if err != nil {
+		return fmt.Errorf("failed to configure snap: %w", err)
+	}
+
+	err = h.controlServices(ctx, s)
+	if err != nil {
+		return fmt.Errorf("failed to control snap services: %w", err)
+	}
+
+	return nil
+}
+
 // installSnap ensures that the specified snap is installed at the specified channel.
 // If already installed, but on the wrong channel, the snap is refreshed.
-func (h *SnapHandler) installSnap(s *system.Snap) error {
+func (h *SnapHandler) installSnap(ctx context.Context, s *system.Snap) error {
 	slog.Debug("Installing snap", "snap", s.Name)
-	var action, logAction string
+	var logAction string
 
-	snapInfo, err := h.system.SnapInfo(s.Name, s.Channel)
+	snapInfo, err := h.system.SnapInfo(ctx, s.Name, s.Channel)
 	if err != nil {
 		return fmt.Errorf("failed to lookup snap details: %w", err)
 	}
 
+	h.inventory.RecordSnap(s.Name, config.SnapState{
+		Installed: snapInfo.Installed,
+		Channel:   snapInfo.TrackingChannel,
+	})
+
 	if snapInfo.Installed {
-		action = "refresh"
 		logAction = "Refreshed"
+		err = h.system.RefreshSnap(ctx, s.Name, s.Channel, snapInfo.Classic)
 	} else {
-		action = "install"
 		logAction = "Installed"
+		err = h.system.InstallSnap(ctx, s.Name, s.Channel, snapInfo.Classic)
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.Info(fmt.Sprintf("%s snap", logAction), "snap", s.Name)
+	return nil
+}
+
+// installSnapFile installs a snap from a local .snap file. If an assertion file with the same
+// name is present alongside the snap, it is acknowledged and the snap is installed as signed.
+// Otherwise, the snap is installed with '--dangerous'.
+func (h *SnapHandler) installSnapFile(ctx context.Context, s *system.Snap) error {
+	slog.Debug("Installing snap from file", "snap", s.Name, "path", s.Path)
+
+	snapInfo, err := h.system.InstalledSnapInfo(ctx, s.Name)
+	if err != nil {
+		return fmt.Errorf("failed to lookup snap details: %w", err)
+	}
+
+	h.inventory.RecordSnap(s.Name, config.SnapState{
+		Installed: snapInfo.Installed,
+		Channel:   snapInfo.TrackingChannel,
+		Revision:  snapInfo.Revision,
+	})
+
+	metadata, err := h.snapFileMetadata(ctx, s.Path)
+	if err != nil {
+		return err
+	}
+
+	if metadata.Name != s.Name {
+		return fmt.Errorf("snap file '%s' contains snap '%s', not '%s'", s.Path, metadata.Name, s.Name)
+	}
+
+	dangerous := true
+	assertion := strings.TrimSuffix(s.Path, ".snap") + ".assert"
+	if _, err := h.system.ReadFile(assertion); err == nil {
+		err = h.system.AckSnapAssertion(ctx, assertion)
+		if err != nil {
+			return err
+		}
+		dangerous = false
 	}
 
-	args := []string{action, s.Name}
+	err = h.system.InstallSnapFile(ctx, s.Path, dangerous, metadata.Confinement == "classic")
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Installed snap from file", "snap", s.Name, "path", s.Path, "dangerous", dangerous)
+	return nil
+}
+
+// snapFileMetadata describes the fields of a snap's meta/snap.yaml used by concierge.
+type snapFileMetadata struct {
+	Name        string `yaml:"name"`
+	Confinement string `yaml:"confinement"`
+}
+
+// snapFileMetadata reads the meta/snap.yaml file from within a local .snap file.
+func (h *SnapHandler) snapFileMetadata(ctx context.Context, path string) (*snapFileMetadata, error) {
+	cmd := system.NewCommand("unsquashfs", []string{"-n", "-cat", path, "meta/snap.yaml"})
+	cmd.ReadOnly = true
 
-	if s.Channel != "" {
-		args = append(args, "--channel", s.Channel)
+	output, err := h.system.Run(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata from snap file '%s': %w", path, err)
 	}
 
-	if snapInfo.Classic {
-		args = append(args, "--classic")
+	metadata := &snapFileMetadata{}
+	err = yaml.Unmarshal(output, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metadata from snap file '%s': %w", path, err)
 	}
 
-	cmd := system.NewCommand("snap", args)
-	_, err = h.system.RunExclusive(cmd)
+	return metadata, nil
+}
+
+// aliasSnap creates the specified aliases for the snap's applications. Aliases that already
+// refer to the same application are skipped, and aliases created by concierge are recorded in
+// the inventory.
+func (h *SnapHandler) aliasSnap(ctx context.Context, s *system.Snap) error {
+	if len(s.Aliases) == 0 {
+		return nil
+	}
+
+	existing, err := h.system.SnapAliases(ctx, s.Name)
 	if err != nil {
-		return fmt.Errorf("command failed: %w", err)
+		return err
 	}
 
-	slog.Info(fmt.Sprintf("%s snap", logAction), "snap", s.Name)
+	for _, alias := range slices.Sorted(maps.Keys(s.Aliases)) {
+		if app, ok := existing[alias]; ok && app == s.Aliases[alias] {
+			slog.Debug("Snap alias already exists", "snap", s.Name, "app", app, "alias", alias)
+			continue
+		}
+
+		err := h.system.AliasSnap(ctx, s.Name, s.Aliases[alias], alias)
+		if err != nil {
+			return fmt.Errorf("failed to create alias '%s': %w", alias, err)
+		}
+
+		h.inventory.RecordSnapAlias(s.Name, alias)
+		slog.Debug("Created snap alias", "snap", s.Name, "app", s.Aliases[alias], "alias", alias)
+	}
 	return nil
 }
 
-// connectSnap ensures that the specified snap interfaces are connected.
-func (h *SnapHandler) connectSnap(s *system.Snap) error {
+// connectSnap ensures that the specified snap interfaces are connected. Each connection is
+// checked against the plugs and slots known to snapd, and is skipped if already connected.
+// Connections formed by concierge are recorded in the inventory.
+func (h *SnapHandler) connectSnap(ctx context.Context, s *system.Snap) error {
+	if len(s.Connections) == 0 {
+		return nil
+	}
+
+	interfaces, err := h.system.SnapInterfaces(ctx)
+	if err != nil {
+		return err
+	}
+
 	for _, connection := range s.Connections {
-		parts := strings.Split(connection, " ")
-		if len(parts) > 2 {
-			return fmt.Errorf("too many arguments in snap connection string '%s'", connection)
+		conn, err := system.ParseSnapConnection(connection)
+		if err != nil {
+			return err
 		}
 
-		args := append([]string{"connect"}, parts...)
+		// A snap is only unknown to snapd if it has not been installed, such as during a
+		// dry run, in which case its connections cannot be checked.
+		if interfaces.Known(conn.Plug.Snap) {
+			conn, err = interfaces.Resolve(conn)
+			if err != nil {
+				return fmt.Errorf("invalid snap connection '%s': %w", connection, err)
+			}
 
-		cmd := system.NewCommand("snap", args)
-		_, err := h.system.RunExclusive(cmd)
+			if interfaces.Connected(conn) {
+				slog.Debug("Snap connection already exists", "snap", s.Name, "connection", conn)
+				continue
+			}
+		} else {
+			slog.Debug("Snap is not known to snapd, skipping connection checks", "snap", conn.Plug.Snap)
+		}
+
+		err = h.system.ConnectSnap(ctx, conn.Plug.String(), conn.Slot.String())
 		if err != nil {
-			return fmt.Errorf("command failed: %w", err)
+			return fmt.Errorf("failed to connect '%s': %w", connection, err)
 		}
+
+		h.inventory.RecordSnapConnection(s.Name, conn.String())
+		slog.Debug("Connected snap", "snap", s.Name, "connection", conn)
+	}
+	return nil
+}
+
+// configureSnap sets the configuration options of a snap that differ from their current
+// values. The original value of each option is recorded in the inventory.
+func (h *SnapHandler) configureSnap(ctx context.Context, s *system.Snap) error {
+	if len(s.Config) == 0 {
+		return nil
+	}
+
+	options := slices.Sorted(maps.Keys(s.Config))
+
+	current, err := h.system.SnapConfig(ctx, s.Name, options)
+	if err != nil {
+		return err
 	}
+
+	changes := map[string]string{}
+	for _, option := range options {
+		value, ok := current[option]
+		if ok {
+			h.inventory.RecordSnapConfig(s.Name, option, &value)
+		} else {
+			h.inventory.RecordSnapConfig(s.Name, option, nil)
+		}
+
+		if !ok || value != s.Config[option] {
+			changes[option] = s.Config[option]
+		}
+	}
+
+	if len(changes) == 0 {
+		slog.Debug("Snap configuration already up to date", "snap", s.Name)
+		return nil
+	}
+
+	err = h.system.SetSnapConfig(ctx, s.Name, changes)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Configured snap", "snap", s.Name, "options", slices.Sorted(maps.Keys(changes)))
+	return nil
+}
+
+// controlServices starts, stops, enables or disables the services of a snap, where their
+// current state differs from the requested action. Enabling a service also starts it, and
+// disabling a service also stops it.
+func (h *SnapHandler) controlServices(ctx context.Context, s *system.Snap) error {
+	if len(s.Services) == 0 {
+		return nil
+	}
+
+	services, err := h.system.SnapServices(ctx, s.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range slices.Sorted(maps.Keys(s.Services)) {
+		action := s.Services[service]
+
+		state, ok := services[service]
+		if !ok {
+			return fmt.Errorf("snap '%s' has no service named '%s'", s.Name, service)
+		}
+
+		switch action {
+		case "start":
+			if !state.Active {
+				err = h.system.StartSnapService(ctx, s.Name, service, false)
+			}
+		case "stop":
+			if state.Active {
+				err = h.system.StopSnapService(ctx, s.Name, service, false)
+			}
+		case "enable":
+			if !state.Enabled || !state.Active {
+				err = h.system.StartSnapService(ctx, s.Name, service, true)
+			}
+		case "disable":
+			if state.Enabled || state.Active {
+				err = h.system.StopSnapService(ctx, s.Name, service, true)
+			}
+		default:
+			return fmt.Errorf("unknown action '%s' for service '%s'", action, service)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s service '%s': %w", action, service, err)
+		}
+
+		slog.Debug("Snap service in desired state", "snap", s.Name, "service", service, "action", action)
+	}
+
+	return nil
+}
+
+// revertSnap returns a snap that was installed before concierge ran to its original channel
+// and configuration, and removes the connections and aliases created by concierge.
+func (h *SnapHandler) revertSnap(ctx context.Context, s *system.Snap, state config.SnapState) error {
+	for _, connection := range slices.Backward(state.Connections) {
+		conn, err := system.ParseSnapConnection(connection)
+		if err != nil {
+			return err
+		}
+
+		err = h.system.DisconnectSnap(ctx, conn.Plug.String(), conn.Slot.String())
+		if err != nil {
+			return fmt.Errorf("failed to disconnect '%s': %w", connection, err)
+		}
+	}
+
+	for _, alias := range slices.Backward(state.Aliases) {
+		err := h.system.UnaliasSnap(ctx, alias)
+		if err != nil {
+			return fmt.Errorf("failed to remove snap alias '%s': %w", alias, err)
+		}
+	}
+
+	err := h.revertSnapConfig(ctx, s, state.Config)
+	if err != nil {
+		return fmt.Errorf("failed to revert snap config: %w", err)
+	}
+
+	// A snap installed from a local file cannot be refreshed back onto its channel, so it is
+	// reverted to the revision that was installed instead.
+	if s.Path != "" {
+		err = h.revertSnapRevision(ctx, s, state.Revision)
+		if err != nil {
+			return fmt.Errorf("failed to revert snap revision: %w", err)
+		}
+		return nil
+	}
+
+	err = h.revertSnapChannel(ctx, s, state.Channel)
+	if err != nil {
+		return fmt.Errorf("failed to revert snap channel: %w", err)
+	}
+
+	return nil
+}
+
+// revertSnapConfig restores the original values of the configuration options set by
+// concierge, and unsets those options which were not originally set.
+func (h *SnapHandler) revertSnapConfig(ctx context.Context, s *system.Snap, original map[string]*string) error {
+	if len(original) == 0 {
+		return nil
+	}
+
+	restore := map[string]string{}
+	unset := []string{}
+
+	for _, option := range slices.Sorted(maps.Keys(original)) {
+		if original[option] == nil {
+			unset = append(unset, option)
+		} else {
+			restore[option] = *original[option]
+		}
+	}
+
+	if len(restore) > 0 {
+		err := h.system.SetSnapConfig(ctx, s.Name, restore)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(unset) > 0 {
+		err := h.system.UnsetSnapConfig(ctx, s.Name, unset)
+		if err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Reverted snap configuration", "snap", s.Name)
+	return nil
+}
+
+// revertSnapChannel refreshes a snap that was installed before concierge ran back onto the
+// channel it was originally tracking.
+func (h *SnapHandler) revertSnapChannel(ctx context.Context, s *system.Snap, channel string) error {
+	if channel == "" || channel == s.Channel {
+		slog.Info("Snap pre-dates concierge, not removing", "snap", s.Name)
+		return nil
+	}
+
+	err := h.system.RefreshSnap(ctx, s.Name, channel, false)
+	if err != nil {
+		return fmt.Errorf("failed to refresh snap '%s': %w", s.Name, err)
+	}
+
+	slog.Info("Reverted snap channel", "snap", s.Name, "channel", channel)
+	return nil
+}
+
+// revertSnapRevision reverts a snap that was installed before concierge ran, and that has
+// since been replaced with a local .snap file, to the revision that was originally installed.
+func (h *SnapHandler) revertSnapRevision(ctx context.Context, s *system.Snap, revision string) error {
+	if revision == "" {
+		slog.Warn("Original revision of snap is unknown, not reverting", "snap", s.Name)
+		return nil
+	}
+
+	err := h.system.RevertSnap(ctx, s.Name, revision)
+	if err != nil {
+		return fmt.Errorf("failed to revert snap '%s': %w", s.Name, err)
+	}
+
+	slog.Info("Reverted snap revision", "snap", s.Name, "revision", revision)
 	return nil
 }
 
-// removeSnap uninstalls the specified snap from the system, optionally purging its data.
-func (h *SnapHandler) removeSnap(s *system.Snap) error {
+// removeSnap uninstalls the specified snap from the system, purging its data.
+func (h *SnapHandler) removeSnap(ctx context.Context, s *system.Snap) error {
 	slog.Debug("Removing snap", "snap", s.Name)
-	args := []string{"remove", s.Name, "--purge"}
 
-	cmd := system.NewCommand("snap", args)
-	_, err := h.system.RunExclusive(cmd)
+	err := h.system.RemoveSnap(ctx, s.Name, true)
 	if err != nil {
 		return fmt.Errorf("failed to remove snap '%s': %w", s.Name, err)
 	}
@@ -1,9 +1,11 @@
 package packages
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
+	"github.com/jnsgruk/concierge/internal/config"
 	"github.com/jnsgruk/concierge/internal/system"
 )
 
@@ -15,7 +17,7 @@ func TestSnapHandlerCommands(t *testing.T) {
 
 	tests := []test{
 		{
-			func(s *SnapHandler) { s.Prepare() },
+			func(s *SnapHandler) { s.Prepare(context.Background()) },
 			[]string{
 				"snap refresh charmcraft --channel latest/stable --classic",
 				"snap install jq --channel latest/stable",
@@ -25,7 +27,7 @@ func TestSnapHandlerCommands(t *testing.T) {
 			},
 		},
 		{
-			func(s *SnapHandler) { s.Restore() },
+			func(s *SnapHandler) { s.Restore(context.Background()) },
 			[]string{
 				"snap remove charmcraft --purge",
 				"snap remove jq --purge",
@@ -46,7 +48,7 @@ func TestSnapHandlerCommands(t *testing.T) {
 			system.NewSnap("jhack", "latest/edge", []string{"jhack:dot-local-share-juju"}),
 		}
 
-		tc.testFunc(NewSnapHandler(r, snaps))
+		tc.testFunc(NewSnapHandler(r, snaps, nil, nil))
 
 		if !reflect.DeepEqual(tc.expected, r.ExecutedCommands) {
 			t.Fatalf("expected: %v, got: %v", tc.expected, r.ExecutedCommands)
@@ -54,3 +56,371 @@ func TestSnapHandlerCommands(t *testing.T) {
 	}
 
 }
+
+func TestSnapHandlerRecordsInventory(t *testing.T) {
+	r := system.NewMockSystem()
+	r.MockSnapStoreLookup("charmcraft", "latest/edge", true, true)
+
+	snaps := []*system.Snap{
+		system.NewSnap("charmcraft", "latest/stable", []string{}),
+		system.NewSnap("jq", "latest/stable", []string{}),
+	}
+
+	inventory := config.NewInventory()
+	NewSnapHandler(r, snaps, inventory, nil).Prepare(context.Background())
+
+	expected := map[string]config.SnapState{
+		"charmcraft": {Installed: true, Channel: "latest/edge"},
+		"jq":         {Installed: false},
+	}
+
+	if !reflect.DeepEqual(expected, inventory.Snaps) {
+		t.Fatalf("expected: %v, got: %v", expected, inventory.Snaps)
+	}
+}
+
+func TestSnapHandlerRestoreWithInventory(t *testing.T) {
+	r := system.NewMockSystem()
+
+	snaps := []*system.Snap{
+		system.NewSnap("charmcraft", "latest/stable", []string{}),
+		system.NewSnap("jq", "latest/stable", []string{}),
+		system.NewSnap("yq", "latest/stable", []string{}),
+		system.NewSnap("jhack", "latest/edge", []string{}),
+	}
+
+	inventory := config.NewInventory()
+	inventory.RecordSnap("charmcraft", config.SnapState{Installed: true, Channel: "3.x/stable"})
+	inventory.RecordSnap("jq", config.SnapState{Installed: true, Channel: "latest/stable"})
+	inventory.RecordSnap("yq", config.SnapState{Installed: false})
+
+	NewSnapHandler(r, snaps, inventory, nil).Restore(context.Background())
+
+	expected := []string{
+		"snap refresh charmcraft --channel 3.x/stable",
+		"snap remove yq --purge",
+		"snap remove jhack --purge",
+	}
+
+	if !reflect.DeepEqual(expected, r.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, r.ExecutedCommands)
+	}
+}
+
+func TestSnapHandlerSkipsCompletedSteps(t *testing.T) {
+	r := system.NewMockSystem()
+
+	snaps := []*system.Snap{
+		system.NewSnap("jq", "latest/stable", []string{}),
+		system.NewSnap("yq", "latest/stable", []string{}),
+	}
+
+	journal := config.NewJournal()
+	journal.Complete("snap/jq", "latest/stable", "", []string{}, map[string]string{}, map[string]string{}, map[string]string{})
+	journal.Complete("snap/yq", "latest/edge", "", []string{}, map[string]string{}, map[string]string{}, map[string]string{})
+
+	NewSnapHandler(r, snaps, nil, journal).Prepare(context.Background())
+
+	expected := []string{"snap install yq --channel latest/stable"}
+	if !reflect.DeepEqual(expected, r.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, r.ExecutedCommands)
+	}
+
+	if !journal.Completed("snap/yq", "latest/stable", "", []string{}, map[string]string{}, map[string]string{}, map[string]string{}) {
+		t.Fatalf("expected yq to be recorded in the journal: %v", journal.Steps)
+	}
+}
+
+func TestSnapHandlerConfigAndServices(t *testing.T) {
+	r := system.NewMockSystem()
+	r.MockSnapStoreLookup("lxd", "5.21/stable", false, true)
+	r.MockSnapConfig("lxd", "ui.enable", "true")
+	r.MockSnapConfig("lxd", "core.https-address", "127.0.0.1:8443")
+	r.MockSnapService("lxd", "daemon", true, true)
+	r.MockSnapService("lxd", "activate", true, false)
+	r.MockSnapService("lxd", "user-daemon", false, false)
+
+	snap := system.NewSnap("lxd", "5.21/stable", []string{})
+	snap.Config = map[string]string{
+		"ui.enable":          "true",
+		"core.https-address": "[::]:8443",
+		"core.trust-pwd":     "secret",
+	}
+	snap.Services = map[string]string{
+		"daemon":      "enable",
+		"activate":    "disable",
+		"user-daemon": "start",
+	}
+
+	inventory := config.NewInventory()
+	NewSnapHandler(r, []*system.Snap{snap}, inventory, nil).Prepare(context.Background())
+
+	expected := []string{
+		"snap refresh lxd --channel 5.21/stable",
+		"snap set lxd 'core.https-address=[::]:8443' core.trust-pwd=secret",
+		"snap stop --disable lxd.activate",
+		"snap start lxd.user-daemon",
+	}
+
+	if !reflect.DeepEqual(expected, r.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, r.ExecutedCommands)
+	}
+
+	state, _ := inventory.SnapState("lxd")
+	address, enabled := "127.0.0.1:8443", "true"
+	expectedConfig := map[string]*string{
+		"ui.enable":          &enabled,
+		"core.https-address": &address,
+		"core.trust-pwd":     nil,
+	}
+
+	if !reflect.DeepEqual(expectedConfig, state.Config) {
+		t.Fatalf("expected: %v, got: %v", expectedConfig, state.Config)
+	}
+}
+
+func TestSnapHandlerUnknownService(t *testing.T) {
+	r := system.NewMockSystem()
+	r.MockSnapService("lxd", "daemon", true, true)
+
+	snap := system.NewSnap("lxd", "5.21/stable", []string{})
+	snap.Services = map[string]string{"deamon": "stop"}
+
+	err := NewSnapHandler(r, []*system.Snap{snap}, nil, nil).Prepare(context.Background())
+
+	expected := "failed to control snap services: snap 'lxd' has no service named 'deamon'"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected: %v, got: %v", expected, err)
+	}
+}
+
+func TestSnapHandlerRestoreConfig(t *testing.T) {
+	r := system.NewMockSystem()
+
+	snap := system.NewSnap("lxd", "5.21/stable", []string{})
+	snap.Config = map[string]string{"ui.enable": "true", "core.https-address": "[::]:8443"}
+
+	address := "127.0.0.1:8443"
+	inventory := config.NewInventory()
+	inventory.RecordSnap("lxd", config.SnapState{Installed: true, Channel: "5.21/stable"})
+	inventory.RecordSnapConfig("lxd", "core.https-address", &address)
+	inventory.RecordSnapConfig("lxd", "ui.enable", nil)
+
+	NewSnapHandler(r, []*system.Snap{snap}, inventory, nil).Restore(context.Background())
+
+	expected := []string{
+		"snap set lxd core.https-address=127.0.0.1:8443",
+		"snap unset lxd ui.enable",
+	}
+
+	if !reflect.DeepEqual(expected, r.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, r.ExecutedCommands)
+	}
+}
+
+func TestSnapHandlerInstallsSnapFiles(t *testing.T) {
+	r := system.NewMockSystem()
+	r.MockCommandReturn("unsquashfs -n -cat ./jhack_0.4_amd64.snap meta/snap.yaml", []byte("name: jhack\nconfinement: strict\n"), nil)
+	r.MockCommandReturn("unsquashfs -n -cat ./build/concierge_1.0_amd64.snap meta/snap.yaml", []byte("name: concierge\nconfinement: classic\n"), nil)
+	r.MockFile("./build/concierge_1.0_amd64.assert", []byte("type: snap-declaration"))
+
+	jhack := system.NewSnapFromString("./jhack_0.4_amd64.snap")
+	jhack.Aliases = map[string]string{"jh": "jhack"}
+
+	snaps := []*system.Snap{
+		jhack,
+		system.NewSnapFromPath("./build/concierge_1.0_amd64.snap"),
+	}
+
+	NewSnapHandler(r, snaps, nil, nil).Prepare(context.Background())
+
+	expected := []string{
+		"unsquashfs -n -cat ./jhack_0.4_amd64.snap meta/snap.yaml",
+		"snap install ./jhack_0.4_amd64.snap --dangerous",
+		"snap alias jhack jh",
+		"unsquashfs -n -cat ./build/concierge_1.0_amd64.snap meta/snap.yaml",
+		"snap ack ./build/concierge_1.0_amd64.assert",
+		"snap install ./build/concierge_1.0_amd64.snap --classic",
+	}
+
+	if !reflect.DeepEqual(expected, r.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, r.ExecutedCommands)
+	}
+}
+
+func TestSnapHandlerRevertsSnapFileOverInstalledSnap(t *testing.T) {
+	r := system.NewMockSystem()
+	r.MockSnapStoreLookup("jhack", "latest/edge", false, true)
+	r.MockSnapRevision("jhack", "498")
+	r.MockCommandReturn("unsquashfs -n -cat ./jhack_0.4_amd64.snap meta/snap.yaml", []byte("name: jhack\nconfinement: strict\n"), nil)
+
+	inventory := config.NewInventory()
+
+	jhack := system.NewSnapFromPath("./jhack_0.4_amd64.snap")
+	err := NewSnapHandler(r, []*system.Snap{jhack}, inventory, nil).Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, _ := inventory.SnapState("jhack")
+	if state.Revision != "498" {
+		t.Fatalf("expected: %v, got: %v", "498", state.Revision)
+	}
+
+	r.ExecutedCommands = nil
+	jhack = system.NewSnapFromPath("./jhack_0.4_amd64.snap")
+	err = NewSnapHandler(r, []*system.Snap{jhack}, inventory, nil).Restore(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"snap revert jhack --revision 498"}
+
+	if !reflect.DeepEqual(expected, r.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, r.ExecutedCommands)
+	}
+}
+
+func TestSnapHandlerSnapFileNameMismatch(t *testing.T) {
+	r := system.NewMockSystem()
+	r.MockCommandReturn("unsquashfs -n -cat ./tools.snap meta/snap.yaml", []byte("name: jhack\n"), nil)
+
+	snaps := []*system.Snap{system.NewSnapFromPath("./tools.snap")}
+
+	err := NewSnapHandler(r, snaps, nil, nil).Prepare(context.Background())
+
+	expected := "failed to install snap: snap file './tools.snap' contains snap 'jhack', not 'tools'"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected: %v, got: %v", expected, err)
+	}
+}
+
+func TestSnapHandlerRestoreRemovesAliases(t *testing.T) {
+	r := system.NewMockSystem()
+
+	lxd := system.NewSnap("lxd", "5.21/stable", []string{})
+	lxd.Aliases = map[string]string{"lxc": "lxc"}
+	jhack := system.NewSnapFromPath("./jhack_0.4_amd64.snap")
+	jhack.Aliases = map[string]string{"jh": "jhack"}
+
+	inventory := config.NewInventory()
+	inventory.RecordSnap("lxd", config.SnapState{Installed: true, Channel: "5.21/stable"})
+	inventory.RecordSnapAlias("lxd", "lxc")
+	inventory.RecordSnap("jhack", config.SnapState{Installed: false})
+
+	NewSnapHandler(r, []*system.Snap{lxd, jhack}, inventory, nil).Restore(context.Background())
+
+	expected := []string{
+		"snap unalias lxc",
+		"snap remove jhack --purge",
+	}
+
+	if !reflect.DeepEqual(expected, r.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, r.ExecutedCommands)
+	}
+}
+
+func TestSnapHandlerKeepsExistingAliases(t *testing.T) {
+	r := system.NewMockSystem()
+	r.MockSnapStoreLookup("lxd", "5.21/stable", false, true)
+	r.MockSnapAlias("lxd", "lxc", "lxc")
+
+	lxd := system.NewSnap("lxd", "5.21/stable", []string{})
+	lxd.Aliases = map[string]string{"lxc": "lxc", "lxd-lxc": "lxc"}
+
+	inventory := config.NewInventory()
+	err := NewSnapHandler(r, []*system.Snap{lxd}, inventory, nil).Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"snap refresh lxd --channel 5.21/stable",
+		"snap alias lxd.lxc lxd-lxc",
+	}
+
+	if !reflect.DeepEqual(expected, r.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, r.ExecutedCommands)
+	}
+
+	r.ExecutedCommands = nil
+	err = NewSnapHandler(r, []*system.Snap{lxd}, inventory, nil).Restore(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{"snap unalias lxd-lxc"}
+
+	if !reflect.DeepEqual(expected, r.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, r.ExecutedCommands)
+	}
+}
+
+func TestSnapHandlerConnections(t *testing.T) {
+	r := system.NewMockSystem()
+	r.MockSnapPlug("juju", "lxd", "lxd")
+	r.MockSnapPlug("juju", "home", "home")
+	r.MockSnapSlot("lxd", "lxd", "lxd")
+	r.MockSnapSlot("snapd", "home", "home")
+	r.MockSnapConnection(system.SnapEndpoint{Snap: "juju", Name: "home"}, system.SnapEndpoint{Snap: "snapd", Name: "home"})
+
+	snap := system.NewSnap("juju", "3.6/stable", []string{"juju:home", "juju:lxd lxd"})
+
+	inventory := config.NewInventory()
+	NewSnapHandler(r, []*system.Snap{snap}, inventory, nil).Prepare(context.Background())
+
+	expected := []string{
+		"snap install juju --channel 3.6/stable",
+		"snap connect juju:lxd lxd:lxd",
+	}
+
+	if !reflect.DeepEqual(expected, r.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, r.ExecutedCommands)
+	}
+
+	state, _ := inventory.SnapState("juju")
+	if !reflect.DeepEqual([]string{"juju:lxd lxd:lxd"}, state.Connections) {
+		t.Fatalf("expected: %v, got: %v", []string{"juju:lxd lxd:lxd"}, state.Connections)
+	}
+}
+
+func TestSnapHandlerInvalidConnection(t *testing.T) {
+	r := system.NewMockSystem()
+	r.MockSnapPlug("jhack", "dot-local-share-juju", "personal-files")
+
+	snap := system.NewSnap("jhack", "latest/edge", []string{"jhack:dot-local-share-jujuu"})
+
+	err := NewSnapHandler(r, []*system.Snap{snap}, nil, nil).Prepare(context.Background())
+
+	expected := "failed to create snap connections: invalid snap connection 'jhack:dot-local-share-jujuu': snap 'jhack' has no plug named 'dot-local-share-jujuu'"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected: %v, got: %v", expected, err)
+	}
+}
+
+func TestSnapHandlerRestoreDisconnects(t *testing.T) {
+	r := system.NewMockSystem()
+
+	snaps := []*system.Snap{
+		system.NewSnap("juju", "3.6/stable", []string{"juju:lxd lxd", "juju:ssh-keys"}),
+		system.NewSnap("jhack", "latest/edge", []string{"jhack:dot-local-share-juju"}),
+	}
+
+	inventory := config.NewInventory()
+	inventory.RecordSnap("juju", config.SnapState{Installed: true, Channel: "3.6/stable"})
+	inventory.RecordSnapConnection("juju", "juju:lxd lxd:lxd")
+	inventory.RecordSnapConnection("juju", "juju:ssh-keys snapd:ssh-keys")
+	inventory.RecordSnap("jhack", config.SnapState{Installed: false})
+
+	NewSnapHandler(r, snaps, inventory, nil).Restore(context.Background())
+
+	expected := []string{
+		"snap disconnect juju:ssh-keys snapd:ssh-keys",
+		"snap disconnect juju:lxd lxd:lxd",
+		"snap remove jhack --purge",
+	}
+
+	if !reflect.DeepEqual(expected, r.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, r.ExecutedCommands)
+	}
+}
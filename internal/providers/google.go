@@ -1,10 +1,12 @@
 package providers
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 
 	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
 	"github.com/jnsgruk/concierge/internal/system"
 	"gopkg.in/yaml.v3"
 )
@@ -23,6 +25,9 @@ func NewGoogle(system system.Worker, config *config.Config) *Google {
 		credentials:          map[string]interface{}{},
 		modelDefaults:        config.Providers.Google.ModelDefaults,
 		bootstrapConstraints: config.Providers.Google.BootstrapConstraints,
+		controllers:          config.Providers.Google.Controllers,
+		agentVersion:         config.Providers.Google.AgentVersion,
+		extraBootstrapArgs:   config.Providers.Google.ExtraBootstrapArgs,
 	}
 }
 
@@ -34,12 +39,15 @@ type Google struct {
 	credentials          map[string]interface{}
 	modelDefaults        map[string]string
 	bootstrapConstraints map[string]string
+	controllers          []config.ControllerConfig
+	agentVersion         string
+	extraBootstrapArgs   []string
 }
 
 // Prepare installs and configures Google such that it can work in testing environments.
 // This includes installing the snap, enabling the user who ran concierge to interact
 // with Google without sudo, and deconflicting the firewall rules with docker.
-func (l *Google) Prepare() error {
+func (l *Google) Prepare(ctx context.Context) error {
 	contents, err := l.system.ReadFile(l.credentialsFile)
 	if err != nil {
 		return fmt.Errorf("failed to read credentials file: %w", err)
@@ -55,6 +63,7 @@ func (l *Google) Prepare() error {
 	l.credentials = credentials
 
 	slog.Info("Prepared provider", "provider", l.Name())
+	events.Emit(ctx, events.Event{Type: events.ProviderPrepared, Provider: l.Name()})
 	return nil
 }
 
@@ -79,8 +88,18 @@ func (l *Google) ModelDefaults() map[string]string { return l.modelDefaults }
 // BootstrapConstraints reports the Juju bootstrap-constraints specific to the provider.
 func (l *Google) BootstrapConstraints() map[string]string { return l.bootstrapConstraints }
 
+// Controllers reports the Juju controllers to be bootstrapped on the provider.
+func (l *Google) Controllers() []config.ControllerConfig { return l.controllers }
+
+// AgentVersion reports the Juju agent version to bootstrap on the provider, if specified.
+func (l *Google) AgentVersion() string { return l.agentVersion }
+
+// ExtraBootstrapArgs reports additional arguments passed to `juju bootstrap` on the provider.
+func (l *Google) ExtraBootstrapArgs() []string { return l.extraBootstrapArgs }
+
 // Remove Google provider.
-func (l *Google) Restore() error {
+func (l *Google) Restore(ctx context.Context) error {
 	slog.Info("Restored provider", "provider", l.Name())
+	events.Emit(ctx, events.Event{Type: events.ProviderRestored, Provider: l.Name()})
 	return nil
 }
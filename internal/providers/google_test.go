@@ -1,6 +1,7 @@
 package providers
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
@@ -65,7 +66,7 @@ func TestGooglePrepareCommands(t *testing.T) {
 
 	system := system.NewMockSystem()
 	uk8s := NewGoogle(system, config)
-	uk8s.Prepare()
+	uk8s.Prepare(context.Background())
 
 	if len(system.ExecutedCommands) != 0 {
 		t.Fatalf("expected no commands to have been run")
@@ -101,7 +102,7 @@ project-id: concierge
 	system.MockFile("credentials.yaml", creds)
 
 	google := NewGoogle(system, config)
-	google.Prepare()
+	google.Prepare(context.Background())
 
 	if !reflect.DeepEqual(google.Credentials(), fakeCredsMarshalled) {
 		t.Fatalf("expected: %v, got: %v", fakeCredsMarshalled, google.Credentials())
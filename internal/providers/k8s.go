@@ -1,13 +1,14 @@
 package providers
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
-	"path"
 	"strings"
 	"time"
 
 	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
 	"github.com/jnsgruk/concierge/internal/packages"
 	"github.com/jnsgruk/concierge/internal/system"
 )
@@ -15,6 +16,12 @@ import (
 // Default channel from which K8s is installed.
 const defaultK8sChannel = "1.32-classic/stable"
 
+// Image from which the virtual machines for additional K8s nodes are launched.
+const k8sNodeImage = "ubuntu:24.04"
+
+// Default resources allocated to the virtual machines for additional K8s nodes.
+var defaultK8sNodeResources = config.K8sNodeResources{CPU: 2, Memory: "4GiB", Disk: "20GiB"}
+
 // NewK8s constructs a new K8s provider instance.
 func NewK8s(r system.Worker, config *config.Config) *K8s {
 	var channel string
@@ -27,17 +34,32 @@ func NewK8s(r system.Worker, config *config.Config) *K8s {
 		channel = defaultK8sChannel
 	}
 
+	// Additional nodes are launched as LXD virtual machines. Unless the LXD provider is
+	// enabled, in which case the K8s provider depends on it, the K8s provider sets up LXD
+	// itself.
+	var lxd *LXD
+	if len(config.Providers.K8s.Nodes) > 0 && !config.Providers.LXD.Enable {
+		lxd = NewLXD(r, config)
+	}
+
 	return &K8s{
 		Channel:              channel,
 		Features:             config.Providers.K8s.Features,
+		nodes:                k8sNodes(config.Providers.K8s.Nodes),
+		lxd:                  lxd,
 		bootstrap:            config.Providers.K8s.Bootstrap,
 		modelDefaults:        config.Providers.K8s.ModelDefaults,
 		bootstrapConstraints: config.Providers.K8s.BootstrapConstraints,
+		controllers:          config.Providers.K8s.Controllers,
+		agentVersion:         config.Providers.K8s.AgentVersion,
+		extraBootstrapArgs:   config.Providers.K8s.ExtraBootstrapArgs,
 		system:               r,
 		snaps: []*system.Snap{
 			{Name: "k8s", Channel: channel},
 			{Name: "kubectl", Channel: "stable"},
 		},
+		inventory: config.Inventory,
+		users:     config.Users(),
 	}
 }
 
@@ -49,36 +71,50 @@ type K8s struct {
 	bootstrap            bool
 	modelDefaults        map[string]string
 	bootstrapConstraints map[string]string
-
-	system system.Worker
-	snaps  []*system.Snap
+	controllers          []config.ControllerConfig
+	agentVersion         string
+	extraBootstrapArgs   []string
+	nodes                []k8sNode
+	lxd                  *LXD
+
+	system    system.Worker
+	snaps     []*system.Snap
+	inventory *config.Inventory
+	// users is the list of users added to the provider's group, or given a kubeconfig.
+	users []string
 }
 
 // Prepare installs and configures K8s such that it can work in testing environments.
 // This includes installing the snap, enabling the user who ran concierge to interact
 // with K8s without sudo, and sets up the user's kubeconfig file.
-func (k *K8s) Prepare() error {
-	err := k.install()
+func (k *K8s) Prepare(ctx context.Context) error {
+	err := k.install(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to install K8s: %w", err)
 	}
 
-	err = k.init()
+	err = k.init(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to install K8s: %w", err)
 	}
 
-	err = k.configureFeatures()
+	err = k.joinNodes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to join K8s nodes: %w", err)
+	}
+
+	err = k.configureFeatures(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to enable K8s features: %w", err)
 	}
 
-	err = k.setupKubectl()
+	err = k.setupKubectl(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to setup kubectl for K8s: %w", err)
 	}
 
 	slog.Info("Prepared provider", "provider", k.Name())
+	events.Emit(ctx, events.Event{Type: events.ProviderPrepared, Provider: k.Name()})
 
 	return nil
 }
@@ -104,30 +140,54 @@ func (m *K8s) ModelDefaults() map[string]string { return m.modelDefaults }
 // BootstrapConstraints reports the Juju bootstrap-constraints specific to the provider.
 func (m *K8s) BootstrapConstraints() map[string]string { return m.bootstrapConstraints }
 
-// Remove uninstalls K8s and kubectl.
-func (k *K8s) Restore() error {
-	snapHandler := packages.NewSnapHandler(k.system, k.snaps)
+// Controllers reports the Juju controllers to be bootstrapped on the provider.
+func (m *K8s) Controllers() []config.ControllerConfig { return m.controllers }
+
+// AgentVersion reports the Juju agent version to bootstrap on the provider, if specified.
+func (m *K8s) AgentVersion() string { return m.agentVersion }
+
+// ExtraBootstrapArgs reports additional arguments passed to `juju bootstrap` on the provider.
+func (m *K8s) ExtraBootstrapArgs() []string { return m.extraBootstrapArgs }
 
-	err := snapHandler.Restore()
+// DependsOn reports the providers that must be prepared before, and restored after, K8s. The
+// virtual machines for additional nodes are launched on the LXD provider, if it is enabled.
+func (k *K8s) DependsOn() []string {
+	if len(k.nodes) > 0 && k.lxd == nil {
+		return []string{"lxd"}
+	}
+	return nil
+}
+
+// Remove uninstalls K8s and kubectl, and removes any additional nodes.
+func (k *K8s) Restore(ctx context.Context) error {
+	err := k.removeNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	snapHandler := packages.NewSnapHandler(k.system, k.snaps, k.inventory, nil)
+
+	err = snapHandler.Restore(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = k.system.RemoveAllHome(".kube")
+	err = restoreKubeconfigs(k.system, k.users, k.inventory)
 	if err != nil {
-		return fmt.Errorf("failed to remove '.kube' from user's home directory: %w", err)
+		return err
 	}
 
 	slog.Info("Removed provider", "provider", k.Name())
+	events.Emit(ctx, events.Event{Type: events.ProviderRestored, Provider: k.Name()})
 
 	return nil
 }
 
 // install ensures that K8s is installed.
-func (k *K8s) install() error {
-	snapHandler := packages.NewSnapHandler(k.system, k.snaps)
+func (k *K8s) install(ctx context.Context) error {
+	snapHandler := packages.NewSnapHandler(k.system, k.snaps, k.inventory, nil)
 
-	err := snapHandler.Prepare()
+	err := snapHandler.Prepare(ctx)
 	if err != nil {
 		return err
 	}
@@ -136,36 +196,179 @@ func (k *K8s) install() error {
 }
 
 // init ensures that K8s is installed, minimally configured, and ready.
-func (k *K8s) init() error {
-	if k.needsBootstrap() {
+func (k *K8s) init(ctx context.Context) error {
+	if k.needsBootstrap(ctx) {
 		cmd := system.NewCommand("k8s", []string{"bootstrap"})
-		_, err := k.system.RunWithRetries(cmd, (5 * time.Minute))
+		_, err := k.system.RunWithRetries(ctx, cmd, (5 * time.Minute))
 		if err != nil {
 			return err
 		}
 	}
 
 	cmd := system.NewCommand("k8s", []string{"status", "--wait-ready"})
-	_, err := k.system.RunWithRetries(cmd, (5 * time.Minute))
+	_, err := k.system.RunWithRetries(ctx, cmd, (5 * time.Minute))
+
+	return err
+}
+
+// joinNodes launches a LXD virtual machine for each additional node, joins it to the cluster,
+// then waits for every node in the cluster to be ready.
+func (k *K8s) joinNodes(ctx context.Context) error {
+	if len(k.nodes) == 0 {
+		return nil
+	}
+
+	err := k.prepareLXD(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range k.nodes {
+		err := k.launchNode(ctx, node)
+		if err != nil {
+			return fmt.Errorf("failed to launch node '%s': %w", node.Name, err)
+		}
+
+		err = k.joinNode(ctx, node)
+		if err != nil {
+			return fmt.Errorf("failed to join node '%s' to cluster: %w", node.Name, err)
+		}
+	}
+
+	args := []string{"kubectl", "wait", "--for=condition=Ready", "nodes", "--all", "--timeout=5m"}
+	cmd := system.NewCommand("k8s", args)
+	_, err = k.system.RunWithRetries(ctx, cmd, (10 * time.Minute))
+	if err != nil {
+		return fmt.Errorf("failed waiting for K8s nodes to be ready: %w", err)
+	}
+
+	return nil
+}
+
+// prepareLXD sets up LXD to launch virtual machines, unless the LXD provider is enabled, in
+// which case it has already been prepared.
+func (k *K8s) prepareLXD(ctx context.Context) error {
+	if k.lxd == nil {
+		return nil
+	}
+
+	return k.lxd.setup(ctx)
+}
+
+// launchNode launches the virtual machine for a node, unless it already exists, and installs
+// K8s inside it.
+func (k *K8s) launchNode(ctx context.Context, node k8sNode) error {
+	if !k.nodeExists(ctx, node) {
+		slog.Info("Launching K8s node", "node", node.Name, "role", node.Role)
+
+		args := []string{
+			"launch", k8sNodeImage, node.Name, "--vm",
+			"-c", fmt.Sprintf("limits.cpu=%d", node.Resources.CPU),
+			"-c", fmt.Sprintf("limits.memory=%s", node.Resources.Memory),
+			"-d", fmt.Sprintf("root,size=%s", node.Resources.Disk),
+		}
+
+		cmd := system.NewCommand("lxc", args)
+		_, err := k.system.RunWithRetries(ctx, cmd, (5 * time.Minute))
+		if err != nil {
+			return err
+		}
+	}
+
+	// The LXD agent in the virtual machine takes some time to start after launch.
+	cmd := system.NewCommand("lxc", []string{"exec", node.Name, "--", "cloud-init", "status", "--wait"})
+	_, err := k.system.RunWithRetries(ctx, cmd, (5 * time.Minute))
+	if err != nil {
+		return err
+	}
+
+	args := []string{"exec", node.Name, "--", "snap", "install", "k8s", "--classic", "--channel", k.Channel}
+	cmd = system.NewCommand("lxc", args)
+	_, err = k.system.RunWithRetries(ctx, cmd, (5 * time.Minute))
 
 	return err
 }
 
+// joinNode joins a node to the cluster, unless it is already part of the cluster.
+func (k *K8s) joinNode(ctx context.Context, node k8sNode) error {
+	cmd := system.NewCommand("lxc", []string{"exec", node.Name, "--", "k8s", "status"})
+	cmd.ReadOnly = true
+	_, err := k.system.Run(ctx, cmd)
+	if err == nil {
+		slog.Info("K8s node already joined to cluster", "node", node.Name)
+		return nil
+	}
+
+	args := []string{"get-join-token", node.Name}
+	if node.Role == "worker" {
+		args = append(args, "--worker")
+	}
+
+	cmd = system.NewCommand("k8s", args)
+	cmd.Sensitive = true
+	token, err := k.system.Run(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to generate join token: %w", err)
+	}
+
+	args = []string{"exec", node.Name, "--", "k8s", "join-cluster", strings.TrimSpace(string(token))}
+	cmd = system.NewCommand("lxc", args)
+	_, err = k.system.RunWithRetries(ctx, cmd, (5 * time.Minute))
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Joined K8s node to cluster", "node", node.Name, "role", node.Role)
+	return nil
+}
+
+// removeNodes deletes the virtual machines for any additional nodes, then reverses the setup
+// of LXD if it was set up by the K8s provider.
+func (k *K8s) removeNodes(ctx context.Context) error {
+	for _, node := range k.nodes {
+		if !k.nodeExists(ctx, node) {
+			continue
+		}
+
+		cmd := system.NewCommand("lxc", []string{"delete", "--force", node.Name})
+		_, err := k.system.Run(ctx, cmd)
+		if err != nil {
+			return fmt.Errorf("failed to delete K8s node '%s': %w", node.Name, err)
+		}
+
+		slog.Info("Removed K8s node", "node", node.Name)
+	}
+
+	if k.lxd != nil {
+		return k.lxd.teardown(ctx)
+	}
+
+	return nil
+}
+
+// nodeExists reports whether the virtual machine for a node has been launched.
+func (k *K8s) nodeExists(ctx context.Context, node k8sNode) bool {
+	cmd := system.NewCommand("lxc", []string{"info", node.Name})
+	cmd.ReadOnly = true
+	_, err := k.system.Run(ctx, cmd)
+	return err == nil
+}
+
 // configureFeatures iterates over the specified features, enabling and configuring them.
-func (k *K8s) configureFeatures() error {
+func (k *K8s) configureFeatures(ctx context.Context) error {
 	for featureName, conf := range k.Features {
 		for key, value := range conf {
 			featureConfig := fmt.Sprintf("%s.%s=%s", featureName, key, value)
 
 			cmd := system.NewCommand("k8s", []string{"set", featureConfig})
-			_, err := k.system.Run(cmd)
+			_, err := k.system.Run(ctx, cmd)
 			if err != nil {
 				return fmt.Errorf("failed to set K8s feature config '%s': %w", featureConfig, err)
 			}
 		}
 
 		cmd := system.NewCommand("k8s", []string{"enable", featureName})
-		_, err := k.system.RunWithRetries(cmd, (5 * time.Minute))
+		_, err := k.system.RunWithRetries(ctx, cmd, (5 * time.Minute))
 		if err != nil {
 			return fmt.Errorf("failed to enable K8s addon '%s': %w", featureName, err)
 		}
@@ -176,19 +379,21 @@ func (k *K8s) configureFeatures() error {
 
 // setupKubectl both installs the kubectl snap, and writes the relevant kubeconfig
 // file to the user's home directory such that kubectl works with K8s.
-func (k *K8s) setupKubectl() error {
+func (k *K8s) setupKubectl(ctx context.Context) error {
 	cmd := system.NewCommand("k8s", []string{"kubectl", "config", "view", "--raw"})
-	result, err := k.system.Run(cmd)
+	cmd.Sensitive = true
+	result, err := k.system.Run(ctx, cmd)
 	if err != nil {
 		return fmt.Errorf("failed to fetch K8s configuration: %w", err)
 	}
 
-	return k.system.WriteHomeDirFile(path.Join(".kube", "config"), result)
+	return writeKubeconfigs(k.system, k.users, k.inventory, result)
 }
 
-func (k *K8s) needsBootstrap() bool {
+func (k *K8s) needsBootstrap(ctx context.Context) bool {
 	cmd := system.NewCommand("k8s", []string{"status"})
-	output, err := k.system.Run(cmd)
+	cmd.ReadOnly = true
+	output, err := k.system.Run(ctx, cmd)
 
 	if err != nil && strings.Contains(string(output), "Error: The node is not part of a Kubernetes cluster.") {
 		return true
@@ -196,3 +401,46 @@ func (k *K8s) needsBootstrap() bool {
 
 	return false
 }
+
+// k8sNode represents an additional node in the K8s cluster.
+type k8sNode struct {
+	Name      string
+	Role      string
+	Resources config.K8sNodeResources
+}
+
+// k8sNodes expands the configured sets of nodes into a list of individual nodes, each with a
+// unique name, and applies the default role and resources.
+func k8sNodes(nodeConfigs []config.K8sNodeConfig) []k8sNode {
+	var nodes []k8sNode
+	counts := map[string]int{}
+
+	for _, nc := range nodeConfigs {
+		role := nc.Role
+		if role == "" {
+			role = "worker"
+		}
+
+		resources := nc.Resources
+		if resources.CPU == 0 {
+			resources.CPU = defaultK8sNodeResources.CPU
+		}
+		if resources.Memory == "" {
+			resources.Memory = defaultK8sNodeResources.Memory
+		}
+		if resources.Disk == "" {
+			resources.Disk = defaultK8sNodeResources.Disk
+		}
+
+		for i := 0; i < max(nc.Count, 1); i++ {
+			counts[role]++
+			nodes = append(nodes, k8sNode{
+				Name:      fmt.Sprintf("concierge-k8s-%s-%d", role, counts[role]),
+				Role:      role,
+				Resources: resources,
+			})
+		}
+	}
+
+	return nodes
+}
@@ -1,7 +1,10 @@
 package providers
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path"
 	"reflect"
 	"slices"
 	"testing"
@@ -94,7 +97,7 @@ func TestK8sPrepareCommands(t *testing.T) {
 	system.MockCommandReturn("k8s status", []byte("Error: The node is not part of a Kubernetes cluster."), fmt.Errorf("command error"))
 
 	ck8s := NewK8s(system, config)
-	ck8s.Prepare()
+	ck8s.Prepare(context.Background())
 
 	slices.Sort(expectedCommands)
 	slices.Sort(system.ExecutedCommands)
@@ -132,7 +135,7 @@ func TestK8sPrepareCommandsAlreadyBootstrapped(t *testing.T) {
 
 	system := system.NewMockSystem()
 	ck8s := NewK8s(system, config)
-	ck8s.Prepare()
+	ck8s.Prepare(context.Background())
 
 	slices.Sort(expectedCommands)
 	slices.Sort(system.ExecutedCommands)
@@ -147,13 +150,14 @@ func TestK8sPrepareCommandsAlreadyBootstrapped(t *testing.T) {
 }
 
 func TestK8sRestore(t *testing.T) {
-	config := &config.Config{}
+	config := &config.Config{Inventory: config.NewInventory()}
 	config.Providers.K8s.Channel = ""
 	config.Providers.K8s.Features = defaultFeatureConfig
+	config.Inventory.RecordFile(path.Join(os.TempDir(), ".kube/config"), false)
 
 	system := system.NewMockSystem()
 	ck8s := NewK8s(system, config)
-	ck8s.Restore()
+	ck8s.Restore(context.Background())
 
 	expectedDeleted := []string{".kube"}
 
@@ -170,3 +174,242 @@ func TestK8sRestore(t *testing.T) {
 		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
 	}
 }
+
+func TestK8sPrepareBacksUpExistingKubeconfig(t *testing.T) {
+	inventory := config.NewInventory()
+
+	config := &config.Config{Inventory: inventory}
+
+	system := system.NewMockSystem()
+	system.MockFile(".kube/config", []byte("original"))
+	system.MockCommandReturn("k8s kubectl config view --raw", []byte("concierge"), nil)
+
+	ck8s := NewK8s(system, config)
+	ck8s.Prepare(context.Background())
+
+	expectedFiles := map[string]string{
+		".cache/concierge/backups/.kube/config": "original",
+		".kube/config":                          "concierge",
+	}
+
+	if !reflect.DeepEqual(expectedFiles, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expectedFiles, system.CreatedFiles)
+	}
+
+	if !inventory.FileExisted(path.Join(os.TempDir(), ".kube/config")) {
+		t.Fatalf("expected existing kubeconfig to be recorded in the inventory")
+	}
+}
+
+func TestK8sRestoreExistingKubeconfig(t *testing.T) {
+	inventory := config.NewInventory()
+	inventory.RecordFile(path.Join(os.TempDir(), ".kube/config"), true)
+	inventory.RecordSnap("kubectl", config.SnapState{Installed: true, Channel: "latest/stable"})
+
+	config := &config.Config{Inventory: inventory}
+
+	system := system.NewMockSystem()
+	system.MockFile(".cache/concierge/backups/.kube/config", []byte("original"))
+
+	ck8s := NewK8s(system, config)
+	ck8s.Restore(context.Background())
+
+	expectedCommands := []string{
+		"snap remove k8s --purge",
+		"snap refresh kubectl --channel latest/stable",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	expectedFiles := map[string]string{".kube/config": "original"}
+	if !reflect.DeepEqual(expectedFiles, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expectedFiles, system.CreatedFiles)
+	}
+
+	expectedDeleted := []string{".cache/concierge/backups/.kube/config"}
+	if !reflect.DeepEqual(expectedDeleted, system.Deleted) {
+		t.Fatalf("expected: %v, got: %v", expectedDeleted, system.Deleted)
+	}
+}
+
+func TestK8sRestoreKeepsUnrecordedKubeconfig(t *testing.T) {
+	config := &config.Config{Inventory: config.NewInventory()}
+
+	system := system.NewMockSystem()
+	ck8s := NewK8s(system, config)
+
+	err := ck8s.Restore(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(system.Deleted) > 0 {
+		t.Fatalf("expected no files to be removed, got: %v", system.Deleted)
+	}
+}
+
+func TestK8sPrepareMultipleUsers(t *testing.T) {
+	inventory := config.NewInventory()
+
+	config := &config.Config{Inventory: inventory}
+	config.Host.Users = []string{"test-user", "alice"}
+
+	system := system.NewMockSystem()
+	system.MockFile("/home/alice/.kube/config", []byte("original"))
+	system.MockCommandReturn("k8s kubectl config view --raw", []byte("concierge"), nil)
+
+	ck8s := NewK8s(system, config)
+	err := ck8s.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFiles := map[string]string{
+		".kube/config": "concierge",
+		"/home/alice/.cache/concierge/backups/.kube/config": "original",
+		"/home/alice/.kube/config":                          "concierge",
+	}
+
+	if !reflect.DeepEqual(expectedFiles, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expectedFiles, system.CreatedFiles)
+	}
+
+	expectedInventory := map[string]bool{
+		path.Join(os.TempDir(), ".kube/config"): false,
+		"/home/alice/.kube/config":              true,
+	}
+
+	if !reflect.DeepEqual(expectedInventory, inventory.Files) {
+		t.Fatalf("expected: %v, got: %v", expectedInventory, inventory.Files)
+	}
+
+	system.ExecutedCommands = nil
+	system.Deleted = nil
+	system.CreatedFiles = map[string]string{}
+	system.MockFile("/home/alice/.cache/concierge/backups/.kube/config", []byte("original"))
+
+	err = ck8s.Restore(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedDeleted := []string{".kube", "/home/alice/.cache/concierge/backups/.kube/config"}
+	if !reflect.DeepEqual(expectedDeleted, system.Deleted) {
+		t.Fatalf("expected: %v, got: %v", expectedDeleted, system.Deleted)
+	}
+
+	expectedFiles = map[string]string{"/home/alice/.kube/config": "original"}
+	if !reflect.DeepEqual(expectedFiles, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expectedFiles, system.CreatedFiles)
+	}
+}
+
+func TestK8sPrepareCommandsWithNodes(t *testing.T) {
+	conf := &config.Config{}
+	conf.Providers.LXD.Enable = true
+	conf.Providers.K8s.Nodes = []config.K8sNodeConfig{
+		{Role: "control-plane", Count: 2},
+		{Resources: config.K8sNodeResources{CPU: 4, Memory: "8GiB"}},
+	}
+
+	expectedCommands := []string{
+		fmt.Sprintf("snap install k8s --channel %s", defaultK8sChannel),
+		"snap install kubectl --channel stable",
+		"k8s status",
+		"k8s status --wait-ready",
+	}
+
+	for _, node := range []struct{ name, flags, joinFlags string }{
+		{name: "concierge-k8s-control-plane-1", flags: "-c limits.cpu=2 -c limits.memory=4GiB -d root,size=20GiB"},
+		{name: "concierge-k8s-control-plane-2", flags: "-c limits.cpu=2 -c limits.memory=4GiB -d root,size=20GiB"},
+		{name: "concierge-k8s-worker-1", flags: "-c limits.cpu=4 -c limits.memory=8GiB -d root,size=20GiB", joinFlags: " --worker"},
+	} {
+		expectedCommands = append(expectedCommands,
+			fmt.Sprintf("lxc info %s", node.name),
+			fmt.Sprintf("lxc launch ubuntu:24.04 %s --vm %s", node.name, node.flags),
+			fmt.Sprintf("lxc exec %s -- cloud-init status --wait", node.name),
+			fmt.Sprintf("lxc exec %s -- snap install k8s --classic --channel %s", node.name, defaultK8sChannel),
+			fmt.Sprintf("lxc exec %s -- k8s status", node.name),
+			fmt.Sprintf("k8s get-join-token %s%s", node.name, node.joinFlags),
+			fmt.Sprintf("lxc exec %s -- k8s join-cluster token-%s", node.name, node.name),
+		)
+	}
+
+	expectedCommands = append(expectedCommands,
+		"k8s kubectl wait --for=condition=Ready nodes --all --timeout=5m",
+		"k8s kubectl config view --raw",
+	)
+
+	system := system.NewMockSystem()
+	for _, name := range []string{"concierge-k8s-control-plane-1", "concierge-k8s-control-plane-2", "concierge-k8s-worker-1"} {
+		system.MockCommandReturn(fmt.Sprintf("lxc info %s", name), []byte("Error: Instance not found"), fmt.Errorf("command error"))
+		system.MockCommandReturn(fmt.Sprintf("lxc exec %s -- k8s status", name), []byte("Error: The node is not part of a Kubernetes cluster."), fmt.Errorf("command error"))
+		system.MockCommandReturn(fmt.Sprintf("k8s get-join-token %s", name), []byte(fmt.Sprintf("token-%s\n", name)), nil)
+		system.MockCommandReturn(fmt.Sprintf("k8s get-join-token %s --worker", name), []byte(fmt.Sprintf("token-%s\n", name)), nil)
+	}
+
+	ck8s := NewK8s(system, conf)
+	err := ck8s.Prepare(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+}
+
+func TestK8sRestoreWithNodes(t *testing.T) {
+	conf := &config.Config{Inventory: config.NewInventory()}
+	conf.Providers.K8s.Nodes = []config.K8sNodeConfig{{Count: 2}}
+	conf.Inventory.RecordGroup("test-user", "lxd", false)
+
+	system := system.NewMockSystem()
+	system.MockCommandReturn("lxc info concierge-k8s-worker-2", []byte("Error: Instance not found"), fmt.Errorf("command error"))
+
+	ck8s := NewK8s(system, conf)
+	ck8s.Restore(context.Background())
+
+	// LXD is restored in the same way as by the LXD provider, because the K8s provider set
+	// it up.
+	expectedCommands := []string{
+		"lxc info concierge-k8s-worker-1",
+		"lxc delete --force concierge-k8s-worker-1",
+		"lxc info concierge-k8s-worker-2",
+		"gpasswd -d test-user lxd",
+		"snap remove lxd --purge",
+		"snap remove k8s --purge",
+		"snap remove kubectl --purge",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+}
+
+func TestK8sDependsOn(t *testing.T) {
+	type test struct {
+		nodes     []config.K8sNodeConfig
+		lxdEnable bool
+		expected  []string
+	}
+
+	tests := []test{
+		{nodes: nil, lxdEnable: true, expected: nil},
+		{nodes: []config.K8sNodeConfig{{Count: 1}}, lxdEnable: false, expected: nil},
+		{nodes: []config.K8sNodeConfig{{Count: 1}}, lxdEnable: true, expected: []string{"lxd"}},
+	}
+
+	for _, tc := range tests {
+		conf := &config.Config{}
+		conf.Providers.K8s.Nodes = tc.nodes
+		conf.Providers.LXD.Enable = tc.lxdEnable
+
+		dependencies := Dependencies(NewK8s(system.NewMockSystem(), conf))
+		if !reflect.DeepEqual(tc.expected, dependencies) {
+			t.Fatalf("expected: %v, got: %v", tc.expected, dependencies)
+		}
+	}
+}
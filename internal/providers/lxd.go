@@ -1,10 +1,12 @@
 package providers
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 
 	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
 	"github.com/jnsgruk/concierge/internal/packages"
 	"github.com/jnsgruk/concierge/internal/system"
 )
@@ -24,7 +26,12 @@ func NewLXD(r system.Worker, config *config.Config) *LXD {
 		bootstrap:            config.Providers.LXD.Bootstrap,
 		modelDefaults:        config.Providers.LXD.ModelDefaults,
 		bootstrapConstraints: config.Providers.LXD.BootstrapConstraints,
+		controllers:          config.Providers.LXD.Controllers,
+		agentVersion:         config.Providers.LXD.AgentVersion,
+		extraBootstrapArgs:   config.Providers.LXD.ExtraBootstrapArgs,
 		snaps:                []*system.Snap{{Name: "lxd", Channel: channel}},
+		inventory:            config.Inventory,
+		users:                config.Users(),
 	}
 }
 
@@ -35,36 +42,28 @@ type LXD struct {
 	bootstrap            bool
 	modelDefaults        map[string]string
 	bootstrapConstraints map[string]string
-
-	system system.Worker
-	snaps  []*system.Snap
+	controllers          []config.ControllerConfig
+	agentVersion         string
+	extraBootstrapArgs   []string
+
+	system    system.Worker
+	snaps     []*system.Snap
+	inventory *config.Inventory
+	// users is the list of users added to the provider's group, or given a kubeconfig.
+	users []string
 }
 
 // Prepare installs and configures LXD such that it can work in testing environments.
 // This includes installing the snap, enabling the user who ran concierge to interact
 // with LXD without sudo, and deconflicting the firewall rules with docker.
-func (l *LXD) Prepare() error {
-	err := l.install()
-	if err != nil {
-		return fmt.Errorf("failed to install LXD: %w", err)
-	}
-
-	err = l.init()
-	if err != nil {
-		return fmt.Errorf("failed to initialise LXD: %w", err)
-	}
-
-	err = l.enableNonRootUserControl()
-	if err != nil {
-		return fmt.Errorf("failed to enable non-root LXD access: %w", err)
-	}
-
-	err = l.deconflictFirewall()
+func (l *LXD) Prepare(ctx context.Context) error {
+	err := l.setup(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to adjust firewall rules for LXD: %w", err)
+		return err
 	}
 
 	slog.Info("Prepared provider", "provider", l.Name())
+	events.Emit(ctx, events.Event{Type: events.ProviderPrepared, Provider: l.Name()})
 	return nil
 }
 
@@ -89,30 +88,77 @@ func (l *LXD) ModelDefaults() map[string]string { return l.modelDefaults }
 // BootstrapConstraints reports the Juju bootstrap-constraints specific to the provider.
 func (l *LXD) BootstrapConstraints() map[string]string { return l.bootstrapConstraints }
 
-// Remove uninstalls LXD.
-func (l *LXD) Restore() error {
-	snapHandler := packages.NewSnapHandler(l.system, l.snaps)
+// Controllers reports the Juju controllers to be bootstrapped on the provider.
+func (l *LXD) Controllers() []config.ControllerConfig { return l.controllers }
 
-	err := snapHandler.Restore()
+// AgentVersion reports the Juju agent version to bootstrap on the provider, if specified.
+func (l *LXD) AgentVersion() string { return l.agentVersion }
+
+// ExtraBootstrapArgs reports additional arguments passed to `juju bootstrap` on the provider.
+func (l *LXD) ExtraBootstrapArgs() []string { return l.extraBootstrapArgs }
+
+// Remove uninstalls LXD.
+func (l *LXD) Restore(ctx context.Context) error {
+	err := l.teardown(ctx)
 	if err != nil {
 		return err
 	}
 
 	slog.Info("Restored provider", "provider", l.Name())
+	events.Emit(ctx, events.Event{Type: events.ProviderRestored, Provider: l.Name()})
 	return nil
 }
 
+// setup installs and configures LXD. It is shared by the LXD provider, and by the K8s provider
+// when it installs LXD to launch additional nodes.
+func (l *LXD) setup(ctx context.Context) error {
+	err := l.install(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to install LXD: %w", err)
+	}
+
+	err = l.init(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialise LXD: %w", err)
+	}
+
+	err = l.enableNonRootUserControl(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to enable non-root LXD access: %w", err)
+	}
+
+	err = l.deconflictFirewall(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to adjust firewall rules for LXD: %w", err)
+	}
+
+	return nil
+}
+
+// teardown reverses setup, removing the users from the 'lxd' group and uninstalling LXD, along
+// with its configuration, unless it was installed before concierge ran.
+func (l *LXD) teardown(ctx context.Context) error {
+	err := removeUsersFromGroup(ctx, l.system, l.users, l.inventory, l.GroupName())
+	if err != nil {
+		return err
+	}
+
+	snapHandler := packages.NewSnapHandler(l.system, l.snaps, l.inventory, nil)
+
+	return snapHandler.Restore(ctx)
+}
+
 // install ensures that LXD is installed.
-func (l *LXD) install() error {
+func (l *LXD) install(ctx context.Context) error {
 	// Check if LXD is already installed, and stop the snap if it is.
-	restart, err := l.workaroundRefresh()
+	restart, err := l.workaroundRefresh(ctx)
 	if err != nil {
 		return err
 	}
 
-	snapHandler := packages.NewSnapHandler(l.system, l.snaps)
+	snapHandler := packages.NewSnapHandler(l.system, l.snaps, l.inventory, nil)
 
-	err = snapHandler.Prepare()
+	err = snapHandler.Prepare(ctx)
 	if err != nil {
 		return err
 	}
@@ -120,11 +166,9 @@ func (l *LXD) install() error {
 	// If we stopped the LXD snap, make sure we start it again now the refresh
 	// has happened.
 	if restart {
-		args := []string{"start", l.Name()}
-		cmd := system.NewCommand("snap", args)
-		_, err = l.system.RunExclusive(cmd)
+		err = l.system.StartSnapService(ctx, l.Name(), "", false)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to start snap '%s': %w", l.Name(), err)
 		}
 	}
 
@@ -132,8 +176,8 @@ func (l *LXD) install() error {
 }
 
 // init ensures that LXD is minimally configured, and ready.
-func (l *LXD) init() error {
-	return l.system.RunMany(
+func (l *LXD) init(ctx context.Context) error {
+	return l.system.RunMany(ctx,
 		system.NewCommand("lxd", []string{"waitready"}),
 		system.NewCommand("lxd", []string{"init", "--minimal"}),
 		system.NewCommand("lxc", []string{"network", "set", "lxdbr0", "ipv6.address", "none"}),
@@ -141,20 +185,21 @@ func (l *LXD) init() error {
 }
 
 // enableNonRootUserControl ensures the current user is in the `lxd` group.
-func (l *LXD) enableNonRootUserControl() error {
-	username := l.system.User().Username
+func (l *LXD) enableNonRootUserControl(ctx context.Context) error {
+	cmd := system.NewCommand("chmod", []string{"a+wr", "/var/snap/lxd/common/lxd/unix.socket"})
+	_, err := l.system.Run(ctx, cmd)
+	if err != nil {
+		return err
+	}
 
-	return l.system.RunMany(
-		system.NewCommand("chmod", []string{"a+wr", "/var/snap/lxd/common/lxd/unix.socket"}),
-		system.NewCommand("usermod", []string{"-a", "-G", "lxd", username}),
-	)
+	return addUsersToGroup(ctx, l.system, l.users, l.inventory, l.GroupName())
 }
 
 // deconflictFirewall ensures that LXD containers can talk out to the internet.
 // This is to avoid a conflict with the default iptables rules that ship with
 // docker on Ubuntu.
-func (l *LXD) deconflictFirewall() error {
-	return l.system.RunMany(
+func (l *LXD) deconflictFirewall(ctx context.Context) error {
+	return l.system.RunMany(ctx,
 		system.NewCommand("iptables", []string{"-F", "FORWARD"}),
 		system.NewCommand("iptables", []string{"-P", "FORWARD", "ACCEPT"}),
 	)
@@ -163,18 +208,16 @@ func (l *LXD) deconflictFirewall() error {
 // workaroundRefresh checks if LXD will be refreshed and stops it first.
 // This is a workaround for an issue in the LXD snap sometimes failing
 // on refresh because of a missing snap socket file.
-func (l *LXD) workaroundRefresh() (bool, error) {
-	snapInfo, err := l.system.SnapInfo(l.Name(), l.Channel)
+func (l *LXD) workaroundRefresh(ctx context.Context) (bool, error) {
+	snapInfo, err := l.system.SnapInfo(ctx, l.Name(), l.Channel)
 	if err != nil {
 		return false, fmt.Errorf("failed to lookup snap details: %w", err)
 	}
 
 	if snapInfo.Installed {
-		args := []string{"stop", l.Name()}
-		cmd := system.NewCommand("snap", args)
-		_, err = l.system.RunExclusive(cmd)
+		err = l.system.StopSnapService(ctx, l.Name(), "", false)
 		if err != nil {
-			return false, fmt.Errorf("command failed: %w", err)
+			return false, fmt.Errorf("failed to stop snap '%s': %w", l.Name(), err)
 		}
 		return true, nil
 	}
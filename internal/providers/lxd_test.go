@@ -1,6 +1,7 @@
 package providers
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
@@ -62,7 +63,7 @@ func TestLXDPrepareCommands(t *testing.T) {
 
 	system := system.NewMockSystem()
 	lxd := NewLXD(system, config)
-	lxd.Prepare()
+	lxd.Prepare(context.Background())
 
 	if !reflect.DeepEqual(expected, system.ExecutedCommands) {
 		t.Fatalf("expected: %v, got: %v", expected, system.ExecutedCommands)
@@ -89,7 +90,7 @@ func TestLXDPrepareCommandsLXDAlreadyInstalled(t *testing.T) {
 	system.MockSnapStoreLookup("lxd", "", false, true)
 
 	lxd := NewLXD(system, config)
-	lxd.Prepare()
+	lxd.Prepare(context.Background())
 
 	if !reflect.DeepEqual(expected, system.ExecutedCommands) {
 		t.Fatalf("expected: %v, got: %v", expected, system.ExecutedCommands)
@@ -101,7 +102,7 @@ func TestLXDRestore(t *testing.T) {
 
 	system := system.NewMockSystem()
 	lxd := NewLXD(system, config)
-	lxd.Restore()
+	lxd.Restore(context.Background())
 
 	expectedCommands := []string{"snap remove lxd --purge"}
 
@@ -109,3 +110,73 @@ func TestLXDRestore(t *testing.T) {
 		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
 	}
 }
+
+func TestLXDInventory(t *testing.T) {
+	inventory := config.NewInventory()
+	config := &config.Config{Inventory: inventory}
+
+	system := system.NewMockSystem()
+	system.MockCommandReturn("id -nG test-user", []byte("test-user adm sudo"), nil)
+
+	lxd := NewLXD(system, config)
+	lxd.Prepare(context.Background())
+
+	if !inventory.GroupAdded("test-user", "lxd") {
+		t.Fatalf("expected the addition of the 'lxd' group to be recorded")
+	}
+
+	system.ExecutedCommands = nil
+	lxd.Restore(context.Background())
+
+	expectedCommands := []string{
+		"gpasswd -d test-user lxd",
+		"snap remove lxd --purge",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+}
+
+func TestLXDMultipleUsers(t *testing.T) {
+	inventory := config.NewInventory()
+	config := &config.Config{Inventory: inventory}
+	config.Host.Users = []string{"alice", "bob"}
+	config.Overrides.Users = []string{"test-user"}
+
+	system := system.NewMockSystem()
+	system.MockCommandReturn("id -nG test-user", []byte("test-user"), nil)
+	system.MockCommandReturn("id -nG alice", []byte("alice lxd"), nil)
+	system.MockCommandReturn("id -nG bob", []byte("bob"), nil)
+
+	lxd := NewLXD(system, config)
+	lxd.enableNonRootUserControl(context.Background())
+
+	expectedCommands := []string{
+		"chmod a+wr /var/snap/lxd/common/lxd/unix.socket",
+		"id -nG test-user",
+		"usermod -a -G lxd test-user",
+		"id -nG alice",
+		"usermod -a -G lxd alice",
+		"id -nG bob",
+		"usermod -a -G lxd bob",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+
+	system.ExecutedCommands = nil
+	lxd.Restore(context.Background())
+
+	// Alice was a member of the 'lxd' group before concierge ran, so is not removed.
+	expectedCommands = []string{
+		"gpasswd -d test-user lxd",
+		"gpasswd -d bob lxd",
+		"snap remove lxd --purge",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
+	}
+}
@@ -1,13 +1,14 @@
 package providers
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
-	"path"
 	"strings"
 	"time"
 
 	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/events"
 	"github.com/jnsgruk/concierge/internal/packages"
 	"github.com/jnsgruk/concierge/internal/system"
 )
@@ -23,7 +24,7 @@ func NewMicroK8s(r system.Worker, config *config.Config) *MicroK8s {
 	if config.Overrides.MicroK8sChannel != "" {
 		channel = config.Overrides.MicroK8sChannel
 	} else if config.Providers.MicroK8s.Channel == "" {
-		channel = computeDefaultChannel(r)
+		channel = computeDefaultChannel(context.Background(), r)
 	} else {
 		channel = config.Providers.MicroK8s.Channel
 	}
@@ -34,11 +35,16 @@ func NewMicroK8s(r system.Worker, config *config.Config) *MicroK8s {
 		bootstrap:            config.Providers.MicroK8s.Bootstrap,
 		modelDefaults:        config.Providers.Google.ModelDefaults,
 		bootstrapConstraints: config.Providers.Google.BootstrapConstraints,
+		controllers:          config.Providers.MicroK8s.Controllers,
+		agentVersion:         config.Providers.MicroK8s.AgentVersion,
+		extraBootstrapArgs:   config.Providers.MicroK8s.ExtraBootstrapArgs,
 		system:               r,
 		snaps: []*system.Snap{
 			{Name: "microk8s", Channel: channel},
 			{Name: "kubectl", Channel: "stable"},
 		},
+		inventory: config.Inventory,
+		users:     config.Users(),
 	}
 }
 
@@ -50,41 +56,48 @@ type MicroK8s struct {
 	bootstrap            bool
 	modelDefaults        map[string]string
 	bootstrapConstraints map[string]string
-
-	system system.Worker
-	snaps  []*system.Snap
+	controllers          []config.ControllerConfig
+	agentVersion         string
+	extraBootstrapArgs   []string
+
+	system    system.Worker
+	snaps     []*system.Snap
+	inventory *config.Inventory
+	// users is the list of users added to the provider's group, or given a kubeconfig.
+	users []string
 }
 
 // Prepare installs and configures MicroK8s such that it can work in testing environments.
 // This includes installing the snap, enabling the user who ran concierge to interact
 // with MicroK8s without sudo, and sets up the user's kubeconfig file.
-func (m *MicroK8s) Prepare() error {
-	err := m.install()
+func (m *MicroK8s) Prepare(ctx context.Context) error {
+	err := m.install(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to install MicroK8s: %w", err)
 	}
 
-	err = m.init()
+	err = m.init(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to install MicroK8s: %w", err)
 	}
 
-	err = m.enableAddons()
+	err = m.enableAddons(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to enable MicroK8s addons: %w", err)
 	}
 
-	err = m.enableNonRootUserControl()
+	err = m.enableNonRootUserControl(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to enable non-root MicroK8s access: %w", err)
 	}
 
-	err = m.setupKubectl()
+	err = m.setupKubectl(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to setup kubectl for MicroK8s: %w", err)
 	}
 
 	slog.Info("Prepared provider", "provider", m.Name())
+	events.Emit(ctx, events.Event{Type: events.ProviderPrepared, Provider: m.Name()})
 
 	return nil
 }
@@ -116,30 +129,45 @@ func (m *MicroK8s) ModelDefaults() map[string]string { return m.modelDefaults }
 // BootstrapConstraints reports the Juju bootstrap-constraints specific to the provider.
 func (m *MicroK8s) BootstrapConstraints() map[string]string { return m.bootstrapConstraints }
 
+// Controllers reports the Juju controllers to be bootstrapped on the provider.
+func (m *MicroK8s) Controllers() []config.ControllerConfig { return m.controllers }
+
+// AgentVersion reports the Juju agent version to bootstrap on the provider, if specified.
+func (m *MicroK8s) AgentVersion() string { return m.agentVersion }
+
+// ExtraBootstrapArgs reports additional arguments passed to `juju bootstrap` on the provider.
+func (m *MicroK8s) ExtraBootstrapArgs() []string { return m.extraBootstrapArgs }
+
 // Remove uninstalls MicroK8s and kubectl.
-func (m *MicroK8s) Restore() error {
-	snapHandler := packages.NewSnapHandler(m.system, m.snaps)
+func (m *MicroK8s) Restore(ctx context.Context) error {
+	err := removeUsersFromGroup(ctx, m.system, m.users, m.inventory, m.GroupName())
+	if err != nil {
+		return err
+	}
+
+	snapHandler := packages.NewSnapHandler(m.system, m.snaps, m.inventory, nil)
 
-	err := snapHandler.Restore()
+	err = snapHandler.Restore(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = m.system.RemoveAllHome(".kube")
+	err = restoreKubeconfigs(m.system, m.users, m.inventory)
 	if err != nil {
-		return fmt.Errorf("failed to remove '.kube' from user's home directory: %w", err)
+		return err
 	}
 
 	slog.Info("Removed provider", "provider", m.Name())
+	events.Emit(ctx, events.Event{Type: events.ProviderRestored, Provider: m.Name()})
 
 	return nil
 }
 
 // install ensures that MicroK8s is installed.
-func (m *MicroK8s) install() error {
-	snapHandler := packages.NewSnapHandler(m.system, m.snaps)
+func (m *MicroK8s) install(ctx context.Context) error {
+	snapHandler := packages.NewSnapHandler(m.system, m.snaps, m.inventory, nil)
 
-	err := snapHandler.Prepare()
+	err := snapHandler.Prepare(ctx)
 	if err != nil {
 		return err
 	}
@@ -148,15 +176,15 @@ func (m *MicroK8s) install() error {
 }
 
 // init ensures that MicroK8s is installed, minimally configured, and ready.
-func (m *MicroK8s) init() error {
+func (m *MicroK8s) init(ctx context.Context) error {
 	cmd := system.NewCommand("microk8s", []string{"status", "--wait-ready"})
-	_, err := m.system.RunWithRetries(cmd, (5 * time.Minute))
+	_, err := m.system.RunWithRetries(ctx, cmd, (5 * time.Minute))
 
 	return err
 }
 
 // enableAddons iterates over the specified addons, enabling and configuring them.
-func (m *MicroK8s) enableAddons() error {
+func (m *MicroK8s) enableAddons(ctx context.Context) error {
 	for _, addon := range m.Addons {
 		enableArg := addon
 
@@ -166,7 +194,7 @@ func (m *MicroK8s) enableAddons() error {
 		}
 
 		cmd := system.NewCommand("microk8s", []string{"enable", enableArg})
-		_, err := m.system.RunWithRetries(cmd, (5 * time.Minute))
+		_, err := m.system.RunWithRetries(ctx, cmd, (5 * time.Minute))
 		if err != nil {
 			return fmt.Errorf("failed to enable MicroK8s addon '%s': %w", addon, err)
 		}
@@ -177,36 +205,28 @@ func (m *MicroK8s) enableAddons() error {
 
 // enableNonRootUserControl ensures the current user is in the correct POSIX group
 // that allows them to interact with MicroK8s.
-func (m *MicroK8s) enableNonRootUserControl() error {
-	username := m.system.User().Username
-
-	cmd := system.NewCommand("usermod", []string{"-a", "-G", m.GroupName(), username})
-
-	_, err := m.system.Run(cmd)
-	if err != nil {
-		return fmt.Errorf("failed to add user '%s' to group 'microk8s': %w", username, err)
-	}
-
-	return nil
+func (m *MicroK8s) enableNonRootUserControl(ctx context.Context) error {
+	return addUsersToGroup(ctx, m.system, m.users, m.inventory, m.GroupName())
 }
 
 // setupKubectl both installs the kubectl snap, and writes the relevant kubeconfig
 // file to the user's home directory such that kubectl works with MicroK8s.
-func (m *MicroK8s) setupKubectl() error {
+func (m *MicroK8s) setupKubectl(ctx context.Context) error {
 	cmd := system.NewCommand("microk8s", []string{"config"})
-	result, err := m.system.Run(cmd)
+	cmd.Sensitive = true
+	result, err := m.system.Run(ctx, cmd)
 	if err != nil {
 		return fmt.Errorf("failed to fetch MicroK8s configuration: %w", err)
 	}
 
-	return m.system.WriteHomeDirFile(path.Join(".kube", "config"), result)
+	return writeKubeconfigs(m.system, m.users, m.inventory, result)
 }
 
 // Try to compute the "correct" default channel. Concierge prefers that the 'strict'
 // variants are installed, so we filter available channels and sort descending by
 // version. If the list cannot be retrieved, default to a know good version.
-func computeDefaultChannel(s system.Worker) string {
-	channels, err := s.SnapChannels("microk8s")
+func computeDefaultChannel(ctx context.Context, s system.Worker) string {
+	channels, err := s.SnapChannels(ctx, "microk8s")
 	if err != nil {
 		return defaultMicroK8sChannel
 	}
@@ -1,6 +1,9 @@
 package providers
 
 import (
+	"context"
+	"os"
+	"path"
 	"reflect"
 	"testing"
 
@@ -108,7 +111,7 @@ func TestMicroK8sPrepareCommands(t *testing.T) {
 
 	system := system.NewMockSystem()
 	uk8s := NewMicroK8s(system, config)
-	uk8s.Prepare()
+	uk8s.Prepare(context.Background())
 
 	if !reflect.DeepEqual(expectedCommands, system.ExecutedCommands) {
 		t.Fatalf("expected: %v, got: %v", expectedCommands, system.ExecutedCommands)
@@ -120,13 +123,14 @@ func TestMicroK8sPrepareCommands(t *testing.T) {
 }
 
 func TestMicroK8sRestore(t *testing.T) {
-	config := &config.Config{}
+	config := &config.Config{Inventory: config.NewInventory()}
 	config.Providers.MicroK8s.Channel = "1.31-strict/stable"
 	config.Providers.MicroK8s.Addons = defaultAddons
+	config.Inventory.RecordFile(path.Join(os.TempDir(), ".kube/config"), false)
 
 	system := system.NewMockSystem()
 	uk8s := NewMicroK8s(system, config)
-	uk8s.Restore()
+	uk8s.Restore(context.Background())
 
 	expectedDeleted := []string{".kube"}
 
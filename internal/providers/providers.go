@@ -1,6 +1,7 @@
 package providers
 
 import (
+	"context"
 	"github.com/jnsgruk/concierge/internal/config"
 	"github.com/jnsgruk/concierge/internal/system"
 )
@@ -17,9 +18,9 @@ var SupportedProviders []string = []string{
 // provider that concierge can try to bootstrap Juju onto.
 type Provider interface {
 	// Prepare is used for installing/configuring the provider.
-	Prepare() error
+	Prepare(ctx context.Context) error
 	// Restore is used for uninstalling the provider.
-	Restore() error
+	Restore(ctx context.Context) error
 	// Name reports the name of the provider used internally by concierge.
 	Name() string
 	// Bootstrap reports whether or not a Juju controller should be bootstrapped on the provider.
@@ -35,6 +36,14 @@ type Provider interface {
 	ModelDefaults() map[string]string
 	// BootstrapConstraints reports the Juju bootstrap-constraints specific to the provider.
 	BootstrapConstraints() map[string]string
+	// Controllers reports the Juju controllers to be bootstrapped on the provider. If empty,
+	// a single controller with the default name is bootstrapped.
+	Controllers() []config.ControllerConfig
+	// AgentVersion reports the Juju agent version to bootstrap on the provider. If empty, the
+	// agent version specified in the Juju config is used.
+	AgentVersion() string
+	// ExtraBootstrapArgs reports additional arguments passed to `juju bootstrap` on the provider.
+	ExtraBootstrapArgs() []string
 }
 
 // NewProvider returns a newly constructed provider based on a stringified name of the provider.
@@ -51,3 +60,19 @@ func NewProvider(providerName string, system system.Worker, config *config.Confi
 		return nil
 	}
 }
+
+// dependent is implemented by providers that rely on other providers.
+type dependent interface {
+	// DependsOn reports the names of the providers that must be prepared before, and restored
+	// after, the provider.
+	DependsOn() []string
+}
+
+// Dependencies returns the names of the providers that must be prepared before, and restored
+// after, the specified provider.
+func Dependencies(provider Provider) []string {
+	if d, ok := provider.(dependent); ok {
+		return d.DependsOn()
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/jnsgruk/concierge/internal/config"
+	"github.com/jnsgruk/concierge/internal/system"
+)
+
+// kubeconfigPath is the path of the kubeconfig file, relative to the user's home directory.
+var kubeconfigPath = path.Join(".kube", "config")
+
+// KubeconfigPath returns the path of the kubeconfig file written by any of the specified
+// providers, relative to the user's home directory, or an empty string if none of them
+// write one.
+func KubeconfigPath(providers []Provider) string {
+	for _, p := range providers {
+		if p.Name() == "k8s" || p.Name() == "microk8s" {
+			return kubeconfigPath
+		}
+	}
+	return ""
+}
+
+// addUsersToGroup adds each of the users to the specified POSIX group. If no users are
+// specified, the real user is added.
+func addUsersToGroup(ctx context.Context, s system.Worker, users []string, inventory *config.Inventory, group string) error {
+	workers, err := system.UserWorkers(s, users)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range workers {
+		err := addUserToGroup(ctx, w, inventory, group)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeUsersFromGroup removes each of the users from the specified POSIX group, if concierge
+// added them to the group. If no users are specified, the real user is removed.
+func removeUsersFromGroup(ctx context.Context, s system.Worker, users []string, inventory *config.Inventory, group string) error {
+	workers, err := system.UserWorkers(s, users)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range workers {
+		err := removeUserFromGroup(ctx, w, inventory, group)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addUserToGroup adds the worker's user to the specified POSIX group, first recording whether
+// the user was already a member in the inventory.
+func addUserToGroup(ctx context.Context, s system.Worker, inventory *config.Inventory, group string) error {
+	username := s.User().Username
+
+	if inventory != nil {
+		cmd := system.NewCommand("id", []string{"-nG", username})
+		cmd.ReadOnly = true
+
+		output, err := s.Run(ctx, cmd)
+		if err != nil {
+			return fmt.Errorf("failed to lookup groups for user '%s': %w", username, err)
+		}
+
+		inventory.RecordGroup(username, group, slices.Contains(strings.Fields(string(output)), group))
+	}
+
+	cmd := system.NewCommand("usermod", []string{"-a", "-G", group, username})
+	_, err := s.Run(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to add user '%s' to group '%s': %w", username, group, err)
+	}
+
+	return nil
+}
+
+// removeUserFromGroup removes the worker's user from the specified POSIX group, if concierge
+// added the user to the group.
+func removeUserFromGroup(ctx context.Context, s system.Worker, inventory *config.Inventory, group string) error {
+	username := s.User().Username
+
+	if !inventory.GroupAdded(username, group) {
+		return nil
+	}
+
+	cmd := system.NewCommand("gpasswd", []string{"-d", username, group})
+	_, err := s.Run(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to remove user '%s' from group '%s': %w", username, group, err)
+	}
+
+	return nil
+}
+
+// writeKubeconfigs writes a kubeconfig file to the home directory of each of the users. If no
+// users are specified, it is written to the real user's home directory.
+func writeKubeconfigs(s system.Worker, users []string, inventory *config.Inventory, contents []byte) error {
+	workers, err := system.UserWorkers(s, users)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range workers {
+		err := writeKubeconfig(w, inventory, contents)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreKubeconfigs restores the kubeconfig file in the home directory of each of the users.
+// If no users are specified, the real user's kubeconfig is restored.
+func restoreKubeconfigs(s system.Worker, users []string, inventory *config.Inventory) error {
+	workers, err := system.UserWorkers(s, users)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range workers {
+		err := restoreKubeconfig(w, inventory)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeKubeconfig writes a kubeconfig file to the worker's user's home directory. If a
+// kubeconfig already exists, it is backed up and recorded in the inventory, by its absolute
+// path, so it can be restored.
+func writeKubeconfig(s system.Worker, inventory *config.Inventory, contents []byte) error {
+	_, err := s.ReadHomeDirFile(kubeconfigPath)
+	existed := err == nil
+
+	if inventory.RecordFile(path.Join(s.User().HomeDir, kubeconfigPath), existed) && existed {
+		err := system.BackupHomeDirFile(s, kubeconfigPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.WriteHomeDirFile(kubeconfigPath, contents)
+}
+
+// restoreKubeconfig removes the '.kube' directory from the worker's user's home directory,
+// unless a kubeconfig file existed before concierge ran, in which case it is restored. If
+// concierge did not write the kubeconfig file, it is left in place.
+func restoreKubeconfig(s system.Worker, inventory *config.Inventory) error {
+	filePath := path.Join(s.User().HomeDir, kubeconfigPath)
+
+	if inventory.FileExisted(filePath) {
+		return system.RestoreHomeDirFile(s, kubeconfigPath)
+	}
+
+	if !inventory.FileAdded(filePath) {
+		slog.Info("Kubeconfig not written by concierge, not removing", "user", s.User().Username)
+		return nil
+	}
+
+	err := s.RemoveAllHome(".kube")
+	if err != nil {
+		return fmt.Errorf("failed to remove '.kube' from the home directory of user '%s': %w", s.User().Username, err)
+	}
+
+	return nil
+}
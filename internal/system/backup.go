@@ -0,0 +1,63 @@
+package system
+
+import (
+	"fmt"
+	"path"
+)
+
+// backupDir is the directory, relative to the real user's home directory, in which concierge
+// keeps copies of files in the home directory that it overwrites.
+var backupDir = path.Join(".cache", "concierge", "backups")
+
+// systemBackupDir is the directory in which concierge keeps copies of files outside the home
+// directory that it overwrites, such that they remain owned by root.
+var systemBackupDir = path.Join("/var", "lib", "concierge", "backups")
+
+// BackupHomeDirFile copies a file from the real user's home directory into concierge's backup
+// directory, such that it can later be put back with RestoreHomeDirFile. Files with absolute
+// paths are backed up to a directory owned by root, i.e. '/etc/foo' to
+// '<systemBackupDir>/etc/foo', and can only be read by root.
+func BackupHomeDirFile(w Worker, filePath string) error {
+	contents, err := w.ReadHomeDirFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file '%s': %w", filePath, err)
+	}
+
+	backup := backupPath(filePath)
+	if path.IsAbs(filePath) {
+		err = w.WriteFile(backup, contents, 0600)
+	} else {
+		err = w.WriteHomeDirFile(backup, contents)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to back up file '%s': %w", filePath, err)
+	}
+
+	return nil
+}
+
+// RestoreHomeDirFile puts back a file previously saved with BackupHomeDirFile, and removes
+// the backup.
+func RestoreHomeDirFile(w Worker, filePath string) error {
+	backup := backupPath(filePath)
+
+	contents, err := w.ReadHomeDirFile(backup)
+	if err != nil {
+		return fmt.Errorf("failed to read backup of file '%s': %w", filePath, err)
+	}
+
+	err = w.WriteHomeDirFile(filePath, contents)
+	if err != nil {
+		return fmt.Errorf("failed to restore file '%s': %w", filePath, err)
+	}
+
+	return w.RemoveAllHome(backup)
+}
+
+// backupPath returns the path at which the backup of a file is kept.
+func backupPath(filePath string) string {
+	if path.IsAbs(filePath) {
+		return path.Join(systemBackupDir, filePath)
+	}
+	return path.Join(backupDir, filePath)
+}
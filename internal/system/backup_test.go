@@ -0,0 +1,65 @@
+package system
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBackupHomeDirFile(t *testing.T) {
+	system := NewMockSystem()
+	system.MockFile(".kube/config", []byte("original"))
+
+	err := BackupHomeDirFile(system, ".kube/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{".cache/concierge/backups/.kube/config": "original"}
+	if !reflect.DeepEqual(expected, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expected, system.CreatedFiles)
+	}
+}
+
+func TestBackupAbsoluteFile(t *testing.T) {
+	system := NewMockSystem()
+	system.MockFile("/etc/docker/daemon.json", []byte("original"))
+
+	err := BackupHomeDirFile(system, "/etc/docker/daemon.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"/var/lib/concierge/backups/etc/docker/daemon.json": "original"}
+	if !reflect.DeepEqual(expected, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expected, system.CreatedFiles)
+	}
+}
+
+func TestRestoreHomeDirFile(t *testing.T) {
+	system := NewMockSystem()
+	system.MockFile(".cache/concierge/backups/.kube/config", []byte("original"))
+
+	err := RestoreHomeDirFile(system, ".kube/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFiles := map[string]string{".kube/config": "original"}
+	if !reflect.DeepEqual(expectedFiles, system.CreatedFiles) {
+		t.Fatalf("expected: %v, got: %v", expectedFiles, system.CreatedFiles)
+	}
+
+	expectedDeleted := []string{".cache/concierge/backups/.kube/config"}
+	if !reflect.DeepEqual(expectedDeleted, system.Deleted) {
+		t.Fatalf("expected: %v, got: %v", expectedDeleted, system.Deleted)
+	}
+}
+
+func TestRestoreHomeDirFileMissingBackup(t *testing.T) {
+	system := NewMockSystem()
+
+	err := RestoreHomeDirFile(system, ".kube/config")
+	if err == nil {
+		t.Fatalf("expected an error when restoring a file with no backup")
+	}
+}
@@ -14,6 +14,15 @@ type Command struct {
 	Args       []string
 	User       string
 	Group      string
+	// Env is a list of additional environment variables for the command, in the form
+	// KEY=value.
+	Env []string
+	// ReadOnly indicates that the command only inspects the state of the system, and is
+	// therefore safe to run when concierge is invoked with `--dry-run`.
+	ReadOnly bool
+	// Sensitive indicates that the output of the command contains secrets, such as
+	// credentials or tokens, and is therefore never streamed or printed.
+	Sensitive bool
 }
 
 // NewCommand constructs a command to be run as the current user/group.
@@ -41,7 +50,7 @@ func NewCommandAs(user string, group string, executable string, args []string) *
 }
 
 // CommandString puts together a command to be executed in a shell, including the `sudo`
-// command and its arguments where appropriate.
+// command and its arguments, and any environment variables, where appropriate.
 func (c *Command) CommandString() string {
 	path, err := exec.LookPath(c.Executable)
 	if err != nil {
@@ -63,6 +72,7 @@ func (c *Command) CommandString() string {
 		cmdArgs = append(cmdArgs, "-g", c.Group)
 	}
 
+	cmdArgs = append(cmdArgs, c.Env...)
 	cmdArgs = append(cmdArgs, path)
 	cmdArgs = append(cmdArgs, c.Args...)
 
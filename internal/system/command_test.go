@@ -67,6 +67,14 @@ func TestCommandString(t *testing.T) {
 			command:  NewCommandAs("test-user", "apters", "CONCIERGE_TEST_COMMAND", []string{"install", "-y", "cowsay"}),
 			expected: "sudo -u test-user -g apters CONCIERGE_TEST_COMMAND install -y cowsay",
 		},
+		{
+			command:  &Command{Executable: "CONCIERGE_TEST_COMMAND", Args: []string{"install", "-y"}, Env: []string{"DEBIAN_FRONTEND=noninteractive"}},
+			expected: "DEBIAN_FRONTEND=noninteractive CONCIERGE_TEST_COMMAND install -y",
+		},
+		{
+			command:  &Command{Executable: "CONCIERGE_TEST_COMMAND", User: "test-user", Env: []string{"FOO=bar baz"}},
+			expected: "sudo -u test-user 'FOO=bar baz' CONCIERGE_TEST_COMMAND",
+		},
 	}
 
 	for _, tc := range tests {
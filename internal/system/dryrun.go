@@ -0,0 +1,309 @@
+package system
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+// NewDryRunWorker constructs a new worker that records the changes it would make to the
+// system, rather than making them. Queries about the state of the system are passed through
+// to the underlying worker.
+func NewDryRunWorker(worker Worker) *DryRunWorker {
+	return &DryRunWorker{worker: worker}
+}
+
+// DryRunWorker is a Worker that records commands and file operations without executing them.
+type DryRunWorker struct {
+	// Commands is the ordered list of commands that would have been run.
+	Commands []string
+	// Files is the list of paths that would have been written. Relative paths are relative
+	// to the real user's home directory.
+	Files []string
+	// Directories is the list of directories that would have been created in the real
+	// user's home directory.
+	Directories []string
+	// Removed is the list of paths that would have been removed. Relative paths are relative
+	// to the real user's home directory.
+	Removed []string
+
+	worker Worker
+	mtx    sync.Mutex
+}
+
+// User returns the user the system executes commands on behalf of.
+func (d *DryRunWorker) User() *user.User { return d.worker.User() }
+
+// ForUser returns a worker that records the changes it would make on behalf of the named
+// user. Paths in that user's home directory are recorded as absolute paths.
+func (d *DryRunWorker) ForUser(username string) (Worker, error) {
+	worker, err := d.worker.ForUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if worker.User().Username == d.User().Username {
+		return d, nil
+	}
+
+	return &dryRunUserWorker{DryRunWorker: d, userWorker: worker}, nil
+}
+
+// Run records the command. Commands marked as read-only are executed by the underlying worker
+// so that concierge can still make decisions based on the state of the system.
+func (d *DryRunWorker) Run(ctx context.Context, c *Command) ([]byte, error) {
+	if c.ReadOnly {
+		return d.worker.Run(ctx, c)
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.Commands = append(d.Commands, c.CommandString())
+	return []byte{}, nil
+}
+
+// RunWithRetries records the command. Commands marked as read-only are executed by the
+// underlying worker.
+func (d *DryRunWorker) RunWithRetries(ctx context.Context, c *Command, maxDuration time.Duration) ([]byte, error) {
+	if c.ReadOnly {
+		return d.worker.RunWithRetries(ctx, c, maxDuration)
+	}
+	return d.Run(ctx, c)
+}
+
+// RunMany records each of the commands in sequence.
+func (d *DryRunWorker) RunMany(ctx context.Context, commands ...*Command) error {
+	for _, cmd := range commands {
+		_, err := d.Run(ctx, cmd)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunExclusive records the command.
+func (d *DryRunWorker) RunExclusive(ctx context.Context, c *Command) ([]byte, error) {
+	return d.Run(ctx, c)
+}
+
+// WriteHomeDirFile records the path of the file that would be written.
+func (d *DryRunWorker) WriteHomeDirFile(filepath string, contents []byte) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if !slices.Contains(d.Files, filepath) {
+		d.Files = append(d.Files, filepath)
+	}
+	return nil
+}
+
+// MkHomeSubdirectory records the directory that would be created.
+func (d *DryRunWorker) MkHomeSubdirectory(subdirectory string) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if !slices.Contains(d.Directories, subdirectory) {
+		d.Directories = append(d.Directories, subdirectory)
+	}
+	return nil
+}
+
+// RemoveAllHome records the path that would be removed.
+func (d *DryRunWorker) RemoveAllHome(filePath string) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.Removed = append(d.Removed, filePath)
+	return nil
+}
+
+// WriteFile records the path of the file that would be written.
+func (d *DryRunWorker) WriteFile(filePath string, contents []byte, perm os.FileMode) error {
+	return d.WriteHomeDirFile(filePath, contents)
+}
+
+// RemoveFile records the path of the file that would be removed.
+func (d *DryRunWorker) RemoveFile(filePath string) error {
+	return d.RemoveAllHome(filePath)
+}
+
+// ReadHomeDirFile reads a file from the user's home directory using the underlying worker.
+func (d *DryRunWorker) ReadHomeDirFile(filepath string) ([]byte, error) {
+	return d.worker.ReadHomeDirFile(filepath)
+}
+
+// ReadFile reads a file from the system using the underlying worker.
+func (d *DryRunWorker) ReadFile(filePath string) ([]byte, error) {
+	return d.worker.ReadFile(filePath)
+}
+
+// Fetch retrieves the contents of a file from a URL using the underlying worker.
+func (d *DryRunWorker) Fetch(ctx context.Context, url string) ([]byte, error) {
+	return d.worker.Fetch(ctx, url)
+}
+
+// SnapInfo returns information about a given snap using the underlying worker.
+func (d *DryRunWorker) SnapInfo(ctx context.Context, snap string, channel string) (*SnapInfo, error) {
+	return d.worker.SnapInfo(ctx, snap, channel)
+}
+
+// SnapChannels returns the list of channels available for a given snap using the
+// underlying worker.
+func (d *DryRunWorker) SnapChannels(ctx context.Context, snap string) ([]string, error) {
+	return d.worker.SnapChannels(ctx, snap)
+}
+
+// InstallSnap records the equivalent 'snap install' command.
+func (d *DryRunWorker) InstallSnap(ctx context.Context, name string, channel string, classic bool) error {
+	_, err := d.Run(ctx, NewCommand("snap", snapInstallArgs("install", name, channel, classic)))
+	return err
+}
+
+// RefreshSnap records the equivalent 'snap refresh' command.
+func (d *DryRunWorker) RefreshSnap(ctx context.Context, name string, channel string, classic bool) error {
+	_, err := d.Run(ctx, NewCommand("snap", snapInstallArgs("refresh", name, channel, classic)))
+	return err
+}
+
+// RevertSnap records the equivalent 'snap revert' command.
+func (d *DryRunWorker) RevertSnap(ctx context.Context, name string, revision string) error {
+	_, err := d.Run(ctx, NewCommand("snap", snapRevertArgs(name, revision)))
+	return err
+}
+
+// ConnectSnap records the equivalent 'snap connect' command.
+func (d *DryRunWorker) ConnectSnap(ctx context.Context, plug string, slot string) error {
+	_, err := d.Run(ctx, NewCommand("snap", snapConnectArgs(plug, slot)))
+	return err
+}
+
+// RemoveSnap records the equivalent 'snap remove' command.
+func (d *DryRunWorker) RemoveSnap(ctx context.Context, name string, purge bool) error {
+	_, err := d.Run(ctx, NewCommand("snap", snapRemoveArgs(name, purge)))
+	return err
+}
+
+// SnapConfig returns the current values of snap configuration options using the underlying
+// worker.
+func (d *DryRunWorker) SnapConfig(ctx context.Context, name string, options []string) (map[string]string, error) {
+	return d.worker.SnapConfig(ctx, name, options)
+}
+
+// SetSnapConfig records the equivalent 'snap set' command.
+func (d *DryRunWorker) SetSnapConfig(ctx context.Context, name string, config map[string]string) error {
+	_, err := d.Run(ctx, NewCommand("snap", snapSetArgs(name, config)))
+	return err
+}
+
+// UnsetSnapConfig records the equivalent 'snap unset' command.
+func (d *DryRunWorker) UnsetSnapConfig(ctx context.Context, name string, options []string) error {
+	_, err := d.Run(ctx, NewCommand("snap", append([]string{"unset", name}, options...)))
+	return err
+}
+
+// SnapServices returns the state of a snap's services using the underlying worker.
+func (d *DryRunWorker) SnapServices(ctx context.Context, name string) (map[string]SnapService, error) {
+	return d.worker.SnapServices(ctx, name)
+}
+
+// StartSnapService records the equivalent 'snap start' command.
+func (d *DryRunWorker) StartSnapService(ctx context.Context, name string, service string, enable bool) error {
+	_, err := d.Run(ctx, NewCommand("snap", snapStartArgs(name, service, enable)))
+	return err
+}
+
+// StopSnapService records the equivalent 'snap stop' command.
+func (d *DryRunWorker) StopSnapService(ctx context.Context, name string, service string, disable bool) error {
+	_, err := d.Run(ctx, NewCommand("snap", snapStopArgs(name, service, disable)))
+	return err
+}
+
+// InstalledSnapInfo returns information about an installed snap using the underlying worker.
+func (d *DryRunWorker) InstalledSnapInfo(ctx context.Context, snap string) (*SnapInfo, error) {
+	return d.worker.InstalledSnapInfo(ctx, snap)
+}
+
+// InstallSnapFile records the equivalent 'snap install' command.
+func (d *DryRunWorker) InstallSnapFile(ctx context.Context, path string, dangerous bool, classic bool) error {
+	_, err := d.Run(ctx, NewCommand("snap", snapInstallFileArgs(path, dangerous, classic)))
+	return err
+}
+
+// AckSnapAssertion records the equivalent 'snap ack' command.
+func (d *DryRunWorker) AckSnapAssertion(ctx context.Context, path string) error {
+	_, err := d.Run(ctx, NewCommand("snap", []string{"ack", path}))
+	return err
+}
+
+// AliasSnap records the equivalent 'snap alias' command.
+func (d *DryRunWorker) AliasSnap(ctx context.Context, name string, app string, alias string) error {
+	_, err := d.Run(ctx, NewCommand("snap", snapAliasArgs(name, app, alias)))
+	return err
+}
+
+// UnaliasSnap records the equivalent 'snap unalias' command.
+func (d *DryRunWorker) UnaliasSnap(ctx context.Context, alias string) error {
+	_, err := d.Run(ctx, NewCommand("snap", []string{"unalias", alias}))
+	return err
+}
+
+// SnapAliases returns the enabled aliases of a snap using the underlying worker.
+func (d *DryRunWorker) SnapAliases(ctx context.Context, name string) (map[string]string, error) {
+	return d.worker.SnapAliases(ctx, name)
+}
+
+// DisconnectSnap records the equivalent 'snap disconnect' command.
+func (d *DryRunWorker) DisconnectSnap(ctx context.Context, plug string, slot string) error {
+	_, err := d.Run(ctx, NewCommand("snap", snapDisconnectArgs(plug, slot)))
+	return err
+}
+
+// SnapInterfaces returns the plugs, slots and connections known to snapd using the
+// underlying worker.
+func (d *DryRunWorker) SnapInterfaces(ctx context.Context) (*SnapInterfaces, error) {
+	return d.worker.SnapInterfaces(ctx)
+}
+
+// dryRunUserWorker records changes made on behalf of a user other than the real user into
+// the DryRunWorker it was created from.
+type dryRunUserWorker struct {
+	*DryRunWorker
+	userWorker Worker
+}
+
+// User returns the user the worker acts on behalf of.
+func (d *dryRunUserWorker) User() *user.User { return d.userWorker.User() }
+
+// WriteHomeDirFile records the absolute path of the file that would be written.
+func (d *dryRunUserWorker) WriteHomeDirFile(filePath string, contents []byte) error {
+	return d.DryRunWorker.WriteHomeDirFile(d.homePath(filePath), contents)
+}
+
+// MkHomeSubdirectory records the absolute path of the directory that would be created.
+func (d *dryRunUserWorker) MkHomeSubdirectory(subdirectory string) error {
+	return d.DryRunWorker.MkHomeSubdirectory(d.homePath(subdirectory))
+}
+
+// RemoveAllHome records the absolute path that would be removed.
+func (d *dryRunUserWorker) RemoveAllHome(filePath string) error {
+	return d.DryRunWorker.RemoveAllHome(d.homePath(filePath))
+}
+
+// ReadHomeDirFile reads a file from the user's home directory using the underlying worker.
+func (d *dryRunUserWorker) ReadHomeDirFile(filePath string) ([]byte, error) {
+	return d.userWorker.ReadHomeDirFile(filePath)
+}
+
+// homePath returns the absolute path of a path in the user's home directory.
+func (d *dryRunUserWorker) homePath(filePath string) string {
+	if path.IsAbs(filePath) {
+		return filePath
+	}
+	return path.Join(d.User().HomeDir, filePath)
+}
@@ -0,0 +1,65 @@
+package system
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestDryRunWorkerRecordsCommands(t *testing.T) {
+	mock := NewMockSystem()
+	dryRun := NewDryRunWorker(mock)
+
+	// Use CONCIERGE_TEST_COMMAND to avoid $PATH lookups making tests flaky
+	probe := NewCommand("CONCIERGE_TEST_COMMAND", []string{"status"})
+	probe.ReadOnly = true
+
+	dryRun.Run(context.Background(), NewCommand("CONCIERGE_TEST_COMMAND", []string{"install", "foo"}))
+	dryRun.RunExclusive(context.Background(), NewCommandAs("test-user", "lxd", "CONCIERGE_TEST_COMMAND", []string{"bootstrap"}))
+	dryRun.Run(context.Background(), probe)
+
+	expectedCommands := []string{
+		"CONCIERGE_TEST_COMMAND install foo",
+		"sudo -u test-user -g lxd CONCIERGE_TEST_COMMAND bootstrap",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, dryRun.Commands) {
+		t.Fatalf("expected: %v, got: %v", expectedCommands, dryRun.Commands)
+	}
+
+	// Only read-only commands should reach the underlying worker.
+	expectedExecuted := []string{"CONCIERGE_TEST_COMMAND status"}
+	if !reflect.DeepEqual(expectedExecuted, mock.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expectedExecuted, mock.ExecutedCommands)
+	}
+}
+
+func TestDryRunWorkerRecordsFiles(t *testing.T) {
+	mock := NewMockSystem()
+	mock.MockFile(".cache/concierge/concierge.yaml", []byte("status: 1"))
+
+	dryRun := NewDryRunWorker(mock)
+
+	dryRun.WriteHomeDirFile(".kube/config", []byte("foo"))
+	dryRun.WriteHomeDirFile(".kube/config", []byte("bar"))
+	dryRun.MkHomeSubdirectory(".local/share/juju")
+	dryRun.RemoveAllHome(".kube")
+
+	if !reflect.DeepEqual([]string{".kube/config"}, dryRun.Files) {
+		t.Fatalf("expected: %v, got: %v", []string{".kube/config"}, dryRun.Files)
+	}
+	if !reflect.DeepEqual([]string{".local/share/juju"}, dryRun.Directories) {
+		t.Fatalf("expected: %v, got: %v", []string{".local/share/juju"}, dryRun.Directories)
+	}
+	if !reflect.DeepEqual([]string{".kube"}, dryRun.Removed) {
+		t.Fatalf("expected: %v, got: %v", []string{".kube"}, dryRun.Removed)
+	}
+	if len(mock.CreatedFiles) > 0 || len(mock.CreatedDirectories) > 0 || len(mock.Deleted) > 0 {
+		t.Fatalf("expected no changes to the underlying system")
+	}
+
+	contents, err := dryRun.ReadHomeDirFile(".cache/concierge/concierge.yaml")
+	if err != nil || string(contents) != "status: 1" {
+		t.Fatalf("expected reads to be passed to the underlying worker")
+	}
+}
@@ -1,6 +1,8 @@
 package system
 
 import (
+	"context"
+	"os"
 	"os/user"
 	"time"
 )
@@ -10,32 +12,90 @@ type Worker interface {
 	// User returns the 'real user' the system executes command as. This may be different from
 	// the current user since the command is often executed with `sudo`.
 	User() *user.User
+	// ForUser returns a worker that acts on behalf of the named user, such that operations on
+	// files in the home directory apply to that user's home directory.
+	ForUser(username string) (Worker, error)
 	// Run takes a single command and runs it, returning the combined output and an error value.
-	Run(c *Command) ([]byte, error)
+	// If the context is cancelled, the command and any processes it started are terminated.
+	Run(ctx context.Context, c *Command) ([]byte, error)
 	// RunMany takes multiple commands and runs them in sequence, returning an error on the
 	// first error encountered.
-	RunMany(commands ...*Command) error
+	RunMany(ctx context.Context, commands ...*Command) error
 	// RunExclusive is a wrapper around Run that uses a mutex to ensure that only one of that
 	// particular command can be run at a time.
-	RunExclusive(c *Command) ([]byte, error)
+	RunExclusive(ctx context.Context, c *Command) ([]byte, error)
 	// RunWithRetries executes the command, retrying utilising an exponential backoff pattern,
 	// which starts at 1 second. Retries will be attempted up to the specified maximum duration.
-	RunWithRetries(c *Command, maxDuration time.Duration) ([]byte, error)
-	// WriteHomeDirFile takes a path relative to the real user's home dir, and writes the contents
-	// specified to it.
+	RunWithRetries(ctx context.Context, c *Command, maxDuration time.Duration) ([]byte, error)
+	// WriteHomeDirFile takes a path relative to the real user's home dir, or an absolute path,
+	// and writes the contents specified to it.
 	WriteHomeDirFile(filepath string, contents []byte) error
 	// MkHomeSubdirectory takes a relative folder path and creates it recursively in the real
 	// user's home directory.
 	MkHomeSubdirectory(subdirectory string) error
-	// RemoveAllHome recursively removes a file path from the user's home directory.
+	// RemoveAllHome recursively removes a file path from the user's home directory, or an
+	// absolute path.
 	RemoveAllHome(filePath string) error
-	// ReadHomeDirFile reads a file from the user's home directory.
+	// ReadHomeDirFile reads a file from the user's home directory, or from an absolute path.
 	ReadHomeDirFile(filepath string) ([]byte, error)
 	// ReadFile reads a file with an arbitrary path from the system.
 	ReadFile(filePath string) ([]byte, error)
+	// Fetch retrieves the contents of a file from a URL. Supported schemes are 'file', 'http'
+	// and 'https'.
+	Fetch(ctx context.Context, url string) ([]byte, error)
+	// WriteFile writes the contents specified to a file with an arbitrary path, creating its
+	// parent directories if necessary.
+	WriteFile(filePath string, contents []byte, perm os.FileMode) error
+	// RemoveFile removes a file with an arbitrary path, if it exists.
+	RemoveFile(filePath string) error
 	// SnapInfo returns information about a given snap, looking up details in the snap
 	// store using the snapd client API where necessary.
-	SnapInfo(snap string, channel string) (*SnapInfo, error)
+	SnapInfo(ctx context.Context, snap string, channel string) (*SnapInfo, error)
+	// InstalledSnapInfo returns information about a given snap from snapd, without looking up
+	// its details in the snap store.
+	InstalledSnapInfo(ctx context.Context, snap string) (*SnapInfo, error)
 	// SnapChannels returns the list of channels available for a given snap.
-	SnapChannels(snap string) ([]string, error)
+	SnapChannels(ctx context.Context, snap string) ([]string, error)
+	// InstallSnap installs a snap from the specified channel using the snapd API.
+	InstallSnap(ctx context.Context, name string, channel string, classic bool) error
+	// RefreshSnap refreshes an installed snap onto the specified channel using the snapd API.
+	RefreshSnap(ctx context.Context, name string, channel string, classic bool) error
+	// RevertSnap reverts an installed snap to the specified revision using the snapd API.
+	RevertSnap(ctx context.Context, name string, revision string) error
+	// InstallSnapFile installs a snap from a local .snap file using the snapd API, optionally
+	// without verifying its signatures.
+	InstallSnapFile(ctx context.Context, path string, dangerous bool, classic bool) error
+	// AckSnapAssertion adds the assertions in the specified file to the system assertion database.
+	AckSnapAssertion(ctx context.Context, path string) error
+	// AliasSnap creates an alias for one of a snap's applications using the snapd API.
+	AliasSnap(ctx context.Context, name string, app string, alias string) error
+	// UnaliasSnap removes an alias using the snapd API.
+	UnaliasSnap(ctx context.Context, alias string) error
+	// SnapAliases returns the enabled aliases of a snap, mapped to the applications they refer to.
+	SnapAliases(ctx context.Context, name string) (map[string]string, error)
+	// ConnectSnap connects a snap plug to a slot using the snapd API. The slot may be empty,
+	// in which case snapd chooses the slot.
+	ConnectSnap(ctx context.Context, plug string, slot string) error
+	// DisconnectSnap disconnects a snap plug from a slot using the snapd API. If the slot is
+	// empty, the plug is disconnected from all of its slots.
+	DisconnectSnap(ctx context.Context, plug string, slot string) error
+	// SnapInterfaces returns the plugs, slots and established connections known to snapd.
+	SnapInterfaces(ctx context.Context) (*SnapInterfaces, error)
+	// RemoveSnap removes a snap using the snapd API, optionally purging its data.
+	RemoveSnap(ctx context.Context, name string, purge bool) error
+	// SnapConfig returns the current values of the specified configuration options of a snap.
+	// Options that are not set are omitted.
+	SnapConfig(ctx context.Context, name string, options []string) (map[string]string, error)
+	// SetSnapConfig sets configuration options of a snap using the snapd API.
+	SetSnapConfig(ctx context.Context, name string, config map[string]string) error
+	// UnsetSnapConfig removes configuration options from a snap using the snapd API.
+	UnsetSnapConfig(ctx context.Context, name string, options []string) error
+	// SnapServices returns the state of each of the services provided by a snap.
+	SnapServices(ctx context.Context, name string) (map[string]SnapService, error)
+	// StartSnapService starts one of a snap's services, or all of them if no service is
+	// specified, optionally enabling it.
+	StartSnapService(ctx context.Context, name string, service string, enable bool) error
+	// StopSnapService stops one of a snap's services, or all of them if no service is
+	// specified, optionally disabling it.
+	StopSnapService(ctx context.Context, name string, service string, disable bool) error
 }
@@ -0,0 +1,84 @@
+package system
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// logDir is the directory, relative to the real user's home directory, in which concierge
+// writes a log file for each run.
+var logDir = path.Join(".cache", "concierge", "logs")
+
+// maxLogFiles is the number of log files kept in the log directory. The oldest log files are
+// removed when a new one is created.
+const maxLogFiles = 10
+
+// CreateLogFile creates a new log file for a run of the specified action, named using the
+// current time, such as '~/.cache/concierge/logs/20250102-150405-prepare.log'. The output of
+// every command subsequently run by the system is written to the log file, whether or not it
+// is streamed, except for the output of sensitive commands. Log files are only readable by the
+// user. Older log files are removed, such that at most maxLogFiles are kept.
+func (s *System) CreateLogFile(action string) (*os.File, error) {
+	err := s.MkHomeSubdirectory(logDir)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Join(s.user.HomeDir, logDir)
+
+	err = os.Chmod(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to change mode of log directory '%s': %w", dir, err)
+	}
+
+	err = rotateLogFiles(dir, maxLogFiles-1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate log files: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.log", time.Now().Format("20060102-150405"), action)
+	filePath := path.Join(dir, name)
+
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log file '%s': %w", filePath, err)
+	}
+
+	err = s.chownRecursively(filePath, s.user)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to change ownership of log file '%s': %w", filePath, err)
+	}
+
+	s.log = f
+	return f, nil
+}
+
+// rotateLogFiles removes the oldest log files in a directory, such that at most keep remain.
+// Log files are named with a timestamp prefix, so sort in order of creation.
+func rotateLogFiles(dir string, keep int) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return err
+	}
+
+	if len(files) <= keep {
+		return nil
+	}
+
+	slices.Sort(files)
+
+	for _, f := range files[:len(files)-keep] {
+		slog.Debug("Removing old log file", "path", f)
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
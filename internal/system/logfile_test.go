@@ -0,0 +1,121 @@
+package system
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRotateLogFiles(t *testing.T) {
+	type test struct {
+		files    []string
+		keep     int
+		expected []string
+	}
+
+	tests := []test{
+		{
+			files:    []string{},
+			keep:     2,
+			expected: []string{},
+		},
+		{
+			files:    []string{"20250101-100000-prepare.log", "20250102-100000-restore.log"},
+			keep:     2,
+			expected: []string{"20250101-100000-prepare.log", "20250102-100000-restore.log"},
+		},
+		{
+			files: []string{
+				"20250103-100000-prepare.log",
+				"20250101-100000-prepare.log",
+				"20250102-100000-restore.log",
+				"notes.txt",
+			},
+			keep:     1,
+			expected: []string{"20250103-100000-prepare.log", "notes.txt"},
+		},
+	}
+
+	for _, tc := range tests {
+		dir := t.TempDir()
+		for _, f := range tc.files {
+			if err := os.WriteFile(filepath.Join(dir, f), []byte{}, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := rotateLogFiles(dir, tc.keep)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		remaining := []string{}
+		for _, e := range entries {
+			remaining = append(remaining, e.Name())
+		}
+
+		if !reflect.DeepEqual(tc.expected, remaining) {
+			t.Fatalf("expected: %v, got: %v", tc.expected, remaining)
+		}
+	}
+}
+
+func TestCreateLogFile(t *testing.T) {
+	s, err := NewSystem(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := *s.user
+	u.HomeDir = t.TempDir()
+	s.user = &u
+	s.out = io.Discard
+
+	f, err := s.CreateLogFile("prepare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cmd := NewCommand("sh", []string{"-c", "echo secret-token"})
+	cmd.Sensitive = true
+
+	_, err = s.Run(context.Background(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Run(context.Background(), NewCommand("sh", []string{"-c", "echo not-a-secret"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(contents), "secret-token") || !strings.Contains(string(contents), "not-a-secret") {
+		t.Fatalf("expected only output that is not sensitive to be logged, got: %q", contents)
+	}
+
+	for filePath, expected := range map[string]os.FileMode{f.Name(): 0600, filepath.Dir(f.Name()): 0700} {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != expected {
+			t.Fatalf("expected: %v, got: %v", expected, info.Mode().Perm())
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package system
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/user"
+	"path"
 	"time"
 )
 
@@ -13,7 +15,14 @@ func NewMockSystem() *MockSystem {
 		CreatedFiles: map[string]string{},
 		mockReturns:  map[string]MockCommandReturn{},
 		mockFiles:    map[string][]byte{},
+		mockFetches:  map[string][]byte{},
 		mockSnapInfo: map[string]*SnapInfo{},
+
+		mockSnapConfig:   map[string]map[string]string{},
+		mockSnapServices: map[string]map[string]SnapService{},
+		mockSnapAliases:  map[string]map[string]string{},
+
+		mockSnapInterfaces: &SnapInterfaces{},
 	}
 }
 
@@ -31,9 +40,15 @@ type MockSystem struct {
 	Deleted            []string
 
 	mockFiles        map[string][]byte
+	mockFetches      map[string][]byte
 	mockReturns      map[string]MockCommandReturn
 	mockSnapInfo     map[string]*SnapInfo
 	mockSnapChannels map[string][]string
+	mockSnapConfig   map[string]map[string]string
+	mockSnapServices map[string]map[string]SnapService
+	mockSnapAliases  map[string]map[string]string
+
+	mockSnapInterfaces *SnapInterfaces
 }
 
 // MockCommandReturn sets a static return value representing command combined output,
@@ -47,20 +62,78 @@ func (r *MockSystem) MockFile(filePath string, contents []byte) {
 	r.mockFiles[filePath] = contents
 }
 
+// MockFetch sets the contents returned when fetching the specified URL.
+func (r *MockSystem) MockFetch(url string, contents []byte) {
+	r.mockFetches[url] = contents
+}
+
 // MockSnapStoreLookup gets a new test snap and adds a mock snap into the mock test
 func (r *MockSystem) MockSnapStoreLookup(name, channel string, classic, installed bool) *Snap {
 	r.mockSnapInfo[name] = &SnapInfo{
 		Installed: installed,
 		Classic:   classic,
 	}
+	if installed {
+		r.mockSnapInfo[name].TrackingChannel = channel
+	}
 	return &Snap{Name: name, Channel: channel}
 }
 
+// MockSnapRevision sets the revision of a snap mocked with MockSnapStoreLookup.
+func (r *MockSystem) MockSnapRevision(snap, revision string) {
+	r.mockSnapInfo[snap].Revision = revision
+}
+
 // MockSnapChannels mocks the set of available channels for a snap in the store.
 func (r *MockSystem) MockSnapChannels(snap string, channels []string) {
 	r.mockSnapChannels[snap] = channels
 }
 
+// MockSnapConfig sets the current value of a snap configuration option.
+func (r *MockSystem) MockSnapConfig(snap, option, value string) {
+	if _, ok := r.mockSnapConfig[snap]; !ok {
+		r.mockSnapConfig[snap] = map[string]string{}
+	}
+	r.mockSnapConfig[snap][option] = value
+}
+
+// MockSnapService sets the state of a service provided by a snap.
+func (r *MockSystem) MockSnapService(snap, service string, enabled, active bool) {
+	if _, ok := r.mockSnapServices[snap]; !ok {
+		r.mockSnapServices[snap] = map[string]SnapService{}
+	}
+	r.mockSnapServices[snap][service] = SnapService{Enabled: enabled, Active: active}
+}
+
+// MockSnapAlias sets an existing alias for one of a snap's applications.
+func (r *MockSystem) MockSnapAlias(snap, app, alias string) {
+	if _, ok := r.mockSnapAliases[snap]; !ok {
+		r.mockSnapAliases[snap] = map[string]string{}
+	}
+	r.mockSnapAliases[snap][alias] = app
+}
+
+// MockSnapPlug adds a plug of the specified interface to the mocked snap interfaces.
+func (r *MockSystem) MockSnapPlug(snap, name, iface string) {
+	r.mockSnapInterfaces.Plugs = append(r.mockSnapInterfaces.Plugs, SnapInterface{
+		SnapEndpoint: SnapEndpoint{Snap: snap, Name: name},
+		Interface:    iface,
+	})
+}
+
+// MockSnapSlot adds a slot of the specified interface to the mocked snap interfaces.
+func (r *MockSystem) MockSnapSlot(snap, name, iface string) {
+	r.mockSnapInterfaces.Slots = append(r.mockSnapInterfaces.Slots, SnapInterface{
+		SnapEndpoint: SnapEndpoint{Snap: snap, Name: name},
+		Interface:    iface,
+	})
+}
+
+// MockSnapConnection adds an established connection to the mocked snap interfaces.
+func (r *MockSystem) MockSnapConnection(plug, slot SnapEndpoint) {
+	r.mockSnapInterfaces.Connections = append(r.mockSnapInterfaces.Connections, SnapConnection{Plug: plug, Slot: slot})
+}
+
 // User returns the user the system executes commands on behalf of.
 func (r *MockSystem) User() *user.User {
 	return &user.User{
@@ -71,8 +144,22 @@ func (r *MockSystem) User() *user.User {
 	}
 }
 
+// ForUser returns a mock that records the changes it makes on behalf of the named user into
+// the same fields as the original mock. Paths in that user's home directory, which is
+// '/home/<username>', are recorded as absolute paths.
+func (r *MockSystem) ForUser(username string) (Worker, error) {
+	if username == r.User().Username {
+		return r, nil
+	}
+
+	return &mockUserSystem{
+		MockSystem: r,
+		user:       &user.User{Username: username, Uid: "1000", Gid: "1000", HomeDir: path.Join("/home", username)},
+	}, nil
+}
+
 // Run executes the command, returning the stdout/stderr where appropriate.
-func (r *MockSystem) Run(c *Command) ([]byte, error) {
+func (r *MockSystem) Run(ctx context.Context, c *Command) ([]byte, error) {
 	// Prevent the path of the test machine interfering with the test results.
 	path := os.Getenv("PATH")
 	defer os.Setenv("PATH", path)
@@ -82,6 +169,10 @@ func (r *MockSystem) Run(c *Command) ([]byte, error) {
 
 	r.ExecutedCommands = append(r.ExecutedCommands, cmd)
 
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("command '%s' cancelled: %w", cmd, ctx.Err())
+	}
+
 	val, ok := r.mockReturns[cmd]
 	if ok {
 		return val.Output, val.Error
@@ -91,15 +182,15 @@ func (r *MockSystem) Run(c *Command) ([]byte, error) {
 
 // RunWithRetries executes the command, retrying utilising an exponential backoff pattern,
 // which starts at 1 second. Retries will be attempted up to the specified maximum duration.
-func (r *MockSystem) RunWithRetries(c *Command, maxDuration time.Duration) ([]byte, error) {
-	return r.Run(c)
+func (r *MockSystem) RunWithRetries(ctx context.Context, c *Command, maxDuration time.Duration) ([]byte, error) {
+	return r.Run(ctx, c)
 }
 
 // RunMany takes a variadic number of Command's, and runs them in a loop, returning
 // and error if any command fails.
-func (r *MockSystem) RunMany(commands ...*Command) error {
+func (r *MockSystem) RunMany(ctx context.Context, commands ...*Command) error {
 	for _, cmd := range commands {
-		_, err := r.Run(cmd)
+		_, err := r.Run(ctx, cmd)
 		if err != nil {
 			return err
 		}
@@ -109,8 +200,8 @@ func (r *MockSystem) RunMany(commands ...*Command) error {
 
 // RunExclusive is a wrapper around Run that uses a mutex to ensure that only one of that
 // particular command can be run at a time.
-func (r *MockSystem) RunExclusive(c *Command) ([]byte, error) {
-	return r.Run(c)
+func (r *MockSystem) RunExclusive(ctx context.Context, c *Command) ([]byte, error) {
+	return r.Run(ctx, c)
 }
 
 // WriteHomeDirFile takes a path relative to the real user's home dir, and writes the contents
@@ -146,7 +237,29 @@ func (r *MockSystem) ReadFile(filePath string) ([]byte, error) {
 	return val, nil
 }
 
-// RemoveAllHome recursively removes a file path from the user's home directory.
+// Fetch returns the contents mocked for the specified URL.
+func (r *MockSystem) Fetch(ctx context.Context, url string) ([]byte, error) {
+	val, ok := r.mockFetches[url]
+	if !ok {
+		return nil, fmt.Errorf("failed to fetch '%s': 404 Not Found", url)
+	}
+	return val, nil
+}
+
+// WriteFile records the contents written to a file with an arbitrary path.
+func (r *MockSystem) WriteFile(filePath string, contents []byte, perm os.FileMode) error {
+	r.CreatedFiles[filePath] = string(contents)
+	return nil
+}
+
+// RemoveFile records the removal of a file with an arbitrary path.
+func (r *MockSystem) RemoveFile(filePath string) error {
+	r.Deleted = append(r.Deleted, filePath)
+	return nil
+}
+
+// RemoveAllHome records the removal of a path in the user's home directory, or an absolute
+// path.
 func (r *MockSystem) RemoveAllHome(filePath string) error {
 	r.Deleted = append(r.Deleted, filePath)
 	return nil
@@ -154,7 +267,7 @@ func (r *MockSystem) RemoveAllHome(filePath string) error {
 
 // SnapInfo returns information about a given snap, looking up details in the snap
 // store using the snapd client API where necessary.
-func (r *MockSystem) SnapInfo(snap string, channel string) (*SnapInfo, error) {
+func (r *MockSystem) SnapInfo(ctx context.Context, snap string, channel string) (*SnapInfo, error) {
 	snapInfo, ok := r.mockSnapInfo[snap]
 	if ok {
 		return snapInfo, nil
@@ -166,8 +279,13 @@ func (r *MockSystem) SnapInfo(snap string, channel string) (*SnapInfo, error) {
 	}, nil
 }
 
+// InstalledSnapInfo returns a mocked SnapInfo for the specified snap.
+func (r *MockSystem) InstalledSnapInfo(ctx context.Context, snap string) (*SnapInfo, error) {
+	return r.SnapInfo(ctx, snap, "")
+}
+
 // SnapChannels returns the list of channels available for a given snap.
-func (r *MockSystem) SnapChannels(snap string) ([]string, error) {
+func (r *MockSystem) SnapChannels(ctx context.Context, snap string) ([]string, error) {
 	val, ok := r.mockSnapChannels[snap]
 	if ok {
 		return val, nil
@@ -175,3 +293,158 @@ func (r *MockSystem) SnapChannels(snap string) ([]string, error) {
 
 	return nil, fmt.Errorf("channels for snap '%s' not found", snap)
 }
+
+// InstallSnap records the equivalent 'snap install' command as executed.
+func (r *MockSystem) InstallSnap(ctx context.Context, name string, channel string, classic bool) error {
+	_, err := r.Run(ctx, NewCommand("snap", snapInstallArgs("install", name, channel, classic)))
+	return err
+}
+
+// RefreshSnap records the equivalent 'snap refresh' command as executed.
+func (r *MockSystem) RefreshSnap(ctx context.Context, name string, channel string, classic bool) error {
+	_, err := r.Run(ctx, NewCommand("snap", snapInstallArgs("refresh", name, channel, classic)))
+	return err
+}
+
+// RevertSnap records the equivalent 'snap revert' command as executed.
+func (r *MockSystem) RevertSnap(ctx context.Context, name string, revision string) error {
+	_, err := r.Run(ctx, NewCommand("snap", snapRevertArgs(name, revision)))
+	return err
+}
+
+// ConnectSnap records the equivalent 'snap connect' command as executed.
+func (r *MockSystem) ConnectSnap(ctx context.Context, plug string, slot string) error {
+	_, err := r.Run(ctx, NewCommand("snap", snapConnectArgs(plug, slot)))
+	return err
+}
+
+// RemoveSnap records the equivalent 'snap remove' command as executed.
+func (r *MockSystem) RemoveSnap(ctx context.Context, name string, purge bool) error {
+	_, err := r.Run(ctx, NewCommand("snap", snapRemoveArgs(name, purge)))
+	return err
+}
+
+// SnapConfig returns the mocked values of the specified snap configuration options.
+func (r *MockSystem) SnapConfig(ctx context.Context, name string, options []string) (map[string]string, error) {
+	config := map[string]string{}
+	for _, option := range options {
+		if value, ok := r.mockSnapConfig[name][option]; ok {
+			config[option] = value
+		}
+	}
+	return config, nil
+}
+
+// SetSnapConfig records the equivalent 'snap set' command as executed.
+func (r *MockSystem) SetSnapConfig(ctx context.Context, name string, config map[string]string) error {
+	_, err := r.Run(ctx, NewCommand("snap", snapSetArgs(name, config)))
+	return err
+}
+
+// UnsetSnapConfig records the equivalent 'snap unset' command as executed.
+func (r *MockSystem) UnsetSnapConfig(ctx context.Context, name string, options []string) error {
+	_, err := r.Run(ctx, NewCommand("snap", append([]string{"unset", name}, options...)))
+	return err
+}
+
+// SnapServices returns the mocked state of the services provided by a snap.
+func (r *MockSystem) SnapServices(ctx context.Context, name string) (map[string]SnapService, error) {
+	services := map[string]SnapService{}
+	for service, state := range r.mockSnapServices[name] {
+		services[service] = state
+	}
+	return services, nil
+}
+
+// StartSnapService records the equivalent 'snap start' command as executed.
+func (r *MockSystem) StartSnapService(ctx context.Context, name string, service string, enable bool) error {
+	_, err := r.Run(ctx, NewCommand("snap", snapStartArgs(name, service, enable)))
+	return err
+}
+
+// StopSnapService records the equivalent 'snap stop' command as executed.
+func (r *MockSystem) StopSnapService(ctx context.Context, name string, service string, disable bool) error {
+	_, err := r.Run(ctx, NewCommand("snap", snapStopArgs(name, service, disable)))
+	return err
+}
+
+// InstallSnapFile records the equivalent 'snap install' command as executed.
+func (r *MockSystem) InstallSnapFile(ctx context.Context, path string, dangerous bool, classic bool) error {
+	_, err := r.Run(ctx, NewCommand("snap", snapInstallFileArgs(path, dangerous, classic)))
+	return err
+}
+
+// AckSnapAssertion records the equivalent 'snap ack' command as executed.
+func (r *MockSystem) AckSnapAssertion(ctx context.Context, path string) error {
+	_, err := r.Run(ctx, NewCommand("snap", []string{"ack", path}))
+	return err
+}
+
+// AliasSnap records the equivalent 'snap alias' command as executed.
+func (r *MockSystem) AliasSnap(ctx context.Context, name string, app string, alias string) error {
+	_, err := r.Run(ctx, NewCommand("snap", snapAliasArgs(name, app, alias)))
+	return err
+}
+
+// UnaliasSnap records the equivalent 'snap unalias' command as executed.
+func (r *MockSystem) UnaliasSnap(ctx context.Context, alias string) error {
+	_, err := r.Run(ctx, NewCommand("snap", []string{"unalias", alias}))
+	return err
+}
+
+// SnapAliases returns the mocked aliases of a snap.
+func (r *MockSystem) SnapAliases(ctx context.Context, name string) (map[string]string, error) {
+	aliases := map[string]string{}
+	for alias, app := range r.mockSnapAliases[name] {
+		aliases[alias] = app
+	}
+	return aliases, nil
+}
+
+// DisconnectSnap records the equivalent 'snap disconnect' command as executed.
+func (r *MockSystem) DisconnectSnap(ctx context.Context, plug string, slot string) error {
+	_, err := r.Run(ctx, NewCommand("snap", snapDisconnectArgs(plug, slot)))
+	return err
+}
+
+// SnapInterfaces returns the mocked plugs, slots and connections.
+func (r *MockSystem) SnapInterfaces(ctx context.Context) (*SnapInterfaces, error) {
+	return r.mockSnapInterfaces, nil
+}
+
+// mockUserSystem is a MockSystem acting on behalf of a user other than the test user.
+type mockUserSystem struct {
+	*MockSystem
+	user *user.User
+}
+
+// User returns the user the mock acts on behalf of.
+func (r *mockUserSystem) User() *user.User { return r.user }
+
+// WriteHomeDirFile records the file at its absolute path.
+func (r *mockUserSystem) WriteHomeDirFile(filePath string, contents []byte) error {
+	return r.MockSystem.WriteHomeDirFile(r.homePath(filePath), contents)
+}
+
+// MkHomeSubdirectory records the directory at its absolute path.
+func (r *mockUserSystem) MkHomeSubdirectory(subdirectory string) error {
+	return r.MockSystem.MkHomeSubdirectory(r.homePath(subdirectory))
+}
+
+// ReadHomeDirFile reads the mocked file at its absolute path.
+func (r *mockUserSystem) ReadHomeDirFile(filePath string) ([]byte, error) {
+	return r.MockSystem.ReadHomeDirFile(r.homePath(filePath))
+}
+
+// RemoveAllHome records the removal of the path at its absolute path.
+func (r *mockUserSystem) RemoveAllHome(filePath string) error {
+	return r.MockSystem.RemoveAllHome(r.homePath(filePath))
+}
+
+// homePath returns the absolute path of a path in the user's home directory.
+func (r *mockUserSystem) homePath(filePath string) string {
+	if path.IsAbs(filePath) {
+		return filePath
+	}
+	return path.Join(r.user.HomeDir, filePath)
+}
@@ -0,0 +1,108 @@
+package system
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// outputMutex serialises writes of streamed command output, such that lines from commands
+// running concurrently are not interleaved.
+var outputMutex sync.Mutex
+
+// outputPrefixKey is the context key used to store the prefix applied to streamed output.
+type outputPrefixKey struct{}
+
+// WithOutputPrefix returns a copy of the context which causes the output of commands run
+// with it to be prefixed with the specified string, e.g. the name of the provider or
+// handler that started the command.
+func WithOutputPrefix(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, outputPrefixKey{}, prefix)
+}
+
+// OutputPrefix returns the prefix applied to the output of commands run with the context.
+func OutputPrefix(ctx context.Context) string {
+	prefix, _ := ctx.Value(outputPrefixKey{}).(string)
+	return prefix
+}
+
+// newLineWriter constructs a writer that writes each complete line of its input to out,
+// with the specified prefix, and records the full, unprefixed output. If log is not nil, each
+// line is also written to it without colour.
+func newLineWriter(out io.Writer, log io.Writer, prefix string) *lineWriter {
+	w := &lineWriter{out: out, log: log}
+	if len(prefix) > 0 {
+		w.prefix = color.New(color.FgCyan, color.Bold).Sprintf("[%s]", prefix) + " "
+		w.logPrefix = fmt.Sprintf("[%s] ", prefix)
+	}
+	return w
+}
+
+// lineWriter is an io.Writer that streams command output line by line.
+type lineWriter struct {
+	out       io.Writer
+	log       io.Writer
+	prefix    string
+	logPrefix string
+	// output is the full output written so far.
+	output bytes.Buffer
+	// partial holds any trailing output that is not yet terminated by a newline.
+	partial []byte
+}
+
+// Write records p, and writes any lines it completes.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.output.Write(p)
+	w.partial = append(w.partial, p...)
+
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush writes any remaining output that is not terminated by a newline.
+func (w *lineWriter) Flush() {
+	if len(w.partial) > 0 {
+		w.writeLine(w.partial)
+		w.partial = nil
+	}
+}
+
+// Bytes returns the full output written so far.
+func (w *lineWriter) Bytes() []byte {
+	return w.output.Bytes()
+}
+
+// writeLine writes a single line of output with the prefix. Carriage returns, as used by
+// progress bars, are removed so they do not overwrite the prefix.
+func (w *lineWriter) writeLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if i := bytes.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	fmt.Fprintf(w.out, "%s%s\n", w.prefix, line)
+	if w.log != nil {
+		fmt.Fprintf(w.log, "%s%s\n", w.logPrefix, line)
+	}
+}
+
+// streamOutput reports whether the output of a command should be streamed. Output from
+// read-only commands, which query the state of the machine, is only streamed with `--trace`,
+// and output from sensitive commands is never streamed.
+func (s *System) streamOutput(c *Command) bool {
+	return !c.Sensitive && (s.trace || !c.ReadOnly)
+}
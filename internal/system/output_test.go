@@ -0,0 +1,78 @@
+package system
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestLineWriter(t *testing.T) {
+	color.NoColor = true
+
+	type test struct {
+		prefix   string
+		writes   []string
+		expected string
+	}
+
+	tests := []test{
+		{
+			prefix:   "",
+			writes:   []string{"foo\nbar\n"},
+			expected: "foo\nbar\n",
+		},
+		{
+			prefix:   "k8s",
+			writes:   []string{"foo\nbar\n"},
+			expected: "[k8s] foo\n[k8s] bar\n",
+		},
+		{
+			prefix:   "juju:lxd",
+			writes:   []string{"fo", "o\nba", "r"},
+			expected: "[juju:lxd] foo\n[juju:lxd] bar\n",
+		},
+		{
+			prefix:   "snap",
+			writes:   []string{"10%\r50%\r100%\r\ndone\n"},
+			expected: "[snap] 100%\n[snap] done\n",
+		},
+	}
+
+	for _, tc := range tests {
+		var out, log bytes.Buffer
+		w := newLineWriter(&out, &log, tc.prefix)
+
+		input := ""
+		for _, s := range tc.writes {
+			input += s
+			w.Write([]byte(s))
+		}
+		w.Flush()
+
+		if out.String() != tc.expected {
+			t.Fatalf("expected: %q, got: %q", tc.expected, out.String())
+		}
+
+		if log.String() != tc.expected {
+			t.Fatalf("expected: %q, got: %q", tc.expected, log.String())
+		}
+
+		if string(w.Bytes()) != input {
+			t.Fatalf("expected: %q, got: %q", input, string(w.Bytes()))
+		}
+	}
+}
+
+func TestOutputPrefix(t *testing.T) {
+	ctx := context.Background()
+	if prefix := OutputPrefix(ctx); prefix != "" {
+		t.Fatalf("expected: %q, got: %q", "", prefix)
+	}
+
+	ctx = WithOutputPrefix(ctx, "juju:lxd")
+	if prefix := OutputPrefix(ctx); prefix != "juju:lxd" {
+		t.Fatalf("expected: %q, got: %q", "juju:lxd", prefix)
+	}
+}
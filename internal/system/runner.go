@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/user"
@@ -14,12 +17,18 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/jnsgruk/concierge/internal/events"
 	retry "github.com/sethvargo/go-retry"
 	client "github.com/snapcore/snapd/client"
 )
 
+// commandGracePeriod is the time a command is given to exit after being terminated, before
+// it is killed.
+const commandGracePeriod = 10 * time.Second
+
 // NewSystem constructs a new command system.
 func NewSystem(trace bool) (*System, error) {
 	realUser, err := realUser()
@@ -29,8 +38,10 @@ func NewSystem(trace bool) (*System, error) {
 	return &System{
 		trace:      trace,
 		user:       realUser,
-		cmdMutexes: map[string]*sync.Mutex{},
+		out:        os.Stdout,
+		cmdMutexes: &sync.Map{},
 		snapd:      *client.New(nil),
+		snapMtx:    &sync.Mutex{},
 	}, nil
 }
 
@@ -39,16 +50,47 @@ type System struct {
 	trace bool
 	user  *user.User
 	snapd client.Client
-	// Map of mutexes to prevent the concurrent execution of certain commands.
-	cmdMutexes map[string]*sync.Mutex
+	// out is the writer to which the output of commands is streamed.
+	out io.Writer
+	// log is the file to which the output of each command is written, if any.
+	log io.Writer
+	// Map of mutexes to prevent the concurrent execution of certain commands, keyed by
+	// executable. The map is shared with the systems returned by ForUser.
+	cmdMutexes *sync.Map
+	// snapMtx prevents the concurrent execution of snapd changes.
+	snapMtx *sync.Mutex
 }
 
 // User returns a user struct containing details of the "real" user, which
 // may differ from the current user when concierge is executed with `sudo`.
 func (s *System) User() *user.User { return s.user }
 
+// ForUser returns a system that acts on behalf of the specified user, such that its home
+// directory operations apply to that user's home directory. Command mutexes, the snapd
+// client and the log file are shared with the original system.
+func (s *System) ForUser(username string) (Worker, error) {
+	if username == s.user.Username {
+		return s, nil
+	}
+
+	u, err := user.Lookup(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup user '%s': %w", username, err)
+	}
+
+	return &System{
+		trace:      s.trace,
+		user:       u,
+		out:        s.out,
+		snapd:      s.snapd,
+		log:        s.log,
+		cmdMutexes: s.cmdMutexes,
+		snapMtx:    s.snapMtx,
+	}, nil
+}
+
 // Run executes the command, returning the stdout/stderr where appropriate.
-func (s *System) Run(c *Command) ([]byte, error) {
+func (s *System) Run(ctx context.Context, c *Command) ([]byte, error) {
 	logger := slog.Default()
 	if len(c.User) > 0 {
 		logger = slog.With("user", c.User)
@@ -63,18 +105,73 @@ func (s *System) Run(c *Command) ([]byte, error) {
 	}
 
 	commandString := c.CommandString()
-	cmd := exec.Command(shell, "-c", commandString)
+	cmd := exec.CommandContext(ctx, shell, "-c", commandString)
+
+	// Run the command in its own process group, such that if the context is cancelled, any
+	// processes started by the shell are terminated along with it. Processes that have not
+	// exited after the grace period are killed.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM) }
+	cmd.WaitDelay = commandGracePeriod
+
+	// Output is streamed line by line as it arrives, prefixed to identify the component that
+	// started the command, since several commands may be running concurrently.
+	// The output of sensitive commands is not written to the log file either.
+	log := s.log
+	if c.Sensitive {
+		log = nil
+	}
+
+	stream := s.streamOutput(c)
+	writer := newLineWriter(io.Discard, log, OutputPrefix(ctx))
+	if stream {
+		writer = newLineWriter(s.out, log, OutputPrefix(ctx))
+	}
+	cmd.Stdout = writer
+	cmd.Stderr = writer
 
 	logger.Debug("Starting command", "command", commandString)
+	events.Emit(ctx, events.Event{Type: events.CommandStarted, Component: OutputPrefix(ctx), Command: commandString, User: c.User})
+
+	if s.trace {
+		fmt.Print(generateTraceMessage(commandString, nil))
+	}
 
 	start := time.Now()
-	output, err := cmd.CombinedOutput()
+	err = cmd.Run()
+	writer.Flush()
+	output := writer.Bytes()
 
 	elapsed := time.Since(start)
-	logger.Debug("Finished command", "command", commandString, "elapsed", elapsed)
+	duration := elapsed.Seconds()
 
-	if s.trace || err != nil {
-		fmt.Print(generateTraceMessage(commandString, output))
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	logger.Debug("Finished command", "command", commandString, "elapsed", elapsed, "exit-code", exitCode)
+	events.Emit(ctx, events.Event{
+		Type:      events.CommandFinished,
+		Component: OutputPrefix(ctx),
+		Command:   commandString,
+		User:      c.User,
+		ExitCode:  &exitCode,
+		Duration:  &duration,
+	})
+
+	if ctx.Err() != nil {
+		logger.Debug("Command cancelled", "command", commandString)
+		return output, fmt.Errorf("command '%s' cancelled: %w", commandString, ctx.Err())
+	}
+
+	// Failed commands are always reported, along with their output if it was not streamed
+	// and does not contain secrets.
+	if err != nil && !s.trace {
+		if stream || c.Sensitive {
+			fmt.Print(generateTraceMessage(commandString, nil))
+		} else {
+			fmt.Print(generateTraceMessage(commandString, output))
+		}
 	}
 
 	return output, err
@@ -82,14 +179,29 @@ func (s *System) Run(c *Command) ([]byte, error) {
 
 // RunWithRetries executes the command, retrying utilising an exponential backoff pattern,
 // which starts at 1 second. Retries will be attempted up to the specified maximum duration.
-func (s *System) RunWithRetries(c *Command, maxDuration time.Duration) ([]byte, error) {
+func (s *System) RunWithRetries(ctx context.Context, c *Command, maxDuration time.Duration) ([]byte, error) {
 	backoff := retry.NewExponential(1 * time.Second)
 	backoff = retry.WithMaxDuration(maxDuration, backoff)
-	ctx := context.Background()
+
+	attempt := 0
+	var lastErr error
 
 	return retry.DoValue(ctx, backoff, func(ctx context.Context) ([]byte, error) {
-		output, err := s.Run(c)
+		attempt++
+		if attempt > 1 {
+			slog.Debug("Retrying command", "command", c.CommandString(), "attempt", attempt)
+			events.Emit(ctx, events.Event{
+				Type:      events.RetryAttempted,
+				Component: OutputPrefix(ctx),
+				Command:   c.CommandString(),
+				Attempt:   attempt,
+				Error:     lastErr.Error(),
+			})
+		}
+
+		output, err := s.Run(ctx, c)
 		if err != nil {
+			lastErr = err
 			return nil, retry.RetryableError(err)
 		}
 
@@ -99,9 +211,9 @@ func (s *System) RunWithRetries(c *Command, maxDuration time.Duration) ([]byte,
 
 // RunMany takes a variadic number of Command's, and runs them in a loop, returning
 // and error if any command fails.
-func (s *System) RunMany(commands ...*Command) error {
+func (s *System) RunMany(ctx context.Context, commands ...*Command) error {
 	for _, cmd := range commands {
-		_, err := s.Run(cmd)
+		_, err := s.Run(ctx, cmd)
 		if err != nil {
 			return err
 		}
@@ -111,23 +223,24 @@ func (s *System) RunMany(commands ...*Command) error {
 
 // RunExclusive is a wrapper around Run that uses a mutex to ensure that only one of that
 // particular command can be run at a time.
-func (s *System) RunExclusive(c *Command) ([]byte, error) {
-	mtx, ok := s.cmdMutexes[c.Executable]
-	if !ok {
-		mtx = &sync.Mutex{}
-		s.cmdMutexes[c.Executable] = mtx
-	}
+func (s *System) RunExclusive(ctx context.Context, c *Command) ([]byte, error) {
+	value, _ := s.cmdMutexes.LoadOrStore(c.Executable, &sync.Mutex{})
+	mtx := value.(*sync.Mutex)
 
 	mtx.Lock()
 	defer mtx.Unlock()
 
-	output, err := s.Run(c)
+	output, err := s.Run(ctx, c)
 	return output, err
 }
 
 // WriteHomeDirFile takes a path relative to the real user's home dir, and writes the contents
-// specified to it.
+// specified to it. Absolute paths are written as they are, and are not chowned to the user.
 func (s *System) WriteHomeDirFile(filePath string, contents []byte) error {
+	if path.IsAbs(filePath) {
+		return s.WriteFile(filePath, contents, 0644)
+	}
+
 	dir := path.Dir(filePath)
 
 	err := s.MkHomeSubdirectory(dir)
@@ -176,9 +289,13 @@ func (s *System) MkHomeSubdirectory(subdirectory string) error {
 	return nil
 }
 
-// ReadHomeDirFile takes a path relative to the real user's home dir, and reads the content
-// from the file
+// ReadHomeDirFile takes a path relative to the real user's home dir, or an absolute path, and
+// reads the content from the file
 func (s *System) ReadHomeDirFile(filePath string) ([]byte, error) {
+	if path.IsAbs(filePath) {
+		return s.ReadFile(filePath)
+	}
+
 	homePath := path.Join(s.user.HomeDir, filePath)
 	return s.ReadFile(homePath)
 }
@@ -191,8 +308,77 @@ func (s *System) ReadFile(filePath string) ([]byte, error) {
 	return os.ReadFile(filePath)
 }
 
-// RemoveAllHome recursively removes a file path from the user's home directory.
+// Fetch retrieves the contents of a file from a URL. Supported schemes are 'file', 'http' and
+// 'https'.
+func (s *System) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse url '%s': %w", rawURL, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return s.ReadFile(u.Path)
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported scheme '%s' in url '%s'", u.Scheme, rawURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for '%s': %w", rawURL, err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch '%s': %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch '%s': %s", rawURL, resp.Status)
+	}
+
+	contents, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from '%s': %w", rawURL, err)
+	}
+
+	return contents, nil
+}
+
+// WriteFile writes the contents specified to a file with an arbitrary path, creating its parent
+// directories if necessary.
+func (s *System) WriteFile(filePath string, contents []byte, perm os.FileMode) error {
+	err := os.MkdirAll(path.Dir(filePath), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory '%s': %w", path.Dir(filePath), err)
+	}
+
+	if err := os.WriteFile(filePath, contents, perm); err != nil {
+		return fmt.Errorf("failed to write file '%s': %w", filePath, err)
+	}
+
+	return nil
+}
+
+// RemoveFile removes a file with an arbitrary path. Removing a file that does not exist
+// succeeds.
+func (s *System) RemoveFile(filePath string) error {
+	err := os.Remove(filePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove file '%s': %w", filePath, err)
+	}
+	return nil
+}
+
+// RemoveAllHome recursively removes a file path from the user's home directory, or an
+// absolute path.
 func (s *System) RemoveAllHome(filePath string) error {
+	if path.IsAbs(filePath) {
+		return os.RemoveAll(filePath)
+	}
+
 	return os.RemoveAll(path.Join(s.user.HomeDir, filePath))
 }
 
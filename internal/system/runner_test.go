@@ -0,0 +1,206 @@
+package system
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunCancelledCommand(t *testing.T) {
+	s, err := NewSystem(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The shell starts a child process, which must also be terminated on cancellation.
+	start := time.Now()
+	_, err = s.Run(ctx, NewCommand("sh", []string{"-c", "sleep 30; echo done"}))
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected: %v, got: %v", context.DeadlineExceeded, err)
+	}
+
+	if elapsed > 5*time.Second {
+		t.Fatalf("expected command to be terminated promptly, took %s", elapsed)
+	}
+}
+
+func TestRunReturnsCombinedOutput(t *testing.T) {
+	s, err := NewSystem(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithOutputPrefix(context.Background(), "test")
+
+	output, err := s.Run(ctx, NewCommand("sh", []string{"-c", "echo foo; echo bar >&2"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "foo\nbar\n"
+	if string(output) != expected {
+		t.Fatalf("expected: %q, got: %q", expected, string(output))
+	}
+}
+
+func TestRunSensitiveCommand(t *testing.T) {
+	s, err := NewSystem(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	s.out = &out
+
+	cmd := NewCommand("sh", []string{"-c", "echo secret-token"})
+	cmd.Sensitive = true
+
+	output, err := s.Run(context.Background(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(output) != "secret-token\n" {
+		t.Fatalf("expected: %q, got: %q", "secret-token\n", string(output))
+	}
+
+	if strings.Contains(out.String(), "secret-token") {
+		t.Fatalf("expected sensitive output not to be streamed, got: %q", out.String())
+	}
+
+	// Output from commands that are not sensitive is streamed to the same writer.
+	_, err = s.Run(context.Background(), NewCommand("sh", []string{"-c", "echo not-a-secret"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "not-a-secret") {
+		t.Fatalf("expected output to be streamed, got: %q", out.String())
+	}
+}
+
+func TestRunExclusiveConcurrently(t *testing.T) {
+	s, err := NewSystem(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := &System{user: s.user, out: s.out, cmdMutexes: s.cmdMutexes, snapMtx: s.snapMtx}
+
+	// Workers for different users share the same command mutexes, and may run exclusive
+	// commands at the same time.
+	var wg sync.WaitGroup
+	for _, worker := range []*System{s, other} {
+		for _, executable := range []string{"true", "echo", "printf", "basename"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := worker.RunExclusive(context.Background(), NewCommand(executable, []string{"x"}))
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func TestFetch(t *testing.T) {
+	s, err := NewSystem(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/kustomize" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("from http"))
+	}))
+	defer server.Close()
+
+	filePath := path.Join(t.TempDir(), "kustomize")
+	err = os.WriteFile(filePath, []byte("from file"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type test struct {
+		url      string
+		expected string
+		err      string
+	}
+
+	tests := []test{
+		{url: server.URL + "/kustomize", expected: "from http"},
+		{url: "file://" + filePath, expected: "from file"},
+		{url: server.URL + "/missing", err: fmt.Sprintf("failed to fetch '%s/missing': 404 Not Found", server.URL)},
+		{url: "ftp://example.com/kustomize", err: "unsupported scheme 'ftp' in url 'ftp://example.com/kustomize'"},
+	}
+
+	for _, tc := range tests {
+		contents, err := s.Fetch(context.Background(), tc.url)
+
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("expected: %v, got: %v", tc.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(contents) != tc.expected {
+			t.Fatalf("expected: %v, got: %v", tc.expected, string(contents))
+		}
+	}
+}
+
+func TestHomeDirFileAbsolutePath(t *testing.T) {
+	s, err := NewSystem(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := path.Join(t.TempDir(), "etc", "concierge.conf")
+
+	err = s.WriteHomeDirFile(filePath, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := s.ReadHomeDirFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(contents) != "foo" {
+		t.Fatalf("expected: %v, got: %v", "foo", string(contents))
+	}
+
+	err = s.RemoveAllHome(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filePath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected file '%s' to be removed, got: %v", filePath, err)
+	}
+}
@@ -2,29 +2,56 @@ package system
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"time"
 
+	"github.com/jnsgruk/concierge/internal/events"
 	retry "github.com/sethvargo/go-retry"
 	client "github.com/snapcore/snapd/client"
 )
 
+// snapChangePollInterval is the interval at which the progress of a snapd change is checked.
+const snapChangePollInterval = 250 * time.Millisecond
+
 // SnapInfo represents information about a snap fetched from the snapd API.
 type SnapInfo struct {
 	Installed bool
 	Classic   bool
+	// TrackingChannel is the channel an installed snap is tracking.
+	TrackingChannel string
+	// Revision is the revision of an installed snap.
+	Revision string
 }
 
-// Snap represents a given snap on a given channel.
+// Snap represents a given snap on a given channel, or a snap installed from a local file.
 type Snap struct {
 	Name        string
 	Channel     string
 	Connections []string
+	// Path is the path of a local .snap file to install, rather than installing from the store.
+	Path string
+	// Aliases maps the name of each alias to create to the snap application it refers to.
+	Aliases map[string]string
+	// Config is a map of configuration options to set on the snap.
+	Config map[string]string
+	// Services maps the name of each of the snap's services to the action to take on it.
+	Services map[string]string
+}
+
+// SnapService represents the state of a service provided by a snap.
+type SnapService struct {
+	// Enabled reports whether the service starts on boot.
+	Enabled bool
+	// Active reports whether the service is running.
+	Active bool
 }
 
 // NewSnap returns a new Snap package.
@@ -32,9 +59,23 @@ func NewSnap(name, channel string, connections []string) *Snap {
 	return &Snap{Name: name, Channel: channel, Connections: connections}
 }
 
+// NewSnapFromPath returns a snap to be installed from a local .snap file. The name of the snap
+// is taken from the file name, which is of the form `<name>_<version>_<arch>.snap`.
+func NewSnapFromPath(path string) *Snap {
+	name, _, _ := strings.Cut(strings.TrimSuffix(filepath.Base(path), ".snap"), "_")
+	snap := NewSnap(name, "", []string{})
+	snap.Path = path
+	return snap
+}
+
 // NewSnapFromString returns a constructed snap instance, where the snap is
-// specified in shorthand form, i.e. `charmcraft/latest/edge`.
+// specified in shorthand form, i.e. `charmcraft/latest/edge`, or as the path of a
+// local .snap file, i.e. `./charmcraft_3.2_amd64.snap`.
 func NewSnapFromString(snap string) *Snap {
+	if strings.HasSuffix(snap, ".snap") {
+		return NewSnapFromPath(snap)
+	}
+
 	before, after, found := strings.Cut(snap, "/")
 	if found {
 		return NewSnap(before, after, []string{})
@@ -43,28 +84,49 @@ func NewSnapFromString(snap string) *Snap {
 	}
 }
 
+// InstalledSnapInfo returns information about a given snap from snapd, without looking up its
+// details in the snap store.
+func (s *System) InstalledSnapInfo(ctx context.Context, snap string) (*SnapInfo, error) {
+	info := &SnapInfo{}
+
+	if installed := s.installedSnap(ctx, snap); installed != nil {
+		info.Installed = true
+		info.Classic = installed.Confinement == client.ClassicConfinement
+		info.TrackingChannel = installed.TrackingChannel
+		info.Revision = installed.Revision.String()
+	}
+
+	return info, nil
+}
+
 // SnapInfo returns information about a given snap, looking up details in the snap
 // store using the snapd client API where necessary.
-func (s *System) SnapInfo(snap string, channel string) (*SnapInfo, error) {
-	classic, err := s.snapIsClassic(snap, channel)
+func (s *System) SnapInfo(ctx context.Context, snap string, channel string) (*SnapInfo, error) {
+	classic, err := s.snapIsClassic(ctx, snap, channel)
 	if err != nil {
 		return nil, err
 	}
 
-	installed := s.snapInstalled(snap)
+	info := &SnapInfo{Classic: classic}
 
-	slog.Debug("Queried snapd API", "snap", snap, "installed", installed, "classic", classic)
-	return &SnapInfo{Installed: installed, Classic: classic}, nil
+	if installed := s.installedSnap(ctx, snap); installed != nil {
+		info.Installed = true
+		info.TrackingChannel = installed.TrackingChannel
+		info.Revision = installed.Revision.String()
+	}
+
+	slog.Debug("Queried snapd API", "snap", snap, "installed", info.Installed, "classic", classic)
+	return info, nil
 }
 
 // SnapChannels returns the list of channels available for a given snap.
-func (s *System) SnapChannels(snap string) ([]string, error) {
+func (s *System) SnapChannels(ctx context.Context, snap string) ([]string, error) {
 	// Fetch the channels from
 	if _, err := os.Stat("/run/snapd.socket"); errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	}
 
-	storeSnap, err := s.withRetry(func(ctx context.Context) (*client.Snap, error) {
+	storeSnap, err := s.withRetry(ctx, func(ctx context.Context) (*client.Snap, error) {
 		snap, _, err := s.snapd.FindOne(snap)
 		if err != nil {
 			if strings.Contains(err.Error(), "snap not found") {
@@ -93,9 +155,10 @@ func (s *System) SnapChannels(snap string) ([]string, error) {
 	return channels, nil
 }
 
-// snapInstalled is a helper that reports if the snap is currently Installed.
-func (s *System) snapInstalled(name string) bool {
-	snap, err := s.withRetry(func(ctx context.Context) (*client.Snap, error) {
+// installedSnap is a helper that returns the details of a snap if it is currently installed,
+// or nil otherwise.
+func (s *System) installedSnap(ctx context.Context, name string) *client.Snap {
+	snap, err := s.withRetry(ctx, func(ctx context.Context) (*client.Snap, error) {
 		snap, _, err := s.snapd.Snap(name)
 		if err != nil && strings.Contains(err.Error(), "snap not installed") {
 			return snap, nil
@@ -104,17 +167,17 @@ func (s *System) snapInstalled(name string) bool {
 		}
 		return snap, nil
 	})
-	if err != nil || snap == nil {
-		return false
+	if err != nil || snap == nil || snap.Status != client.StatusActive {
+		return nil
 	}
 
-	return snap.Status == client.StatusActive
+	return snap
 }
 
 // snapIsClassic reports whether or not the snap at the tip of the specified channel uses
 // Classic confinement or not.
-func (s *System) snapIsClassic(name, channel string) (bool, error) {
-	snap, err := s.withRetry(func(ctx context.Context) (*client.Snap, error) {
+func (s *System) snapIsClassic(ctx context.Context, name, channel string) (bool, error) {
+	snap, err := s.withRetry(ctx, func(ctx context.Context) (*client.Snap, error) {
 		snap, _, err := s.snapd.FindOne(name)
 		if err != nil {
 			if strings.Contains(err.Error(), "snap not found") {
@@ -136,9 +199,481 @@ func (s *System) snapIsClassic(name, channel string) (bool, error) {
 	return snap.Confinement == "classic", nil
 }
 
-func (s *System) withRetry(f func(ctx context.Context) (*client.Snap, error)) (*client.Snap, error) {
+// InstallSnap installs a snap from the specified channel using the snapd API, and waits for
+// the installation to complete.
+func (s *System) InstallSnap(ctx context.Context, name string, channel string, classic bool) error {
+	cmd := NewCommand("snap", snapInstallArgs("install", name, channel, classic))
+	return s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.Install(name, nil, &client.SnapOptions{Channel: channel, Classic: classic})
+	})
+}
+
+// RefreshSnap refreshes an installed snap onto the specified channel using the snapd API, and
+// waits for the refresh to complete. Refreshing a snap that is already up to date succeeds.
+func (s *System) RefreshSnap(ctx context.Context, name string, channel string, classic bool) error {
+	cmd := NewCommand("snap", snapInstallArgs("refresh", name, channel, classic))
+	err := s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.Refresh(name, &client.SnapOptions{Channel: channel, Classic: classic})
+	})
+	if isSnapErrorKind(err, client.ErrorKindSnapNoUpdateAvailable) {
+		slog.Debug("Snap has no updates available", "snap", name)
+		return nil
+	}
+	return err
+}
+
+// RevertSnap reverts an installed snap to the specified revision using the snapd API, and
+// waits for the change to complete.
+func (s *System) RevertSnap(ctx context.Context, name string, revision string) error {
+	cmd := NewCommand("snap", snapRevertArgs(name, revision))
+	return s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.Revert(name, &client.SnapOptions{Revision: revision})
+	})
+}
+
+// ConnectSnap connects a snap plug to a slot using the snapd API, and waits for the connection
+// to complete. The plug and slot are specified as they would be to 'snap connect', i.e.
+// '<snap>:<plug>' and optionally '<snap>:<slot>', and connecting an already connected plug
+// succeeds.
+func (s *System) ConnectSnap(ctx context.Context, plug string, slot string) error {
+	plugSnap, plugName := parseSnapEndpoint(plug)
+	slotSnap, slotName := parseSnapEndpoint(slot)
+
+	cmd := NewCommand("snap", snapConnectArgs(plug, slot))
+	err := s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.Connect(plugSnap, plugName, slotSnap, slotName)
+	})
+	if client.IsInterfacesUnchangedError(err) {
+		slog.Debug("Snap connection already exists", "plug", plug, "slot", slot)
+		return nil
+	}
+	return err
+}
+
+// RemoveSnap removes a snap using the snapd API, optionally purging its data, and waits for
+// the removal to complete. Removing a snap that is not installed succeeds.
+func (s *System) RemoveSnap(ctx context.Context, name string, purge bool) error {
+	cmd := NewCommand("snap", snapRemoveArgs(name, purge))
+	err := s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.Remove(name, nil, &client.SnapOptions{Purge: purge})
+	})
+	if isSnapErrorKind(err, client.ErrorKindSnapNotInstalled) {
+		slog.Debug("Snap is not installed", "snap", name)
+		return nil
+	}
+	return err
+}
+
+// InstallSnapFile installs a snap from a local .snap file using the snapd API, and waits for
+// the installation to complete. Unless dangerous is set, the snap's assertions must already
+// have been acknowledged.
+func (s *System) InstallSnapFile(ctx context.Context, path string, dangerous bool, classic bool) error {
+	cmd := NewCommand("snap", snapInstallFileArgs(path, dangerous, classic))
+	return s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.InstallPath(path, "", &client.SnapOptions{Dangerous: dangerous, Classic: classic})
+	})
+}
+
+// AckSnapAssertion adds the assertions in the specified file to the system assertion
+// database, as with 'snap ack'.
+func (s *System) AckSnapAssertion(ctx context.Context, path string) error {
+	slog.Debug("Acknowledging snap assertion", "path", path)
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read assertion file: %w", err)
+	}
+
+	err = s.snapd.Ack(contents)
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge assertion '%s': %w", path, err)
+	}
+
+	return nil
+}
+
+// AliasSnap creates an alias for one of a snap's applications using the snapd API, and waits
+// for the change to complete.
+func (s *System) AliasSnap(ctx context.Context, name string, app string, alias string) error {
+	cmd := NewCommand("snap", snapAliasArgs(name, app, alias))
+	return s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.Alias(name, app, alias)
+	})
+}
+
+// UnaliasSnap removes an alias using the snapd API, and waits for the change to complete.
+func (s *System) UnaliasSnap(ctx context.Context, alias string) error {
+	cmd := NewCommand("snap", []string{"unalias", alias})
+	return s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.Unalias(alias)
+	})
+}
+
+// SnapAliases returns the enabled aliases of a snap, mapped to the applications they refer to.
+// An application with the same name as its snap is referred to by the snap name.
+func (s *System) SnapAliases(ctx context.Context, name string) (map[string]string, error) {
+	statuses, err := s.snapd.Aliases()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query aliases of snap '%s': %w", name, err)
+	}
+
+	aliases := map[string]string{}
+	for alias, status := range statuses[name] {
+		if status.Status == "disabled" {
+			continue
+		}
+
+		_, app, ok := strings.Cut(status.Command, ".")
+		if !ok {
+			app = name
+		}
+		aliases[alias] = app
+	}
+
+	return aliases, nil
+}
+
+// SnapConfig returns the current values of the specified configuration options of a snap.
+// Options that are not set are omitted. Values that are not strings are formatted as JSON.
+func (s *System) SnapConfig(ctx context.Context, name string, options []string) (map[string]string, error) {
+	config := map[string]string{}
+
+	// Options are queried individually, since snapd returns an error if any are not set.
+	for _, option := range options {
+		values, err := s.snapd.Conf(name, []string{option})
+		if isSnapErrorKind(err, client.ErrorKindConfigNoSuchOption) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to query option '%s' of snap '%s': %w", option, name, err)
+		}
+
+		value, err := formatSnapConfigValue(values[option])
+		if err != nil {
+			return nil, fmt.Errorf("failed to format option '%s' of snap '%s': %w", option, name, err)
+		}
+		config[option] = value
+	}
+
+	return config, nil
+}
+
+// SetSnapConfig sets configuration options of a snap using the snapd API. As with 'snap set',
+// values that are valid JSON are set as such, and other values are set as strings.
+func (s *System) SetSnapConfig(ctx context.Context, name string, config map[string]string) error {
+	patch := map[string]interface{}{}
+	for option, value := range config {
+		patch[option] = parseSnapConfigValue(value)
+	}
+
+	cmd := NewCommand("snap", snapSetArgs(name, config))
+	return s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.SetConf(name, patch)
+	})
+}
+
+// UnsetSnapConfig removes configuration options from a snap using the snapd API.
+func (s *System) UnsetSnapConfig(ctx context.Context, name string, options []string) error {
+	patch := map[string]interface{}{}
+	for _, option := range options {
+		patch[option] = nil
+	}
+
+	cmd := NewCommand("snap", append([]string{"unset", name}, options...))
+	return s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.SetConf(name, patch)
+	})
+}
+
+// SnapServices returns the state of each of the services provided by a snap, keyed by the
+// name of the service.
+func (s *System) SnapServices(ctx context.Context, name string) (map[string]SnapService, error) {
+	apps, err := s.snapd.Apps([]string{name}, client.AppOptions{Service: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query services of snap '%s': %w", name, err)
+	}
+
+	services := map[string]SnapService{}
+	for _, app := range apps {
+		services[app.Name] = SnapService{Enabled: app.Enabled, Active: app.Active}
+	}
+
+	return services, nil
+}
+
+// StartSnapService starts one of a snap's services using the snapd API, optionally enabling it
+// such that it starts on boot. If no service is specified, all of the snap's services are
+// started.
+func (s *System) StartSnapService(ctx context.Context, name string, service string, enable bool) error {
+	cmd := NewCommand("snap", snapStartArgs(name, service, enable))
+	return s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.Start([]string{snapServiceName(name, service)}, nil, client.UserSelector{}, client.StartOptions{Enable: enable})
+	})
+}
+
+// StopSnapService stops one of a snap's services using the snapd API, optionally disabling it
+// such that it does not start on boot. If no service is specified, all of the snap's services
+// are stopped.
+func (s *System) StopSnapService(ctx context.Context, name string, service string, disable bool) error {
+	cmd := NewCommand("snap", snapStopArgs(name, service, disable))
+	return s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.Stop([]string{snapServiceName(name, service)}, nil, client.UserSelector{}, client.StopOptions{Disable: disable})
+	})
+}
+
+// doSnapChange starts a snapd change, retrying while it conflicts with another change, and
+// waits for it to complete. The command is the equivalent snap CLI command, which is used to
+// describe the change in logs and events. Progress of the change, such as the percentage of a
+// snap that has been downloaded, is streamed with the output prefix from the context. If the
+// context is cancelled, the change is aborted.
+func (s *System) doSnapChange(ctx context.Context, cmd *Command, start func() (string, error)) error {
+	commandString := cmd.CommandString()
+
+	// Changes are made one at a time, since snapd refuses many concurrent changes that
+	// affect the same snaps.
+	s.snapMtx.Lock()
+	defer s.snapMtx.Unlock()
+
+	slog.Debug("Starting snap change", "command", commandString)
+	events.Emit(ctx, events.Event{Type: events.CommandStarted, Component: OutputPrefix(ctx), Command: commandString})
+
+	begin := time.Now()
+	err := s.runSnapChange(ctx, start)
+	elapsed := time.Since(begin)
+	duration := elapsed.Seconds()
+
+	exitCode := 0
+	if err != nil {
+		exitCode = 1
+	}
+
+	slog.Debug("Finished snap change", "command", commandString, "elapsed", elapsed, "error", err)
+	events.Emit(ctx, events.Event{
+		Type:      events.CommandFinished,
+		Component: OutputPrefix(ctx),
+		Command:   commandString,
+		ExitCode:  &exitCode,
+		Duration:  &duration,
+	})
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("snap change '%s' cancelled: %w", commandString, ctx.Err())
+	}
+
+	return err
+}
+
+// runSnapChange starts a snapd change and waits for it to complete.
+func (s *System) runSnapChange(ctx context.Context, start func() (string, error)) error {
+	backoff := retry.NewExponential(1 * time.Second)
+	backoff = retry.WithMaxRetries(10, backoff)
+
+	changeID, err := retry.DoValue(ctx, backoff, func(ctx context.Context) (string, error) {
+		id, err := start()
+		if client.IsRetryable(err) {
+			slog.Debug("Snap change conflicts with another change, retrying", "error", err.Error())
+			return "", retry.RetryableError(err)
+		}
+		return id, err
+	})
+	if err != nil {
+		return err
+	}
+
+	progress := newLineWriter(os.Stdout, s.log, OutputPrefix(ctx))
+	lastStatus := ""
+
+	ticker := time.NewTicker(snapChangePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if _, err := s.snapd.Abort(changeID); err != nil {
+				slog.Debug("Failed to abort snap change", "change", changeID, "error", err.Error())
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		change, err := s.snapd.Change(changeID)
+		if err != nil {
+			return fmt.Errorf("failed to query snap change '%s': %w", changeID, err)
+		}
+
+		if status := snapChangeStatus(change); status != "" && status != lastStatus {
+			fmt.Fprintln(progress, status)
+			lastStatus = status
+		}
+
+		if !change.Ready {
+			continue
+		}
+
+		if change.Status != "Done" {
+			return fmt.Errorf("snap change '%s' failed: %s", change.Summary, change.Err)
+		}
+
+		return nil
+	}
+}
+
+// snapChangeStatus describes the task in a snapd change that is in progress, along with the
+// percentage complete in steps of 10% where the task reports it, e.g. when downloading a snap.
+func snapChangeStatus(change *client.Change) string {
+	for _, task := range change.Tasks {
+		if task.Status != "Doing" {
+			continue
+		}
+
+		if task.Progress.Total > 1 {
+			percent := task.Progress.Done * 100 / task.Progress.Total
+			return fmt.Sprintf("%s (%d%%)", task.Summary, percent-percent%10)
+		}
+
+		return task.Summary
+	}
+
+	return ""
+}
+
+// snapInstallArgs returns the snap CLI arguments equivalent to installing or refreshing a snap.
+func snapInstallArgs(action string, name string, channel string, classic bool) []string {
+	args := []string{action, name}
+
+	if channel != "" {
+		args = append(args, "--channel", channel)
+	}
+
+	if classic {
+		args = append(args, "--classic")
+	}
+
+	return args
+}
+
+// snapInstallFileArgs returns the snap CLI arguments equivalent to installing a local .snap file.
+func snapInstallFileArgs(path string, dangerous bool, classic bool) []string {
+	args := []string{"install", path}
+
+	if dangerous {
+		args = append(args, "--dangerous")
+	}
+
+	if classic {
+		args = append(args, "--classic")
+	}
+
+	return args
+}
+
+// snapRevertArgs returns the snap CLI arguments equivalent to reverting a snap to a revision.
+func snapRevertArgs(name string, revision string) []string {
+	return []string{"revert", name, "--revision", revision}
+}
+
+// snapAliasArgs returns the snap CLI arguments equivalent to aliasing a snap application. An
+// application with the same name as its snap is referred to by the snap name alone.
+func snapAliasArgs(name string, app string, alias string) []string {
+	if app == name {
+		return []string{"alias", name, alias}
+	}
+	return []string{"alias", fmt.Sprintf("%s.%s", name, app), alias}
+}
+
+// snapConnectArgs returns the snap CLI arguments equivalent to connecting a plug to a slot.
+func snapConnectArgs(plug string, slot string) []string {
+	args := []string{"connect", plug}
+	if slot != "" {
+		args = append(args, slot)
+	}
+	return args
+}
+
+// snapRemoveArgs returns the snap CLI arguments equivalent to removing a snap.
+func snapRemoveArgs(name string, purge bool) []string {
+	args := []string{"remove", name}
+	if purge {
+		args = append(args, "--purge")
+	}
+	return args
+}
+
+// snapSetArgs returns the snap CLI arguments equivalent to setting configuration options.
+func snapSetArgs(name string, config map[string]string) []string {
+	args := []string{"set", name}
+	for _, option := range slices.Sorted(maps.Keys(config)) {
+		args = append(args, fmt.Sprintf("%s=%s", option, config[option]))
+	}
+	return args
+}
+
+// snapStartArgs returns the snap CLI arguments equivalent to starting a service.
+func snapStartArgs(name string, service string, enable bool) []string {
+	args := []string{"start"}
+	if enable {
+		args = append(args, "--enable")
+	}
+	return append(args, snapServiceName(name, service))
+}
+
+// snapStopArgs returns the snap CLI arguments equivalent to stopping a service.
+func snapStopArgs(name string, service string, disable bool) []string {
+	args := []string{"stop"}
+	if disable {
+		args = append(args, "--disable")
+	}
+	return append(args, snapServiceName(name, service))
+}
+
+// snapServiceName returns the name by which snapd refers to a snap's service, or to all of
+// its services if no service is specified.
+func snapServiceName(name string, service string) string {
+	if service == "" {
+		return name
+	}
+	return fmt.Sprintf("%s.%s", name, service)
+}
+
+// parseSnapConfigValue parses the value of a snap configuration option in the same way as
+// 'snap set': values that are valid JSON are parsed, and other values are used as strings.
+func parseSnapConfigValue(value string) interface{} {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		return value
+	}
+	return parsed
+}
+
+// formatSnapConfigValue formats the value of a snap configuration option such that it can be
+// compared with the value in a config file. Strings are returned as-is, and other values are
+// formatted as JSON.
+func formatSnapConfigValue(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+
+	formatted, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(formatted), nil
+}
+
+// parseSnapEndpoint splits a plug or slot specified as '<snap>:<name>' into its snap and name.
+// If there is no colon, the endpoint is the name of a snap.
+func parseSnapEndpoint(endpoint string) (string, string) {
+	snap, name, _ := strings.Cut(endpoint, ":")
+	return snap, name
+}
+
+// isSnapErrorKind reports whether an error returned by the snapd API is of the specified kind.
+func isSnapErrorKind(err error, kind client.ErrorKind) bool {
+	var snapErr *client.Error
+	return errors.As(err, &snapErr) && snapErr.Kind == kind
+}
+
+func (s *System) withRetry(ctx context.Context, f func(ctx context.Context) (*client.Snap, error)) (*client.Snap, error) {
 	backoff := retry.NewExponential(1 * time.Second)
 	backoff = retry.WithMaxRetries(10, backoff)
-	ctx := context.Background()
 	return retry.DoValue(ctx, backoff, f)
 }
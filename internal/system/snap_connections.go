@@ -0,0 +1,202 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	client "github.com/snapcore/snapd/client"
+)
+
+// systemSnaps are the names by which the snap providing the system's slots may be referred to.
+var systemSnaps = []string{"system", "snapd", "core"}
+
+// SnapEndpoint identifies a plug or slot of a snap.
+type SnapEndpoint struct {
+	Snap string
+	Name string
+}
+
+// String returns the endpoint as it would be specified to 'snap connect', i.e. '<snap>:<name>'.
+func (e SnapEndpoint) String() string {
+	if e.Name == "" {
+		return e.Snap
+	}
+	return fmt.Sprintf("%s:%s", e.Snap, e.Name)
+}
+
+// SnapConnection represents a connection between a plug and a slot. If the slot is empty,
+// or only partially specified, snapd chooses the slot when connecting.
+type SnapConnection struct {
+	Plug SnapEndpoint
+	Slot SnapEndpoint
+}
+
+// ParseSnapConnection parses a connection specified as it would be to 'snap connect', i.e.
+// '<snap>:<plug> [<snap>][:<slot>]'.
+func ParseSnapConnection(connection string) (*SnapConnection, error) {
+	parts := strings.Fields(connection)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty snap connection string")
+	} else if len(parts) > 2 {
+		return nil, fmt.Errorf("too many arguments in snap connection string '%s'", connection)
+	}
+
+	plugSnap, plugName := parseSnapEndpoint(parts[0])
+	if plugSnap == "" || plugName == "" {
+		return nil, fmt.Errorf("plug in snap connection string '%s' must be of the form <snap>:<plug>", connection)
+	}
+
+	c := &SnapConnection{Plug: SnapEndpoint{Snap: plugSnap, Name: plugName}}
+
+	if len(parts) == 2 {
+		slotSnap, slotName := parseSnapEndpoint(parts[1])
+		c.Slot = SnapEndpoint{Snap: slotSnap, Name: slotName}
+	}
+
+	return c, nil
+}
+
+// String returns the connection as it would be specified to 'snap connect'.
+func (c SnapConnection) String() string {
+	return strings.Join(snapConnectArgs(c.Plug.String(), c.Slot.String())[1:], " ")
+}
+
+// SnapInterface describes a plug or slot, and the interface it implements.
+type SnapInterface struct {
+	SnapEndpoint
+	Interface string
+}
+
+// SnapInterfaces describes the plugs, slots and established connections known to snapd.
+type SnapInterfaces struct {
+	Plugs       []SnapInterface
+	Slots       []SnapInterface
+	Connections []SnapConnection
+}
+
+// Known reports whether snapd knows of any plugs or slots of the specified snap.
+func (i *SnapInterfaces) Known(snap string) bool {
+	isSnap := func(e SnapInterface) bool { return e.Snap == snap }
+	return slices.ContainsFunc(i.Plugs, isSnap) || slices.ContainsFunc(i.Slots, isSnap)
+}
+
+// Resolve checks that the plug and slot of a connection exist and implement the same
+// interface, and returns the connection with its slot fully specified. As with snapd, a
+// missing slot snap refers to the system snap, and a missing slot name refers to the only
+// slot of the slot snap that implements the plug's interface.
+func (i *SnapInterfaces) Resolve(c *SnapConnection) (*SnapConnection, error) {
+	plugIndex := slices.IndexFunc(i.Plugs, func(p SnapInterface) bool { return p.SnapEndpoint == c.Plug })
+	if plugIndex < 0 {
+		return nil, fmt.Errorf("snap '%s' has no plug named '%s'", c.Plug.Snap, c.Plug.Name)
+	}
+	plug := i.Plugs[plugIndex]
+
+	slotSnap := c.Slot.Snap
+	if slotSnap == "" {
+		slotSnap = "system"
+	}
+
+	candidates := []SnapInterface{}
+	for _, slot := range i.Slots {
+		if !sameSnap(slot.Snap, slotSnap) {
+			continue
+		}
+		if c.Slot.Name == slot.Name || (c.Slot.Name == "" && slot.Interface == plug.Interface) {
+			candidates = append(candidates, slot)
+		}
+	}
+
+	if len(candidates) == 0 && c.Slot.Name != "" {
+		return nil, fmt.Errorf("snap '%s' has no slot named '%s'", slotSnap, c.Slot.Name)
+	} else if len(candidates) == 0 {
+		return nil, fmt.Errorf("snap '%s' has no slot implementing the '%s' interface", slotSnap, plug.Interface)
+	} else if len(candidates) > 1 {
+		return nil, fmt.Errorf("snap '%s' has more than one slot implementing the '%s' interface", slotSnap, plug.Interface)
+	}
+
+	slot := candidates[0]
+	if slot.Interface != plug.Interface {
+		return nil, fmt.Errorf(
+			"plug '%s' of interface '%s' is not compatible with slot '%s' of interface '%s'",
+			plug.SnapEndpoint, plug.Interface, slot.SnapEndpoint, slot.Interface,
+		)
+	}
+
+	return &SnapConnection{Plug: plug.SnapEndpoint, Slot: slot.SnapEndpoint}, nil
+}
+
+// Connected reports whether a fully specified connection is established.
+func (i *SnapInterfaces) Connected(c *SnapConnection) bool {
+	return slices.ContainsFunc(i.Connections, func(e SnapConnection) bool {
+		return e.Plug == c.Plug && e.Slot.Name == c.Slot.Name && sameSnap(e.Slot.Snap, c.Slot.Snap)
+	})
+}
+
+// SnapInterfaces returns the plugs, slots and established connections known to snapd.
+func (s *System) SnapInterfaces(ctx context.Context) (*SnapInterfaces, error) {
+	conns, err := s.snapd.Connections(&client.ConnectionOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snap connections: %w", err)
+	}
+
+	interfaces := &SnapInterfaces{}
+
+	for _, p := range conns.Plugs {
+		interfaces.Plugs = append(interfaces.Plugs, SnapInterface{
+			SnapEndpoint: SnapEndpoint{Snap: p.Snap, Name: p.Name},
+			Interface:    p.Interface,
+		})
+	}
+
+	for _, p := range conns.Slots {
+		interfaces.Slots = append(interfaces.Slots, SnapInterface{
+			SnapEndpoint: SnapEndpoint{Snap: p.Snap, Name: p.Name},
+			Interface:    p.Interface,
+		})
+	}
+
+	for _, c := range conns.Established {
+		interfaces.Connections = append(interfaces.Connections, SnapConnection{
+			Plug: SnapEndpoint{Snap: c.Plug.Snap, Name: c.Plug.Name},
+			Slot: SnapEndpoint{Snap: c.Slot.Snap, Name: c.Slot.Name},
+		})
+	}
+
+	return interfaces, nil
+}
+
+// DisconnectSnap disconnects a snap plug from a slot using the snapd API, and waits for the
+// disconnection to complete. If the slot is empty, the plug is disconnected from all of its
+// slots. Disconnecting a plug that is not connected succeeds.
+func (s *System) DisconnectSnap(ctx context.Context, plug string, slot string) error {
+	plugSnap, plugName := parseSnapEndpoint(plug)
+	slotSnap, slotName := parseSnapEndpoint(slot)
+
+	cmd := NewCommand("snap", snapDisconnectArgs(plug, slot))
+	err := s.doSnapChange(ctx, cmd, func() (string, error) {
+		return s.snapd.Disconnect(plugSnap, plugName, slotSnap, slotName, nil)
+	})
+	if client.IsInterfacesUnchangedError(err) {
+		slog.Debug("Snap connection does not exist", "plug", plug, "slot", slot)
+		return nil
+	}
+	return err
+}
+
+// snapDisconnectArgs returns the snap CLI arguments equivalent to disconnecting a plug.
+func snapDisconnectArgs(plug string, slot string) []string {
+	args := []string{"disconnect", plug}
+	if slot != "" {
+		args = append(args, slot)
+	}
+	return args
+}
+
+// sameSnap reports whether two snap names refer to the same snap, taking into account the
+// names by which the system snap may be referred to.
+func sameSnap(a string, b string) bool {
+	return a == b || (slices.Contains(systemSnaps, a) && slices.Contains(systemSnaps, b))
+}
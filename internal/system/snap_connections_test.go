@@ -0,0 +1,143 @@
+package system
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSnapConnection(t *testing.T) {
+	type test struct {
+		input    string
+		expected *SnapConnection
+		err      string
+	}
+
+	tests := []test{
+		{
+			input:    "jhack:dot-local-share-juju",
+			expected: &SnapConnection{Plug: SnapEndpoint{"jhack", "dot-local-share-juju"}},
+		},
+		{
+			input:    "juju:lxd  lxd",
+			expected: &SnapConnection{Plug: SnapEndpoint{"juju", "lxd"}, Slot: SnapEndpoint{"lxd", ""}},
+		},
+		{
+			input:    "juju:home :home",
+			expected: &SnapConnection{Plug: SnapEndpoint{"juju", "home"}, Slot: SnapEndpoint{"", "home"}},
+		},
+		{input: "", err: "empty snap connection string"},
+		{input: "jhack", err: "plug in snap connection string 'jhack' must be of the form <snap>:<plug>"},
+		{input: "a:b c:d e:f", err: "too many arguments in snap connection string 'a:b c:d e:f'"},
+	}
+
+	for _, tc := range tests {
+		c, err := ParseSnapConnection(tc.input)
+
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("expected: %v, got: %v", tc.err, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(tc.expected, c) {
+			t.Fatalf("expected: %v, got: %v", tc.expected, c)
+		}
+	}
+}
+
+func TestSnapConnectionString(t *testing.T) {
+	type test struct {
+		input    SnapConnection
+		expected string
+	}
+
+	tests := []test{
+		{SnapConnection{Plug: SnapEndpoint{"jhack", "ssh-read"}}, "jhack:ssh-read"},
+		{SnapConnection{Plug: SnapEndpoint{"juju", "lxd"}, Slot: SnapEndpoint{"lxd", "lxd"}}, "juju:lxd lxd:lxd"},
+		{SnapConnection{Plug: SnapEndpoint{"juju", "home"}, Slot: SnapEndpoint{"", "home"}}, "juju:home :home"},
+	}
+
+	for _, tc := range tests {
+		if tc.input.String() != tc.expected {
+			t.Fatalf("expected: %v, got: %v", tc.expected, tc.input.String())
+		}
+	}
+}
+
+func TestSnapInterfacesResolve(t *testing.T) {
+	r := NewMockSystem()
+	r.MockSnapPlug("juju", "lxd", "lxd")
+	r.MockSnapPlug("juju", "home", "home")
+	r.MockSnapPlug("jhack", "dot-local-share-juju", "personal-files")
+	r.MockSnapSlot("lxd", "lxd", "lxd")
+	r.MockSnapSlot("snapd", "home", "home")
+	r.MockSnapSlot("snapd", "network", "network")
+	r.MockSnapSlot("snapd", "personal-files", "personal-files")
+
+	interfaces := r.mockSnapInterfaces
+
+	type test struct {
+		input    string
+		expected *SnapConnection
+		err      string
+	}
+
+	tests := []test{
+		{
+			input:    "juju:lxd lxd",
+			expected: &SnapConnection{Plug: SnapEndpoint{"juju", "lxd"}, Slot: SnapEndpoint{"lxd", "lxd"}},
+		},
+		{
+			input:    "juju:home",
+			expected: &SnapConnection{Plug: SnapEndpoint{"juju", "home"}, Slot: SnapEndpoint{"snapd", "home"}},
+		},
+		{
+			input:    "juju:home system:home",
+			expected: &SnapConnection{Plug: SnapEndpoint{"juju", "home"}, Slot: SnapEndpoint{"snapd", "home"}},
+		},
+		{
+			input:    "jhack:dot-local-share-juju",
+			expected: &SnapConnection{Plug: SnapEndpoint{"jhack", "dot-local-share-juju"}, Slot: SnapEndpoint{"snapd", "personal-files"}},
+		},
+		{input: "juju:lxdd lxd", err: "snap 'juju' has no plug named 'lxdd'"},
+		{input: "juju:lxd lxd:lxdd", err: "snap 'lxd' has no slot named 'lxdd'"},
+		{input: "juju:lxd", err: "snap 'system' has no slot implementing the 'lxd' interface"},
+		{input: "juju:home :network", err: "plug 'juju:home' of interface 'home' is not compatible with slot 'snapd:network' of interface 'network'"},
+	}
+
+	for _, tc := range tests {
+		c, err := ParseSnapConnection(tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resolved, err := interfaces.Resolve(c)
+
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("expected: %v, got: %v", tc.err, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(tc.expected, resolved) {
+			t.Fatalf("expected: %v, got: %v", tc.expected, resolved)
+		}
+	}
+}
+
+func TestSnapInterfacesConnected(t *testing.T) {
+	r := NewMockSystem()
+	r.MockSnapConnection(SnapEndpoint{"juju", "home"}, SnapEndpoint{"snapd", "home"})
+
+	interfaces := r.mockSnapInterfaces
+
+	if !interfaces.Connected(&SnapConnection{Plug: SnapEndpoint{"juju", "home"}, Slot: SnapEndpoint{"system", "home"}}) {
+		t.Fatalf("expected connection to the system snap to be reported as connected")
+	}
+
+	if interfaces.Connected(&SnapConnection{Plug: SnapEndpoint{"juju", "lxd"}, Slot: SnapEndpoint{"lxd", "lxd"}}) {
+		t.Fatalf("expected connection to be reported as not connected")
+	}
+}
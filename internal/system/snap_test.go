@@ -1,7 +1,12 @@
 package system
 
 import (
+	"context"
+	"fmt"
+	"reflect"
 	"testing"
+
+	client "github.com/snapcore/snapd/client"
 )
 
 func TestNewSnapFromString(t *testing.T) {
@@ -14,11 +19,17 @@ func TestNewSnapFromString(t *testing.T) {
 		{input: "juju", expected: &Snap{Name: "juju"}},
 		{input: "juju/latest/edge", expected: &Snap{Name: "juju", Channel: "latest/edge"}},
 		{input: "juju/stable", expected: &Snap{Name: "juju", Channel: "stable"}},
+		{input: "./jhack_0.4_amd64.snap", expected: &Snap{Name: "jhack", Path: "./jhack_0.4_amd64.snap"}},
+		{input: "/tmp/build/jhack.snap", expected: &Snap{Name: "jhack", Path: "/tmp/build/jhack.snap"}},
 	}
 
 	for _, tc := range tests {
 		snap := NewSnapFromString(tc.input)
 
+		if tc.expected.Path != snap.Path {
+			t.Fatalf("incorrect snap path; expected: %v, got: %v", tc.expected, snap)
+		}
+
 		if tc.expected.Channel != snap.Channel {
 			t.Fatalf("incorrect snap channel; expected: %v, got: %v", tc.expected, snap)
 		}
@@ -27,3 +38,98 @@ func TestNewSnapFromString(t *testing.T) {
 		}
 	}
 }
+
+func TestParseSnapEndpoint(t *testing.T) {
+	type test struct {
+		input        string
+		expectedSnap string
+		expectedName string
+	}
+
+	tests := []test{
+		{input: "juju:lxd", expectedSnap: "juju", expectedName: "lxd"},
+		{input: "lxd", expectedSnap: "lxd", expectedName: ""},
+		{input: ":home", expectedSnap: "", expectedName: "home"},
+		{input: "", expectedSnap: "", expectedName: ""},
+	}
+
+	for _, tc := range tests {
+		snap, name := parseSnapEndpoint(tc.input)
+		if snap != tc.expectedSnap || name != tc.expectedName {
+			t.Fatalf("expected: %s %s, got: %s %s", tc.expectedSnap, tc.expectedName, snap, name)
+		}
+	}
+}
+
+func TestSnapChangeStatus(t *testing.T) {
+	type test struct {
+		change   *client.Change
+		expected string
+	}
+
+	tests := []test{
+		{
+			change:   &client.Change{},
+			expected: "",
+		},
+		{
+			change: &client.Change{Tasks: []*client.Task{
+				{Summary: "Ensure prerequisites for \"juju\" are available", Status: "Done"},
+				{Summary: "Download snap \"juju\" (29171) from channel \"3.6/stable\"", Status: "Doing", Progress: client.TaskProgress{Label: "juju", Done: 37, Total: 100}},
+				{Summary: "Mount snap \"juju\" (29171)", Status: "Do"},
+			}},
+			expected: "Download snap \"juju\" (29171) from channel \"3.6/stable\" (30%)",
+		},
+		{
+			change: &client.Change{Tasks: []*client.Task{
+				{Summary: "Mount snap \"juju\" (29171)", Status: "Doing", Progress: client.TaskProgress{Done: 1, Total: 1}},
+			}},
+			expected: "Mount snap \"juju\" (29171)",
+		},
+	}
+
+	for _, tc := range tests {
+		status := snapChangeStatus(tc.change)
+		if status != tc.expected {
+			t.Fatalf("expected: %s, got: %s", tc.expected, status)
+		}
+	}
+}
+
+func TestIsSnapErrorKind(t *testing.T) {
+	err := fmt.Errorf("failed: %w", &client.Error{Kind: client.ErrorKindSnapNotInstalled, Message: "snap \"jq\" is not installed"})
+
+	if !isSnapErrorKind(err, client.ErrorKindSnapNotInstalled) {
+		t.Fatalf("expected error to be of kind '%s'", client.ErrorKindSnapNotInstalled)
+	}
+
+	if isSnapErrorKind(err, client.ErrorKindSnapChangeConflict) {
+		t.Fatalf("expected error not to be of kind '%s'", client.ErrorKindSnapChangeConflict)
+	}
+
+	if isSnapErrorKind(fmt.Errorf("failed"), client.ErrorKindSnapNotInstalled) {
+		t.Fatalf("expected plain error not to be of kind '%s'", client.ErrorKindSnapNotInstalled)
+	}
+}
+
+func TestMockSnapOperations(t *testing.T) {
+	system := NewMockSystem()
+
+	system.InstallSnap(context.Background(), "charmcraft", "latest/stable", true)
+	system.RefreshSnap(context.Background(), "jq", "latest/edge", false)
+	system.ConnectSnap(context.Background(), "juju:lxd", "")
+	system.ConnectSnap(context.Background(), "lxd:lxd-support", "lxd")
+	system.RemoveSnap(context.Background(), "jq", true)
+
+	expected := []string{
+		"snap install charmcraft --channel latest/stable --classic",
+		"snap refresh jq --channel latest/edge",
+		"snap connect juju:lxd",
+		"snap connect lxd:lxd-support lxd",
+		"snap remove jq --purge",
+	}
+
+	if !reflect.DeepEqual(expected, system.ExecutedCommands) {
+		t.Fatalf("expected: %v, got: %v", expected, system.ExecutedCommands)
+	}
+}
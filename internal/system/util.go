@@ -60,3 +60,22 @@ func realUser() (*user.User, error) {
 
 	return user.Lookup(realUser)
 }
+
+// UserWorkers returns a worker acting on behalf of each of the named users. If no users are
+// named, only the specified worker is returned.
+func UserWorkers(w Worker, usernames []string) ([]Worker, error) {
+	if len(usernames) == 0 {
+		return []Worker{w}, nil
+	}
+
+	workers := []Worker{}
+	for _, username := range usernames {
+		worker, err := w.ForUser(username)
+		if err != nil {
+			return nil, err
+		}
+		workers = append(workers, worker)
+	}
+
+	return workers, nil
+}
@@ -4,6 +4,8 @@ import (
 	"github.com/jnsgruk/concierge/cmd"
 )
 
+//go:generate sh -c "go run . validate --schema > concierge.schema.json"
+
 func main() {
 	cmd.Execute()
 }